@@ -0,0 +1,63 @@
+package crypto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrKeySize 密钥长度不是 16/24/32 字节
+	ErrKeySize = errors.New("invalid AES key size")
+	// ErrPadding PKCS#7 填充无效
+	ErrPadding = errors.New("invalid PKCS#7 padding")
+	// ErrCiphertext 密文长度无效
+	ErrCiphertext = errors.New("invalid ciphertext length")
+	// ErrNonceSize nonce 或 IV 长度无效
+	ErrNonceSize = errors.New("invalid nonce size")
+	// ErrAuthentication 密文或附加数据被篡改, 或者密钥错误
+	ErrAuthentication = errors.New("message authentication failed")
+)
+
+// newCipher 检查密钥长度, 只接受 AES-128/192/256 的密钥
+func newCipher(key []byte) (cipher.Block, error) {
+	switch len(key) {
+	case 16, 24, 32:
+		return aes.NewCipher(key)
+	default:
+		return nil, fmt.Errorf("%w: %d bytes", ErrKeySize, len(key))
+	}
+}
+
+// PKCS7Pad 按 blockSize 进行 PKCS#7 填充, 总会追加 1 到 blockSize 个字节
+func PKCS7Pad(data []byte, blockSize int) []byte {
+	pad := blockSize - len(data)%blockSize
+	padded := make([]byte, len(data)+pad)
+	copy(padded, data)
+	for i := len(data); i < len(padded); i++ {
+		padded[i] = byte(pad)
+	}
+	return padded
+}
+
+// PKCS7Unpad 严格校验并去除 PKCS#7 填充, 长度必须是 blockSize 的整数倍且每个填充字节都一致
+func PKCS7Unpad(data []byte, blockSize int) ([]byte, error) {
+	if len(data) == 0 || len(data)%blockSize != 0 {
+		return nil, ErrPadding
+	}
+	pad := int(data[len(data)-1])
+	if pad == 0 || pad > blockSize {
+		return nil, ErrPadding
+	}
+	// 不因第一个错误字节提前返回, 避免泄露填充的位置
+	good := 1
+	for _, b := range data[len(data)-pad:] {
+		good &= subtle.ConstantTimeByteEq(b, byte(pad))
+	}
+	if good != 1 {
+		return nil, ErrPadding
+	}
+	return data[:len(data)-pad], nil
+}
@@ -0,0 +1,184 @@
+package crypto
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func unhex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+func TestGCM(t *testing.T) {
+	t.Run("NIST 测试向量", func(t *testing.T) {
+		key := unhex("feffe9928665731c6d6a8f9467308308")
+		nonce := unhex("cafebabefacedbaddecaf888")
+		plaintext := unhex("d9313225f88406e5a55909c5aff5269a86a7a9531534f7da2e4c303d8a318a721c3c0c95956809532fcf0e2449a6b525b16aedf5aa0de657ba637b391aafd255")
+		sealed, err := SealGCM(key, nonce, plaintext, nil)
+		require.NoError(t, err)
+		assert.Equal(t, "42831ec2217774244b7221b784d0d49ce3aa212f2c02a4e035c17e2329aca12e21d514b25466931c7d8f6a5aac84aa051ba30b396a0aac973d58e091473f5985"+
+			"4d5c2af327cd64a62cf35abd2ba6fab4", hex.EncodeToString(sealed))
+		opened, err := OpenGCM(key, nonce, sealed, nil)
+		require.NoError(t, err)
+		assert.Equal(t, plaintext, opened)
+	})
+
+	for _, size := range []int{16, 24, 32} {
+		key := bytes.Repeat([]byte{byte(size)}, size)
+		data, err := EncryptGCM(key, []byte("cookie"), []byte("Default/Cookies"))
+		require.NoError(t, err)
+		plaintext, err := DecryptGCM(key, data, []byte("Default/Cookies"))
+		require.NoError(t, err)
+		assert.Equal(t, "cookie", string(plaintext))
+
+		_, err = DecryptGCM(key, data, []byte("Profile 1/Cookies"))
+		assert.ErrorIs(t, err, ErrAuthentication, "附加数据不同")
+		data[len(data)-1] ^= 1
+		_, err = DecryptGCM(key, data, []byte("Default/Cookies"))
+		assert.ErrorIs(t, err, ErrAuthentication, "密文被篡改")
+	}
+
+	_, err := EncryptGCM(make([]byte, 20), nil, nil)
+	assert.ErrorIs(t, err, ErrKeySize)
+	_, err = SealGCM(make([]byte, 16), make([]byte, 8), nil, nil)
+	assert.ErrorIs(t, err, ErrNonceSize)
+	_, err = DecryptGCM(make([]byte, 16), make([]byte, 20), nil)
+	assert.ErrorIs(t, err, ErrCiphertext)
+}
+
+func TestCBCHMAC(t *testing.T) {
+	t.Run("RFC 7518 B.1 测试向量", func(t *testing.T) {
+		key := unhex("000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f")
+		iv := unhex("1af38c2dc2b96ffdd86694092341bc04")
+		plaintext := []byte("A cipher system must not be required to be secret, and it must be able to fall into the hands of the enemy without inconvenience")
+		aad := []byte("The second principle of Auguste Kerckhoffs")
+		sealed, err := SealCBCHMAC(key, iv, plaintext, aad)
+		require.NoError(t, err)
+		assert.Equal(t, "c80edfa32ddf39d5ef00c0b468834279a2e46a1b8049f792f76bfe54b903a9c9a94ac9b47ad2655c5f10f9aef71427e2fc6f9b3f399a221489f16362c703233609d45ac69864e3321cf82935ac4096c86e133314c54019e8ca7980dfa4b9cf1b384c486f3a54c51078158ee5d79de59fbd34d848b3d69550a67646344427ade54b8851ffb598f7f80074b9473c82e2db"+
+			"652c3fa36b0a7c5b3219fab3a30bc1c4", hex.EncodeToString(sealed))
+		opened, err := OpenCBCHMAC(key, iv, sealed, aad)
+		require.NoError(t, err)
+		assert.Equal(t, plaintext, opened)
+	})
+
+	for _, size := range []int{32, 48, 64} {
+		key := bytes.Repeat([]byte{byte(size)}, size)
+		data, err := EncryptCBCHMAC(key, []byte("password"), nil)
+		require.NoError(t, err)
+		assert.Len(t, data, 16+16+size/2)
+		plaintext, err := DecryptCBCHMAC(key, data, nil)
+		require.NoError(t, err)
+		assert.Equal(t, "password", string(plaintext))
+
+		data[20] ^= 1
+		_, err = DecryptCBCHMAC(key, data, nil)
+		assert.ErrorIs(t, err, ErrAuthentication)
+	}
+	_, err := EncryptCBCHMAC(make([]byte, 16), nil, nil)
+	assert.ErrorIs(t, err, ErrKeySize)
+	_, err = DecryptCBCHMAC(make([]byte, 32), make([]byte, 40), nil)
+	assert.ErrorIs(t, err, ErrCiphertext)
+}
+
+func TestCBC(t *testing.T) {
+	key := []byte("0123456789abcdef")
+	iv := []byte("fedcba9876543210")
+	for _, n := range []int{0, 1, 15, 16, 17, 32} {
+		plaintext := bytes.Repeat([]byte{'a'}, n)
+		ciphertext, err := EncryptCBC(key, iv, plaintext)
+		require.NoError(t, err)
+		assert.Len(t, ciphertext, (n/16+1)*16)
+		decrypted, err := DecryptCBC(key, iv, ciphertext)
+		require.NoError(t, err)
+		assert.Equal(t, plaintext, decrypted)
+	}
+
+	_, err := DecryptCBC(key, iv, make([]byte, 15))
+	assert.ErrorIs(t, err, ErrCiphertext)
+	_, err = DecryptCBC(key, iv[:8], make([]byte, 16))
+	assert.ErrorIs(t, err, ErrNonceSize)
+	_, err = DecryptCBC([]byte("another key 1234"), iv, must(EncryptCBC(key, iv, []byte("secret"))))
+	assert.ErrorIs(t, err, ErrPadding, "错误的密钥几乎总是产生无效填充")
+}
+
+func TestPKCS7(t *testing.T) {
+	assert.Equal(t, []byte{1, 2, 3, 5, 5, 5, 5, 5}, PKCS7Pad([]byte{1, 2, 3}, 8))
+	assert.Equal(t, bytes.Repeat([]byte{8}, 8), PKCS7Pad(nil, 8))
+
+	data, err := PKCS7Unpad([]byte{1, 2, 3, 5, 5, 5, 5, 5}, 8)
+	require.NoError(t, err)
+	assert.Equal(t, []byte{1, 2, 3}, data)
+
+	for _, invalid := range [][]byte{
+		nil,
+		{1, 2, 3},
+		{1, 2, 3, 4, 5, 6, 7, 0},
+		{1, 2, 3, 4, 5, 6, 7, 9},
+		{1, 2, 3, 4, 5, 3, 4, 3},
+	} {
+		_, err := PKCS7Unpad(invalid, 8)
+		assert.ErrorIs(t, err, ErrPadding, "%v", invalid)
+	}
+}
+
+func TestCTR(t *testing.T) {
+	key := bytes.Repeat([]byte{7}, 32)
+	data, err := EncryptCTR(key, []byte("stream"))
+	require.NoError(t, err)
+	assert.Len(t, data, 16+6)
+	plaintext, err := DecryptCTR(key, data)
+	require.NoError(t, err)
+	assert.Equal(t, "stream", string(plaintext))
+
+	iv := make([]byte, 16)
+	ciphertext, err := XORCTR(key, iv, []byte("stream"))
+	require.NoError(t, err)
+	again, err := XORCTR(key, iv, ciphertext)
+	require.NoError(t, err)
+	assert.Equal(t, "stream", string(again))
+
+	_, err = DecryptCTR(key, make([]byte, 8))
+	assert.ErrorIs(t, err, ErrCiphertext)
+	_, err = XORCTR(key[:5], iv, nil)
+	assert.ErrorIs(t, err, ErrKeySize)
+}
+
+func TestECB(t *testing.T) {
+	t.Run("旧接口", func(t *testing.T) {
+		key := []byte("a key longer than sixteen bytes")
+		encrypted := AesEncryptECB([]byte("legacy"), key)
+		assert.Len(t, encrypted, 16)
+		assert.Equal(t, "legacy", string(AesDecryptECB(encrypted, key)))
+
+		assert.NotPanics(t, func() {
+			assert.Nil(t, AesDecryptECB(encrypted[:10], key))
+			assert.Nil(t, AesDecryptECB(bytes.Repeat([]byte{0xFF}, 16), []byte("wrong")))
+			assert.Nil(t, AesDecryptECB(nil, key))
+		})
+	})
+
+	key := bytes.Repeat([]byte{1}, 24)
+	ciphertext, err := EncryptECB(key, bytes.Repeat([]byte("block of 16 byte"), 2))
+	require.NoError(t, err)
+	assert.Equal(t, ciphertext[:16], ciphertext[16:32], "ECB 对相同的明文块生成相同的密文块")
+	plaintext, err := DecryptECB(key, ciphertext)
+	require.NoError(t, err)
+	assert.Equal(t, "block of 16 byteblock of 16 byte", string(plaintext))
+	_, err = EncryptECB(make([]byte, 17), nil)
+	assert.ErrorIs(t, err, ErrKeySize)
+}
+
+func must(b []byte, err error) []byte {
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
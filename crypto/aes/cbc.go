@@ -0,0 +1,128 @@
+package crypto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"fmt"
+	"hash"
+)
+
+// EncryptCBC 使用 AES-CBC 和指定的 16 字节 IV 加密, 使用 PKCS#7 填充.
+// CBC 不能发现密文被篡改, 只用于兼容已有格式, 新数据请使用 GCM 或 CBC+HMAC
+func EncryptCBC(key, iv, plaintext []byte) ([]byte, error) {
+	block, err := newCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(iv) != aes.BlockSize {
+		return nil, fmt.Errorf("%w: CBC needs %d bytes, got %d", ErrNonceSize, aes.BlockSize, len(iv))
+	}
+	ciphertext := PKCS7Pad(plaintext, aes.BlockSize)
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(ciphertext, ciphertext)
+	return ciphertext, nil
+}
+
+// DecryptCBC 解密 EncryptCBC 的输出并严格校验填充
+func DecryptCBC(key, iv, ciphertext []byte) ([]byte, error) {
+	block, err := newCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(iv) != aes.BlockSize {
+		return nil, fmt.Errorf("%w: CBC needs %d bytes, got %d", ErrNonceSize, aes.BlockSize, len(iv))
+	}
+	if len(ciphertext) == 0 || len(ciphertext)%aes.BlockSize != 0 {
+		return nil, ErrCiphertext
+	}
+	plaintext := make([]byte, len(ciphertext))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plaintext, ciphertext)
+	return PKCS7Unpad(plaintext, aes.BlockSize)
+}
+
+// cbcHMAC 按 RFC 7518 5.2 拆分组合密钥: 前半部分是 HMAC 密钥, 后半部分是 AES 密钥,
+// 32/48/64 字节分别对应 AES-128+HMAC-SHA256, AES-192+HMAC-SHA384, AES-256+HMAC-SHA512
+func cbcHMAC(key []byte) (macKey, encKey []byte, newHash func() hash.Hash, tagSize int, err error) {
+	switch len(key) {
+	case 32:
+		newHash = sha256.New
+	case 48:
+		newHash = sha512.New384
+	case 64:
+		newHash = sha512.New
+	default:
+		return nil, nil, nil, 0, fmt.Errorf("%w: CBC+HMAC needs 32, 48 or 64 bytes, got %d", ErrKeySize, len(key))
+	}
+	half := len(key) / 2
+	return key[:half], key[half:], newHash, half, nil
+}
+
+// cbcTag 计算 HMAC(A || IV || E || AL) 并截断为 tagSize, AL 是附加数据的位长度
+func cbcTag(macKey []byte, newHash func() hash.Hash, tagSize int, iv, ciphertext, additionalData []byte) []byte {
+	mac := hmac.New(newHash, macKey)
+	mac.Write(additionalData)
+	mac.Write(iv)
+	mac.Write(ciphertext)
+	var al [8]byte
+	binary.BigEndian.PutUint64(al[:], uint64(len(additionalData))*8)
+	mac.Write(al[:])
+	return mac.Sum(nil)[:tagSize]
+}
+
+// SealCBCHMAC 按 RFC 7518 的 AES_CBC_HMAC_SHA2 先加密后认证, 返回密文 || 认证标签.
+// key 是 32/48/64 字节的组合密钥, iv 是 16 字节
+func SealCBCHMAC(key, iv, plaintext, additionalData []byte) ([]byte, error) {
+	macKey, encKey, newHash, tagSize, err := cbcHMAC(key)
+	if err != nil {
+		return nil, err
+	}
+	ciphertext, err := EncryptCBC(encKey, iv, plaintext)
+	if err != nil {
+		return nil, err
+	}
+	return append(ciphertext, cbcTag(macKey, newHash, tagSize, iv, ciphertext, additionalData)...), nil
+}
+
+// OpenCBCHMAC 先校验认证标签再解密 SealCBCHMAC 的输出
+func OpenCBCHMAC(key, iv, sealed, additionalData []byte) ([]byte, error) {
+	macKey, encKey, newHash, tagSize, err := cbcHMAC(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(iv) != aes.BlockSize {
+		return nil, fmt.Errorf("%w: CBC needs %d bytes, got %d", ErrNonceSize, aes.BlockSize, len(iv))
+	}
+	if len(sealed) < tagSize+aes.BlockSize {
+		return nil, ErrCiphertext
+	}
+	ciphertext, tag := sealed[:len(sealed)-tagSize], sealed[len(sealed)-tagSize:]
+	if !hmac.Equal(tag, cbcTag(macKey, newHash, tagSize, iv, ciphertext, additionalData)) {
+		return nil, ErrAuthentication
+	}
+	return DecryptCBC(encKey, iv, ciphertext)
+}
+
+// EncryptCBCHMAC 使用随机 IV 调用 SealCBCHMAC, 返回 IV || 密文 || 认证标签
+func EncryptCBCHMAC(key, plaintext, additionalData []byte) ([]byte, error) {
+	iv := make([]byte, aes.BlockSize)
+	if _, err := rand.Read(iv); err != nil {
+		return nil, err
+	}
+	sealed, err := SealCBCHMAC(key, iv, plaintext, additionalData)
+	if err != nil {
+		return nil, err
+	}
+	return append(iv, sealed...), nil
+}
+
+// DecryptCBCHMAC 解密 EncryptCBCHMAC 的输出
+func DecryptCBCHMAC(key, data, additionalData []byte) ([]byte, error) {
+	if len(data) < aes.BlockSize {
+		return nil, ErrCiphertext
+	}
+	return OpenCBCHMAC(key, data[:aes.BlockSize], data[aes.BlockSize:], additionalData)
+}
@@ -0,0 +1,44 @@
+package crypto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"fmt"
+)
+
+// XORCTR 使用 AES-CTR 和指定的 16 字节初始计数器处理数据, 加密和解密是同一个操作.
+// CTR 不能发现密文被篡改, 需要认证时请使用 GCM
+func XORCTR(key, iv, data []byte) ([]byte, error) {
+	block, err := newCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(iv) != aes.BlockSize {
+		return nil, fmt.Errorf("%w: CTR needs %d bytes, got %d", ErrNonceSize, aes.BlockSize, len(iv))
+	}
+	out := make([]byte, len(data))
+	cipher.NewCTR(block, iv).XORKeyStream(out, data)
+	return out, nil
+}
+
+// EncryptCTR 使用 AES-CTR 和随机 IV 加密, 返回 IV || 密文
+func EncryptCTR(key, plaintext []byte) ([]byte, error) {
+	iv := make([]byte, aes.BlockSize)
+	if _, err := rand.Read(iv); err != nil {
+		return nil, err
+	}
+	ciphertext, err := XORCTR(key, iv, plaintext)
+	if err != nil {
+		return nil, err
+	}
+	return append(iv, ciphertext...), nil
+}
+
+// DecryptCTR 解密 EncryptCTR 的输出
+func DecryptCTR(key, data []byte) ([]byte, error) {
+	if len(data) < aes.BlockSize {
+		return nil, ErrCiphertext
+	}
+	return XORCTR(key, data[:aes.BlockSize], data[aes.BlockSize:])
+}
@@ -2,40 +2,50 @@ package crypto
 
 import "crypto/aes"
 
-func AesEncryptECB(origData []byte, key []byte) (encrypted []byte) {
-	cipher, _ := aes.NewCipher(generateKey(key))
-	length := (len(origData) + aes.BlockSize) / aes.BlockSize
-	plain := make([]byte, length*aes.BlockSize)
-	copy(plain, origData)
-	pad := byte(len(plain) - len(origData))
-	for i := len(origData); i < len(plain); i++ {
-		plain[i] = pad
+// EncryptECB 使用 AES-ECB 加密, 使用 PKCS#7 填充.
+// ECB 对相同的明文块生成相同的密文块且不能发现篡改, 只用于兼容已有格式
+func EncryptECB(key, plaintext []byte) ([]byte, error) {
+	block, err := newCipher(key)
+	if err != nil {
+		return nil, err
 	}
-	encrypted = make([]byte, len(plain))
-	// 分组分块加密
-	for bs, be := 0, cipher.BlockSize(); bs <= len(origData); bs, be = bs+cipher.BlockSize(), be+cipher.BlockSize() {
-		cipher.Encrypt(encrypted[bs:be], plain[bs:be])
+	ciphertext := PKCS7Pad(plaintext, aes.BlockSize)
+	for bs := 0; bs < len(ciphertext); bs += aes.BlockSize {
+		block.Encrypt(ciphertext[bs:bs+aes.BlockSize], ciphertext[bs:bs+aes.BlockSize])
 	}
-
-	return encrypted
+	return ciphertext, nil
 }
 
-func AesDecryptECB(encrypted []byte, key []byte) (decrypted []byte) {
-	cipher, _ := aes.NewCipher(generateKey(key))
-	decrypted = make([]byte, len(encrypted))
-	//
-	for bs, be := 0, cipher.BlockSize(); bs < len(encrypted); bs, be = bs+cipher.BlockSize(), be+cipher.BlockSize() {
-		cipher.Decrypt(decrypted[bs:be], encrypted[bs:be])
+// DecryptECB 解密 EncryptECB 的输出并严格校验填充
+func DecryptECB(key, ciphertext []byte) ([]byte, error) {
+	block, err := newCipher(key)
+	if err != nil {
+		return nil, err
 	}
-
-	trim := 0
-	if len(decrypted) > 0 {
-		trim = len(decrypted) - int(decrypted[len(decrypted)-1])
+	if len(ciphertext) == 0 || len(ciphertext)%aes.BlockSize != 0 {
+		return nil, ErrCiphertext
+	}
+	plaintext := make([]byte, len(ciphertext))
+	for bs := 0; bs < len(ciphertext); bs += aes.BlockSize {
+		block.Decrypt(plaintext[bs:bs+aes.BlockSize], ciphertext[bs:bs+aes.BlockSize])
 	}
+	return PKCS7Unpad(plaintext, aes.BlockSize)
+}
+
+// AesEncryptECB 是旧的 ECB 接口, 任意长度的密钥会被 generateKey 折叠为 AES-128 密钥.
+// 保留它只为了解密旧数据, 新代码请使用 EncryptGCM
+func AesEncryptECB(origData []byte, key []byte) (encrypted []byte) {
+	encrypted, _ = EncryptECB(generateKey(key), origData)
+	return encrypted
+}
 
-	return decrypted[:trim]
+// AesDecryptECB 是 AesEncryptECB 对应的旧接口, 密文长度或填充无效时返回 nil 而不是 panic
+func AesDecryptECB(encrypted []byte, key []byte) (decrypted []byte) {
+	decrypted, _ = DecryptECB(generateKey(key), encrypted)
+	return decrypted
 }
 
+// generateKey 把密钥补零或按 16 字节循环异或折叠为 AES-128 密钥, 这不是安全的密钥派生
 func generateKey(key []byte) (genKey []byte) {
 	genKey = make([]byte, 16)
 	copy(genKey, key)
@@ -0,0 +1,71 @@
+package crypto
+
+import (
+	"crypto/cipher"
+	"crypto/rand"
+	"fmt"
+)
+
+// GCMNonceSize 是 GCM 的标准 nonce 长度
+const GCMNonceSize = 12
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := newCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// SealGCM 使用 AES-GCM 和指定的 12 字节 nonce 加密, 返回密文和 16 字节认证标签.
+// 同一密钥下 nonce 绝不能重复使用
+func SealGCM(key, nonce, plaintext, additionalData []byte) ([]byte, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(nonce) != aead.NonceSize() {
+		return nil, fmt.Errorf("%w: GCM needs %d bytes, got %d", ErrNonceSize, aead.NonceSize(), len(nonce))
+	}
+	return aead.Seal(nil, nonce, plaintext, additionalData), nil
+}
+
+// OpenGCM 校验并解密 SealGCM 的输出
+func OpenGCM(key, nonce, ciphertext, additionalData []byte) ([]byte, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(nonce) != aead.NonceSize() {
+		return nil, fmt.Errorf("%w: GCM needs %d bytes, got %d", ErrNonceSize, aead.NonceSize(), len(nonce))
+	}
+	if len(ciphertext) < aead.Overhead() {
+		return nil, ErrCiphertext
+	}
+	plaintext, err := aead.Open(nil, nonce, ciphertext, additionalData)
+	if err != nil {
+		return nil, ErrAuthentication
+	}
+	return plaintext, nil
+}
+
+// EncryptGCM 使用 AES-GCM 和随机 nonce 加密, 返回 nonce || 密文 || 认证标签
+func EncryptGCM(key, plaintext, additionalData []byte) ([]byte, error) {
+	nonce := make([]byte, GCMNonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	sealed, err := SealGCM(key, nonce, plaintext, additionalData)
+	if err != nil {
+		return nil, err
+	}
+	return append(nonce, sealed...), nil
+}
+
+// DecryptGCM 解密 EncryptGCM 的输出
+func DecryptGCM(key, data, additionalData []byte) ([]byte, error) {
+	if len(data) < GCMNonceSize {
+		return nil, ErrCiphertext
+	}
+	return OpenGCM(key, data[:GCMNonceSize], data[GCMNonceSize:], additionalData)
+}
@@ -0,0 +1,322 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"time"
+
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// ErrCertificate 无法解析证书或证书请求
+var ErrCertificate = errors.New("invalid certificate")
+
+const (
+	// defaultCAValidity 是 CA 证书默认的有效期
+	defaultCAValidity = 10 * 365 * 24 * time.Hour
+	// defaultLeafValidity 是叶子证书默认的有效期, 不超过浏览器接受的 398 天
+	defaultLeafValidity = 397 * 24 * time.Hour
+	// clockSkew 是默认生效时间提前的时间, 容忍机器之间的时钟误差
+	clockSkew = 5 * time.Minute
+)
+
+// CertificateOptions 是证书的主题和扩展
+type CertificateOptions struct {
+	Subject pkix.Name
+	// Hosts 是主题备用名称(SAN), IP 地址放入 IPAddresses, 其他放入 DNSNames.
+	// Subject.CommonName 为空时使用第一个
+	Hosts          []string
+	EmailAddresses []string
+	// NotBefore 默认为当前时间前 5 分钟
+	NotBefore time.Time
+	// Validity 是有效期, CA 默认 10 年, 叶子证书默认 397 天
+	Validity time.Duration
+	// IsCA 签发中间 CA 证书. CA 证书的 MaxPathLen 为 0 时不能再签发下级 CA, 为 -1 时不限制
+	IsCA       bool
+	MaxPathLen int
+	// ExtKeyUsage 是叶子证书的扩展用途, 默认为 ServerAuth 和 ClientAuth
+	ExtKeyUsage []x509.ExtKeyUsage
+}
+
+// template 返回 opts 对应的证书模板, 序列号是 128 位随机数
+func (o *CertificateOptions) template(defaultValidity time.Duration) (*x509.Certificate, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+	template := &x509.Certificate{
+		SerialNumber:   serial,
+		Subject:        o.Subject,
+		EmailAddresses: o.EmailAddresses,
+		NotBefore:      o.NotBefore,
+	}
+	for _, host := range o.Hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+	if template.Subject.CommonName == "" && len(o.Hosts) > 0 {
+		template.Subject.CommonName = o.Hosts[0]
+	}
+	if template.NotBefore.IsZero() {
+		template.NotBefore = time.Now().Add(-clockSkew)
+	}
+	validity := o.Validity
+	if validity == 0 {
+		validity = defaultValidity
+	}
+	template.NotAfter = template.NotBefore.Add(validity)
+	return template, nil
+}
+
+// setCA 把模板设置为 CA 证书
+func setCA(template *x509.Certificate, maxPathLen int) {
+	template.IsCA = true
+	template.BasicConstraintsValid = true
+	template.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature
+	template.MaxPathLen = maxPathLen
+	template.MaxPathLenZero = maxPathLen == 0
+}
+
+// setLeaf 把模板设置为叶子证书, RSA 密钥还可以用于密钥交换
+func setLeaf(template *x509.Certificate, publicKey crypto.PublicKey, extKeyUsage []x509.ExtKeyUsage) {
+	template.BasicConstraintsValid = true
+	template.KeyUsage = x509.KeyUsageDigitalSignature
+	if KeyTypeOf(publicKey) == KeyRSA {
+		template.KeyUsage |= x509.KeyUsageKeyEncipherment
+	}
+	template.ExtKeyUsage = extKeyUsage
+	if len(template.ExtKeyUsage) == 0 {
+		template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth}
+	}
+}
+
+func createCertificate(template, parent *x509.Certificate, publicKey crypto.PublicKey, signer crypto.Signer) (*x509.Certificate, error) {
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, publicKey, signer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create certificate, %v", err)
+	}
+	return x509.ParseCertificate(der)
+}
+
+// CreateRootCA 用 signer 创建自签名的根 CA 证书, opts.IsCA 被忽略. 需要中间 CA 时 MaxPathLen 应为 -1 或大于 0
+func CreateRootCA(signer crypto.Signer, opts *CertificateOptions) (*x509.Certificate, error) {
+	if opts == nil {
+		opts = &CertificateOptions{}
+	}
+	template, err := opts.template(defaultCAValidity)
+	if err != nil {
+		return nil, err
+	}
+	setCA(template, opts.MaxPathLen)
+	return createCertificate(template, template, signer.Public(), signer)
+}
+
+// CreateSelfSigned 用 signer 创建自签名的叶子证书, 适合不需要 CA 的本地 HTTPS 服务
+func CreateSelfSigned(signer crypto.Signer, opts *CertificateOptions) (*x509.Certificate, error) {
+	if opts == nil {
+		opts = &CertificateOptions{}
+	}
+	template, err := opts.template(defaultLeafValidity)
+	if err != nil {
+		return nil, err
+	}
+	setLeaf(template, signer.Public(), opts.ExtKeyUsage)
+	return createCertificate(template, template, signer.Public(), signer)
+}
+
+// IssueCertificate 用 CA 证书和私钥为 publicKey 签发证书, opts.IsCA 时签发中间 CA
+func IssueCertificate(ca *x509.Certificate, caKey crypto.Signer, publicKey crypto.PublicKey, opts *CertificateOptions) (*x509.Certificate, error) {
+	if !ca.IsCA {
+		return nil, fmt.Errorf("%w: %s is not a CA", ErrCertificate, ca.Subject)
+	}
+	if opts == nil {
+		opts = &CertificateOptions{}
+	}
+	validity := defaultLeafValidity
+	if opts.IsCA {
+		validity = defaultCAValidity
+	}
+	template, err := opts.template(validity)
+	if err != nil {
+		return nil, err
+	}
+	if opts.IsCA {
+		setCA(template, opts.MaxPathLen)
+	} else {
+		setLeaf(template, publicKey, opts.ExtKeyUsage)
+	}
+	// the certificate can't outlive its issuer
+	if template.NotAfter.After(ca.NotAfter) {
+		template.NotAfter = ca.NotAfter
+	}
+	return createCertificate(template, ca, publicKey, caKey)
+}
+
+// CreateCSR 用 signer 创建证书签名请求, 只使用 opts 中的 Subject, Hosts 和 EmailAddresses
+func CreateCSR(signer crypto.Signer, opts *CertificateOptions) (*x509.CertificateRequest, error) {
+	if opts == nil {
+		opts = &CertificateOptions{}
+	}
+	template, err := opts.template(defaultLeafValidity)
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:        template.Subject,
+		DNSNames:       template.DNSNames,
+		IPAddresses:    template.IPAddresses,
+		EmailAddresses: template.EmailAddresses,
+	}, signer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create certificate request, %v", err)
+	}
+	return x509.ParseCertificateRequest(der)
+}
+
+// ParseCSR 解析 PEM 或 DER 编码的证书签名请求, 并校验请求的签名
+func ParseCSR(data []byte) (*x509.CertificateRequest, error) {
+	if block, _ := pem.Decode(data); block != nil {
+		if block.Type != "CERTIFICATE REQUEST" && block.Type != "NEW CERTIFICATE REQUEST" {
+			return nil, fmt.Errorf("%w: unexpected PEM type %q", ErrCertificate, block.Type)
+		}
+		data = block.Bytes
+	}
+	csr, err := x509.ParseCertificateRequest(data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCertificate, err)
+	}
+	if err = csr.CheckSignature(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrSignature, err)
+	}
+	return csr, nil
+}
+
+// SignCSR 用 CA 签发 csr 请求的证书. 主题和 SAN 来自请求, opts.Subject 和 opts.Hosts 不为空时代替请求中的值,
+// 有效期和用途来自 opts
+func SignCSR(ca *x509.Certificate, caKey crypto.Signer, csr *x509.CertificateRequest, opts *CertificateOptions) (*x509.Certificate, error) {
+	if err := csr.CheckSignature(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrSignature, err)
+	}
+	requested := CertificateOptions{}
+	if opts != nil {
+		requested = *opts
+	}
+	if requested.Subject.String() == "" {
+		requested.Subject = csr.Subject
+	}
+	if len(requested.Hosts) == 0 {
+		requested.Hosts = append(requested.Hosts, csr.DNSNames...)
+		for _, ip := range csr.IPAddresses {
+			requested.Hosts = append(requested.Hosts, ip.String())
+		}
+	}
+	if len(requested.EmailAddresses) == 0 {
+		requested.EmailAddresses = csr.EmailAddresses
+	}
+	return IssueCertificate(ca, caKey, csr.PublicKey, &requested)
+}
+
+// VerifyChain 用 roots 校验 cert 的证书链, intermediates 是中间 CA 证书. dnsName 不为空时还校验证书是否适用于该主机名.
+// 返回所有有效的证书链, 从 cert 开始到根证书结束
+func VerifyChain(cert *x509.Certificate, intermediates, roots []*x509.Certificate, dnsName string) ([][]*x509.Certificate, error) {
+	opts := x509.VerifyOptions{
+		DNSName:       dnsName,
+		Roots:         x509.NewCertPool(),
+		Intermediates: x509.NewCertPool(),
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}
+	for _, root := range roots {
+		opts.Roots.AddCert(root)
+	}
+	for _, intermediate := range intermediates {
+		opts.Intermediates.AddCert(intermediate)
+	}
+	return cert.Verify(opts)
+}
+
+// ExportCertificatesToPEM 把证书编码为 PEM, 多个证书按顺序拼接, 通常为叶子证书在前的证书链
+func ExportCertificatesToPEM(certs ...*x509.Certificate) []byte {
+	buf := bytes.NewBuffer(nil)
+	for _, cert := range certs {
+		_ = pem.Encode(buf, &pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+	}
+	return buf.Bytes()
+}
+
+// ExportCSRToPEM 把证书签名请求编码为 PEM
+func ExportCSRToPEM(csr *x509.CertificateRequest) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csr.Raw})
+}
+
+// ImportCertificates 解析 PEM 编码的一个或多个证书, 也接受单个 DER 编码的证书
+func ImportCertificates(data []byte) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for rest := data; ; {
+		var block *pem.Block
+		if block, rest = pem.Decode(rest); block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrCertificate, err)
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) > 0 {
+		return certs, nil
+	}
+	cert, err := x509.ParseCertificate(data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCertificate, err)
+	}
+	return []*x509.Certificate{cert}, nil
+}
+
+// ExportPKCS12 把私钥, 证书和 CA 证书链编码为密码保护的 PKCS#12(.p12/.pfx),
+// 使用 PBES2(AES-256-CBC) 和 SHA-256 MAC, 可以被 OpenSSL 3 和较新的 Windows/macOS 导入
+func ExportPKCS12(privateKey crypto.PrivateKey, cert *x509.Certificate, caCerts []*x509.Certificate, password string) ([]byte, error) {
+	data, err := pkcs12.Modern.Encode(privateKey, cert, caCerts, password)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode PKCS#12, %v", err)
+	}
+	return data, nil
+}
+
+// ImportPKCS12 解析 PKCS#12, 返回私钥, 证书和 CA 证书链. 密码错误时返回 ErrPassphrase
+func ImportPKCS12(data []byte, password string) (crypto.PrivateKey, *x509.Certificate, []*x509.Certificate, error) {
+	privateKey, cert, caCerts, err := pkcs12.DecodeChain(data, password)
+	if errors.Is(err, pkcs12.ErrIncorrectPassword) {
+		return nil, nil, nil, ErrPassphrase
+	}
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to decode PKCS#12, %v", err)
+	}
+	return normalizeKey(privateKey), cert, caCerts, nil
+}
+
+// TLSCertificate 返回可以用于 tls.Config 的证书, chain 是叶子证书在前的证书链
+func TLSCertificate(privateKey crypto.PrivateKey, chain ...*x509.Certificate) tls.Certificate {
+	certificate := tls.Certificate{PrivateKey: privateKey}
+	for _, cert := range chain {
+		certificate.Certificate = append(certificate.Certificate, cert.Raw)
+	}
+	if len(chain) > 0 {
+		certificate.Leaf = chain[0]
+	}
+	return certificate
+}
@@ -0,0 +1,195 @@
+package crypto
+
+import (
+	"crypto"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func generateSigner(t *testing.T, keyType KeyType) crypto.Signer {
+	privateKey, err := GenerateKey(keyType)
+	require.NoError(t, err)
+	return privateKey.(crypto.Signer)
+}
+
+func TestCertificateAuthority(t *testing.T) {
+	rootKey := generateSigner(t, KeyECDSAP384)
+	root, err := CreateRootCA(rootKey, &CertificateOptions{
+		Subject:    pkix.Name{CommonName: "poketto root", Organization: []string{"poketto"}},
+		MaxPathLen: 1,
+	})
+	require.NoError(t, err)
+	assert.True(t, root.IsCA)
+	assert.Equal(t, 1, root.MaxPathLen)
+
+	intermediateKey := generateSigner(t, KeyRSA)
+	intermediate, err := IssueCertificate(root, rootKey, intermediateKey.Public(), &CertificateOptions{
+		Subject: pkix.Name{CommonName: "poketto intermediate"},
+		IsCA:    true,
+	})
+	require.NoError(t, err)
+	assert.True(t, intermediate.MaxPathLenZero)
+
+	leafKey := generateSigner(t, KeyEd25519)
+	leaf, err := IssueCertificate(intermediate, intermediateKey, leafKey.Public(), &CertificateOptions{
+		Hosts:    []string{"localhost", "127.0.0.1", "::1"},
+		Validity: time.Hour,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "localhost", leaf.Subject.CommonName)
+	assert.Equal(t, []string{"localhost"}, leaf.DNSNames)
+	require.Len(t, leaf.IPAddresses, 2)
+	assert.True(t, leaf.IPAddresses[0].Equal(net.ParseIP("127.0.0.1")))
+	assert.Equal(t, []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth}, leaf.ExtKeyUsage)
+
+	t.Run("校验证书链", func(t *testing.T) {
+		chains, err := VerifyChain(leaf, []*x509.Certificate{intermediate}, []*x509.Certificate{root}, "localhost")
+		require.NoError(t, err)
+		require.Len(t, chains, 1)
+		assert.Equal(t, []*x509.Certificate{leaf, intermediate, root}, chains[0])
+
+		_, err = VerifyChain(leaf, []*x509.Certificate{intermediate}, []*x509.Certificate{root}, "example.com")
+		assert.Error(t, err)
+		_, err = VerifyChain(leaf, nil, []*x509.Certificate{root}, "")
+		assert.Error(t, err)
+
+		otherKey := generateSigner(t, KeyECDSAP256)
+		other, err := CreateRootCA(otherKey, &CertificateOptions{Subject: pkix.Name{CommonName: "poketto root"}})
+		require.NoError(t, err)
+		_, err = VerifyChain(leaf, []*x509.Certificate{intermediate}, []*x509.Certificate{other}, "")
+		assert.Error(t, err)
+	})
+
+	t.Run("中间 CA 不能再签发 CA", func(t *testing.T) {
+		subKey := generateSigner(t, KeyECDSAP256)
+		sub, err := IssueCertificate(intermediate, intermediateKey, subKey.Public(), &CertificateOptions{IsCA: true})
+		require.NoError(t, err)
+		subLeaf, err := IssueCertificate(sub, subKey, leafKey.Public(), &CertificateOptions{Hosts: []string{"localhost"}})
+		require.NoError(t, err)
+		_, err = VerifyChain(subLeaf, []*x509.Certificate{intermediate, sub}, []*x509.Certificate{root}, "")
+		assert.Error(t, err)
+
+		_, err = IssueCertificate(leaf, leafKey, subKey.Public(), nil)
+		assert.ErrorIs(t, err, ErrCertificate)
+	})
+
+	t.Run("有效期不超过签发者", func(t *testing.T) {
+		long, err := IssueCertificate(root, rootKey, leafKey.Public(), &CertificateOptions{Validity: 100 * 365 * 24 * time.Hour})
+		require.NoError(t, err)
+		assert.Equal(t, root.NotAfter, long.NotAfter)
+	})
+
+	t.Run("PEM", func(t *testing.T) {
+		data := ExportCertificatesToPEM(leaf, intermediate)
+		certs, err := ImportCertificates(data)
+		require.NoError(t, err)
+		require.Len(t, certs, 2)
+		assert.True(t, leaf.Equal(certs[0]))
+		assert.True(t, intermediate.Equal(certs[1]))
+
+		certs, err = ImportCertificates(root.Raw)
+		require.NoError(t, err)
+		assert.True(t, root.Equal(certs[0]))
+
+		_, err = ImportCertificates([]byte("not a certificate"))
+		assert.ErrorIs(t, err, ErrCertificate)
+	})
+
+	t.Run("PKCS#12", func(t *testing.T) {
+		data, err := ExportPKCS12(leafKey, leaf, []*x509.Certificate{intermediate, root}, "secret")
+		require.NoError(t, err)
+
+		privateKey, cert, caCerts, err := ImportPKCS12(data, "secret")
+		require.NoError(t, err)
+		assert.Equal(t, leafKey, privateKey)
+		assert.True(t, leaf.Equal(cert))
+		require.Len(t, caCerts, 2)
+		assert.True(t, intermediate.Equal(caCerts[0]))
+
+		_, _, _, err = ImportPKCS12(data, "wrong")
+		assert.ErrorIs(t, err, ErrPassphrase)
+	})
+
+	t.Run("TLS", func(t *testing.T) {
+		serverConn, clientConn := net.Pipe()
+		defer clientConn.Close()
+		server := tls.Server(serverConn, &tls.Config{
+			Certificates: []tls.Certificate{TLSCertificate(leafKey, leaf, intermediate)},
+		})
+		go func() {
+			defer server.Close()
+			_ = server.Handshake()
+		}()
+
+		roots := x509.NewCertPool()
+		roots.AddCert(root)
+		client := tls.Client(clientConn, &tls.Config{RootCAs: roots, ServerName: "localhost"})
+		require.NoError(t, client.Handshake())
+	})
+}
+
+func TestCertificateRequest(t *testing.T) {
+	caKey := generateSigner(t, KeyRSA)
+	ca, err := CreateRootCA(caKey, &CertificateOptions{Subject: pkix.Name{CommonName: "poketto CA"}})
+	require.NoError(t, err)
+
+	key := generateSigner(t, KeyECDSAP256)
+	csr, err := CreateCSR(key, &CertificateOptions{
+		Subject:        pkix.Name{CommonName: "service", Organization: []string{"poketto"}},
+		Hosts:          []string{"service.local", "10.0.0.1"},
+		EmailAddresses: []string{"ops@example.com"},
+	})
+	require.NoError(t, err)
+
+	t.Run("解析和签发", func(t *testing.T) {
+		parsed, err := ParseCSR(ExportCSRToPEM(csr))
+		require.NoError(t, err)
+		_, err = ParseCSR(csr.Raw)
+		require.NoError(t, err)
+
+		cert, err := SignCSR(ca, caKey, parsed, &CertificateOptions{ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}})
+		require.NoError(t, err)
+		assert.Equal(t, "service", cert.Subject.CommonName)
+		assert.Equal(t, []string{"poketto"}, cert.Subject.Organization)
+		assert.Equal(t, []string{"service.local"}, cert.DNSNames)
+		assert.Equal(t, []string{"ops@example.com"}, cert.EmailAddresses)
+		assert.Equal(t, []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}, cert.ExtKeyUsage)
+		assert.Equal(t, key.Public(), cert.PublicKey)
+
+		_, err = VerifyChain(cert, nil, []*x509.Certificate{ca}, "10.0.0.1")
+		require.NoError(t, err)
+	})
+
+	t.Run("覆盖主机名", func(t *testing.T) {
+		cert, err := SignCSR(ca, caKey, csr, &CertificateOptions{Hosts: []string{"other.local"}})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"other.local"}, cert.DNSNames)
+		assert.Empty(t, cert.IPAddresses)
+		assert.Equal(t, "service", cert.Subject.CommonName)
+	})
+
+	t.Run("篡改", func(t *testing.T) {
+		tampered := append([]byte(nil), csr.Raw...)
+		tampered[len(tampered)-1] ^= 1
+		_, err := ParseCSR(tampered)
+		assert.Error(t, err)
+
+		_, err = ParseCSR(ExportCertificatesToPEM(ca))
+		assert.ErrorIs(t, err, ErrCertificate)
+	})
+
+	t.Run("自签名证书", func(t *testing.T) {
+		cert, err := CreateSelfSigned(key, &CertificateOptions{Hosts: []string{"localhost"}})
+		require.NoError(t, err)
+		assert.False(t, cert.IsCA)
+		_, err = VerifyChain(cert, nil, []*x509.Certificate{cert}, "localhost")
+		require.NoError(t, err)
+	})
+}
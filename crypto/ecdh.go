@@ -0,0 +1,100 @@
+package crypto
+
+import (
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"io"
+
+	paes "github.com/w-devin/poketto/crypto/aes"
+	"golang.org/x/crypto/hkdf"
+)
+
+func ecdhPrivateKey(privateKey crypto.PrivateKey) (*ecdh.PrivateKey, error) {
+	switch key := privateKey.(type) {
+	case *ecdh.PrivateKey:
+		return key, nil
+	case *ecdsa.PrivateKey:
+		return key.ECDH()
+	default:
+		return nil, fmt.Errorf("%w: %T can't be used for key agreement", ErrKeyType, privateKey)
+	}
+}
+
+func ecdhPublicKey(publicKey crypto.PublicKey) (*ecdh.PublicKey, error) {
+	switch key := publicKey.(type) {
+	case *ecdh.PublicKey:
+		return key, nil
+	case *ecdsa.PublicKey:
+		return key.ECDH()
+	default:
+		return nil, fmt.Errorf("%w: %T can't be used for key agreement", ErrKeyType, publicKey)
+	}
+}
+
+// DeriveSharedKey 用 X25519 或 ECDH(P-256/P-384) 计算共享密钥, 再用 HKDF-SHA256 派生 size 字节的密钥.
+// 双方用各自的私钥和对方的公钥得到相同的密钥, info 区分不同的用途
+func DeriveSharedKey(privateKey crypto.PrivateKey, publicKey crypto.PublicKey, info []byte, size int) ([]byte, error) {
+	private, err := ecdhPrivateKey(privateKey)
+	if err != nil {
+		return nil, err
+	}
+	public, err := ecdhPublicKey(publicKey)
+	if err != nil {
+		return nil, err
+	}
+	return deriveSharedKey(private, public, nil, info, size)
+}
+
+func deriveSharedKey(private *ecdh.PrivateKey, public *ecdh.PublicKey, salt, info []byte, size int) ([]byte, error) {
+	shared, err := private.ECDH(public)
+	if err != nil {
+		return nil, fmt.Errorf("failed to agree on a key, %v", err)
+	}
+	key := make([]byte, size)
+	if _, err = io.ReadFull(hkdf.New(sha256.New, shared, salt, info), key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// ecdhWrapInfo 是包装文件密钥时 HKDF 的 info
+var ecdhWrapInfo = []byte("poketto envelope key")
+
+// wrapKeyECDH 为椭圆曲线接收者包装 fileKey: 生成临时密钥和接收者协商出包装密钥, 输出
+// 临时公钥 | AES-256-GCM(fileKey). 包装密钥每次都不同, 所以使用全 0 的 nonce
+func wrapKeyECDH(recipient *ecdh.PublicKey, fileKey []byte) ([]byte, error) {
+	ephemeral, err := recipient.Curve().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	ephemeralPublic := ephemeral.PublicKey().Bytes()
+	kek, err := deriveSharedKey(ephemeral, recipient, append(ephemeralPublic, recipient.Bytes()...), ecdhWrapInfo, fileKeySize)
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := paes.SealGCM(kek, make([]byte, paes.GCMNonceSize), fileKey, nil)
+	if err != nil {
+		return nil, err
+	}
+	return append(ephemeralPublic, sealed...), nil
+}
+
+func unwrapKeyECDH(privateKey *ecdh.PrivateKey, wrapped []byte) ([]byte, error) {
+	size := len(privateKey.PublicKey().Bytes())
+	if len(wrapped) < size {
+		return nil, ErrEnvelope
+	}
+	ephemeral, err := privateKey.Curve().NewPublicKey(wrapped[:size])
+	if err != nil {
+		return nil, ErrEnvelope
+	}
+	kek, err := deriveSharedKey(privateKey, ephemeral, append(wrapped[:size:size], privateKey.PublicKey().Bytes()...), ecdhWrapInfo, fileKeySize)
+	if err != nil {
+		return nil, err
+	}
+	return paes.OpenGCM(kek, make([]byte, paes.GCMNonceSize), wrapped[size:], nil)
+}
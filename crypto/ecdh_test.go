@@ -0,0 +1,89 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestECDH(t *testing.T) {
+	t.Run("协商密钥", func(t *testing.T) {
+		for _, keyType := range []KeyType{KeyX25519, KeyECDSAP256, KeyECDSAP384} {
+			alice, err := GenerateKey(keyType)
+			require.NoError(t, err)
+			bob, err := GenerateKey(keyType)
+			require.NoError(t, err)
+			alicePublic, err := PublicKeyOf(alice)
+			require.NoError(t, err)
+			bobPublic, err := PublicKeyOf(bob)
+			require.NoError(t, err)
+
+			aliceKey, err := DeriveSharedKey(alice, bobPublic, []byte("test"), 32)
+			require.NoError(t, err)
+			bobKey, err := DeriveSharedKey(bob, alicePublic, []byte("test"), 32)
+			require.NoError(t, err)
+			assert.Equal(t, aliceKey, bobKey, keyType)
+
+			other, err := DeriveSharedKey(bob, alicePublic, []byte("other"), 32)
+			require.NoError(t, err)
+			assert.NotEqual(t, aliceKey, other)
+		}
+
+		x25519, err := GenerateKey(KeyX25519)
+		require.NoError(t, err)
+		p256, err := GenerateKey(KeyECDSAP256)
+		require.NoError(t, err)
+		p256Public, err := PublicKeyOf(p256)
+		require.NoError(t, err)
+		_, err = DeriveSharedKey(x25519, p256Public, nil, 32)
+		assert.Error(t, err, "不同曲线的密钥不能协商")
+
+		ed25519Key, err := GenerateKey(KeyEd25519)
+		require.NoError(t, err)
+		_, err = DeriveSharedKey(ed25519Key, p256Public, nil, 32)
+		assert.ErrorIs(t, err, ErrKeyType)
+	})
+
+	t.Run("信封和加密流的接收者", func(t *testing.T) {
+		var privateKeys []crypto.PrivateKey
+		var publicKeys []crypto.PublicKey
+		for _, keyType := range []KeyType{KeyRSA, KeyX25519, KeyECDSAP256, KeyECDSAP384} {
+			privateKey, err := GenerateKey(keyType)
+			require.NoError(t, err)
+			publicKey, err := PublicKeyOf(privateKey)
+			require.NoError(t, err)
+			privateKeys = append(privateKeys, privateKey)
+			publicKeys = append(publicKeys, publicKey)
+		}
+
+		data := bytes.Repeat([]byte("artifact "), 10000)
+		blob, err := SealEnvelopeFor(publicKeys, data)
+		require.NoError(t, err)
+		buf := bytes.NewBuffer(nil)
+		w, err := NewEncryptingWriter(buf, publicKeys)
+		require.NoError(t, err)
+		_, err = w.Write(data)
+		require.NoError(t, err)
+		require.NoError(t, w.Close())
+
+		for _, privateKey := range privateKeys {
+			opened, err := OpenEnvelope(privateKey, blob)
+			require.NoError(t, err, KeyTypeOf(privateKey))
+			assert.Equal(t, data, opened)
+
+			decrypted, err := decryptStream(privateKey, buf.Bytes())
+			require.NoError(t, err, KeyTypeOf(privateKey))
+			assert.Equal(t, data, decrypted)
+		}
+
+		ed25519Key, err := GenerateKey(KeyEd25519)
+		require.NoError(t, err)
+		ed25519Public, err := PublicKeyOf(ed25519Key)
+		require.NoError(t, err)
+		_, err = SealEnvelope(ed25519Public, data)
+		assert.ErrorIs(t, err, ErrKeyType)
+	})
+}
@@ -0,0 +1,259 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	paes "github.com/w-devin/poketto/crypto/aes"
+)
+
+var (
+	// ErrEnvelope 信封格式无效或版本不受支持
+	ErrEnvelope = errors.New("invalid envelope")
+	// ErrNotRecipient 私钥不是信封的接收者
+	ErrNotRecipient = errors.New("key is not a recipient of the envelope")
+)
+
+// envelopeMagic 是信封的开头, 后面是 1 字节的版本号
+var envelopeMagic = []byte("PKEV")
+
+const (
+	envelopeVersion = 1
+	// fileKeySize 是 AES-256 的密钥长度
+	fileKeySize = 32
+)
+
+// envelopeOAEP 包装文件密钥, 标签把包装后的密钥绑定到信封格式上
+var envelopeOAEP = &EncryptOptions{Scheme: SchemeOAEP, Hash: crypto.SHA256, Label: []byte("poketto envelope key")}
+
+// KeyID 返回公钥的标识, 即 PKIX 编码的 SHA-256
+func KeyID(publicKey crypto.PublicKey) ([]byte, error) {
+	der, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal public key, %v", err)
+	}
+	sum := sha256.Sum256(der)
+	return sum[:], nil
+}
+
+// Fingerprint 返回公钥的指纹, 为 "SHA256:" 加 KeyID 的 base64(不带填充). 写法和 ssh-keygen -l 相同,
+// 但哈希的是 PKIX 编码而不是 SSH 编码, 所以两者的值不同
+func Fingerprint(publicKey crypto.PublicKey) (string, error) {
+	keyID, err := KeyID(publicKey)
+	if err != nil {
+		return "", err
+	}
+	return "SHA256:" + base64.RawStdEncoding.EncodeToString(keyID), nil
+}
+
+// recipient 是一个接收者的密钥标识和用它的公钥包装的文件密钥
+type recipient struct {
+	keyID   []byte
+	wrapped []byte
+}
+
+// wrapKey 为每个接收者包装 fileKey, RSA 公钥使用 RSA-OAEP(SHA-256), X25519 和 ECDSA 公钥见 wrapKeyECDH
+func wrapKey[K crypto.PublicKey](publicKeys []K, fileKey []byte) ([]recipient, error) {
+	if len(publicKeys) == 0 {
+		return nil, errors.New("no recipients")
+	}
+	if len(publicKeys) > 0xffff {
+		return nil, fmt.Errorf("too many recipients, %d", len(publicKeys))
+	}
+	recipients := make([]recipient, 0, len(publicKeys))
+	for _, publicKey := range publicKeys {
+		keyID, err := KeyID(publicKey)
+		if err != nil {
+			return nil, err
+		}
+		var wrapped []byte
+		if rsaKey, ok := crypto.PublicKey(publicKey).(*rsa.PublicKey); ok {
+			wrapped, err = EncryptWithOptions(rsaKey, fileKey, envelopeOAEP)
+		} else {
+			var ecdhKey *ecdh.PublicKey
+			if ecdhKey, err = ecdhPublicKey(publicKey); err != nil {
+				return nil, err
+			}
+			wrapped, err = wrapKeyECDH(ecdhKey, fileKey)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to wrap key, %v", err)
+		}
+		recipients = append(recipients, recipient{keyID: keyID, wrapped: wrapped})
+	}
+	return recipients, nil
+}
+
+// unwrapKey 找到 privateKey 对应的接收者并解出文件密钥
+func unwrapKey(privateKey crypto.PrivateKey, recipients []recipient) ([]byte, error) {
+	publicKey, err := PublicKeyOf(privateKey)
+	if err != nil {
+		return nil, err
+	}
+	keyID, err := KeyID(publicKey)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range recipients {
+		if !bytes.Equal(r.keyID, keyID) {
+			continue
+		}
+		var fileKey []byte
+		if rsaKey, ok := privateKey.(*rsa.PrivateKey); ok {
+			fileKey, err = DecryptWithOptions(rsaKey, r.wrapped, envelopeOAEP)
+		} else {
+			var ecdhKey *ecdh.PrivateKey
+			if ecdhKey, err = ecdhPrivateKey(privateKey); err != nil {
+				return nil, err
+			}
+			fileKey, err = unwrapKeyECDH(ecdhKey, r.wrapped)
+		}
+		if err != nil || len(fileKey) != fileKeySize {
+			return nil, fmt.Errorf("%w: failed to unwrap key", ErrEnvelope)
+		}
+		return fileKey, nil
+	}
+	return nil, ErrNotRecipient
+}
+
+// writeRecipients 写入接收者列表: 数量(uint16), 每个接收者的标识和包装后的密钥(各带 uint16 长度)
+func writeRecipients(buf *bytes.Buffer, recipients []recipient) {
+	binary.Write(buf, binary.BigEndian, uint16(len(recipients)))
+	for _, r := range recipients {
+		binary.Write(buf, binary.BigEndian, uint16(len(r.keyID)))
+		buf.Write(r.keyID)
+		binary.Write(buf, binary.BigEndian, uint16(len(r.wrapped)))
+		buf.Write(r.wrapped)
+	}
+}
+
+func readRecipients(r io.Reader) ([]recipient, error) {
+	var count uint16
+	if err := binary.Read(r, binary.BigEndian, &count); err != nil {
+		return nil, ErrEnvelope
+	}
+	if count == 0 {
+		return nil, fmt.Errorf("%w: no recipients", ErrEnvelope)
+	}
+	recipients := make([]recipient, count)
+	for i := range recipients {
+		var err error
+		if recipients[i].keyID, err = readField(r); err != nil {
+			return nil, err
+		}
+		if recipients[i].wrapped, err = readField(r); err != nil {
+			return nil, err
+		}
+	}
+	return recipients, nil
+}
+
+// readField 读取带 uint16 长度的字段
+func readField(r io.Reader) ([]byte, error) {
+	var size uint16
+	if err := binary.Read(r, binary.BigEndian, &size); err != nil {
+		return nil, ErrEnvelope
+	}
+	field := make([]byte, size)
+	if _, err := io.ReadFull(r, field); err != nil {
+		return nil, ErrEnvelope
+	}
+	return field, nil
+}
+
+// readVersion 检查魔数并返回版本号
+func readVersion(r io.Reader, magic []byte) (byte, error) {
+	header := make([]byte, len(magic)+1)
+	if _, err := io.ReadFull(r, header); err != nil || !bytes.Equal(header[:len(magic)], magic) {
+		return 0, ErrEnvelope
+	}
+	return header[len(magic)], nil
+}
+
+// SealEnvelope 为 publicKey 加密任意长度的数据, 见 SealEnvelopeFor
+func SealEnvelope(publicKey crypto.PublicKey, data []byte) ([]byte, error) {
+	return SealEnvelopeFor([]crypto.PublicKey{publicKey}, data)
+}
+
+// SealEnvelopeFor 用随机的 AES-256-GCM 密钥加密数据, 再为每个接收者包装这个密钥, 任何一个接收者的私钥都能解开.
+// 接收者可以是 RSA 公钥(RSA-OAEP), X25519 公钥和 ECDSA P-256/P-384 公钥(临时密钥 ECDH 协商出的 AES-256-GCM 密钥).
+// 格式为
+//
+//	"PKEV" | 版本(1) | 接收者数量(uint16) | {标识长度(uint16) | 标识 | 密钥长度(uint16) | 包装后的密钥}... | nonce(12) | 密文 | 认证标签(16)
+//
+// 标识是 KeyID, 整数均为大端序, nonce 之前的头部作为 GCM 的附加数据受到保护
+func SealEnvelopeFor[K crypto.PublicKey](publicKeys []K, data []byte) ([]byte, error) {
+	fileKey := make([]byte, fileKeySize)
+	if _, err := rand.Read(fileKey); err != nil {
+		return nil, err
+	}
+	recipients, err := wrapKey(publicKeys, fileKey)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := bytes.NewBuffer(nil)
+	buf.Write(envelopeMagic)
+	buf.WriteByte(envelopeVersion)
+	writeRecipients(buf, recipients)
+	header := buf.Bytes()
+
+	sealed, err := paes.EncryptGCM(fileKey, data, header)
+	if err != nil {
+		return nil, err
+	}
+	return append(header, sealed...), nil
+}
+
+// OpenEnvelope 用接收者的私钥解密 SealEnvelope 的输出
+func OpenEnvelope(privateKey crypto.PrivateKey, blob []byte) ([]byte, error) {
+	r := bytes.NewReader(blob)
+	recipients, err := readEnvelopeHeader(r)
+	if err != nil {
+		return nil, err
+	}
+	fileKey, err := unwrapKey(privateKey, recipients)
+	if err != nil {
+		return nil, err
+	}
+	header := blob[:len(blob)-r.Len()]
+	data, err := paes.DecryptGCM(fileKey, blob[len(header):], header)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open envelope, %w", err)
+	}
+	return data, nil
+}
+
+// EnvelopeKeyIDs 返回信封所有接收者的 KeyID
+func EnvelopeKeyIDs(blob []byte) ([][]byte, error) {
+	recipients, err := readEnvelopeHeader(bytes.NewReader(blob))
+	if err != nil {
+		return nil, err
+	}
+	keyIDs := make([][]byte, len(recipients))
+	for i, r := range recipients {
+		keyIDs[i] = r.keyID
+	}
+	return keyIDs, nil
+}
+
+func readEnvelopeHeader(r io.Reader) ([]recipient, error) {
+	version, err := readVersion(r, envelopeMagic)
+	if err != nil {
+		return nil, err
+	}
+	if version != envelopeVersion {
+		return nil, fmt.Errorf("%w: unsupported version %d", ErrEnvelope, version)
+	}
+	return readRecipients(r)
+}
@@ -0,0 +1,79 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	paes "github.com/w-devin/poketto/crypto/aes"
+)
+
+func TestEnvelope(t *testing.T) {
+	alice, alicePublic, err := GenerateKeyPair(2048)
+	require.NoError(t, err)
+	bob, bobPublic, err := GenerateKeyPair(2048)
+	require.NoError(t, err)
+	eve, _, err := GenerateKeyPair(2048)
+	require.NoError(t, err)
+
+	t.Run("任意长度的数据", func(t *testing.T) {
+		for _, size := range []int{0, 1, 300, 1 << 20} {
+			data := bytes.Repeat([]byte{0x5a}, size)
+			blob, err := SealEnvelope(alicePublic, data)
+			require.NoError(t, err)
+			opened, err := OpenEnvelope(alice, blob)
+			require.NoError(t, err)
+			assert.Equal(t, string(data), string(opened))
+		}
+	})
+
+	t.Run("多个接收者", func(t *testing.T) {
+		blob, err := SealEnvelopeFor([]*rsa.PublicKey{alicePublic, bobPublic}, []byte("exported database"))
+		require.NoError(t, err)
+		for _, key := range []*rsa.PrivateKey{alice, bob} {
+			opened, err := OpenEnvelope(key, blob)
+			require.NoError(t, err)
+			assert.Equal(t, []byte("exported database"), opened)
+		}
+
+		_, err = OpenEnvelope(eve, blob)
+		assert.ErrorIs(t, err, ErrNotRecipient)
+
+		keyIDs, err := EnvelopeKeyIDs(blob)
+		require.NoError(t, err)
+		aliceID, err := KeyID(alicePublic)
+		require.NoError(t, err)
+		bobID, err := KeyID(bobPublic)
+		require.NoError(t, err)
+		assert.Equal(t, [][]byte{aliceID, bobID}, keyIDs)
+	})
+
+	t.Run("篡改", func(t *testing.T) {
+		blob, err := SealEnvelope(alicePublic, []byte("secret"))
+		require.NoError(t, err)
+
+		tampered := append([]byte(nil), blob...)
+		tampered[len(tampered)-1] ^= 1
+		_, err = OpenEnvelope(alice, tampered)
+		assert.ErrorIs(t, err, paes.ErrAuthentication)
+
+		tampered = append([]byte(nil), blob...)
+		tampered[4] = 2
+		_, err = OpenEnvelope(alice, tampered)
+		assert.ErrorIs(t, err, ErrEnvelope)
+
+		_, err = OpenEnvelope(alice, blob[:20])
+		assert.ErrorIs(t, err, ErrEnvelope)
+
+		_, err = OpenEnvelope(alice, []byte("not an envelope"))
+		assert.ErrorIs(t, err, ErrEnvelope)
+	})
+
+	t.Run("没有接收者", func(t *testing.T) {
+		_, err := SealEnvelopeFor([]*rsa.PublicKey(nil), []byte("secret"))
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,214 @@
+package crypto
+
+import (
+	"bufio"
+	"crypto"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// fileSignatureVersion 是签名文件格式的版本
+const fileSignatureVersion = 1
+
+// FileSignOptions 控制文件签名
+type FileSignOptions struct {
+	// Hash 是计算文件摘要的哈希, 支持 SHA-256(默认), SHA-384 和 SHA-512
+	Hash crypto.Hash
+}
+
+func (o *FileSignOptions) hash() crypto.Hash {
+	if o == nil || o.Hash == 0 {
+		return crypto.SHA256
+	}
+	return o.Hash
+}
+
+// fileHashes 是签名文件中可以使用的哈希
+var fileHashes = map[string]crypto.Hash{
+	crypto.SHA256.String(): crypto.SHA256,
+	crypto.SHA384.String(): crypto.SHA384,
+	crypto.SHA512.String(): crypto.SHA512,
+}
+
+// FileSignature 是文件的分离签名, 以 JSON 保存. 除 Signature 以外的所有字段都被签名,
+// 所以算法, 公钥指纹和时间戳不能被替换
+type FileSignature struct {
+	Version int `json:"version"`
+	// Algorithm 是签名算法, 例如 "RSA-PKCS1v15-SHA256", "ECDSA-P256-SHA256" 和 "Ed25519"
+	Algorithm string `json:"algorithm"`
+	// KeyFingerprint 是签名公钥的指纹, 见 Fingerprint
+	KeyFingerprint string    `json:"key_fingerprint"`
+	Timestamp      time.Time `json:"timestamp"`
+	// Hash 是计算文件摘要的哈希, 例如 "SHA-256"
+	Hash string `json:"hash"`
+	// Digest 是文件内容的十六进制摘要
+	Digest    string `json:"digest"`
+	Signature []byte `json:"signature"`
+}
+
+// signatureAlgorithm 返回 Sign 对 keyType 使用的签名算法
+func signatureAlgorithm(keyType KeyType) (string, error) {
+	switch keyType {
+	case KeyRSA:
+		return "RSA-PKCS1v15-SHA256", nil
+	case KeyECDSAP256:
+		return "ECDSA-P256-SHA256", nil
+	case KeyECDSAP384:
+		return "ECDSA-P384-SHA384", nil
+	case KeyEd25519:
+		return "Ed25519", nil
+	default:
+		return "", fmt.Errorf("%w: %v can't sign", ErrKeyType, keyType)
+	}
+}
+
+// ReadFileSignature 读取 JSON 格式的签名文件
+func ReadFileSignature(r io.Reader) (*FileSignature, error) {
+	s := &FileSignature{}
+	if err := json.NewDecoder(r).Decode(s); err != nil {
+		return nil, fmt.Errorf("failed to read signature, %v", err)
+	}
+	if s.Version != fileSignatureVersion {
+		return nil, fmt.Errorf("unsupported signature version %d", s.Version)
+	}
+	return s, nil
+}
+
+// WriteJSON 以缩进的 JSON 写入签名
+func (s *FileSignature) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(s)
+}
+
+// payload 返回被签名的数据, 即不含 Signature 的 JSON
+func (s *FileSignature) payload() ([]byte, error) {
+	unsigned := *s
+	unsigned.Signature = nil
+	return json.Marshal(&unsigned)
+}
+
+// newFileSignature 返回 signer 的未签名的 FileSignature
+func newFileSignature(signer crypto.Signer, hash crypto.Hash) (*FileSignature, error) {
+	if _, ok := fileHashes[hash.String()]; !ok || !hash.Available() {
+		return nil, fmt.Errorf("unsupported hash %v", hash)
+	}
+	algorithm, err := signatureAlgorithm(KeyTypeOf(signer.Public()))
+	if err != nil {
+		return nil, err
+	}
+	fingerprint, err := Fingerprint(signer.Public())
+	if err != nil {
+		return nil, err
+	}
+	return &FileSignature{
+		Version:        fileSignatureVersion,
+		Algorithm:      algorithm,
+		KeyFingerprint: fingerprint,
+		Timestamp:      time.Now().UTC().Truncate(time.Second),
+		Hash:           hash.String(),
+	}, nil
+}
+
+func (s *FileSignature) sign(signer crypto.Signer) error {
+	payload, err := s.payload()
+	if err != nil {
+		return err
+	}
+	s.Signature, err = Sign(signer, payload)
+	return err
+}
+
+// verify 校验签名本身, 不读取文件. 公钥必须和签名记录的算法和指纹一致
+func (s *FileSignature) verify(publicKey crypto.PublicKey) (crypto.Hash, error) {
+	hash, ok := fileHashes[s.Hash]
+	if !ok {
+		return 0, fmt.Errorf("unsupported hash %q", s.Hash)
+	}
+	algorithm, err := signatureAlgorithm(KeyTypeOf(publicKey))
+	if err != nil {
+		return 0, err
+	}
+	if algorithm != s.Algorithm {
+		return 0, fmt.Errorf("%w: signed with %s, the key is %s", ErrSignature, s.Algorithm, algorithm)
+	}
+	fingerprint, err := Fingerprint(publicKey)
+	if err != nil {
+		return 0, err
+	}
+	if fingerprint != s.KeyFingerprint {
+		return 0, fmt.Errorf("%w: signed by key %s", ErrSignature, s.KeyFingerprint)
+	}
+	payload, err := s.payload()
+	if err != nil {
+		return 0, err
+	}
+	if err = Verify(publicKey, payload, s.Signature); err != nil {
+		return 0, err
+	}
+	return hash, nil
+}
+
+// hashReader 流式计算 r 的十六进制摘要
+func hashReader(r io.Reader, hash crypto.Hash) (string, error) {
+	h := hash.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// SignReader 流式计算 r 的摘要并签名, 数据不会全部读入内存. signer 的要求同 Sign
+func SignReader(signer crypto.Signer, r io.Reader, opts *FileSignOptions) (*FileSignature, error) {
+	s, err := newFileSignature(signer, opts.hash())
+	if err != nil {
+		return nil, err
+	}
+	if s.Digest, err = hashReader(r, opts.hash()); err != nil {
+		return nil, err
+	}
+	if err = s.sign(signer); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// VerifyReader 用公钥校验 SignReader 的签名和 r 的内容
+func VerifyReader(publicKey crypto.PublicKey, r io.Reader, signature *FileSignature) error {
+	hash, err := signature.verify(publicKey)
+	if err != nil {
+		return err
+	}
+	digest, err := hashReader(r, hash)
+	if err != nil {
+		return err
+	}
+	if digest != signature.Digest {
+		return fmt.Errorf("%w: content has been modified", ErrSignature)
+	}
+	return nil
+}
+
+// SignFile 对文件 path 签名, 签名通常用 WriteJSON 保存为 path + ".sig"
+func SignFile(signer crypto.Signer, path string, opts *FileSignOptions) (*FileSignature, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return SignReader(signer, bufio.NewReaderSize(f, streamChunkSize), opts)
+}
+
+// VerifyFile 用公钥校验文件 path 的签名, 公钥可以由 ExportPublicKeyToPEM 或 ExportPublicKey 导出后离线分发
+func VerifyFile(publicKey crypto.PublicKey, path string, signature *FileSignature) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return VerifyReader(publicKey, bufio.NewReaderSize(f, streamChunkSize), signature)
+}
@@ -0,0 +1,85 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "tool.exe")
+	data := bytes.Repeat([]byte("poketto"), 50000)
+	require.NoError(t, os.WriteFile(path, data, 0o644))
+
+	privateKey, publicKey, err := GenerateKeyPair(2048)
+	require.NoError(t, err)
+
+	t.Run("用导出的 PEM 公钥离线校验", func(t *testing.T) {
+		signature, err := SignFile(privateKey, path, nil)
+		require.NoError(t, err)
+		assert.Equal(t, "RSA-PKCS1v15-SHA256", signature.Algorithm)
+		assert.Equal(t, "SHA-256", signature.Hash)
+		assert.False(t, signature.Timestamp.IsZero())
+
+		buf := bytes.NewBuffer(nil)
+		require.NoError(t, signature.WriteJSON(buf))
+		read, err := ReadFileSignature(buf)
+		require.NoError(t, err)
+
+		imported, err := ImportPublicKeyFromPEM(ExportPublicKeyToPEM(publicKey))
+		require.NoError(t, err)
+		require.NoError(t, VerifyFile(imported, path, read))
+
+		other, _, err := GenerateKeyPair(2048)
+		require.NoError(t, err)
+		assert.ErrorIs(t, VerifyFile(&other.PublicKey, path, read), ErrSignature)
+	})
+
+	for _, keyType := range []KeyType{KeyEd25519, KeyECDSAP256, KeyECDSAP384} {
+		t.Run(keyType.String(), func(t *testing.T) {
+			key, err := GenerateKey(keyType)
+			require.NoError(t, err)
+			signer := key.(crypto.Signer)
+			signature, err := SignReader(signer, bytes.NewReader(data), &FileSignOptions{Hash: crypto.SHA512})
+			require.NoError(t, err)
+			assert.Equal(t, "SHA-512", signature.Hash)
+			require.NoError(t, VerifyReader(signer.Public(), bytes.NewReader(data), signature))
+			require.NoError(t, VerifyFile(signer.Public(), path, signature))
+		})
+	}
+
+	t.Run("篡改", func(t *testing.T) {
+		signature, err := SignFile(privateKey, path, nil)
+		require.NoError(t, err)
+
+		modified := append([]byte(nil), data...)
+		modified[len(modified)/2] ^= 1
+		assert.ErrorIs(t, VerifyReader(publicKey, bytes.NewReader(modified), signature), ErrSignature)
+
+		// the timestamp is signed as well
+		forged := *signature
+		forged.Timestamp = forged.Timestamp.Add(-24 * time.Hour)
+		assert.ErrorIs(t, VerifyFile(publicKey, path, &forged), ErrSignature)
+
+		forged = *signature
+		forged.Hash = "SHA-512"
+		assert.ErrorIs(t, VerifyFile(publicKey, path, &forged), ErrSignature)
+	})
+
+	t.Run("不支持的版本和密钥", func(t *testing.T) {
+		_, err := ReadFileSignature(strings.NewReader(`{"version":2}`))
+		assert.Error(t, err)
+		key, err := GenerateKey(KeyX25519)
+		require.NoError(t, err)
+		_, err = signatureAlgorithm(KeyTypeOf(key))
+		assert.ErrorIs(t, err, ErrKeyType)
+	})
+}
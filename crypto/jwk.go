@@ -0,0 +1,269 @@
+package crypto
+
+import (
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+)
+
+// jwk 是 RFC 7517 的 JSON Web Key, RSA 密钥的 kty 为 RSA, ECDSA 为 EC(RFC 7518),
+// Ed25519 和 X25519 为 OKP(RFC 8037)
+type jwk struct {
+	Kty string `json:"kty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	D   string `json:"d,omitempty"`
+	P   string `json:"p,omitempty"`
+	Q   string `json:"q,omitempty"`
+	DP  string `json:"dp,omitempty"`
+	DQ  string `json:"dq,omitempty"`
+	QI  string `json:"qi,omitempty"`
+}
+
+func encodeBigInt(n *big.Int) string {
+	return base64.RawURLEncoding.EncodeToString(n.Bytes())
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := decodeJWKBytes(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+func decodeJWKBytes(s string) ([]byte, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(b) == 0 {
+		return nil, fmt.Errorf("%w: invalid JWK parameter %q", ErrKeyFormat, s)
+	}
+	return b, nil
+}
+
+// jwkCurves 是 EC 密钥的 crv 对应的曲线
+var jwkCurves = map[string]struct {
+	curve elliptic.Curve
+	ecdh  ecdh.Curve
+}{
+	"P-256": {elliptic.P256(), ecdh.P256()},
+	"P-384": {elliptic.P384(), ecdh.P384()},
+}
+
+func marshalJWK(key interface{}) ([]byte, error) {
+	var k jwk
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		k = jwk{Kty: "RSA", N: encodeBigInt(key.N), E: encodeBigInt(big.NewInt(int64(key.E)))}
+	case *rsa.PrivateKey:
+		if len(key.Primes) != 2 {
+			return nil, fmt.Errorf("%w: multi-prime RSA keys in JWK", ErrKeyType)
+		}
+		key.Precompute()
+		k = jwk{
+			Kty: "RSA",
+			N:   encodeBigInt(key.N),
+			E:   encodeBigInt(big.NewInt(int64(key.E))),
+			D:   encodeBigInt(key.D),
+			P:   encodeBigInt(key.Primes[0]),
+			Q:   encodeBigInt(key.Primes[1]),
+			DP:  encodeBigInt(key.Precomputed.Dp),
+			DQ:  encodeBigInt(key.Precomputed.Dq),
+			QI:  encodeBigInt(key.Precomputed.Qinv),
+		}
+	case *ecdsa.PublicKey:
+		return marshalECJWK(key, nil)
+	case *ecdsa.PrivateKey:
+		return marshalECJWK(&key.PublicKey, key)
+	case ed25519.PublicKey:
+		k = jwk{Kty: "OKP", Crv: "Ed25519", X: base64.RawURLEncoding.EncodeToString(key)}
+	case ed25519.PrivateKey:
+		k = jwk{
+			Kty: "OKP",
+			Crv: "Ed25519",
+			X:   base64.RawURLEncoding.EncodeToString(key.Public().(ed25519.PublicKey)),
+			D:   base64.RawURLEncoding.EncodeToString(key.Seed()),
+		}
+	case *ecdh.PublicKey:
+		if key.Curve() != ecdh.X25519() {
+			return nil, fmt.Errorf("%w: ECDH keys other than X25519 in JWK, use ECDSA keys", ErrKeyType)
+		}
+		k = jwk{Kty: "OKP", Crv: "X25519", X: base64.RawURLEncoding.EncodeToString(key.Bytes())}
+	case *ecdh.PrivateKey:
+		if key.Curve() != ecdh.X25519() {
+			return nil, fmt.Errorf("%w: ECDH keys other than X25519 in JWK, use ECDSA keys", ErrKeyType)
+		}
+		k = jwk{
+			Kty: "OKP",
+			Crv: "X25519",
+			X:   base64.RawURLEncoding.EncodeToString(key.PublicKey().Bytes()),
+			D:   base64.RawURLEncoding.EncodeToString(key.Bytes()),
+		}
+	default:
+		return nil, fmt.Errorf("%w: %T in JWK", ErrKeyType, key)
+	}
+	return json.Marshal(k)
+}
+
+func marshalECJWK(publicKey *ecdsa.PublicKey, privateKey *ecdsa.PrivateKey) ([]byte, error) {
+	point, err := publicKey.ECDH()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrKeyType, err)
+	}
+	// uncompressed point 0x04 | x | y, the coordinates keep their leading zeros
+	xy := point.Bytes()[1:]
+	k := jwk{
+		Kty: "EC",
+		Crv: publicKey.Curve.Params().Name,
+		X:   base64.RawURLEncoding.EncodeToString(xy[:len(xy)/2]),
+		Y:   base64.RawURLEncoding.EncodeToString(xy[len(xy)/2:]),
+	}
+	if privateKey != nil {
+		d, err := privateKey.ECDH()
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrKeyType, err)
+		}
+		k.D = base64.RawURLEncoding.EncodeToString(d.Bytes())
+	}
+	return json.Marshal(k)
+}
+
+// unmarshalJWK 解析 JWK, private 为 true 时返回私钥
+func unmarshalJWK(data []byte, private bool) (interface{}, error) {
+	var k jwk
+	if err := json.Unmarshal(data, &k); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrKeyFormat, err)
+	}
+	if private && k.D == "" {
+		return nil, fmt.Errorf("%w: JWK holds no private key", ErrKeyFormat)
+	}
+	switch {
+	case k.Kty == "RSA":
+		return unmarshalRSAJWK(&k, private)
+	case k.Kty == "EC":
+		return unmarshalECJWK(&k, private)
+	case k.Kty == "OKP" && k.Crv == "Ed25519":
+		x, err := decodeJWKBytes(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("%w: invalid Ed25519 public key", ErrKeyFormat)
+		}
+		if !private {
+			return ed25519.PublicKey(x), nil
+		}
+		d, err := decodeJWKBytes(k.D)
+		if err != nil || len(d) != ed25519.SeedSize {
+			return nil, fmt.Errorf("%w: invalid Ed25519 private key", ErrKeyFormat)
+		}
+		privateKey := ed25519.NewKeyFromSeed(d)
+		if !privateKey.Public().(ed25519.PublicKey).Equal(ed25519.PublicKey(x)) {
+			return nil, fmt.Errorf("%w: Ed25519 public key doesn't match the private key", ErrKeyFormat)
+		}
+		return privateKey, nil
+	case k.Kty == "OKP" && k.Crv == "X25519":
+		x, err := decodeJWKBytes(k.X)
+		if err != nil {
+			return nil, err
+		}
+		publicKey, err := ecdh.X25519().NewPublicKey(x)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrKeyFormat, err)
+		}
+		if !private {
+			return publicKey, nil
+		}
+		d, err := decodeJWKBytes(k.D)
+		if err != nil {
+			return nil, err
+		}
+		privateKey, err := ecdh.X25519().NewPrivateKey(d)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrKeyFormat, err)
+		}
+		if !privateKey.PublicKey().Equal(publicKey) {
+			return nil, fmt.Errorf("%w: X25519 public key doesn't match the private key", ErrKeyFormat)
+		}
+		return privateKey, nil
+	default:
+		return nil, fmt.Errorf("%w: JWK kty %q crv %q", ErrKeyType, k.Kty, k.Crv)
+	}
+}
+
+func unmarshalRSAJWK(k *jwk, private bool) (interface{}, error) {
+	n, err := decodeBigInt(k.N)
+	if err != nil {
+		return nil, err
+	}
+	e, err := decodeBigInt(k.E)
+	if err != nil {
+		return nil, err
+	}
+	if !e.IsInt64() || e.Int64() > 1<<31-1 {
+		return nil, fmt.Errorf("%w: invalid RSA exponent", ErrKeyFormat)
+	}
+	publicKey := rsa.PublicKey{N: n, E: int(e.Int64())}
+	if !private {
+		return &publicKey, nil
+	}
+
+	privateKey := &rsa.PrivateKey{PublicKey: publicKey}
+	if privateKey.D, err = decodeBigInt(k.D); err != nil {
+		return nil, err
+	}
+	for _, prime := range []string{k.P, k.Q} {
+		p, err := decodeBigInt(prime)
+		if err != nil {
+			return nil, err
+		}
+		privateKey.Primes = append(privateKey.Primes, p)
+	}
+	if err = privateKey.Validate(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrKeyFormat, err)
+	}
+	privateKey.Precompute()
+	return privateKey, nil
+}
+
+func unmarshalECJWK(k *jwk, private bool) (interface{}, error) {
+	curve, ok := jwkCurves[k.Crv]
+	if !ok {
+		return nil, fmt.Errorf("%w: JWK curve %q", ErrKeyType, k.Crv)
+	}
+	x, err := decodeJWKBytes(k.X)
+	if err != nil {
+		return nil, err
+	}
+	y, err := decodeJWKBytes(k.Y)
+	if err != nil {
+		return nil, err
+	}
+	// NewPublicKey checks that the point is on the curve
+	point, err := curve.ecdh.NewPublicKey(append(append([]byte{4}, x...), y...))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrKeyFormat, err)
+	}
+	publicKey := ecdsa.PublicKey{Curve: curve.curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+	if !private {
+		return &publicKey, nil
+	}
+
+	d, err := decodeJWKBytes(k.D)
+	if err != nil {
+		return nil, err
+	}
+	scalar, err := curve.ecdh.NewPrivateKey(d)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrKeyFormat, err)
+	}
+	if !scalar.PublicKey().Equal(point) {
+		return nil, fmt.Errorf("%w: EC public key doesn't match the private key", ErrKeyFormat)
+	}
+	return &ecdsa.PrivateKey{PublicKey: publicKey, D: new(big.Int).SetBytes(d)}, nil
+}
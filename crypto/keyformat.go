@@ -0,0 +1,287 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/ssh"
+)
+
+var (
+	// ErrKeyFormat 无法识别密钥格式
+	ErrKeyFormat = errors.New("unrecognized key format")
+	// ErrKeyType 密钥类型不受支持或不适用于这种格式
+	ErrKeyType = errors.New("unsupported key type")
+)
+
+// KeyFormat 是密钥的编码格式
+type KeyFormat int
+
+const (
+	// FormatPKCS1 是 "RSA PRIVATE KEY" 和 "RSA PUBLIC KEY" PEM
+	FormatPKCS1 KeyFormat = iota
+	// FormatPKCS8 是 "PRIVATE KEY" PEM, 有密码时是 PBES2 加密的 "ENCRYPTED PRIVATE KEY" PEM
+	FormatPKCS8
+	// FormatPKIX 是 "PUBLIC KEY" PEM, 即 OpenSSL 默认输出的公钥
+	FormatPKIX
+	// FormatOpenSSH 是 "OPENSSH PRIVATE KEY" PEM 和 authorized_keys 格式的公钥
+	FormatOpenSSH
+	// FormatJWK 是 RFC 7517 的 JSON Web Key
+	FormatJWK
+	// FormatSEC1 是 ECDSA 私钥的 "EC PRIVATE KEY" PEM
+	FormatSEC1
+)
+
+func (f KeyFormat) String() string {
+	switch f {
+	case FormatPKCS1:
+		return "PKCS#1"
+	case FormatPKCS8:
+		return "PKCS#8"
+	case FormatPKIX:
+		return "PKIX"
+	case FormatOpenSSH:
+		return "OpenSSH"
+	case FormatJWK:
+		return "JWK"
+	case FormatSEC1:
+		return "SEC1"
+	default:
+		return fmt.Sprintf("KeyFormat(%d)", int(f))
+	}
+}
+
+// pemFormats 是各种 PEM 类型对应的格式
+var pemFormats = map[string]KeyFormat{
+	"RSA PRIVATE KEY":       FormatPKCS1,
+	"RSA PUBLIC KEY":        FormatPKCS1,
+	"PRIVATE KEY":           FormatPKCS8,
+	"ENCRYPTED PRIVATE KEY": FormatPKCS8,
+	"PUBLIC KEY":            FormatPKIX,
+	"OPENSSH PRIVATE KEY":   FormatOpenSSH,
+	"EC PRIVATE KEY":        FormatSEC1,
+}
+
+// DetectKeyFormat 识别 data 中密钥的格式, 支持 PEM, DER, JWK 和 authorized_keys 格式
+func DetectKeyFormat(data []byte) (KeyFormat, error) {
+	data = bytes.TrimSpace(data)
+	if bytes.HasPrefix(data, []byte("{")) {
+		return FormatJWK, nil
+	}
+	if block, _ := pem.Decode(data); block != nil {
+		if format, ok := pemFormats[block.Type]; ok {
+			return format, nil
+		}
+		return 0, fmt.Errorf("%w: PEM type %q", ErrKeyFormat, block.Type)
+	}
+	if _, _, _, _, err := ssh.ParseAuthorizedKey(data); err == nil {
+		return FormatOpenSSH, nil
+	}
+	// DER
+	if _, err := x509.ParsePKCS1PrivateKey(data); err == nil {
+		return FormatPKCS1, nil
+	}
+	if _, err := x509.ParsePKCS1PublicKey(data); err == nil {
+		return FormatPKCS1, nil
+	}
+	if _, err := x509.ParsePKCS8PrivateKey(data); err == nil {
+		return FormatPKCS8, nil
+	}
+	if _, err := x509.ParsePKIXPublicKey(data); err == nil {
+		return FormatPKIX, nil
+	}
+	if _, err := x509.ParseECPrivateKey(data); err == nil {
+		return FormatSEC1, nil
+	}
+	return 0, ErrKeyFormat
+}
+
+// ExportPrivateKey 将私钥导出为 format 格式, PKCS#8 和 OpenSSH 格式可以用 passphrase 加密,
+// passphrase 为空时不加密. PKCS#1 和 JWK 不支持加密. PKCS#1 只能用于 RSA, SEC1 只能用于 ECDSA,
+// OpenSSH 不支持 X25519
+func ExportPrivateKey(privateKey crypto.PrivateKey, format KeyFormat, passphrase []byte) ([]byte, error) {
+	if len(passphrase) > 0 && (format == FormatPKCS1 || format == FormatJWK || format == FormatSEC1) {
+		return nil, fmt.Errorf("%v private keys can't be encrypted, use PKCS#8 or OpenSSH", format)
+	}
+	switch format {
+	case FormatPKCS1:
+		key, ok := privateKey.(*rsa.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("%w: %T in PKCS#1", ErrKeyType, privateKey)
+		}
+		return pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}), nil
+	case FormatSEC1:
+		key, ok := privateKey.(*ecdsa.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("%w: %T in SEC1", ErrKeyType, privateKey)
+		}
+		der, err := x509.MarshalECPrivateKey(key)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrKeyType, err)
+		}
+		return pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), nil
+	case FormatPKCS8:
+		der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrKeyType, err)
+		}
+		if len(passphrase) == 0 {
+			return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+		}
+		if der, err = encryptPKCS8(der, passphrase); err != nil {
+			return nil, fmt.Errorf("failed to encrypt private key, %v", err)
+		}
+		return pem.EncodeToMemory(&pem.Block{Type: "ENCRYPTED PRIVATE KEY", Bytes: der}), nil
+	case FormatOpenSSH:
+		var block *pem.Block
+		var err error
+		if len(passphrase) == 0 {
+			block, err = ssh.MarshalPrivateKey(privateKey, "")
+		} else {
+			block, err = ssh.MarshalPrivateKeyWithPassphrase(privateKey, "", passphrase)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrKeyType, err)
+		}
+		return pem.EncodeToMemory(block), nil
+	case FormatJWK:
+		return marshalJWK(privateKey)
+	default:
+		return nil, fmt.Errorf("%v private keys are not supported", format)
+	}
+}
+
+// ExportPublicKey 将公钥导出为 format 格式, OpenSSH 格式是 authorized_keys 中的一行
+func ExportPublicKey(publicKey crypto.PublicKey, format KeyFormat) ([]byte, error) {
+	switch format {
+	case FormatPKCS1:
+		key, ok := publicKey.(*rsa.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf("%w: %T in PKCS#1", ErrKeyType, publicKey)
+		}
+		return pem.EncodeToMemory(&pem.Block{Type: "RSA PUBLIC KEY", Bytes: x509.MarshalPKCS1PublicKey(key)}), nil
+	case FormatPKIX:
+		der, err := x509.MarshalPKIXPublicKey(publicKey)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrKeyType, err)
+		}
+		return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), nil
+	case FormatOpenSSH:
+		key, err := ssh.NewPublicKey(publicKey)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrKeyType, err)
+		}
+		return ssh.MarshalAuthorizedKey(key), nil
+	case FormatJWK:
+		return marshalJWK(publicKey)
+	default:
+		return nil, fmt.Errorf("%v public keys are not supported", format)
+	}
+}
+
+// ImportPrivateKey 自动识别格式并导入私钥, 加密的私钥需要 passphrase
+func ImportPrivateKey(data, passphrase []byte) (crypto.PrivateKey, error) {
+	format, err := DetectKeyFormat(data)
+	if err != nil {
+		return nil, err
+	}
+	if format == FormatJWK {
+		return unmarshalJWK(data, true)
+	}
+
+	der := bytes.TrimSpace(data)
+	pemType := ""
+	if block, _ := pem.Decode(der); block != nil {
+		der, pemType = block.Bytes, block.Type
+		// legacy encrypted PEM written by OpenSSL 1.0, e.g. openssl rsa -aes256
+		if x509.IsEncryptedPEMBlock(block) {
+			if len(passphrase) == 0 {
+				return nil, ErrPassphrase
+			}
+			if der, err = x509.DecryptPEMBlock(block, passphrase); err != nil {
+				return nil, ErrPassphrase
+			}
+		}
+	}
+
+	switch {
+	case format == FormatPKCS1:
+		return x509.ParsePKCS1PrivateKey(der)
+	case format == FormatSEC1:
+		return x509.ParseECPrivateKey(der)
+	case pemType == "ENCRYPTED PRIVATE KEY":
+		if len(passphrase) == 0 {
+			return nil, ErrPassphrase
+		}
+		if der, err = decryptPKCS8(der, passphrase); err != nil {
+			return nil, err
+		}
+		key, err := x509.ParsePKCS8PrivateKey(der)
+		if err != nil {
+			// the padding happened to be valid
+			return nil, ErrPassphrase
+		}
+		return key, nil
+	case format == FormatPKCS8:
+		return x509.ParsePKCS8PrivateKey(der)
+	case format == FormatOpenSSH && pemType != "":
+		var key interface{}
+		if len(passphrase) == 0 {
+			key, err = ssh.ParseRawPrivateKey(data)
+		} else {
+			key, err = ssh.ParseRawPrivateKeyWithPassphrase(data, passphrase)
+		}
+		var missing *ssh.PassphraseMissingError
+		if errors.As(err, &missing) || errors.Is(err, x509.IncorrectPasswordError) {
+			return nil, ErrPassphrase
+		}
+		if err != nil {
+			return nil, err
+		}
+		return normalizeKey(key), nil
+	default:
+		return nil, fmt.Errorf("%w: %v data holds no private key", ErrKeyFormat, format)
+	}
+}
+
+// ImportPublicKey 自动识别格式并导入公钥
+func ImportPublicKey(data []byte) (crypto.PublicKey, error) {
+	format, err := DetectKeyFormat(data)
+	if err != nil {
+		return nil, err
+	}
+	if format == FormatJWK {
+		return unmarshalJWK(data, false)
+	}
+
+	der := bytes.TrimSpace(data)
+	pemType := ""
+	if block, _ := pem.Decode(der); block != nil {
+		der, pemType = block.Bytes, block.Type
+	}
+	switch {
+	case format == FormatOpenSSH && pemType == "":
+		key, _, _, _, err := ssh.ParseAuthorizedKey(der)
+		if err != nil {
+			return nil, err
+		}
+		cryptoKey, ok := key.(ssh.CryptoPublicKey)
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrKeyType, key.Type())
+		}
+		return normalizeKey(cryptoKey.CryptoPublicKey()), nil
+	case format == FormatPKCS1 && pemType != "RSA PRIVATE KEY":
+		if key, err := x509.ParsePKCS1PublicKey(der); err == nil {
+			return key, nil
+		}
+	case format == FormatPKIX:
+		return x509.ParsePKIXPublicKey(der)
+	}
+	return nil, fmt.Errorf("%w: %v data holds no public key", ErrKeyFormat, format)
+}
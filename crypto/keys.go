@@ -0,0 +1,137 @@
+package crypto
+
+import (
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"fmt"
+)
+
+// KeyType 是密钥的算法
+type KeyType int
+
+const (
+	KeyUnknown KeyType = iota
+	// KeyRSA 是 RSA 密钥, 生成时为 2048 位
+	KeyRSA
+	// KeyEd25519 是 Ed25519 签名密钥
+	KeyEd25519
+	// KeyECDSAP256 是 P-256 曲线的 ECDSA 密钥, 使用 SHA-256 签名, 也可以用于 ECDH
+	KeyECDSAP256
+	// KeyECDSAP384 是 P-384 曲线的 ECDSA 密钥, 使用 SHA-384 签名, 也可以用于 ECDH
+	KeyECDSAP384
+	// KeyX25519 是 X25519 密钥协商密钥, 不能签名
+	KeyX25519
+)
+
+func (k KeyType) String() string {
+	switch k {
+	case KeyRSA:
+		return "RSA"
+	case KeyEd25519:
+		return "Ed25519"
+	case KeyECDSAP256:
+		return "ECDSA-P256"
+	case KeyECDSAP384:
+		return "ECDSA-P384"
+	case KeyX25519:
+		return "X25519"
+	default:
+		return "unknown"
+	}
+}
+
+// GenerateKey 生成 keyType 类型的私钥. RSA, Ed25519 和 ECDSA 私钥实现了 crypto.Signer,
+// X25519 私钥是 *ecdh.PrivateKey
+func GenerateKey(keyType KeyType) (crypto.PrivateKey, error) {
+	switch keyType {
+	case KeyRSA:
+		privateKey, _, err := GenerateKeyPair(2048)
+		return privateKey, err
+	case KeyEd25519:
+		_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+		return privateKey, err
+	case KeyECDSAP256:
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case KeyECDSAP384:
+		return ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	case KeyX25519:
+		return ecdh.X25519().GenerateKey(rand.Reader)
+	default:
+		return nil, fmt.Errorf("%w: %v", ErrKeyType, keyType)
+	}
+}
+
+// KeyTypeOf 返回私钥或公钥的算法
+func KeyTypeOf(key interface{}) KeyType {
+	switch key := key.(type) {
+	case *rsa.PrivateKey, *rsa.PublicKey:
+		return KeyRSA
+	case ed25519.PrivateKey, ed25519.PublicKey:
+		return KeyEd25519
+	case *ecdsa.PrivateKey:
+		return curveKeyType(key.Curve)
+	case *ecdsa.PublicKey:
+		return curveKeyType(key.Curve)
+	case *ecdh.PrivateKey:
+		return ecdhKeyType(key.Curve())
+	case *ecdh.PublicKey:
+		return ecdhKeyType(key.Curve())
+	case crypto.Signer:
+		return KeyTypeOf(key.Public())
+	default:
+		return KeyUnknown
+	}
+}
+
+func curveKeyType(curve elliptic.Curve) KeyType {
+	switch curve {
+	case elliptic.P256():
+		return KeyECDSAP256
+	case elliptic.P384():
+		return KeyECDSAP384
+	default:
+		return KeyUnknown
+	}
+}
+
+func ecdhKeyType(curve ecdh.Curve) KeyType {
+	switch curve {
+	case ecdh.X25519():
+		return KeyX25519
+	case ecdh.P256():
+		return KeyECDSAP256
+	case ecdh.P384():
+		return KeyECDSAP384
+	default:
+		return KeyUnknown
+	}
+}
+
+// PublicKeyOf 返回私钥对应的公钥
+func PublicKeyOf(privateKey crypto.PrivateKey) (crypto.PublicKey, error) {
+	switch key := privateKey.(type) {
+	case *ecdh.PrivateKey:
+		return key.PublicKey(), nil
+	case crypto.Signer:
+		return key.Public(), nil
+	default:
+		return nil, fmt.Errorf("%w: %T", ErrKeyType, privateKey)
+	}
+}
+
+// normalizeKey 把其他库返回的密钥统一为标准库的类型, 例如 ssh 返回的 *ed25519.PrivateKey
+func normalizeKey(key interface{}) interface{} {
+	switch k := key.(type) {
+	case *ed25519.PrivateKey:
+		return *k
+	case *ed25519.PublicKey:
+		return *k
+	default:
+		return key
+	}
+}
@@ -0,0 +1,75 @@
+package crypto
+
+import (
+	"crypto"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var allKeyTypes = []KeyType{KeyRSA, KeyEd25519, KeyECDSAP256, KeyECDSAP384, KeyX25519}
+
+type equaler interface {
+	Equal(crypto.PrivateKey) bool
+}
+
+type publicEqualer interface {
+	Equal(crypto.PublicKey) bool
+}
+
+func TestKeys(t *testing.T) {
+	for _, keyType := range allKeyTypes {
+		t.Run(keyType.String(), func(t *testing.T) {
+			privateKey, err := GenerateKey(keyType)
+			require.NoError(t, err)
+			assert.Equal(t, keyType, KeyTypeOf(privateKey))
+			publicKey, err := PublicKeyOf(privateKey)
+			require.NoError(t, err)
+			assert.Equal(t, keyType, KeyTypeOf(publicKey))
+
+			privateFormats := []KeyFormat{FormatPKCS8, FormatJWK}
+			publicFormats := []KeyFormat{FormatPKIX, FormatJWK}
+			switch keyType {
+			case KeyRSA:
+				privateFormats = append(privateFormats, FormatPKCS1, FormatOpenSSH)
+				publicFormats = append(publicFormats, FormatPKCS1, FormatOpenSSH)
+			case KeyECDSAP256, KeyECDSAP384:
+				privateFormats = append(privateFormats, FormatSEC1, FormatOpenSSH)
+				publicFormats = append(publicFormats, FormatOpenSSH)
+			case KeyEd25519:
+				privateFormats = append(privateFormats, FormatOpenSSH)
+				publicFormats = append(publicFormats, FormatOpenSSH)
+			}
+
+			for _, format := range privateFormats {
+				exported, err := ExportPrivateKey(privateKey, format, nil)
+				require.NoError(t, err, format)
+				detected, err := DetectKeyFormat(exported)
+				require.NoError(t, err)
+				assert.Equal(t, format, detected)
+				imported, err := ImportPrivateKey(exported, nil)
+				require.NoError(t, err, format)
+				assert.True(t, privateKey.(equaler).Equal(imported), format)
+			}
+			for _, format := range publicFormats {
+				exported, err := ExportPublicKey(publicKey, format)
+				require.NoError(t, err, format)
+				imported, err := ImportPublicKey(exported)
+				require.NoError(t, err, format)
+				assert.True(t, publicKey.(publicEqualer).Equal(imported), format)
+			}
+		})
+	}
+
+	t.Run("不支持的组合", func(t *testing.T) {
+		privateKey, err := GenerateKey(KeyX25519)
+		require.NoError(t, err)
+		_, err = ExportPrivateKey(privateKey, FormatOpenSSH, nil)
+		assert.ErrorIs(t, err, ErrKeyType)
+		_, err = ExportPrivateKey(privateKey, FormatPKCS1, nil)
+		assert.ErrorIs(t, err, ErrKeyType)
+		_, err = GenerateKey(KeyUnknown)
+		assert.ErrorIs(t, err, ErrKeyType)
+	})
+}
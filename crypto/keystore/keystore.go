@@ -0,0 +1,594 @@
+package keystore
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	pcrypto "github.com/w-devin/poketto/crypto"
+	paes "github.com/w-devin/poketto/crypto/aes"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/scrypt"
+)
+
+var (
+	// ErrNotFound 密钥不存在
+	ErrNotFound = errors.New("key not found")
+	// ErrExists 同名的密钥已经存在
+	ErrExists = errors.New("key already exists")
+	// ErrLocked 会话已经超时或被锁定
+	ErrLocked = errors.New("key is locked")
+	// ErrPassphrase 密码错误
+	ErrPassphrase = pcrypto.ErrPassphrase
+)
+
+// storeVersion 是密钥库文件的版本
+const storeVersion = 1
+
+// KDF 是从密码派生加密密钥的算法
+type KDF int
+
+const (
+	KDFArgon2id KDF = iota
+	KDFScrypt
+)
+
+func (k KDF) String() string {
+	switch k {
+	case KDFArgon2id:
+		return "argon2id"
+	case KDFScrypt:
+		return "scrypt"
+	default:
+		return fmt.Sprintf("KDF(%d)", int(k))
+	}
+}
+
+// Options 控制新加入的密钥的加密方式, 已有的密钥按各自保存的参数解密
+type Options struct {
+	KDF KDF
+	// Argon2Time 是 Argon2id 的迭代次数, 默认 3
+	Argon2Time uint32
+	// Argon2Memory 是 Argon2id 使用的内存, 单位 KiB, 默认 64 MiB
+	Argon2Memory uint32
+	// Argon2Threads 是 Argon2id 的并行度, 默认 4
+	Argon2Threads uint8
+	// ScryptN 是 scrypt 的 CPU/内存开销, 必须是 2 的幂, 默认 2^15
+	ScryptN int
+}
+
+func (o *Options) argon2Time() uint32 {
+	if o.Argon2Time == 0 {
+		return 3
+	}
+	return o.Argon2Time
+}
+
+func (o *Options) argon2Memory() uint32 {
+	if o.Argon2Memory == 0 {
+		return 64 * 1024
+	}
+	return o.Argon2Memory
+}
+
+func (o *Options) argon2Threads() uint8 {
+	if o.Argon2Threads == 0 {
+		return 4
+	}
+	return o.Argon2Threads
+}
+
+func (o *Options) scryptN() int {
+	if o.ScryptN == 0 {
+		return 1 << 15
+	}
+	return o.ScryptN
+}
+
+// Usage 是密钥的用途
+type Usage string
+
+const (
+	UsageSign    Usage = "sign"
+	UsageEncrypt Usage = "encrypt"
+)
+
+// defaultUsage 返回密钥类型支持的用途
+func defaultUsage(keyType pcrypto.KeyType) []Usage {
+	switch keyType {
+	case pcrypto.KeyEd25519:
+		return []Usage{UsageSign}
+	case pcrypto.KeyX25519:
+		return []Usage{UsageEncrypt}
+	default:
+		return []Usage{UsageSign, UsageEncrypt}
+	}
+}
+
+// Metadata 描述密钥库中的一个密钥版本
+type Metadata struct {
+	Name string `json:"name"`
+	// Version 从 1 开始, 每次 Rotate 加 1
+	Version int `json:"version"`
+	// Type 由公钥得出, 不保存在文件中
+	Type        pcrypto.KeyType `json:"-"`
+	Usage       []Usage         `json:"usage"`
+	Created     time.Time       `json:"created"`
+	Fingerprint string          `json:"fingerprint"`
+	// Retired 是被 Rotate 替换的时间, 当前版本为 nil
+	Retired *time.Time `json:"retired,omitempty"`
+}
+
+// HasUsage 判断密钥是否可以用于 usage
+func (m *Metadata) HasUsage(usage Usage) bool {
+	for _, u := range m.Usage {
+		if u == usage {
+			return true
+		}
+	}
+	return false
+}
+
+// kdfParams 是加密一个密钥时使用的 KDF 参数
+type kdfParams struct {
+	Name    string `json:"name"`
+	Salt    []byte `json:"salt"`
+	Time    uint32 `json:"time,omitempty"`
+	Memory  uint32 `json:"memory,omitempty"`
+	Threads uint8  `json:"threads,omitempty"`
+	N       int    `json:"n,omitempty"`
+	R       int    `json:"r,omitempty"`
+	P       int    `json:"p,omitempty"`
+}
+
+func (p *kdfParams) key(passphrase []byte) ([]byte, error) {
+	switch p.Name {
+	case KDFArgon2id.String():
+		if p.Time == 0 || p.Memory == 0 || p.Threads == 0 {
+			return nil, errors.New("invalid argon2id parameters")
+		}
+		return argon2.IDKey(passphrase, p.Salt, p.Time, p.Memory, p.Threads, 32), nil
+	case KDFScrypt.String():
+		return scrypt.Key(passphrase, p.Salt, p.N, p.R, p.P, 32)
+	default:
+		return nil, fmt.Errorf("unsupported key derivation %q", p.Name)
+	}
+}
+
+// entry 是密钥库文件中的一个密钥版本, 私钥是用密码派生的密钥加密的 PKCS#8
+type entry struct {
+	Metadata
+	PublicKey  string    `json:"public_key"`
+	KDF        kdfParams `json:"kdf"`
+	Ciphertext []byte    `json:"ciphertext"`
+}
+
+// additionalData 把密文绑定到密钥的名称, 版本和指纹上
+func (e *entry) additionalData() []byte {
+	return []byte(e.Name + "\x00" + strconv.Itoa(e.Version) + "\x00" + e.Fingerprint)
+}
+
+type storeFile struct {
+	Version int      `json:"version"`
+	Keys    []*entry `json:"keys"`
+}
+
+// Store 是保存在一个文件中的密钥库, 每个私钥用各自的密码加密. 每次修改都会立即写回文件
+type Store struct {
+	path string
+	opts Options
+
+	mu      sync.Mutex
+	entries []*entry
+}
+
+// Open 打开 path 处的密钥库, 文件不存在时在第一次修改时创建
+func Open(path string, opts *Options) (*Store, error) {
+	if opts == nil {
+		opts = &Options{}
+	}
+	s := &Store{path: path, opts: *opts}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var file storeFile
+	if err = json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to read keystore %s, %v", path, err)
+	}
+	if file.Version != storeVersion {
+		return nil, fmt.Errorf("unsupported keystore version %d", file.Version)
+	}
+	for _, e := range file.Keys {
+		publicKey, err := pcrypto.ImportPublicKey([]byte(e.PublicKey))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read public key of %s, %v", e.Name, err)
+		}
+		e.Type = pcrypto.KeyTypeOf(publicKey)
+	}
+	s.entries = file.Keys
+	return s, nil
+}
+
+// save 把密钥库写入临时文件再替换原文件
+func (s *Store) save() error {
+	data, err := json.MarshalIndent(storeFile{Version: storeVersion, Keys: s.entries}, "", "  ")
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(s.path)
+	if err = os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, ".keystore-*")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), s.path)
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// latest 返回 name 的当前版本
+func (s *Store) latest(name string) *entry {
+	var latest *entry
+	for _, e := range s.entries {
+		if e.Name == name && (latest == nil || e.Version > latest.Version) {
+			latest = e
+		}
+	}
+	return latest
+}
+
+func (s *Store) find(name string, version int) (*entry, error) {
+	if version == 0 {
+		if e := s.latest(name); e != nil {
+			return e, nil
+		}
+	}
+	for _, e := range s.entries {
+		if e.Name == name && e.Version == version {
+			return e, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrNotFound, name)
+}
+
+// seal 加密 privateKey 生成一个新的版本
+func (s *Store) seal(name string, version int, privateKey crypto.PrivateKey, passphrase []byte, usage []Usage) (*entry, error) {
+	publicKey, err := pcrypto.PublicKeyOf(privateKey)
+	if err != nil {
+		return nil, err
+	}
+	publicPEM, err := pcrypto.ExportPublicKey(publicKey, pcrypto.FormatPKIX)
+	if err != nil {
+		return nil, err
+	}
+	fingerprint, err := pcrypto.Fingerprint(publicKey)
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", pcrypto.ErrKeyType, err)
+	}
+
+	params := kdfParams{Name: s.opts.KDF.String(), Salt: make([]byte, 16)}
+	if _, err = rand.Read(params.Salt); err != nil {
+		return nil, err
+	}
+	switch s.opts.KDF {
+	case KDFArgon2id:
+		params.Time, params.Memory, params.Threads = s.opts.argon2Time(), s.opts.argon2Memory(), s.opts.argon2Threads()
+	case KDFScrypt:
+		params.N, params.R, params.P = s.opts.scryptN(), 8, 1
+	default:
+		return nil, fmt.Errorf("unsupported key derivation %v", s.opts.KDF)
+	}
+	key, err := params.key(passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	keyType := pcrypto.KeyTypeOf(privateKey)
+	if len(usage) == 0 {
+		usage = defaultUsage(keyType)
+	}
+	e := &entry{
+		Metadata: Metadata{
+			Name:        name,
+			Version:     version,
+			Type:        keyType,
+			Usage:       usage,
+			Created:     time.Now().UTC().Truncate(time.Second),
+			Fingerprint: fingerprint,
+		},
+		PublicKey: string(publicPEM),
+		KDF:       params,
+	}
+	if e.Ciphertext, err = paes.EncryptGCM(key, der, e.additionalData()); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// open 解密 e 的私钥
+func (e *entry) open(passphrase []byte) (crypto.PrivateKey, error) {
+	key, err := e.KDF.key(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	der, err := paes.DecryptGCM(key, e.Ciphertext, e.additionalData())
+	if err != nil {
+		return nil, ErrPassphrase
+	}
+	return x509.ParsePKCS8PrivateKey(der)
+}
+
+// Add 用 passphrase 加密 privateKey 存为 name, usage 为空时使用密钥类型支持的所有用途
+func (s *Store) Add(name string, privateKey crypto.PrivateKey, passphrase []byte, usage ...Usage) (*Metadata, error) {
+	if name == "" {
+		return nil, errors.New("empty key name")
+	}
+	// keys which can't be generated again can't be rotated either
+	if pcrypto.KeyTypeOf(privateKey) == pcrypto.KeyUnknown {
+		return nil, fmt.Errorf("%w: %T", pcrypto.ErrKeyType, privateKey)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.latest(name) != nil {
+		return nil, fmt.Errorf("%w: %s", ErrExists, name)
+	}
+	e, err := s.seal(name, 1, privateKey, passphrase, usage)
+	if err != nil {
+		return nil, err
+	}
+	s.entries = append(s.entries, e)
+	if err = s.save(); err != nil {
+		s.entries = s.entries[:len(s.entries)-1]
+		return nil, err
+	}
+	metadata := e.Metadata
+	return &metadata, nil
+}
+
+// Generate 生成 keyType 类型的密钥存为 name
+func (s *Store) Generate(name string, keyType pcrypto.KeyType, passphrase []byte, usage ...Usage) (*Metadata, error) {
+	privateKey, err := pcrypto.GenerateKey(keyType)
+	if err != nil {
+		return nil, err
+	}
+	return s.Add(name, privateKey, passphrase, usage...)
+}
+
+// List 返回所有密钥的所有版本, 按名称和版本排序
+func (s *Store) List() []Metadata {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := make([]Metadata, 0, len(s.entries))
+	for _, e := range s.entries {
+		list = append(list, e.Metadata)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Name != list[j].Name {
+			return list[i].Name < list[j].Name
+		}
+		return list[i].Version < list[j].Version
+	})
+	return list
+}
+
+// Metadata 返回 name 的当前版本
+func (s *Store) Metadata(name string) (*Metadata, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, err := s.find(name, 0)
+	if err != nil {
+		return nil, err
+	}
+	metadata := e.Metadata
+	return &metadata, nil
+}
+
+// PublicKey 返回 name 当前版本的公钥, 不需要密码
+func (s *Store) PublicKey(name string) (crypto.PublicKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, err := s.find(name, 0)
+	if err != nil {
+		return nil, err
+	}
+	return pcrypto.ImportPublicKey([]byte(e.PublicKey))
+}
+
+// Get 解密 name 的当前版本
+func (s *Store) Get(name string, passphrase []byte) (crypto.PrivateKey, error) {
+	return s.GetVersion(name, 0, passphrase)
+}
+
+// GetVersion 解密 name 的指定版本, 例如用被替换的密钥解密以前的数据. version 为 0 时是当前版本
+func (s *Store) GetVersion(name string, version int, passphrase []byte) (crypto.PrivateKey, error) {
+	s.mu.Lock()
+	e, err := s.find(name, version)
+	s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	return e.open(passphrase)
+}
+
+// Rotate 为 name 生成同类型同用途的新版本, 旧版本标记为已替换但仍然保留
+func (s *Store) Rotate(name string, passphrase []byte) (*Metadata, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	current, err := s.find(name, 0)
+	if err != nil {
+		return nil, err
+	}
+	// the passphrase has to be right for the current version
+	currentKey, err := current.open(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	privateKey, err := generateLike(currentKey)
+	if err != nil {
+		return nil, err
+	}
+	e, err := s.seal(name, current.Version+1, privateKey, passphrase, current.Usage)
+	if err != nil {
+		return nil, err
+	}
+
+	retired := e.Created
+	current.Retired = &retired
+	s.entries = append(s.entries, e)
+	if err = s.save(); err != nil {
+		current.Retired = nil
+		s.entries = s.entries[:len(s.entries)-1]
+		return nil, err
+	}
+	metadata := e.Metadata
+	return &metadata, nil
+}
+
+// generateLike 生成和 privateKey 同类型的新私钥, RSA 私钥保持模数长度
+func generateLike(privateKey crypto.PrivateKey) (crypto.PrivateKey, error) {
+	if rsaKey, ok := privateKey.(*rsa.PrivateKey); ok {
+		newKey, _, err := pcrypto.GenerateKeyPair(rsaKey.N.BitLen())
+		return newKey, err
+	}
+	return pcrypto.GenerateKey(pcrypto.KeyTypeOf(privateKey))
+}
+
+// Export 解密 name 的当前版本并导出为 format 格式, exportPassphrase 见 pcrypto.ExportPrivateKey
+func (s *Store) Export(name string, passphrase []byte, format pcrypto.KeyFormat, exportPassphrase []byte) ([]byte, error) {
+	privateKey, err := s.Get(name, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	return pcrypto.ExportPrivateKey(privateKey, format, exportPassphrase)
+}
+
+// ExportPublicKey 导出 name 当前版本的公钥
+func (s *Store) ExportPublicKey(name string, format pcrypto.KeyFormat) ([]byte, error) {
+	publicKey, err := s.PublicKey(name)
+	if err != nil {
+		return nil, err
+	}
+	return pcrypto.ExportPublicKey(publicKey, format)
+}
+
+// Delete 删除 name 的所有版本
+func (s *Store) Delete(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	kept := make([]*entry, 0, len(s.entries))
+	for _, e := range s.entries {
+		if e.Name != name {
+			kept = append(kept, e)
+		}
+	}
+	if len(kept) == len(s.entries) {
+		return fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	previous := s.entries
+	s.entries = kept
+	if err := s.save(); err != nil {
+		s.entries = previous
+		return err
+	}
+	return nil
+}
+
+// Session 是在内存中解锁的密钥, 超时或 Lock 之后需要重新用密码解锁
+type Session struct {
+	metadata Metadata
+
+	mu    sync.Mutex
+	key   crypto.PrivateKey
+	timer *time.Timer
+}
+
+// Unlock 用 passphrase 解密 name 的当前版本, 在 timeout 内可以通过返回的 Session 使用私钥而不用再输入密码.
+// timeout 为 0 时直到调用 Lock 才锁定
+func (s *Store) Unlock(name string, passphrase []byte, timeout time.Duration) (*Session, error) {
+	s.mu.Lock()
+	e, err := s.find(name, 0)
+	s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	key, err := e.open(passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	session := &Session{metadata: e.Metadata, key: key}
+	if timeout > 0 {
+		session.timer = time.AfterFunc(timeout, session.Lock)
+	}
+	return session, nil
+}
+
+// Metadata 返回解锁的密钥版本
+func (s *Session) Metadata() Metadata {
+	return s.metadata
+}
+
+// Key 返回解锁的私钥, 会话已经锁定时返回 ErrLocked
+func (s *Session) Key() (crypto.PrivateKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.key == nil {
+		return nil, fmt.Errorf("%w: %s", ErrLocked, s.metadata.Name)
+	}
+	return s.key, nil
+}
+
+// Signer 返回解锁的私钥作为 crypto.Signer, X25519 密钥不能签名
+func (s *Session) Signer() (crypto.Signer, error) {
+	key, err := s.Key()
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s can't sign", pcrypto.ErrKeyType, s.metadata.Type)
+	}
+	return signer, nil
+}
+
+// Lock 丢弃内存中的私钥, 可以重复调用
+func (s *Session) Lock() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.timer != nil {
+		s.timer.Stop()
+	}
+	s.key = nil
+}
@@ -0,0 +1,190 @@
+package keystore
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	pcrypto "github.com/w-devin/poketto/crypto"
+)
+
+// fastOptions 降低 KDF 的开销, 只用于测试
+var fastOptions = &Options{Argon2Time: 1, Argon2Memory: 1024, Argon2Threads: 1}
+
+func TestStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	passphrase := []byte("correct horse")
+
+	store, err := Open(path, fastOptions)
+	require.NoError(t, err)
+	signing, err := store.Generate("signing", pcrypto.KeyEd25519, passphrase)
+	require.NoError(t, err)
+	assert.Equal(t, 1, signing.Version)
+	assert.Equal(t, []Usage{UsageSign}, signing.Usage)
+	assert.False(t, signing.HasUsage(UsageEncrypt))
+
+	t.Run("重新打开", func(t *testing.T) {
+		info, err := os.Stat(path)
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+		reopened, err := Open(path, nil)
+		require.NoError(t, err)
+		list := reopened.List()
+		require.Len(t, list, 1)
+		assert.Equal(t, pcrypto.KeyEd25519, list[0].Type)
+		assert.Equal(t, signing.Fingerprint, list[0].Fingerprint)
+		assert.True(t, signing.Created.Equal(list[0].Created))
+
+		privateKey, err := reopened.Get("signing", passphrase)
+		require.NoError(t, err)
+		publicKey, err := reopened.PublicKey("signing")
+		require.NoError(t, err)
+		assert.True(t, privateKey.(ed25519.PrivateKey).Public().(ed25519.PublicKey).Equal(publicKey))
+	})
+
+	t.Run("错误的密码", func(t *testing.T) {
+		_, err := store.Get("signing", []byte("wrong"))
+		assert.ErrorIs(t, err, ErrPassphrase)
+		_, err = store.Get("missing", passphrase)
+		assert.ErrorIs(t, err, ErrNotFound)
+		_, err = store.Generate("signing", pcrypto.KeyEd25519, passphrase)
+		assert.ErrorIs(t, err, ErrExists)
+	})
+
+	t.Run("scrypt", func(t *testing.T) {
+		scryptStore, err := Open(path, &Options{KDF: KDFScrypt, ScryptN: 1 << 10})
+		require.NoError(t, err)
+		_, err = scryptStore.Generate("encryption", pcrypto.KeyX25519, passphrase)
+		require.NoError(t, err)
+
+		reopened, err := Open(path, fastOptions)
+		require.NoError(t, err)
+		assert.Len(t, reopened.List(), 2)
+		_, err = reopened.Get("encryption", passphrase)
+		require.NoError(t, err)
+		require.NoError(t, reopened.Delete("encryption"))
+	})
+
+	t.Run("轮换", func(t *testing.T) {
+		old, err := store.Get("signing", passphrase)
+		require.NoError(t, err)
+		rotated, err := store.Rotate("signing", passphrase)
+		require.NoError(t, err)
+		assert.Equal(t, 2, rotated.Version)
+		assert.NotEqual(t, signing.Fingerprint, rotated.Fingerprint)
+
+		list := store.List()
+		require.Len(t, list, 2)
+		assert.NotNil(t, list[0].Retired)
+		assert.Nil(t, list[1].Retired)
+
+		previous, err := store.GetVersion("signing", 1, passphrase)
+		require.NoError(t, err)
+		assert.Equal(t, old, previous)
+		_, err = store.Rotate("signing", []byte("wrong"))
+		assert.ErrorIs(t, err, ErrPassphrase)
+	})
+
+	t.Run("导出", func(t *testing.T) {
+		exported, err := store.Export("signing", passphrase, pcrypto.FormatPKCS8, []byte("export"))
+		require.NoError(t, err)
+		imported, err := pcrypto.ImportPrivateKey(exported, []byte("export"))
+		require.NoError(t, err)
+		current, err := store.Get("signing", passphrase)
+		require.NoError(t, err)
+		assert.Equal(t, current, imported)
+
+		exported, err = store.ExportPublicKey("signing", pcrypto.FormatPKIX)
+		require.NoError(t, err)
+		_, err = pcrypto.ImportPublicKey(exported)
+		require.NoError(t, err)
+	})
+
+	t.Run("删除", func(t *testing.T) {
+		require.NoError(t, store.Delete("signing"))
+		assert.Empty(t, store.List())
+		assert.ErrorIs(t, store.Delete("signing"), ErrNotFound)
+
+		reopened, err := Open(path, nil)
+		require.NoError(t, err)
+		assert.Empty(t, reopened.List())
+	})
+}
+
+func TestStoreKeyTypes(t *testing.T) {
+	store, err := Open(filepath.Join(t.TempDir(), "keys.json"), fastOptions)
+	require.NoError(t, err)
+	passphrase := []byte("correct horse")
+
+	t.Run("轮换保持 RSA 模数长度", func(t *testing.T) {
+		privateKey, _, err := pcrypto.GenerateKeyPair(3072)
+		require.NoError(t, err)
+		_, err = store.Add("rsa", privateKey, passphrase)
+		require.NoError(t, err)
+		_, err = store.Rotate("rsa", passphrase)
+		require.NoError(t, err)
+
+		rotated, err := store.Get("rsa", passphrase)
+		require.NoError(t, err)
+		assert.Equal(t, 3072, rotated.(*rsa.PrivateKey).N.BitLen())
+		assert.False(t, privateKey.Equal(rotated))
+	})
+
+	t.Run("不支持的密钥类型", func(t *testing.T) {
+		privateKey, err := ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+		require.NoError(t, err)
+		_, err = store.Add("p521", privateKey, passphrase)
+		assert.ErrorIs(t, err, pcrypto.ErrKeyType)
+		assert.Len(t, store.List(), 2)
+	})
+}
+
+func TestSession(t *testing.T) {
+	passphrase := []byte("correct horse")
+	store, err := Open(filepath.Join(t.TempDir(), "keys.json"), fastOptions)
+	require.NoError(t, err)
+	_, err = store.Generate("signing", pcrypto.KeyECDSAP256, passphrase)
+	require.NoError(t, err)
+
+	t.Run("超时", func(t *testing.T) {
+		session, err := store.Unlock("signing", passphrase, 50*time.Millisecond)
+		require.NoError(t, err)
+		signer, err := session.Signer()
+		require.NoError(t, err)
+		sig, err := pcrypto.Sign(signer, []byte("data"))
+		require.NoError(t, err)
+		require.NoError(t, pcrypto.Verify(signer.Public(), []byte("data"), sig))
+
+		assert.Eventually(t, func() bool {
+			_, err := session.Key()
+			return err != nil
+		}, time.Second, 10*time.Millisecond)
+		_, err = session.Key()
+		assert.ErrorIs(t, err, ErrLocked)
+	})
+
+	t.Run("手动锁定", func(t *testing.T) {
+		session, err := store.Unlock("signing", passphrase, 0)
+		require.NoError(t, err)
+		assert.Equal(t, "signing", session.Metadata().Name)
+		session.Lock()
+		session.Lock()
+		_, err = session.Key()
+		assert.ErrorIs(t, err, ErrLocked)
+	})
+
+	t.Run("错误的密码", func(t *testing.T) {
+		_, err := store.Unlock("signing", []byte("wrong"), time.Minute)
+		assert.ErrorIs(t, err, ErrPassphrase)
+	})
+}
@@ -0,0 +1,489 @@
+package legacy
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	paes "github.com/w-devin/poketto/crypto/aes"
+)
+
+var (
+	// ErrKeySize 密钥长度不适用于算法
+	ErrKeySize = paes.ErrKeySize
+	// ErrPadding 填充无效
+	ErrPadding = paes.ErrPadding
+	// ErrCiphertext 密文长度无效
+	ErrCiphertext = paes.ErrCiphertext
+	// ErrNoMatch 没有任何一种方案解密出有效的明文
+	ErrNoMatch = errors.New("no cipher spec produced a valid plaintext")
+)
+
+// Algorithm 分组密码算法
+type Algorithm int
+
+const (
+	AES Algorithm = iota
+	DES
+	TripleDES
+	SM4
+)
+
+func (a Algorithm) String() string {
+	switch a {
+	case AES:
+		return "AES"
+	case DES:
+		return "DES"
+	case TripleDES:
+		return "3DES"
+	case SM4:
+		return "SM4"
+	default:
+		return fmt.Sprintf("Algorithm(%d)", int(a))
+	}
+}
+
+// Mode 分组模式
+type Mode int
+
+const (
+	ECB Mode = iota
+	CBC
+	// CFB 是分组长度的 CFB, 例如 AES 的 CFB128
+	CFB
+)
+
+func (m Mode) String() string {
+	switch m {
+	case ECB:
+		return "ECB"
+	case CBC:
+		return "CBC"
+	case CFB:
+		return "CFB"
+	default:
+		return fmt.Sprintf("Mode(%d)", int(m))
+	}
+}
+
+// Padding 填充方式
+type Padding int
+
+const (
+	PKCS7 Padding = iota
+	// ZeroPadding 用 0 补齐到分组长度, 已对齐时不补, 解密时去掉末尾所有的 0
+	ZeroPadding
+	// ISO10126 用随机字节补齐, 最后一个字节是填充长度
+	ISO10126
+	// NoPadding 不填充, ECB 和 CBC 的数据必须已经对齐
+	NoPadding
+)
+
+func (p Padding) String() string {
+	switch p {
+	case PKCS7:
+		return "PKCS7"
+	case ZeroPadding:
+		return "Zero"
+	case ISO10126:
+		return "ISO10126"
+	case NoPadding:
+		return "None"
+	default:
+		return fmt.Sprintf("Padding(%d)", int(p))
+	}
+}
+
+// KDF 从输入的密钥得到算法密钥的方式
+type KDF int
+
+const (
+	// KeyRaw 直接使用密钥, 超长截断, 不足补 0
+	KeyRaw KDF = iota
+	// KeyMD5 使用 MD5(key) 的 16 字节
+	KeyMD5
+	// KeyMD5Hex 使用 MD5(key) 的 32 个小写十六进制字符
+	KeyMD5Hex
+	// KeySHA256 使用 SHA-256(key) 的 32 字节
+	KeySHA256
+	// KeyEVP 使用 OpenSSL 的 EVP_BytesToKey 同时派生密钥和 IV
+	KeyEVP
+)
+
+func (k KDF) String() string {
+	switch k {
+	case KeyRaw:
+		return "raw"
+	case KeyMD5:
+		return "md5"
+	case KeyMD5Hex:
+		return "md5hex"
+	case KeySHA256:
+		return "sha256"
+	case KeyEVP:
+		return "evp"
+	default:
+		return fmt.Sprintf("KDF(%d)", int(k))
+	}
+}
+
+// opensslMagic 是 openssl enc 输出带盐时的前缀
+var opensslMagic = []byte("Salted__")
+
+// Spec 描述一种加密方案
+type Spec struct {
+	Algorithm Algorithm
+	Mode      Mode
+	Padding   Padding
+	KDF       KDF
+	// KeySize 是算法密钥的字节数, 为 0 时 AES 按 KDF 选择(raw 按密钥长度向上取 16/24/32),
+	// DES 为 8, 3DES 为 24, SM4 为 16. 16 字节的 3DES 密钥按 K1 K2 K1 扩展
+	KeySize int
+	// IV 是 CBC 和 CFB 的初始向量, 为空时依次使用 IVPrefix, EVP 派生的 IV, 全 0 的 IV
+	IV []byte
+	// IVPrefix 表示 IV 位于密文前面
+	IVPrefix bool
+	// Salt 是 EVP_BytesToKey 的 8 字节盐, 为空时解密读取 "Salted__" 前缀中的盐, 加密生成随机盐
+	Salt []byte
+	// Digest 是 EVP_BytesToKey 使用的哈希, 默认 MD5(OpenSSL 1.1 之前的默认值)
+	Digest crypto.Hash
+}
+
+func (s Spec) String() string {
+	name := fmt.Sprintf("%s-%d-%s/%s/%s", s.Algorithm, s.keySize(nil)*8, s.Mode, s.Padding, s.KDF)
+	if s.IVPrefix {
+		name += "/iv-prefix"
+	}
+	return name
+}
+
+// keySize 返回算法密钥的长度, raw 的 AES 密钥长度取决于 key
+func (s Spec) keySize(key []byte) int {
+	if s.KeySize > 0 {
+		return s.KeySize
+	}
+	switch s.Algorithm {
+	case DES:
+		return 8
+	case TripleDES:
+		return 24
+	case SM4:
+		return 16
+	}
+	switch s.KDF {
+	case KeyMD5:
+		return 16
+	case KeyRaw:
+		switch {
+		case len(key) <= 16:
+			return 16
+		case len(key) <= 24:
+			return 24
+		}
+	}
+	return 32
+}
+
+func (s Spec) blockSize() int {
+	switch s.Algorithm {
+	case DES, TripleDES:
+		return des.BlockSize
+	default:
+		return aes.BlockSize
+	}
+}
+
+// deriveKey 返回算法密钥和 EVP 派生的 IV
+func (s Spec) deriveKey(key, salt []byte) ([]byte, []byte) {
+	size := s.keySize(key)
+	var derived []byte
+	switch s.KDF {
+	case KeyMD5:
+		sum := md5.Sum(key)
+		derived = sum[:]
+	case KeyMD5Hex:
+		sum := md5.Sum(key)
+		derived = []byte(hex.EncodeToString(sum[:]))
+	case KeySHA256:
+		sum := sha256.Sum256(key)
+		derived = sum[:]
+	case KeyEVP:
+		digest := s.Digest
+		if digest == 0 {
+			digest = crypto.MD5
+		}
+		material := EVPBytesToKey(digest, key, salt, size+s.blockSize())
+		return material[:size], material[size:]
+	default:
+		derived = key
+	}
+	if s.Algorithm == TripleDES && size == 24 && len(derived) == 16 {
+		return append(append([]byte(nil), derived...), derived[:8]...), nil
+	}
+	fitted := make([]byte, size)
+	copy(fitted, derived)
+	return fitted, nil
+}
+
+// EVPBytesToKey 是 OpenSSL 的 EVP_BytesToKey, 迭代次数为 1, 返回 n 字节的密钥和 IV
+func EVPBytesToKey(digest crypto.Hash, password, salt []byte, n int) []byte {
+	var material, prev []byte
+	for len(material) < n {
+		h := digest.New()
+		h.Write(prev)
+		h.Write(password)
+		h.Write(salt)
+		prev = h.Sum(nil)
+		material = append(material, prev...)
+	}
+	return material[:n]
+}
+
+func (s Spec) newBlock(key []byte) (cipher.Block, error) {
+	switch s.Algorithm {
+	case AES:
+		switch len(key) {
+		case 16, 24, 32:
+			return aes.NewCipher(key)
+		}
+	case DES:
+		if len(key) == 8 {
+			return des.NewCipher(key)
+		}
+	case TripleDES:
+		if len(key) == 24 {
+			return des.NewTripleDESCipher(key)
+		}
+	case SM4:
+		return NewSM4Cipher(key)
+	default:
+		return nil, fmt.Errorf("unsupported algorithm %v", s.Algorithm)
+	}
+	return nil, fmt.Errorf("%w: %v with %d bytes", ErrKeySize, s.Algorithm, len(key))
+}
+
+func (s Spec) pad(data []byte, blockSize int) ([]byte, error) {
+	switch s.Padding {
+	case PKCS7:
+		return paes.PKCS7Pad(data, blockSize), nil
+	case ZeroPadding:
+		if len(data)%blockSize == 0 {
+			return append([]byte(nil), data...), nil
+		}
+		padded := make([]byte, len(data)+blockSize-len(data)%blockSize)
+		copy(padded, data)
+		return padded, nil
+	case ISO10126:
+		pad := blockSize - len(data)%blockSize
+		padded := make([]byte, len(data)+pad)
+		copy(padded, data)
+		if _, err := rand.Read(padded[len(data) : len(padded)-1]); err != nil {
+			return nil, err
+		}
+		padded[len(padded)-1] = byte(pad)
+		return padded, nil
+	default:
+		if s.Mode != CFB && len(data)%blockSize != 0 {
+			return nil, fmt.Errorf("%w: %d bytes without padding", ErrCiphertext, len(data))
+		}
+		return append([]byte(nil), data...), nil
+	}
+}
+
+func (s Spec) unpad(data []byte, blockSize int) ([]byte, error) {
+	switch s.Padding {
+	case PKCS7:
+		return paes.PKCS7Unpad(data, blockSize)
+	case ZeroPadding:
+		return bytes.TrimRight(data, "\x00"), nil
+	case ISO10126:
+		if len(data) == 0 || len(data)%blockSize != 0 {
+			return nil, ErrPadding
+		}
+		pad := int(data[len(data)-1])
+		if pad == 0 || pad > blockSize {
+			return nil, ErrPadding
+		}
+		return data[:len(data)-pad], nil
+	default:
+		return data, nil
+	}
+}
+
+// iv 返回 CBC 和 CFB 的 IV 以及去掉 IV 前缀后的数据
+func (s Spec) iv(derived, data []byte, blockSize int) ([]byte, []byte, error) {
+	switch {
+	case s.Mode == ECB:
+		return nil, data, nil
+	case s.IV != nil:
+		if len(s.IV) != blockSize {
+			return nil, nil, fmt.Errorf("IV of %d bytes for a block size of %d", len(s.IV), blockSize)
+		}
+		return s.IV, data, nil
+	case s.IVPrefix:
+		if len(data) < blockSize {
+			return nil, nil, ErrCiphertext
+		}
+		return data[:blockSize], data[blockSize:], nil
+	case derived != nil:
+		return derived, data, nil
+	default:
+		return make([]byte, blockSize), data, nil
+	}
+}
+
+// Decrypt 按 spec 解密 data
+func Decrypt(spec Spec, key, data []byte) ([]byte, error) {
+	salt := spec.Salt
+	if spec.KDF == KeyEVP && salt == nil && bytes.HasPrefix(data, opensslMagic) {
+		if len(data) < len(opensslMagic)+8 {
+			return nil, ErrCiphertext
+		}
+		salt = data[len(opensslMagic) : len(opensslMagic)+8]
+		data = data[len(opensslMagic)+8:]
+	}
+	algorithmKey, derivedIV := spec.deriveKey(key, salt)
+	block, err := spec.newBlock(algorithmKey)
+	if err != nil {
+		return nil, err
+	}
+	blockSize := block.BlockSize()
+	iv, data, err := spec.iv(derivedIV, data, blockSize)
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext := make([]byte, len(data))
+	switch spec.Mode {
+	case ECB, CBC:
+		if len(data) == 0 || len(data)%blockSize != 0 {
+			return nil, ErrCiphertext
+		}
+		if spec.Mode == CBC {
+			cipher.NewCBCDecrypter(block, iv).CryptBlocks(plaintext, data)
+			break
+		}
+		for bs := 0; bs < len(data); bs += blockSize {
+			block.Decrypt(plaintext[bs:bs+blockSize], data[bs:bs+blockSize])
+		}
+	case CFB:
+		cipher.NewCFBDecrypter(block, iv).XORKeyStream(plaintext, data)
+	default:
+		return nil, fmt.Errorf("unsupported mode %v", spec.Mode)
+	}
+	return spec.unpad(plaintext, blockSize)
+}
+
+// Encrypt 按 spec 加密 data, 和 Decrypt 互逆. EVP 没有指定盐时输出 openssl enc 的 "Salted__" 格式,
+// IVPrefix 时生成随机 IV 放在密文前面
+func Encrypt(spec Spec, key, data []byte) ([]byte, error) {
+	var prefix []byte
+	salt := spec.Salt
+	if spec.KDF == KeyEVP && salt == nil {
+		salt = make([]byte, 8)
+		if _, err := rand.Read(salt); err != nil {
+			return nil, err
+		}
+		prefix = append(append(prefix, opensslMagic...), salt...)
+	}
+	algorithmKey, derivedIV := spec.deriveKey(key, salt)
+	block, err := spec.newBlock(algorithmKey)
+	if err != nil {
+		return nil, err
+	}
+	blockSize := block.BlockSize()
+
+	iv := derivedIV
+	switch {
+	case spec.Mode == ECB:
+	case spec.IV != nil:
+		if len(spec.IV) != blockSize {
+			return nil, fmt.Errorf("IV of %d bytes for a block size of %d", len(spec.IV), blockSize)
+		}
+		iv = spec.IV
+	case spec.IVPrefix:
+		iv = make([]byte, blockSize)
+		if _, err = rand.Read(iv); err != nil {
+			return nil, err
+		}
+		prefix = append(prefix, iv...)
+	case iv == nil:
+		iv = make([]byte, blockSize)
+	}
+
+	plaintext, err := spec.pad(data, blockSize)
+	if err != nil {
+		return nil, err
+	}
+	ciphertext := make([]byte, len(plaintext))
+	switch spec.Mode {
+	case ECB:
+		for bs := 0; bs < len(plaintext); bs += blockSize {
+			block.Encrypt(ciphertext[bs:bs+blockSize], plaintext[bs:bs+blockSize])
+		}
+	case CBC:
+		cipher.NewCBCEncrypter(block, iv).CryptBlocks(ciphertext, plaintext)
+	case CFB:
+		cipher.NewCFBEncrypter(block, iv).XORKeyStream(ciphertext, plaintext)
+	default:
+		return nil, fmt.Errorf("unsupported mode %v", spec.Mode)
+	}
+	return append(prefix, ciphertext...), nil
+}
+
+// TryDecrypt 依次用 specs 解密 data, 返回第一个被 valid 接受的明文和对应的方案
+func TryDecrypt(specs []Spec, key, data []byte, valid func([]byte) bool) ([]byte, Spec, error) {
+	for _, spec := range specs {
+		plaintext, err := Decrypt(spec, key, data)
+		if err == nil && valid(plaintext) {
+			return plaintext, spec, nil
+		}
+	}
+	return nil, Spec{}, ErrNoMatch
+}
+
+// Specs 返回各个选项的所有组合, 可以交给 TryDecrypt
+func Specs(algorithms []Algorithm, modes []Mode, paddings []Padding, kdfs []KDF) []Spec {
+	var specs []Spec
+	for _, algorithm := range algorithms {
+		for _, mode := range modes {
+			for _, padding := range paddings {
+				for _, kdf := range kdfs {
+					specs = append(specs, Spec{Algorithm: algorithm, Mode: mode, Padding: padding, KDF: kdf})
+				}
+			}
+		}
+	}
+	return specs
+}
+
+// IsPrintable 判断明文是否为可打印的 UTF-8 文本, 可作为 TryDecrypt 的校验函数
+func IsPrintable(b []byte) bool {
+	if len(b) == 0 || !utf8.Valid(b) {
+		return false
+	}
+	for _, r := range string(b) {
+		if !unicode.IsPrint(r) && !strings.ContainsRune("\t\r\n", r) {
+			return false
+		}
+	}
+	return true
+}
+
+// IsJSON 判断明文是否为 JSON, 可作为 TryDecrypt 的校验函数
+func IsJSON(b []byte) bool {
+	return json.Valid(b)
+}
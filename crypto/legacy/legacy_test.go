@@ -0,0 +1,154 @@
+package legacy
+
+import (
+	"crypto"
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func mustHex(t *testing.T, s string) []byte {
+	b, err := hex.DecodeString(s)
+	require.NoError(t, err)
+	return b
+}
+
+func TestDecrypt(t *testing.T) {
+	plaintext := []byte("hello legacy world")
+
+	// 密文由 openssl enc 生成
+	cases := []struct {
+		name       string
+		spec       Spec
+		key        []byte
+		ciphertext string
+	}{
+		{
+			name:       "openssl AES-256-CBC EVP MD5",
+			spec:       Spec{Algorithm: AES, Mode: CBC, KDF: KeyEVP},
+			key:        []byte("secret"),
+			ciphertext: hex.EncodeToString([]byte("Salted__")) + "0102030405060708" + "42cd8a64d51d60e9c1aa0ee01afd975ce15f671a0c9bcada346137c502a13f05",
+		},
+		{
+			name:       "openssl AES-128-CBC EVP SHA-256 指定盐",
+			spec:       Spec{Algorithm: AES, Mode: CBC, KDF: KeyEVP, KeySize: 16, Digest: crypto.SHA256, Salt: []byte{1, 2, 3, 4, 5, 6, 7, 8}},
+			key:        []byte("secret"),
+			ciphertext: "4d6ce76456332ec601972cfc3be00e2329ba428e26728ff3424f2eb2a85bc39b",
+		},
+		{
+			name:       "3DES-CBC 全 0 IV",
+			spec:       Spec{Algorithm: TripleDES, Mode: CBC},
+			key:        mustHex(t, "000102030405060708090a0b0c0d0e0f1011121314151617"),
+			ciphertext: "5612de51c66759c7ee882ce07cfbba0d22491ff29640b1c9",
+		},
+		{
+			name:       "DES-ECB",
+			spec:       Spec{Algorithm: DES, Mode: ECB},
+			key:        []byte("12345678"),
+			ciphertext: "44b5f28ddd31cfd760d8cee551e1175fa1d16893aa19126e",
+		},
+		{
+			name:       "SM4-CBC",
+			spec:       Spec{Algorithm: SM4, Mode: CBC, IV: mustHex(t, "000102030405060708090a0b0c0d0e0f")},
+			key:        mustHex(t, "0123456789abcdeffedcba9876543210"),
+			ciphertext: "d7e0c846e62d35ce85d61bf418e5d4d23f6daeaf490b2c3527f95952cc648aff",
+		},
+		{
+			name:       "AES-128-CFB MD5 密钥",
+			spec:       Spec{Algorithm: AES, Mode: CFB, Padding: NoPadding, KDF: KeyMD5, IV: mustHex(t, "000102030405060708090a0b0c0d0e0f")},
+			key:        []byte("key"),
+			ciphertext: "22be0a53b9f427811b5191767d1a2b7b45e5",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			decrypted, err := Decrypt(c.spec, c.key, mustHex(t, c.ciphertext))
+			require.NoError(t, err)
+			assert.Equal(t, plaintext, decrypted)
+		})
+	}
+
+	t.Run("错误的密钥", func(t *testing.T) {
+		_, err := Decrypt(Spec{Algorithm: DES, Mode: ECB}, []byte("87654321"), mustHex(t, "44b5f28ddd31cfd760d8cee551e1175fa1d16893aa19126e"))
+		assert.ErrorIs(t, err, ErrPadding)
+	})
+
+	t.Run("密文长度无效", func(t *testing.T) {
+		_, err := Decrypt(Spec{Algorithm: AES, Mode: CBC}, []byte("key"), []byte("short"))
+		assert.ErrorIs(t, err, ErrCiphertext)
+	})
+
+	t.Run("密钥长度无效", func(t *testing.T) {
+		_, err := Decrypt(Spec{Algorithm: AES, Mode: ECB, KeySize: 20}, []byte("key"), make([]byte, 16))
+		assert.ErrorIs(t, err, ErrKeySize)
+	})
+}
+
+func TestEncrypt(t *testing.T) {
+	plaintexts := [][]byte{nil, []byte("16 bytes exactly"), []byte("not aligned to the block size")}
+	specs := Specs([]Algorithm{AES, DES, TripleDES, SM4}, []Mode{ECB, CBC, CFB}, []Padding{PKCS7, ISO10126}, []KDF{KeyRaw, KeyMD5, KeyMD5Hex, KeySHA256, KeyEVP})
+	specs = append(specs, Spec{Algorithm: AES, Mode: CBC, IVPrefix: true}, Spec{Algorithm: SM4, Mode: CFB, Padding: NoPadding})
+	for _, spec := range specs {
+		t.Run(spec.String(), func(t *testing.T) {
+			for _, plaintext := range plaintexts {
+				ciphertext, err := Encrypt(spec, []byte("password"), plaintext)
+				require.NoError(t, err)
+				decrypted, err := Decrypt(spec, []byte("password"), ciphertext)
+				require.NoError(t, err)
+				assert.Equal(t, string(plaintext), string(decrypted))
+			}
+		})
+	}
+
+	t.Run("零填充", func(t *testing.T) {
+		spec := Spec{Algorithm: AES, Mode: CBC, Padding: ZeroPadding}
+		ciphertext, err := Encrypt(spec, []byte("key"), []byte("abc"))
+		require.NoError(t, err)
+		assert.Len(t, ciphertext, 16)
+		decrypted, err := Decrypt(spec, []byte("key"), ciphertext)
+		require.NoError(t, err)
+		assert.Equal(t, []byte("abc"), decrypted)
+	})
+
+	t.Run("不填充要求对齐", func(t *testing.T) {
+		_, err := Encrypt(Spec{Algorithm: AES, Mode: ECB, Padding: NoPadding}, []byte("key"), []byte("abc"))
+		assert.ErrorIs(t, err, ErrCiphertext)
+	})
+
+	t.Run("16 字节的 3DES 密钥", func(t *testing.T) {
+		key := mustHex(t, "0123456789abcdeffedcba9876543210")
+		ciphertext, err := Encrypt(Spec{Algorithm: TripleDES, Mode: ECB}, key, []byte("abc"))
+		require.NoError(t, err)
+		expanded := append(append([]byte(nil), key...), key[:8]...)
+		decrypted, err := Decrypt(Spec{Algorithm: TripleDES, Mode: ECB}, expanded, ciphertext)
+		require.NoError(t, err)
+		assert.Equal(t, []byte("abc"), decrypted)
+	})
+}
+
+func TestTryDecrypt(t *testing.T) {
+	spec := Spec{Algorithm: SM4, Mode: CBC, KDF: KeySHA256, KeySize: 16, IVPrefix: true}
+	ciphertext, err := Encrypt(spec, []byte("password"), []byte(`{"user":"jarvis"}`))
+	require.NoError(t, err)
+
+	specs := Specs([]Algorithm{AES, DES, TripleDES}, []Mode{ECB, CBC}, []Padding{PKCS7, ZeroPadding}, []KDF{KeyRaw, KeyMD5})
+	specs = append(specs, spec)
+	plaintext, found, err := TryDecrypt(specs, []byte("password"), ciphertext, IsJSON)
+	require.NoError(t, err)
+	assert.Equal(t, `{"user":"jarvis"}`, string(plaintext))
+	assert.Equal(t, spec.String(), found.String())
+
+	_, _, err = TryDecrypt(specs[:len(specs)-1], []byte("password"), ciphertext, IsJSON)
+	assert.ErrorIs(t, err, ErrNoMatch)
+}
+
+func TestPredicates(t *testing.T) {
+	assert.True(t, IsPrintable([]byte("line 1\r\n\tline 2 中文")))
+	assert.False(t, IsPrintable([]byte("abc\x00")))
+	assert.False(t, IsPrintable([]byte{0xff, 0xfe}))
+	assert.False(t, IsPrintable(nil))
+	assert.True(t, IsJSON([]byte(`[1, 2]`)))
+	assert.False(t, IsJSON([]byte(`{"a":`)))
+}
@@ -0,0 +1,39 @@
+package legacy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSM4(t *testing.T) {
+	// GB/T 32907-2016 附录 A 的示例
+	key := mustHex(t, "0123456789abcdeffedcba9876543210")
+	block, err := NewSM4Cipher(key)
+	require.NoError(t, err)
+
+	t.Run("一次加密", func(t *testing.T) {
+		dst := make([]byte, SM4BlockSize)
+		block.Encrypt(dst, key)
+		assert.Equal(t, mustHex(t, "681edf34d206965e86b3e94f536e4246"), dst)
+		block.Decrypt(dst, dst)
+		assert.Equal(t, key, dst)
+	})
+
+	t.Run("一百万次加密", func(t *testing.T) {
+		if testing.Short() {
+			t.Skip()
+		}
+		dst := append([]byte(nil), key...)
+		for i := 0; i < 1000000; i++ {
+			block.Encrypt(dst, dst)
+		}
+		assert.Equal(t, mustHex(t, "595298c7c6fd271f0402f804c33d3f66"), dst)
+	})
+
+	t.Run("密钥长度无效", func(t *testing.T) {
+		_, err := NewSM4Cipher(key[:8])
+		assert.ErrorIs(t, err, ErrKeySize)
+	})
+}
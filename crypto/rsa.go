@@ -1,12 +1,12 @@
 package crypto
 
 import (
-	"crypto"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
 	"encoding/pem"
 	"errors"
+	"fmt"
 )
 
 // GenerateKeyPair 生成RSA密钥对
@@ -38,46 +38,46 @@ func ExportPublicKeyToPEM(publicKey *rsa.PublicKey) string {
 	return string(publicKeyPEM)
 }
 
-// ImportPrivateKeyFromPEM 从PEM格式导入私钥
+// ImportPrivateKeyFromPEM 从PEM格式导入私钥, 支持 PKCS#1 和 PKCS#8, 其他格式见 ImportPrivateKey
 func ImportPrivateKeyFromPEM(privateKeyPEM string) (*rsa.PrivateKey, error) {
 	block, _ := pem.Decode([]byte(privateKeyPEM))
 	if block == nil {
 		return nil, errors.New("failed to parse PEM block containing the private key")
 	}
-	return x509.ParsePKCS1PrivateKey(block.Bytes)
+	key, err := ImportPrivateKey(pem.EncodeToMemory(block), nil)
+	if err != nil {
+		return nil, err
+	}
+	privateKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%w: %T is not an RSA private key", ErrKeyType, key)
+	}
+	return privateKey, nil
 }
 
-// ImportPublicKeyFromPEM 从PEM格式导入公钥
+// ImportPublicKeyFromPEM 从PEM格式导入公钥, 支持 PKCS#1 和 PKIX("PUBLIC KEY"), 其他格式见 ImportPublicKey
 func ImportPublicKeyFromPEM(publicKeyPEM string) (*rsa.PublicKey, error) {
 	block, _ := pem.Decode([]byte(publicKeyPEM))
 	if block == nil {
 		return nil, errors.New("failed to parse PEM block containing the public key")
 	}
-	return x509.ParsePKCS1PublicKey(block.Bytes)
+	key, err := ImportPublicKey(pem.EncodeToMemory(block))
+	if err != nil {
+		return nil, err
+	}
+	publicKey, ok := key.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("%w: %T is not an RSA public key", ErrKeyType, key)
+	}
+	return publicKey, nil
 }
 
-// Encrypt 使用公钥加密数据
+// Encrypt 使用公钥加密数据, 使用 PKCS#1 v1.5, 其他方案见 EncryptWithOptions
 func Encrypt(publicKey *rsa.PublicKey, data []byte) ([]byte, error) {
-	return rsa.EncryptPKCS1v15(rand.Reader, publicKey, data)
+	return EncryptWithOptions(publicKey, data, nil)
 }
 
-// Decrypt 使用私钥解密数据
+// Decrypt 使用私钥解密数据, 使用 PKCS#1 v1.5, 其他方案见 DecryptWithOptions
 func Decrypt(privateKey *rsa.PrivateKey, data []byte) ([]byte, error) {
-	return rsa.DecryptPKCS1v15(rand.Reader, privateKey, data)
-}
-
-// Sign 使用私钥对数据进行签名
-func Sign(privateKey *rsa.PrivateKey, data []byte) ([]byte, error) {
-	hash := crypto.SHA256.New()
-	hash.Write(data)
-	hashed := hash.Sum(nil)
-	return rsa.SignPKCS1v15(rand.Reader, privateKey, crypto.SHA256, hashed)
-}
-
-// Verify 使用公钥验证签名
-func Verify(publicKey *rsa.PublicKey, data []byte, signature []byte) error {
-	hash := crypto.SHA256.New()
-	hash.Write(data)
-	hashed := hash.Sum(nil)
-	return rsa.VerifyPKCS1v15(publicKey, crypto.SHA256, hashed, signature)
+	return DecryptWithOptions(privateKey, data, nil)
 }
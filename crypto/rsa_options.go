@@ -0,0 +1,206 @@
+package crypto
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+)
+
+// Scheme 是 RSA 的填充方案
+type Scheme int
+
+const (
+	// SchemePKCS1v15 是 PKCS#1 v1.5 加密或签名, Encrypt 和 Sign 默认使用
+	SchemePKCS1v15 Scheme = iota
+	// SchemeOAEP 是 RSA-OAEP 加密
+	SchemeOAEP
+	// SchemePSS 是 RSA-PSS 签名
+	SchemePSS
+)
+
+func (s Scheme) String() string {
+	switch s {
+	case SchemePKCS1v15:
+		return "PKCS1v15"
+	case SchemeOAEP:
+		return "OAEP"
+	case SchemePSS:
+		return "PSS"
+	default:
+		return fmt.Sprintf("Scheme(%d)", int(s))
+	}
+}
+
+// ErrScheme 方案不能用于这种操作
+var ErrScheme = errors.New("unsupported RSA scheme")
+
+// signatureHashes 是签名和 OAEP 可选的哈希
+var signatureHashes = []crypto.Hash{crypto.SHA256, crypto.SHA384, crypto.SHA512}
+
+func checkHash(hash crypto.Hash) (crypto.Hash, error) {
+	if hash == 0 {
+		return crypto.SHA256, nil
+	}
+	for _, h := range signatureHashes {
+		if h == hash {
+			return hash, nil
+		}
+	}
+	return 0, fmt.Errorf("unsupported hash %v, use SHA-256, SHA-384 or SHA-512", hash)
+}
+
+// EncryptOptions 控制 EncryptWithOptions 和 DecryptWithOptions
+type EncryptOptions struct {
+	// Scheme 是 SchemePKCS1v15 或 SchemeOAEP
+	Scheme Scheme
+	// Hash 是 OAEP 的哈希, 默认 SHA-256
+	Hash crypto.Hash
+	// Label 是 OAEP 的标签, 解密时必须相同
+	Label []byte
+}
+
+// EncryptWithOptions 使用公钥按 opts 加密数据, opts 为 nil 时和 Encrypt 相同
+func EncryptWithOptions(publicKey *rsa.PublicKey, data []byte, opts *EncryptOptions) ([]byte, error) {
+	if opts == nil {
+		opts = &EncryptOptions{}
+	}
+	switch opts.Scheme {
+	case SchemePKCS1v15:
+		return rsa.EncryptPKCS1v15(rand.Reader, publicKey, data)
+	case SchemeOAEP:
+		hash, err := checkHash(opts.Hash)
+		if err != nil {
+			return nil, err
+		}
+		return rsa.EncryptOAEP(hash.New(), rand.Reader, publicKey, data, opts.Label)
+	default:
+		return nil, fmt.Errorf("%w: %v for encryption", ErrScheme, opts.Scheme)
+	}
+}
+
+// DecryptWithOptions 使用私钥按 opts 解密数据, opts 为 nil 时和 Decrypt 相同
+func DecryptWithOptions(privateKey *rsa.PrivateKey, data []byte, opts *EncryptOptions) ([]byte, error) {
+	if opts == nil {
+		opts = &EncryptOptions{}
+	}
+	switch opts.Scheme {
+	case SchemePKCS1v15:
+		return rsa.DecryptPKCS1v15(rand.Reader, privateKey, data)
+	case SchemeOAEP:
+		hash, err := checkHash(opts.Hash)
+		if err != nil {
+			return nil, err
+		}
+		return rsa.DecryptOAEP(hash.New(), rand.Reader, privateKey, data, opts.Label)
+	default:
+		return nil, fmt.Errorf("%w: %v for decryption", ErrScheme, opts.Scheme)
+	}
+}
+
+// SignOptions 控制 SignWithOptions 和 VerifyWithOptions
+type SignOptions struct {
+	// Scheme 是 SchemePKCS1v15 或 SchemePSS
+	Scheme Scheme
+	// Hash 是 SHA-256, SHA-384 或 SHA-512, 默认 SHA-256
+	Hash crypto.Hash
+	// SaltLength 是 PSS 的盐长度, 也可以是 rsa.PSSSaltLengthEqualsHash. 为 0 时签名使用哈希长度的盐,
+	// 验证接受任意长度的盐
+	SaltLength int
+	// Fallback 使验证在指定的方案失败后, 再尝试其他方案和哈希的组合
+	Fallback bool
+}
+
+func (o *SignOptions) signSaltLength() int {
+	if o.SaltLength == 0 {
+		return rsa.PSSSaltLengthEqualsHash
+	}
+	return o.SaltLength
+}
+
+// SignWithOptions 使用私钥按 opts 对数据进行签名, opts 为 nil 时和 Sign 相同
+func SignWithOptions(privateKey *rsa.PrivateKey, data []byte, opts *SignOptions) ([]byte, error) {
+	if opts == nil {
+		opts = &SignOptions{}
+	}
+	hash, err := checkHash(opts.Hash)
+	if err != nil {
+		return nil, err
+	}
+	h := hash.New()
+	h.Write(data)
+	hashed := h.Sum(nil)
+
+	switch opts.Scheme {
+	case SchemePKCS1v15:
+		return rsa.SignPKCS1v15(rand.Reader, privateKey, hash, hashed)
+	case SchemePSS:
+		return rsa.SignPSS(rand.Reader, privateKey, hash, hashed, &rsa.PSSOptions{SaltLength: opts.signSaltLength()})
+	default:
+		return nil, fmt.Errorf("%w: %v for signing", ErrScheme, opts.Scheme)
+	}
+}
+
+// VerifyWithOptions 使用公钥按 opts 验证签名, opts 为 nil 时和 Verify 相同.
+// 设置了 Fallback 时依次尝试 PKCS#1 v1.5 和 PSS(任意盐长度) 与各个哈希的组合
+func VerifyWithOptions(publicKey *rsa.PublicKey, data []byte, signature []byte, opts *SignOptions) error {
+	_, err := verifyWithOptions(publicKey, data, signature, opts)
+	return err
+}
+
+// VerifyAny 尝试所有方案和哈希验证签名, 返回验证通过的组合
+func VerifyAny(publicKey *rsa.PublicKey, data []byte, signature []byte) (*SignOptions, error) {
+	return verifyWithOptions(publicKey, data, signature, &SignOptions{Fallback: true})
+}
+
+func verifyWithOptions(publicKey *rsa.PublicKey, data []byte, signature []byte, opts *SignOptions) (*SignOptions, error) {
+	if opts == nil {
+		opts = &SignOptions{}
+	}
+	hash, err := checkHash(opts.Hash)
+	if err != nil {
+		return nil, err
+	}
+	first := SignOptions{Scheme: opts.Scheme, Hash: hash, SaltLength: opts.SaltLength}
+	err = verifyOnce(publicKey, data, signature, &first)
+	if err == nil || !opts.Fallback {
+		return &first, err
+	}
+
+	hashed := map[crypto.Hash][]byte{}
+	for _, scheme := range []Scheme{SchemePKCS1v15, SchemePSS} {
+		for _, hash := range signatureHashes {
+			candidate := SignOptions{Scheme: scheme, Hash: hash}
+			if candidate == first {
+				continue
+			}
+			if hashed[hash] == nil {
+				h := hash.New()
+				h.Write(data)
+				hashed[hash] = h.Sum(nil)
+			}
+			if verifyHashed(publicKey, hashed[hash], signature, &candidate) == nil {
+				return &candidate, nil
+			}
+		}
+	}
+	return nil, err
+}
+
+func verifyOnce(publicKey *rsa.PublicKey, data []byte, signature []byte, opts *SignOptions) error {
+	h := opts.Hash.New()
+	h.Write(data)
+	return verifyHashed(publicKey, h.Sum(nil), signature, opts)
+}
+
+func verifyHashed(publicKey *rsa.PublicKey, hashed []byte, signature []byte, opts *SignOptions) error {
+	switch opts.Scheme {
+	case SchemePKCS1v15:
+		return rsa.VerifyPKCS1v15(publicKey, opts.Hash, hashed, signature)
+	case SchemePSS:
+		return rsa.VerifyPSS(publicKey, opts.Hash, hashed, signature, &rsa.PSSOptions{SaltLength: opts.SaltLength})
+	default:
+		return fmt.Errorf("%w: %v for verification", ErrScheme, opts.Scheme)
+	}
+}
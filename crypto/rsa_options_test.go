@@ -0,0 +1,85 @@
+package crypto
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRSAOptions(t *testing.T) {
+	privateKey, publicKey, err := GenerateKeyPair(2048)
+	require.NoError(t, err)
+	data := []byte("你好，世界")
+
+	t.Run("OAEP", func(t *testing.T) {
+		for _, hash := range []crypto.Hash{0, crypto.SHA256, crypto.SHA384, crypto.SHA512} {
+			opts := &EncryptOptions{Scheme: SchemeOAEP, Hash: hash, Label: []byte("label")}
+			encrypted, err := EncryptWithOptions(publicKey, data, opts)
+			require.NoError(t, err)
+			decrypted, err := DecryptWithOptions(privateKey, encrypted, opts)
+			require.NoError(t, err)
+			assert.Equal(t, data, decrypted)
+
+			_, err = DecryptWithOptions(privateKey, encrypted, &EncryptOptions{Scheme: SchemeOAEP, Hash: hash})
+			assert.Error(t, err, "标签不同时解密应该失败")
+		}
+
+		// 和标准库互通
+		encrypted, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, publicKey, data, nil)
+		require.NoError(t, err)
+		decrypted, err := DecryptWithOptions(privateKey, encrypted, &EncryptOptions{Scheme: SchemeOAEP})
+		require.NoError(t, err)
+		assert.Equal(t, data, decrypted)
+
+		_, err = EncryptWithOptions(publicKey, data, &EncryptOptions{Scheme: SchemeOAEP, Hash: crypto.MD5})
+		assert.Error(t, err)
+		_, err = EncryptWithOptions(publicKey, data, &EncryptOptions{Scheme: SchemePSS})
+		assert.ErrorIs(t, err, ErrScheme)
+	})
+
+	t.Run("PSS", func(t *testing.T) {
+		for _, hash := range []crypto.Hash{crypto.SHA256, crypto.SHA384, crypto.SHA512} {
+			opts := &SignOptions{Scheme: SchemePSS, Hash: hash, SaltLength: 20}
+			signature, err := SignWithOptions(privateKey, data, opts)
+			require.NoError(t, err)
+			assert.NoError(t, VerifyWithOptions(publicKey, data, signature, opts))
+			assert.NoError(t, VerifyWithOptions(publicKey, data, signature, &SignOptions{Scheme: SchemePSS, Hash: hash}))
+			assert.Error(t, VerifyWithOptions(publicKey, data, signature, &SignOptions{Scheme: SchemePSS, Hash: hash, SaltLength: rsa.PSSSaltLengthEqualsHash}), "盐长度不同时验证应该失败")
+			assert.Error(t, Verify(publicKey, data, signature))
+		}
+	})
+
+	t.Run("默认选项和 Sign 相同", func(t *testing.T) {
+		signature, err := Sign(privateKey, data)
+		require.NoError(t, err)
+		assert.NoError(t, VerifyWithOptions(publicKey, data, signature, &SignOptions{}))
+		assert.NoError(t, VerifyWithOptions(publicKey, data, signature, &SignOptions{Scheme: SchemePKCS1v15, Hash: crypto.SHA256}))
+	})
+
+	t.Run("验证回退", func(t *testing.T) {
+		signature, err := SignWithOptions(privateKey, data, &SignOptions{Scheme: SchemePSS, Hash: crypto.SHA384, SaltLength: rsa.PSSSaltLengthAuto})
+		require.NoError(t, err)
+		assert.Error(t, Verify(publicKey, data, signature))
+		assert.NoError(t, VerifyWithOptions(publicKey, data, signature, &SignOptions{Fallback: true}))
+
+		matched, err := VerifyAny(publicKey, data, signature)
+		require.NoError(t, err)
+		assert.Equal(t, SchemePSS, matched.Scheme)
+		assert.Equal(t, crypto.SHA384, matched.Hash)
+
+		signature, err = SignWithOptions(privateKey, data, &SignOptions{Hash: crypto.SHA512})
+		require.NoError(t, err)
+		matched, err = VerifyAny(publicKey, data, signature)
+		require.NoError(t, err)
+		assert.Equal(t, SchemePKCS1v15, matched.Scheme)
+		assert.Equal(t, crypto.SHA512, matched.Hash)
+
+		_, err = VerifyAny(publicKey, []byte("tampered"), signature)
+		assert.Error(t, err)
+	})
+}
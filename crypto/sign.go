@@ -0,0 +1,85 @@
+package crypto
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+)
+
+// ErrSignature 签名无效
+var ErrSignature = errors.New("invalid signature")
+
+// Sign 使用私钥对数据进行签名. RSA 使用 PKCS#1 v1.5 和 SHA-256(其他方案见 SignWithOptions),
+// ECDSA 使用和曲线匹配的哈希(P-256 为 SHA-256, P-384 为 SHA-384)输出 ASN.1 签名, Ed25519 直接签名数据.
+// signer 也可以是硬件密钥等其他 crypto.Signer 的实现
+func Sign(signer crypto.Signer, data []byte) ([]byte, error) {
+	if privateKey, ok := signer.(*rsa.PrivateKey); ok {
+		return SignWithOptions(privateKey, data, nil)
+	}
+	switch publicKey := signer.Public().(type) {
+	case *rsa.PublicKey:
+		return signer.Sign(rand.Reader, digest(crypto.SHA256, data), crypto.SHA256)
+	case *ecdsa.PublicKey:
+		hash, err := curveHash(publicKey.Curve)
+		if err != nil {
+			return nil, err
+		}
+		return signer.Sign(rand.Reader, digest(hash, data), hash)
+	case ed25519.PublicKey:
+		return signer.Sign(rand.Reader, data, crypto.Hash(0))
+	default:
+		return nil, fmt.Errorf("%w: %T can't sign", ErrKeyType, publicKey)
+	}
+}
+
+// Verify 使用公钥验证 Sign 的签名, 签名无效时返回的错误包装了 ErrSignature
+func Verify(publicKey crypto.PublicKey, data []byte, signature []byte) error {
+	switch key := publicKey.(type) {
+	case *rsa.PublicKey:
+		if err := VerifyWithOptions(key, data, signature, nil); err != nil {
+			return fmt.Errorf("%w: %v", ErrSignature, err)
+		}
+		return nil
+	case *ecdsa.PublicKey:
+		hash, err := curveHash(key.Curve)
+		if err != nil {
+			return err
+		}
+		if !ecdsa.VerifyASN1(key, digest(hash, data), signature) {
+			return ErrSignature
+		}
+		return nil
+	case ed25519.PublicKey:
+		if len(key) != ed25519.PublicKeySize || !ed25519.Verify(key, data, signature) {
+			return ErrSignature
+		}
+		return nil
+	default:
+		return fmt.Errorf("%w: %T can't verify", ErrKeyType, publicKey)
+	}
+}
+
+func digest(hash crypto.Hash, data []byte) []byte {
+	h := hash.New()
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+// curveHash 返回 ECDSA 签名使用的哈希
+func curveHash(curve elliptic.Curve) (crypto.Hash, error) {
+	switch curve {
+	case elliptic.P256():
+		return crypto.SHA256, nil
+	case elliptic.P384():
+		return crypto.SHA384, nil
+	case elliptic.P521():
+		return crypto.SHA512, nil
+	default:
+		return 0, fmt.Errorf("%w: curve %v", ErrKeyType, curve.Params().Name)
+	}
+}
@@ -0,0 +1,65 @@
+package crypto
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"encoding/base64"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// opaqueSigner 只暴露 crypto.Signer 接口, 类似硬件密钥
+type opaqueSigner struct {
+	signer crypto.Signer
+}
+
+func (s opaqueSigner) Public() crypto.PublicKey { return s.signer.Public() }
+
+func (s opaqueSigner) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	return s.signer.Sign(rand, digest, opts)
+}
+
+func TestSign(t *testing.T) {
+	data := []byte("你好，世界")
+	for _, keyType := range []KeyType{KeyRSA, KeyEd25519, KeyECDSAP256, KeyECDSAP384} {
+		t.Run(keyType.String(), func(t *testing.T) {
+			privateKey, err := GenerateKey(keyType)
+			require.NoError(t, err)
+			signer := privateKey.(crypto.Signer)
+
+			for _, s := range []crypto.Signer{signer, opaqueSigner{signer}} {
+				signature, err := Sign(s, data)
+				require.NoError(t, err)
+				assert.NoError(t, Verify(signer.Public(), data, signature))
+				assert.ErrorIs(t, Verify(signer.Public(), []byte("tampered"), signature), ErrSignature)
+			}
+
+			other, err := GenerateKey(keyType)
+			require.NoError(t, err)
+			signature, err := Sign(other.(crypto.Signer), data)
+			require.NoError(t, err)
+			assert.ErrorIs(t, Verify(signer.Public(), data, signature), ErrSignature)
+		})
+	}
+
+	t.Run("RFC 8037 Ed25519", func(t *testing.T) {
+		key, err := ImportPrivateKey([]byte(`{"kty":"OKP","crv":"Ed25519",
+			"d":"nWGxne_9WmC6hEr0kuwsxERJxWl7MmkZcDusAxyuf2A","x":"11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo"}`), nil)
+		require.NoError(t, err)
+		signature, err := Sign(key.(ed25519.PrivateKey), []byte("eyJhbGciOiJFZERTQSJ9.RXhhbXBsZSBvZiBFZDI1NTE5IHNpZ25pbmc"))
+		require.NoError(t, err)
+		assert.Equal(t, "hgyY0il_MGCjP0JzlnLWG1PPOt7-09PGcvMg3AIbQR6dWbhijcNR4ki4iylGjg5BhVsPt9g7sVvpAr_MuM0KAg",
+			base64.RawURLEncoding.EncodeToString(signature))
+	})
+
+	t.Run("X25519 不能签名", func(t *testing.T) {
+		privateKey, err := GenerateKey(KeyX25519)
+		require.NoError(t, err)
+		publicKey, err := PublicKeyOf(privateKey)
+		require.NoError(t, err)
+		assert.ErrorIs(t, Verify(publicKey, data, []byte("signature")), ErrKeyType)
+	})
+}
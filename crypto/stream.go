@@ -0,0 +1,324 @@
+package crypto
+
+import (
+	"bufio"
+	"bytes"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	paes "github.com/w-devin/poketto/crypto/aes"
+)
+
+// ErrTruncated 加密流在最后一个分块之前结束
+var ErrTruncated = errors.New("encrypted stream is truncated")
+
+// streamMagic 是加密流的开头, 后面是 1 字节的版本号
+var streamMagic = []byte("PKST")
+
+const (
+	streamVersion = 1
+	// streamChunkSize 是每个分块的明文长度
+	streamChunkSize = 64 * 1024
+	// streamPrefixSize 是 nonce 中随机前缀的长度, 之后是 4 字节的分块序号和 1 字节的结束标志
+	streamPrefixSize = 7
+)
+
+// streamAEAD 是 STREAM 结构: 第 i 个分块的 nonce 为 前缀 | i(uint32) | 是否最后一块,
+// 分块被重排, 删除或截断后都无法通过认证
+type streamAEAD struct {
+	aead    cipher.AEAD
+	prefix  []byte
+	counter uint32
+	// ad 是头部的 SHA-256, 作为每个分块的附加数据
+	ad []byte
+}
+
+func newStreamAEAD(fileKey, prefix, header []byte) (*streamAEAD, error) {
+	block, err := aes.NewCipher(fileKey)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(header)
+	return &streamAEAD{aead: aead, prefix: prefix, ad: sum[:]}, nil
+}
+
+func (s *streamAEAD) nonce(last bool) ([]byte, error) {
+	if s.counter == ^uint32(0) {
+		return nil, errors.New("encrypted stream is too long")
+	}
+	nonce := make([]byte, 0, s.aead.NonceSize())
+	nonce = append(nonce, s.prefix...)
+	nonce = binary.BigEndian.AppendUint32(nonce, s.counter)
+	if last {
+		return append(nonce, 1), nil
+	}
+	return append(nonce, 0), nil
+}
+
+func (s *streamAEAD) seal(dst, chunk []byte, last bool) ([]byte, error) {
+	nonce, err := s.nonce(last)
+	if err != nil {
+		return nil, err
+	}
+	s.counter++
+	return s.aead.Seal(dst, nonce, chunk, s.ad), nil
+}
+
+func (s *streamAEAD) open(dst, chunk []byte, last bool) ([]byte, error) {
+	nonce, err := s.nonce(last)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := s.aead.Open(dst, nonce, chunk, s.ad)
+	if err != nil {
+		return nil, fmt.Errorf("%w: chunk %d", paes.ErrAuthentication, s.counter)
+	}
+	s.counter++
+	return plaintext, nil
+}
+
+// encryptingWriter 缓存一个分块, 直到知道它是否为最后一块
+type encryptingWriter struct {
+	w      io.Writer
+	stream *streamAEAD
+	buf    []byte
+	sealed []byte
+	closed bool
+	err    error
+}
+
+// NewEncryptingWriter 返回一个加密写入 w 的 io.WriteCloser, 数据按 64 KiB 分块用 AES-256-GCM 加密,
+// 随机的文件密钥为每个接收者包装(见 SealEnvelopeFor)后写在头部. 格式为
+//
+//	"PKST" | 版本(1) | 接收者列表(同 SealEnvelopeFor) | nonce 前缀(7) | 分块...
+//
+// 每个分块是 64 KiB 明文的密文和 16 字节认证标签, 最后一块更短(可以为空).
+// 必须调用 Close 写入最后一块, 否则密文会被认为是截断的. Close 不会关闭 w
+func NewEncryptingWriter[K crypto.PublicKey](w io.Writer, recipients []K) (io.WriteCloser, error) {
+	fileKey := make([]byte, fileKeySize)
+	if _, err := rand.Read(fileKey); err != nil {
+		return nil, err
+	}
+	wrapped, err := wrapKey(recipients, fileKey)
+	if err != nil {
+		return nil, err
+	}
+	prefix := make([]byte, streamPrefixSize)
+	if _, err = rand.Read(prefix); err != nil {
+		return nil, err
+	}
+
+	header := bytes.NewBuffer(nil)
+	header.Write(streamMagic)
+	header.WriteByte(streamVersion)
+	writeRecipients(header, wrapped)
+	header.Write(prefix)
+	stream, err := newStreamAEAD(fileKey, prefix, header.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	if _, err = w.Write(header.Bytes()); err != nil {
+		return nil, err
+	}
+	return &encryptingWriter{w: w, stream: stream, buf: make([]byte, 0, streamChunkSize)}, nil
+}
+
+func (e *encryptingWriter) Write(p []byte) (int, error) {
+	if e.closed {
+		return 0, errors.New("write to closed encrypting writer")
+	}
+	if e.err != nil {
+		return 0, e.err
+	}
+	n := 0
+	for len(p) > 0 {
+		if len(e.buf) == streamChunkSize {
+			// more data follows, the buffered chunk isn't the last one
+			if e.err = e.flush(false); e.err != nil {
+				return n, e.err
+			}
+		}
+		copied := copy(e.buf[len(e.buf):streamChunkSize], p)
+		e.buf = e.buf[:len(e.buf)+copied]
+		p = p[copied:]
+		n += copied
+	}
+	return n, nil
+}
+
+func (e *encryptingWriter) flush(last bool) error {
+	sealed, err := e.stream.seal(e.sealed[:0], e.buf, last)
+	if err != nil {
+		return err
+	}
+	e.sealed, e.buf = sealed, e.buf[:0]
+	_, err = e.w.Write(sealed)
+	return err
+}
+
+// Close 写入最后一个分块
+func (e *encryptingWriter) Close() error {
+	if e.closed || e.err != nil {
+		return e.err
+	}
+	e.closed = true
+	e.err = e.flush(true)
+	return e.err
+}
+
+type decryptingReader struct {
+	r      *bufio.Reader
+	stream *streamAEAD
+	sealed []byte
+	buf    []byte
+	done   bool
+	err    error
+}
+
+// NewDecryptingReader 返回一个解密 NewEncryptingWriter 输出的 io.Reader. 每个分块在认证之后才会返回,
+// 被篡改, 重排或截断的数据返回错误, 所以在读到 io.EOF 之前不应信任已经读出的数据
+func NewDecryptingReader(r io.Reader, privateKey crypto.PrivateKey) (io.Reader, error) {
+	header := bytes.NewBuffer(nil)
+	tee := io.TeeReader(r, header)
+	version, err := readVersion(tee, streamMagic)
+	if err != nil {
+		return nil, err
+	}
+	if version != streamVersion {
+		return nil, fmt.Errorf("%w: unsupported version %d", ErrEnvelope, version)
+	}
+	recipients, err := readRecipients(tee)
+	if err != nil {
+		return nil, err
+	}
+	prefix := make([]byte, streamPrefixSize)
+	if _, err = io.ReadFull(tee, prefix); err != nil {
+		return nil, ErrEnvelope
+	}
+	fileKey, err := unwrapKey(privateKey, recipients)
+	if err != nil {
+		return nil, err
+	}
+	stream, err := newStreamAEAD(fileKey, prefix, header.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	return &decryptingReader{
+		r:      bufio.NewReaderSize(r, streamChunkSize+stream.aead.Overhead()+1),
+		stream: stream,
+		sealed: make([]byte, streamChunkSize+stream.aead.Overhead()),
+	}, nil
+}
+
+func (d *decryptingReader) Read(p []byte) (int, error) {
+	for len(d.buf) == 0 {
+		if d.err != nil {
+			return 0, d.err
+		}
+		if d.done {
+			return 0, io.EOF
+		}
+		d.err = d.next()
+	}
+	n := copy(p, d.buf)
+	d.buf = d.buf[n:]
+	return n, nil
+}
+
+// next 读取并解密下一个分块, 后面没有数据的分块是最后一块
+func (d *decryptingReader) next() error {
+	n, err := io.ReadFull(d.r, d.sealed)
+	switch {
+	case errors.Is(err, io.EOF):
+		return ErrTruncated
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		d.done = true
+	case err != nil:
+		return err
+	default:
+		if _, err = d.r.Peek(1); errors.Is(err, io.EOF) {
+			d.done = true
+		} else if err != nil {
+			return err
+		}
+	}
+	if d.buf, err = d.stream.open(d.buf[:0], d.sealed[:n], d.done); err != nil {
+		if d.done {
+			// the rest has been cut off after a chunk which isn't the last one
+			if _, notLast := d.stream.open(nil, d.sealed[:n], false); notLast == nil {
+				return ErrTruncated
+			}
+		}
+		return err
+	}
+	return nil
+}
+
+// EncryptFile 为 recipients 加密文件 src 写入 dst, 见 NewEncryptingWriter
+func EncryptFile[K crypto.PublicKey](src, dst string, recipients []K) error {
+	return transformFile(src, dst, func(in io.Reader, out io.Writer) error {
+		w, err := NewEncryptingWriter(out, recipients)
+		if err != nil {
+			return err
+		}
+		if _, err = io.Copy(w, in); err != nil {
+			return err
+		}
+		return w.Close()
+	})
+}
+
+// DecryptFile 用 privateKey 解密 EncryptFile 加密的文件 src 写入 dst, 失败时不会留下 dst
+func DecryptFile(src, dst string, privateKey crypto.PrivateKey) error {
+	return transformFile(src, dst, func(in io.Reader, out io.Writer) error {
+		r, err := NewDecryptingReader(in, privateKey)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(out, r)
+		return err
+	})
+}
+
+// transformFile 把 src 经过 transform 写入 dst 旁边的临时文件, 成功后再重命名为 dst
+func transformFile(src, dst string, transform func(io.Reader, io.Writer) error) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.CreateTemp(filepath.Dir(dst), "."+filepath.Base(dst)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(out.Name())
+
+	bw := bufio.NewWriterSize(out, streamChunkSize)
+	if err = transform(bufio.NewReaderSize(in, streamChunkSize), bw); err == nil {
+		err = bw.Flush()
+	}
+	if err == nil {
+		err = out.Sync()
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write %s, %w", dst, err)
+	}
+	return os.Rename(out.Name(), dst)
+}
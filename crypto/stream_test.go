@@ -0,0 +1,134 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	paes "github.com/w-devin/poketto/crypto/aes"
+)
+
+func encryptStream(t *testing.T, recipients []*rsa.PublicKey, data []byte) []byte {
+	buf := bytes.NewBuffer(nil)
+	w, err := NewEncryptingWriter(buf, recipients)
+	require.NoError(t, err)
+	// 分多次写入, 写入的边界和分块的边界不一致
+	for len(data) > 0 {
+		n := min(len(data), 10000)
+		_, err = w.Write(data[:n])
+		require.NoError(t, err)
+		data = data[n:]
+	}
+	require.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+func decryptStream(privateKey crypto.PrivateKey, encrypted []byte) ([]byte, error) {
+	r, err := NewDecryptingReader(bytes.NewReader(encrypted), privateKey)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
+
+func TestStream(t *testing.T) {
+	alice, alicePublic, err := GenerateKeyPair(2048)
+	require.NoError(t, err)
+	bob, bobPublic, err := GenerateKeyPair(2048)
+	require.NoError(t, err)
+	recipients := []*rsa.PublicKey{alicePublic, bobPublic}
+
+	data := make([]byte, 3*streamChunkSize+123)
+	_, err = rand.Read(data)
+	require.NoError(t, err)
+
+	t.Run("加密解密", func(t *testing.T) {
+		for _, size := range []int{0, 1, streamChunkSize, 2 * streamChunkSize, len(data)} {
+			encrypted := encryptStream(t, recipients, data[:size])
+			for _, key := range []*rsa.PrivateKey{alice, bob} {
+				decrypted, err := decryptStream(key, encrypted)
+				require.NoError(t, err, "size %d", size)
+				assert.True(t, bytes.Equal(data[:size], decrypted), "size %d", size)
+			}
+		}
+	})
+
+	encrypted := encryptStream(t, recipients, data)
+	headerSize := len(encrypted) - 3*(streamChunkSize+16) - (123 + 16)
+	chunk := func(i int) []byte {
+		start := headerSize + i*(streamChunkSize+16)
+		return encrypted[start:min(start+streamChunkSize+16, len(encrypted))]
+	}
+
+	t.Run("截断", func(t *testing.T) {
+		for _, size := range []int{headerSize, headerSize + streamChunkSize + 16, headerSize + 2*(streamChunkSize+16), len(encrypted) - 1} {
+			_, err := decryptStream(alice, encrypted[:size])
+			assert.Error(t, err, "size %d", size)
+		}
+		_, err := decryptStream(alice, encrypted[:headerSize+2*(streamChunkSize+16)])
+		assert.ErrorIs(t, err, ErrTruncated)
+		_, err = decryptStream(alice, encrypted[:headerSize])
+		assert.ErrorIs(t, err, ErrTruncated)
+	})
+
+	t.Run("重排", func(t *testing.T) {
+		reordered := append([]byte(nil), encrypted[:headerSize]...)
+		reordered = append(reordered, chunk(1)...)
+		reordered = append(reordered, chunk(0)...)
+		reordered = append(reordered, chunk(2)...)
+		reordered = append(reordered, chunk(3)...)
+		_, err := decryptStream(alice, reordered)
+		assert.ErrorIs(t, err, paes.ErrAuthentication)
+	})
+
+	t.Run("篡改", func(t *testing.T) {
+		tampered := append([]byte(nil), encrypted...)
+		tampered[headerSize+streamChunkSize+100] ^= 1
+		_, err := decryptStream(alice, tampered)
+		assert.ErrorIs(t, err, paes.ErrAuthentication)
+
+		tampered = append(append([]byte(nil), encrypted...), 0)
+		_, err = decryptStream(alice, tampered)
+		assert.ErrorIs(t, err, paes.ErrAuthentication)
+
+		// 头部被替换后所有分块都无法通过认证
+		other := encryptStream(t, recipients, nil)
+		spliced := append(append([]byte(nil), other[:headerSize]...), encrypted[headerSize:]...)
+		_, err = decryptStream(alice, spliced)
+		assert.Error(t, err)
+	})
+
+	t.Run("不是接收者", func(t *testing.T) {
+		eve, _, err := GenerateKeyPair(2048)
+		require.NoError(t, err)
+		_, err = decryptStream(eve, encrypted)
+		assert.ErrorIs(t, err, ErrNotRecipient)
+	})
+
+	t.Run("文件", func(t *testing.T) {
+		dir := t.TempDir()
+		plain := filepath.Join(dir, "archive.zip")
+		require.NoError(t, os.WriteFile(plain, data, 0o600))
+
+		require.NoError(t, EncryptFile(plain, plain+".enc", recipients))
+		require.NoError(t, DecryptFile(plain+".enc", filepath.Join(dir, "decrypted.zip"), bob))
+		decrypted, err := os.ReadFile(filepath.Join(dir, "decrypted.zip"))
+		require.NoError(t, err)
+		assert.True(t, bytes.Equal(data, decrypted))
+
+		// 解密失败时不留下输出文件
+		require.NoError(t, os.Truncate(plain+".enc", 1000))
+		assert.Error(t, DecryptFile(plain+".enc", filepath.Join(dir, "broken.zip"), alice))
+		entries, err := os.ReadDir(dir)
+		require.NoError(t, err)
+		assert.Len(t, entries, 3)
+	})
+}
@@ -0,0 +1,441 @@
+package archive
+
+import (
+	"archive/zip"
+	"compress/flate"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	pcrypto "github.com/w-devin/poketto/crypto"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// WinZip AES encryption, see https://www.winzip.com/en/support/aes-encryption/
+const (
+	methodWinZipAES = 99
+	aesExtraID      = 0x9901
+	aesVendorAE1    = 1
+	aesVendorAE2    = 2
+	aesStrength256  = 3
+	aesIterations   = 1000
+	aesPVLen        = 2
+	aesMACLen       = 10
+	aesReaderVer    = 51
+	flagEncrypted   = 0x1
+	flagDescriptor  = 0x8
+	flagUTF8        = 0x800
+
+	// keyCommentPrefix marks the archive comment carrying the password wrapped for a recipient
+	keyCommentPrefix = "poketto-key:"
+)
+
+var (
+	ErrPassword       = errors.New("wrong password")
+	ErrAuthentication = errors.New("authentication of encrypted entry failed")
+)
+
+// GeneratePassword returns a random password for an encrypted archive
+func GeneratePassword() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// WrapPassword encrypts the archive password for the owner of the public key
+func WrapPassword(publicKey *rsa.PublicKey, password string) (string, error) {
+	wrapped, err := pcrypto.Encrypt(publicKey, []byte(password))
+	if err != nil {
+		return "", fmt.Errorf("failed to wrap password, %v", err)
+	}
+	return base64.StdEncoding.EncodeToString(wrapped), nil
+}
+
+// UnwrapPassword decrypts a password wrapped by WrapPassword
+func UnwrapPassword(privateKey *rsa.PrivateKey, wrapped string) (string, error) {
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(wrapped))
+	if err != nil {
+		return "", fmt.Errorf("failed to decode wrapped password, %v", err)
+	}
+	password, err := pcrypto.Decrypt(privateKey, raw)
+	if err != nil {
+		return "", fmt.Errorf("failed to unwrap password, %v", err)
+	}
+	return string(password), nil
+}
+
+// PasswordFromComment unwraps the password stored in the comment of an archive written with Options.Recipient
+func PasswordFromComment(privateKey *rsa.PrivateKey, comment string) (string, error) {
+	if !strings.HasPrefix(comment, keyCommentPrefix) {
+		return "", fmt.Errorf("archive comment has no wrapped password")
+	}
+	return UnwrapPassword(privateKey, strings.TrimPrefix(comment, keyCommentPrefix))
+}
+
+// IsEncrypted reports whether the zip entry is encrypted
+func IsEncrypted(f *zip.File) bool {
+	return f.Flags&flagEncrypted != 0
+}
+
+// OpenFile opens the zip entry, decrypting it with password when it's WinZip AES encrypted.
+// The authentication code is checked when the end of the entry is read, Read returns
+// ErrAuthentication instead of io.EOF when it doesn't match.
+func OpenFile(f *zip.File, password string) (io.ReadCloser, error) {
+	if !IsEncrypted(f) {
+		return f.Open()
+	}
+	if f.Method != methodWinZipAES {
+		return nil, fmt.Errorf("unsupported encryption of %s, only WinZip AES is supported", f.Name)
+	}
+	if password == "" {
+		return nil, fmt.Errorf("%s is encrypted, password required", f.Name)
+	}
+
+	vendor, strength, method, err := parseAESExtra(f.Extra)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse AES header of %s, %v", f.Name, err)
+	}
+	keyLen, err := aesKeyLen(strength)
+	if err != nil {
+		return nil, err
+	}
+	saltLen := keyLen / 2
+	overhead := uint64(saltLen + aesPVLen + aesMACLen)
+	if f.CompressedSize64 < overhead {
+		return nil, fmt.Errorf("encrypted entry %s is truncated", f.Name)
+	}
+
+	raw, err := f.OpenRaw()
+	if err != nil {
+		return nil, err
+	}
+	header := make([]byte, saltLen+aesPVLen)
+	if _, err = io.ReadFull(raw, header); err != nil {
+		return nil, fmt.Errorf("failed to read AES header of %s, %v", f.Name, err)
+	}
+	encKey, macKey, pv := deriveAESKeys(password, header[:saltLen], keyLen)
+	if subtle.ConstantTimeCompare(pv, header[saltLen:]) != 1 {
+		return nil, ErrPassword
+	}
+
+	block, err := aes.NewCipher(encKey)
+	if err != nil {
+		return nil, err
+	}
+	mac := hmac.New(sha1.New, macKey)
+	body := io.LimitReader(raw, int64(f.CompressedSize64-overhead))
+	ar := &aesReader{
+		body: io.TeeReader(body, mac),
+		raw:  raw,
+		mac:  mac,
+		ctr:  newWinZipCTR(block),
+	}
+
+	var plain io.ReadCloser
+	switch method {
+	case zip.Store:
+		plain = io.NopCloser(ar)
+	case zip.Deflate:
+		plain = flate.NewReader(ar)
+	default:
+		return nil, fmt.Errorf("unsupported compression method %d of %s", method, f.Name)
+	}
+	plain = &authReader{ReadCloser: plain, ar: ar}
+	if vendor == aesVendorAE1 {
+		// only AE-1 keeps the CRC, AE-2 relies on the authentication code
+		return &crcReader{rc: plain, crc: crc32.NewIEEE(), want: f.CRC32}, nil
+	}
+	return plain, nil
+}
+
+func parseAESExtra(extra []byte) (vendor uint16, strength byte, method uint16, err error) {
+	for len(extra) >= 4 {
+		id := binary.LittleEndian.Uint16(extra)
+		size := int(binary.LittleEndian.Uint16(extra[2:]))
+		extra = extra[4:]
+		if size > len(extra) {
+			break
+		}
+		if id == aesExtraID && size >= 7 {
+			field := extra[:size]
+			if string(field[2:4]) != "AE" {
+				return 0, 0, 0, fmt.Errorf("unknown AES vendor %q", field[2:4])
+			}
+			return binary.LittleEndian.Uint16(field), field[4], binary.LittleEndian.Uint16(field[5:]), nil
+		}
+		extra = extra[size:]
+	}
+	return 0, 0, 0, fmt.Errorf("AES extra field not found")
+}
+
+func aesKeyLen(strength byte) (int, error) {
+	switch strength {
+	case 1:
+		return 16, nil
+	case 2:
+		return 24, nil
+	case 3:
+		return 32, nil
+	}
+	return 0, fmt.Errorf("unknown AES strength %d", strength)
+}
+
+func deriveAESKeys(password string, salt []byte, keyLen int) (encKey, macKey, pv []byte) {
+	derived := pbkdf2.Key([]byte(password), salt, aesIterations, 2*keyLen+aesPVLen, sha1.New)
+	return derived[:keyLen], derived[keyLen : 2*keyLen], derived[2*keyLen:]
+}
+
+// winZipCTR is the counter mode of WinZip, a little endian counter starting at 1
+type winZipCTR struct {
+	block   cipher.Block
+	counter [aes.BlockSize]byte
+	stream  [aes.BlockSize]byte
+	used    int
+}
+
+func newWinZipCTR(block cipher.Block) *winZipCTR {
+	return &winZipCTR{block: block, used: aes.BlockSize}
+}
+
+func (c *winZipCTR) XORKeyStream(dst, src []byte) {
+	for i := range src {
+		if c.used == aes.BlockSize {
+			for j := 0; j < 8; j++ {
+				c.counter[j]++
+				if c.counter[j] != 0 {
+					break
+				}
+			}
+			c.block.Encrypt(c.stream[:], c.counter[:])
+			c.used = 0
+		}
+		dst[i] = src[i] ^ c.stream[c.used]
+		c.used++
+	}
+}
+
+type aesReader struct {
+	body io.Reader
+	raw  io.Reader
+	mac  hash.Hash
+	ctr  *winZipCTR
+	err  error
+}
+
+func (r *aesReader) Read(p []byte) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	n, err := r.body.Read(p)
+	r.ctr.XORKeyStream(p[:n], p[:n])
+	if err == io.EOF {
+		code := make([]byte, aesMACLen)
+		if _, rerr := io.ReadFull(r.raw, code); rerr != nil || !hmac.Equal(code, r.mac.Sum(nil)[:aesMACLen]) {
+			err = ErrAuthentication
+		}
+	}
+	r.err = err
+	return n, err
+}
+
+// authReader makes sure the authentication code is checked even when the decompressor
+// stops reading right after the end of its stream
+type authReader struct {
+	io.ReadCloser
+	ar *aesReader
+}
+
+func (r *authReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if err == io.EOF {
+		if _, derr := io.Copy(io.Discard, r.ar); derr != nil {
+			return n, derr
+		}
+	}
+	return n, err
+}
+
+type crcReader struct {
+	rc   io.ReadCloser
+	crc  hash.Hash32
+	want uint32
+}
+
+func (r *crcReader) Read(p []byte) (int, error) {
+	n, err := r.rc.Read(p)
+	r.crc.Write(p[:n])
+	if err == io.EOF && r.want != 0 && r.crc.Sum32() != r.want {
+		return n, zip.ErrChecksum
+	}
+	return n, err
+}
+
+func (r *crcReader) Close() error {
+	return r.rc.Close()
+}
+
+// aesWriter encrypts and authenticates an entry, Close writes the authentication code
+type aesWriter struct {
+	w   io.Writer
+	ctr *winZipCTR
+	mac hash.Hash
+	buf []byte
+	n   int64
+}
+
+func (w *aesWriter) Write(p []byte) (int, error) {
+	if cap(w.buf) < len(p) {
+		w.buf = make([]byte, len(p))
+	}
+	buf := w.buf[:len(p)]
+	w.ctr.XORKeyStream(buf, p)
+	w.mac.Write(buf)
+	n, err := w.w.Write(buf)
+	w.n += int64(n)
+	return n, err
+}
+
+func (w *aesWriter) Close() error {
+	n, err := w.w.Write(w.mac.Sum(nil)[:aesMACLen])
+	w.n += int64(n)
+	return err
+}
+
+// encryptedEntry is the open entry of a Writer with a password
+type encryptedEntry struct {
+	hdr   *zip.FileHeader
+	aes   *aesWriter
+	comp  io.WriteCloser
+	plain int64
+}
+
+func (e *encryptedEntry) Write(p []byte) (int, error) {
+	n, err := e.comp.Write(p)
+	e.plain += int64(n)
+	return n, err
+}
+
+// Close flushes the entry, the sizes end up in the data descriptor and the central directory
+func (e *encryptedEntry) Close() error {
+	if err := e.comp.Close(); err != nil {
+		return err
+	}
+	if err := e.aes.Close(); err != nil {
+		return err
+	}
+	e.hdr.CompressedSize64 = uint64(e.aes.n)
+	e.hdr.UncompressedSize64 = uint64(e.plain)
+	e.hdr.CompressedSize = uint32(min(e.hdr.CompressedSize64, 0xffffffff))
+	e.hdr.UncompressedSize = uint32(min(e.hdr.UncompressedSize64, 0xffffffff))
+	return nil
+}
+
+// createEncrypted starts an AE-2 AES-256 encrypted entry, the returned writer must be closed
+// before the next entry is created
+func createEncrypted(zw *zip.Writer, hdr *zip.FileHeader, password string, level int) (io.WriteCloser, error) {
+	method := hdr.Method
+	extra := make([]byte, 11)
+	binary.LittleEndian.PutUint16(extra, aesExtraID)
+	binary.LittleEndian.PutUint16(extra[2:], 7)
+	binary.LittleEndian.PutUint16(extra[4:], aesVendorAE2)
+	copy(extra[6:], "AE")
+	extra[8] = aesStrength256
+	binary.LittleEndian.PutUint16(extra[9:], method)
+
+	hdr.Method = methodWinZipAES
+	hdr.Extra = append(hdr.Extra, extra...)
+	hdr.Flags |= flagEncrypted | flagDescriptor
+	if !isASCII(hdr.Name) && utf8.ValidString(hdr.Name) {
+		hdr.Flags |= flagUTF8
+	}
+	hdr.ReaderVersion = aesReaderVer
+	hdr.CreatorVersion = hdr.CreatorVersion&0xff00 | aesReaderVer
+	hdr.ModifiedDate, hdr.ModifiedTime = msDosTime(hdr.Modified)
+	// AE-2 doesn't store the CRC, sizes are only known after the data has been written
+	hdr.CRC32 = 0
+	hdr.CompressedSize64, hdr.UncompressedSize64 = 0, 0
+
+	// CreateRaw keeps the header, Close of the returned entry fills in the sizes
+	// before the data descriptor and the central directory are written
+	raw, err := zw.CreateRaw(hdr)
+	if err != nil {
+		return nil, err
+	}
+
+	salt := make([]byte, 16)
+	if _, err = rand.Read(salt); err != nil {
+		return nil, err
+	}
+	encKey, macKey, pv := deriveAESKeys(password, salt, 32)
+	if _, err = raw.Write(append(salt, pv...)); err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(encKey)
+	if err != nil {
+		return nil, err
+	}
+
+	aw := &aesWriter{w: raw, ctr: newWinZipCTR(block), mac: hmac.New(sha1.New, macKey)}
+	aw.n = int64(len(salt) + len(pv))
+
+	entry := &encryptedEntry{hdr: hdr, aes: aw}
+	switch method {
+	case zip.Store:
+		entry.comp = nopWriteCloser{aw}
+	case zip.Deflate:
+		if level == 0 {
+			level = flate.DefaultCompression
+		}
+		fw, err := flate.NewWriter(aw, level)
+		if err != nil {
+			return nil, err
+		}
+		entry.comp = fw
+	default:
+		return nil, fmt.Errorf("unsupported compression method %d", method)
+	}
+	return entry, nil
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+// msDosTime converts t to the date and time fields of a zip header
+func msDosTime(t time.Time) (date, tm uint16) {
+	if t.Year() < 1980 {
+		t = time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+	date = uint16(t.Day() + int(t.Month())<<5 + (t.Year()-1980)<<9)
+	tm = uint16(t.Second()/2 + t.Minute()<<5 + t.Hour()<<11)
+	return date, tm
+}
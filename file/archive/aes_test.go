@@ -0,0 +1,91 @@
+package archive
+
+import (
+	"archive/zip"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	pcrypto "github.com/w-devin/poketto/crypto"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncryptedZip(t *testing.T) {
+	dir := makeTree(t)
+
+	t.Run("password", func(t *testing.T) {
+		dst := filepath.Join(t.TempDir(), "secret.zip")
+		require.NoError(t, CreateFromDir(dst, dir, Options{Format: FormatZip, Password: "s3cret"}))
+
+		zr, err := zip.OpenReader(dst)
+		require.NoError(t, err)
+		defer zr.Close()
+		for _, f := range zr.File {
+			if f.Name != "Network/Cookies" {
+				continue
+			}
+			assert.True(t, IsEncrypted(f))
+
+			_, err = OpenFile(f, "wrong")
+			assert.ErrorIs(t, err, ErrPassword)
+
+			rc, err := OpenFile(f, "s3cret")
+			require.NoError(t, err)
+			content, err := io.ReadAll(rc)
+			require.NoError(t, err)
+			assert.Equal(t, "network cookies", string(content))
+		}
+
+		out := t.TempDir()
+		_, err = Extract(dst, out, ExtractOptions{Password: "s3cret"})
+		require.NoError(t, err)
+		content, err := os.ReadFile(filepath.Join(out, "Extensions", "a", "b", "c.txt"))
+		require.NoError(t, err)
+		assert.Equal(t, "deep", string(content))
+
+		_, err = Extract(dst, t.TempDir(), ExtractOptions{Password: "wrong"})
+		assert.ErrorIs(t, err, ErrPassword)
+	})
+
+	t.Run("tampered entry", func(t *testing.T) {
+		dst := filepath.Join(t.TempDir(), "secret.zip")
+		w, err := os.Create(dst)
+		require.NoError(t, err)
+		aw, err := NewWriter(w, Options{Format: FormatZip, Password: "s3cret"})
+		require.NoError(t, err)
+		require.NoError(t, aw.AddFile("Cookies", filepath.Join(dir, "Cookies")))
+		require.NoError(t, aw.Close())
+		require.NoError(t, w.Close())
+
+		data, err := os.ReadFile(dst)
+		require.NoError(t, err)
+		// the first byte after the local header, salt and password verifier
+		offset := 30 + len("Cookies") + 11 + 16 + 2
+		data[offset] ^= 0xff
+		require.NoError(t, os.WriteFile(dst, data, 0o600))
+
+		_, err = Extract(dst, t.TempDir(), ExtractOptions{Password: "s3cret"})
+		assert.Error(t, err)
+	})
+
+	t.Run("recipient", func(t *testing.T) {
+		privateKey, publicKey, err := pcrypto.GenerateKeyPair(2048)
+		require.NoError(t, err)
+
+		dst := filepath.Join(t.TempDir(), "secret.zip")
+		require.NoError(t, CreateFromDir(dst, dir, Options{Format: FormatZip, Recipient: publicKey}))
+
+		out := t.TempDir()
+		_, err = Extract(dst, out, ExtractOptions{PrivateKey: privateKey})
+		require.NoError(t, err)
+		assert.FileExists(t, filepath.Join(out, "Login Data"))
+	})
+
+	t.Run("tar can't be encrypted", func(t *testing.T) {
+		_, err := NewWriter(io.Discard, Options{Format: FormatTar, Password: "x"})
+		assert.Error(t, err)
+	})
+}
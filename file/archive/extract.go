@@ -0,0 +1,546 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	DefaultMaxTotalSize = 8 << 30
+	DefaultMaxFiles     = 100000
+	DefaultMaxRatio     = 200
+
+	// ratioThreshold is the amount of output after which the overall ratio of a compressed tar is checked,
+	// small archives of very repetitive files would be rejected otherwise
+	ratioThreshold = 1 << 20
+)
+
+var (
+	ErrUnsafePath   = errors.New("unsafe path")
+	ErrLimitReached = errors.New("extraction limit reached")
+)
+
+// ExtractOptions limits what Extract accepts. Zero limits use the defaults, negative ones disable the limit.
+type ExtractOptions struct {
+	// MaxTotalSize is the maximum number of bytes written for all entries
+	MaxTotalSize int64
+	// MaxFileSize is the maximum size of a single entry, MaxTotalSize when zero
+	MaxFileSize int64
+	// MaxFiles is the maximum number of entries
+	MaxFiles int
+	// MaxRatio is the maximum compression ratio of an entry, or of the whole stream for tar.gz and tar.zst
+	MaxRatio float64
+
+	// AllowSymlinks extracts symlinks whose target stays inside the destination, they are skipped otherwise
+	AllowSymlinks bool
+	// Overwrite replaces existing files, extraction of such entries fails otherwise
+	Overwrite bool
+	// Password decrypts WinZip AES encrypted zip entries
+	Password string
+	// PrivateKey unwraps the password stored in the comment of archives written with Options.Recipient
+	PrivateKey *rsa.PrivateKey
+
+	// ContinueOnError records failures of single entries in their result and goes on with the next one.
+	// Limits always stop the extraction.
+	ContinueOnError bool
+}
+
+// EntryResult is the outcome of the extraction of one entry
+type EntryResult struct {
+	// Name is the name of the entry inside the archive
+	Name string
+	// Path is where the entry has been written, empty when it was not
+	Path string
+	Size int64
+	Mode fs.FileMode
+	// Skipped is set for entries which were ignored on purpose, e.g. symlinks without AllowSymlinks
+	Skipped bool
+	Err     error
+}
+
+// DetectFormat guesses the format of an archive from its first bytes
+func DetectFormat(header []byte) (Format, error) {
+	switch {
+	case bytes.HasPrefix(header, []byte("PK\x03\x04")), bytes.HasPrefix(header, []byte("PK\x05\x06")):
+		return FormatZip, nil
+	case bytes.HasPrefix(header, []byte{0x1f, 0x8b}):
+		return FormatTarGz, nil
+	case bytes.HasPrefix(header, []byte{0x28, 0xb5, 0x2f, 0xfd}):
+		return FormatTarZstd, nil
+	case len(header) >= 262 && string(header[257:262]) == "ustar":
+		return FormatTar, nil
+	}
+	return 0, fmt.Errorf("unknown archive format")
+}
+
+// Extract unpacks the archive at src into dst, the format is detected from the content
+func Extract(src, dst string, opts ExtractOptions) ([]EntryResult, error) {
+	f, err := os.Open(src)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s, %v", src, err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat %s, %v", src, err)
+	}
+
+	header := make([]byte, 512)
+	n, err := io.ReadFull(f, header)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return nil, fmt.Errorf("failed to read %s, %v", src, err)
+	}
+	format, err := DetectFormat(header[:n])
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract %s, %v", src, err)
+	}
+
+	if format == FormatZip {
+		return ExtractZip(f, info.Size(), dst, opts)
+	}
+	if _, err = f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return ExtractTar(f, format, dst, opts)
+}
+
+// ExtractZip unpacks the zip archive read from r into dst
+func ExtractZip(r io.ReaderAt, size int64, dst string, opts ExtractOptions) ([]EntryResult, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read zip, %v", err)
+	}
+
+	x, err := newExtractor(dst, opts)
+	if err != nil {
+		return nil, err
+	}
+	if x.opts.Password == "" && x.opts.PrivateKey != nil && zr.Comment != "" {
+		if x.opts.Password, err = PasswordFromComment(x.opts.PrivateKey, zr.Comment); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, f := range zr.File {
+		if err := x.countFile(); err != nil {
+			return x.results, err
+		}
+
+		res := EntryResult{Name: f.Name, Mode: f.Mode(), Size: int64(f.UncompressedSize64)}
+		err := x.checkZipRatio(f)
+		if err == nil {
+			err = x.extractEntry(&res, f.Mode(), f.Modified, int64(f.UncompressedSize64), func() (io.ReadCloser, error) {
+				return x.openZipEntry(f)
+			})
+		}
+		if stop := x.record(res, err); stop != nil {
+			return x.results, stop
+		}
+	}
+	return x.results, x.finish()
+}
+
+// ExtractTar unpacks the tar stream read from r into dst, format tells which compression is used
+func ExtractTar(r io.Reader, format Format, dst string, opts ExtractOptions) ([]EntryResult, error) {
+	counter := &countingReader{r: r}
+	var stream io.Reader = counter
+	switch format {
+	case FormatTar:
+	case FormatTarGz:
+		gr, err := gzip.NewReader(bufio.NewReader(counter))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read gzip, %v", err)
+		}
+		defer gr.Close()
+		stream = gr
+	case FormatTarZstd:
+		zr, err := zstd.NewReader(counter, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read zstd, %v", err)
+		}
+		defer zr.Close()
+		stream = zr
+	default:
+		return nil, fmt.Errorf("%v is not a tar format", format)
+	}
+
+	x, err := newExtractor(dst, opts)
+	if err != nil {
+		return nil, err
+	}
+	if format != FormatTar {
+		// the ratio of a compressed stream is only known for the whole stream
+		x.compressed = counter
+	}
+
+	tr := tar.NewReader(stream)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return x.results, fmt.Errorf("failed to read tar, %v", err)
+		}
+		if err := x.countFile(); err != nil {
+			return x.results, err
+		}
+
+		mode := hdr.FileInfo().Mode()
+		res := EntryResult{Name: hdr.Name, Mode: mode, Size: hdr.Size}
+		switch hdr.Typeflag {
+		case tar.TypeReg, tar.TypeDir, tar.TypeSymlink:
+			err = x.extractEntry(&res, mode, hdr.ModTime, hdr.Size, func() (io.ReadCloser, error) {
+				if mode&fs.ModeSymlink != 0 {
+					return io.NopCloser(strings.NewReader(hdr.Linkname)), nil
+				}
+				return io.NopCloser(tr), nil
+			})
+		case tar.TypeXGlobalHeader:
+			continue
+		default:
+			// hard links, devices and fifos are never restored
+			res.Skipped = true
+		}
+		if stop := x.record(res, err); stop != nil {
+			return x.results, stop
+		}
+	}
+	return x.results, x.finish()
+}
+
+type extractor struct {
+	root       string
+	opts       ExtractOptions
+	results    []EntryResult
+	files      int
+	total      int64
+	compressed *countingReader
+	dirTimes   map[string]time.Time
+}
+
+func newExtractor(dst string, opts ExtractOptions) (*extractor, error) {
+	if opts.MaxTotalSize == 0 {
+		opts.MaxTotalSize = DefaultMaxTotalSize
+	}
+	if opts.MaxFileSize == 0 {
+		opts.MaxFileSize = opts.MaxTotalSize
+	}
+	if opts.MaxFiles == 0 {
+		opts.MaxFiles = DefaultMaxFiles
+	}
+	if opts.MaxRatio == 0 {
+		opts.MaxRatio = DefaultMaxRatio
+	}
+
+	if err := os.MkdirAll(dst, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create %s, %v", dst, err)
+	}
+	root, err := filepath.Abs(dst)
+	if err != nil {
+		return nil, err
+	}
+	if resolved, err := filepath.EvalSymlinks(root); err == nil {
+		root = resolved
+	}
+	return &extractor{root: root, opts: opts, dirTimes: make(map[string]time.Time)}, nil
+}
+
+func (x *extractor) countFile() error {
+	x.files++
+	if x.opts.MaxFiles > 0 && x.files > x.opts.MaxFiles {
+		return fmt.Errorf("%w, more than %d files", ErrLimitReached, x.opts.MaxFiles)
+	}
+	return nil
+}
+
+func (x *extractor) checkZipRatio(f *zip.File) error {
+	if x.opts.MaxRatio < 0 || f.UncompressedSize64 < ratioThreshold {
+		return nil
+	}
+	if f.CompressedSize64 == 0 || float64(f.UncompressedSize64)/float64(f.CompressedSize64) > x.opts.MaxRatio {
+		return fmt.Errorf("%w, compression ratio of %s is above %v", ErrLimitReached, f.Name, x.opts.MaxRatio)
+	}
+	return nil
+}
+
+func (x *extractor) openZipEntry(f *zip.File) (io.ReadCloser, error) {
+	return OpenFile(f, x.opts.Password)
+}
+
+// record appends the result, and returns the error which has to stop the extraction if any
+func (x *extractor) record(res EntryResult, err error) error {
+	res.Err = err
+	if err != nil {
+		res.Path = ""
+	}
+	x.results = append(x.results, res)
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, ErrLimitReached) || !x.opts.ContinueOnError {
+		return fmt.Errorf("failed to extract %s, %w", res.Name, err)
+	}
+	return nil
+}
+
+// finish restores the times of directories, which change while their content is written
+func (x *extractor) finish() error {
+	for p, t := range x.dirTimes {
+		_ = os.Chtimes(p, t, t)
+	}
+	return nil
+}
+
+// targetPath returns where the entry name is extracted, or ErrUnsafePath when it would leave the root.
+// Only directories may be the root itself, e.g. the "./" entry of "tar -C dir .".
+func (x *extractor) targetPath(name string, dir bool) (string, error) {
+	slashed := strings.ReplaceAll(name, "\\", "/")
+	if slashed == "" || strings.HasPrefix(slashed, "/") || filepath.IsAbs(name) || filepath.VolumeName(name) != "" ||
+		(len(slashed) >= 2 && slashed[1] == ':') {
+		return "", fmt.Errorf("%w, %s is absolute", ErrUnsafePath, name)
+	}
+	for _, part := range strings.Split(slashed, "/") {
+		if part == ".." {
+			return "", fmt.Errorf("%w, %s leaves the destination", ErrUnsafePath, name)
+		}
+	}
+	clean := path.Clean(slashed)
+	if clean == "." {
+		if dir {
+			return x.root, nil
+		}
+		return "", fmt.Errorf("%w, %s is empty", ErrUnsafePath, name)
+	}
+
+	// no component below the root may be a symlink, otherwise the entry would be written through it
+	target := x.root
+	parts := strings.Split(clean, "/")
+	for i, part := range parts {
+		target = filepath.Join(target, part)
+		if i == len(parts)-1 {
+			break
+		}
+		info, err := os.Lstat(target)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		if info.Mode()&fs.ModeSymlink != 0 {
+			return "", fmt.Errorf("%w, %s goes through the symlink %s", ErrUnsafePath, name, target)
+		}
+	}
+	return target, nil
+}
+
+func (x *extractor) extractEntry(res *EntryResult, mode fs.FileMode, mtime time.Time, size int64, open func() (io.ReadCloser, error)) error {
+	target, err := x.targetPath(res.Name, mode.IsDir())
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case mode.IsDir():
+		if err := os.MkdirAll(target, dirPerm(mode)); err != nil {
+			return err
+		}
+		x.dirTimes[target] = mtime
+		res.Path = target
+		return nil
+	case mode&fs.ModeSymlink != 0:
+		if !x.opts.AllowSymlinks {
+			res.Skipped = true
+			return nil
+		}
+		return x.extractSymlink(res, target, open)
+	case !mode.IsRegular():
+		res.Skipped = true
+		return nil
+	}
+
+	if x.opts.MaxFileSize > 0 && size > x.opts.MaxFileSize {
+		return fmt.Errorf("%w, %s is larger than %d bytes", ErrLimitReached, res.Name, x.opts.MaxFileSize)
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return err
+	}
+	if x.opts.Overwrite {
+		// never write through whatever is there, it could be a symlink
+		if err := os.Remove(target); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	rc, err := open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	out, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, filePerm(mode))
+	if err != nil {
+		return err
+	}
+	written, err := x.copyLimited(out, rc, res.Name)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.Remove(target)
+		return err
+	}
+	if err := os.Chmod(target, filePerm(mode)); err != nil {
+		return err
+	}
+	if !mtime.IsZero() {
+		_ = os.Chtimes(target, mtime, mtime)
+	}
+	res.Path = target
+	res.Size = written
+	return nil
+}
+
+func (x *extractor) extractSymlink(res *EntryResult, target string, open func() (io.ReadCloser, error)) error {
+	rc, err := open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	link, err := io.ReadAll(io.LimitReader(rc, 4096))
+	if err != nil {
+		return err
+	}
+
+	linkname := filepath.FromSlash(string(link))
+	if filepath.IsAbs(linkname) || filepath.VolumeName(linkname) != "" {
+		return fmt.Errorf("%w, symlink %s points to the absolute path %s", ErrUnsafePath, res.Name, link)
+	}
+	resolved := filepath.Join(filepath.Dir(target), linkname)
+	if !x.inside(resolved) {
+		return fmt.Errorf("%w, symlink %s points outside of the destination", ErrUnsafePath, res.Name)
+	}
+	// symlinks which are already there are followed, each of them has to stay inside as well
+	rel, _ := filepath.Rel(x.root, resolved)
+	p := x.root
+	for _, part := range strings.Split(rel, string(filepath.Separator)) {
+		p = filepath.Join(p, part)
+		if _, err := os.Lstat(p); err != nil {
+			break
+		}
+		if evaluated, err := filepath.EvalSymlinks(p); err != nil || !x.inside(evaluated) {
+			return fmt.Errorf("%w, symlink %s points outside of the destination through %s", ErrUnsafePath, res.Name, p)
+		}
+	}
+	// the target is written without ".." after other components, links extracted later can't
+	// turn such a component into a way out
+	if linkname, err = filepath.Rel(filepath.Dir(target), resolved); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return err
+	}
+	if x.opts.Overwrite {
+		if err := os.Remove(target); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if err := os.Symlink(linkname, target); err != nil {
+		return err
+	}
+	res.Path = target
+	return nil
+}
+
+// inside reports whether p is the root or below it
+func (x *extractor) inside(p string) bool {
+	rel, err := filepath.Rel(x.root, p)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// copyLimited copies one entry while enforcing the size and ratio limits
+func (x *extractor) copyLimited(w io.Writer, r io.Reader, name string) (int64, error) {
+	buf := make([]byte, 32*1024)
+	var written int64
+	for {
+		n, rerr := r.Read(buf)
+		if n > 0 {
+			written += int64(n)
+			x.total += int64(n)
+			if x.opts.MaxFileSize > 0 && written > x.opts.MaxFileSize {
+				return written, fmt.Errorf("%w, %s is larger than %d bytes", ErrLimitReached, name, x.opts.MaxFileSize)
+			}
+			if x.opts.MaxTotalSize > 0 && x.total > x.opts.MaxTotalSize {
+				return written, fmt.Errorf("%w, more than %d bytes extracted", ErrLimitReached, x.opts.MaxTotalSize)
+			}
+			if err := x.checkStreamRatio(); err != nil {
+				return written, err
+			}
+			if _, err := w.Write(buf[:n]); err != nil {
+				return written, err
+			}
+		}
+		if rerr == io.EOF {
+			return written, nil
+		}
+		if rerr != nil {
+			return written, rerr
+		}
+	}
+}
+
+func (x *extractor) checkStreamRatio() error {
+	if x.compressed == nil || x.opts.MaxRatio < 0 || x.total < ratioThreshold {
+		return nil
+	}
+	if x.compressed.n == 0 || float64(x.total)/float64(x.compressed.n) > x.opts.MaxRatio {
+		return fmt.Errorf("%w, compression ratio is above %v", ErrLimitReached, x.opts.MaxRatio)
+	}
+	return nil
+}
+
+func filePerm(mode fs.FileMode) fs.FileMode {
+	perm := mode.Perm()
+	if perm == 0 {
+		return 0o644
+	}
+	// owner always keeps access to what was extracted
+	return perm | 0o600
+}
+
+func dirPerm(mode fs.FileMode) fs.FileMode {
+	perm := mode.Perm()
+	if perm == 0 {
+		return 0o755
+	}
+	return perm | 0o700
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
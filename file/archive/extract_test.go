@@ -0,0 +1,191 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type tarEntry struct {
+	hdr     tar.Header
+	content string
+}
+
+func writeTar(t *testing.T, entries []tarEntry) string {
+	p := filepath.Join(t.TempDir(), "evil.tar")
+	f, err := os.Create(p)
+	require.NoError(t, err)
+	defer f.Close()
+
+	tw := tar.NewWriter(f)
+	for _, e := range entries {
+		hdr := e.hdr
+		if hdr.Typeflag == 0 {
+			hdr.Typeflag = tar.TypeReg
+		}
+		if hdr.Mode == 0 {
+			hdr.Mode = 0o644
+		}
+		hdr.Size = int64(len(e.content))
+		require.NoError(t, tw.WriteHeader(&hdr))
+		_, err := tw.Write([]byte(e.content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	return p
+}
+
+func TestExtract(t *testing.T) {
+	t.Run("round trip", func(t *testing.T) {
+		dir := makeTree(t)
+		mtime := time.Date(2021, 5, 6, 7, 8, 9, 0, time.UTC)
+		require.NoError(t, os.Chmod(filepath.Join(dir, "Cookies"), 0o640))
+		require.NoError(t, os.Chtimes(filepath.Join(dir, "Cookies"), mtime, mtime))
+
+		for _, format := range []Format{FormatZip, FormatTar, FormatTarGz, FormatTarZstd} {
+			t.Run(format.String(), func(t *testing.T) {
+				src := filepath.Join(t.TempDir(), "out."+format.String())
+				require.NoError(t, CreateFromDir(src, dir, Options{Format: format}))
+
+				dst := t.TempDir()
+				results, err := Extract(src, dst, ExtractOptions{})
+				require.NoError(t, err)
+				assert.NotEmpty(t, results)
+
+				content, err := os.ReadFile(filepath.Join(dst, "Extensions", "a", "b", "c.txt"))
+				require.NoError(t, err)
+				assert.Equal(t, "deep", string(content))
+
+				info, err := os.Stat(filepath.Join(dst, "Cookies"))
+				require.NoError(t, err)
+				assert.Equal(t, os.FileMode(0o640), info.Mode().Perm())
+				assert.True(t, mtime.Equal(info.ModTime()))
+			})
+		}
+	})
+
+	t.Run("zip slip and absolute paths", func(t *testing.T) {
+		src := writeTar(t, []tarEntry{
+			{hdr: tar.Header{Name: "../escape.txt"}, content: "x"},
+			{hdr: tar.Header{Name: "/etc/passwd"}, content: "x"},
+			{hdr: tar.Header{Name: "a/../../escape.txt"}, content: "x"},
+			{hdr: tar.Header{Name: "ok.txt"}, content: "ok"},
+		})
+		dst := filepath.Join(t.TempDir(), "out")
+		results, err := Extract(src, dst, ExtractOptions{ContinueOnError: true})
+		require.NoError(t, err)
+		require.Len(t, results, 4)
+		for _, res := range results[:3] {
+			assert.ErrorIs(t, res.Err, ErrUnsafePath, res.Name)
+		}
+		assert.NoError(t, results[3].Err)
+		assert.FileExists(t, filepath.Join(dst, "ok.txt"))
+		assert.NoFileExists(t, filepath.Join(filepath.Dir(dst), "escape.txt"))
+
+		_, err = Extract(src, t.TempDir(), ExtractOptions{})
+		assert.ErrorIs(t, err, ErrUnsafePath)
+	})
+
+	t.Run("symlink escape", func(t *testing.T) {
+		src := writeTar(t, []tarEntry{
+			{hdr: tar.Header{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "../../"}},
+			{hdr: tar.Header{Name: "inside", Typeflag: tar.TypeSymlink, Linkname: "ok.txt"}},
+			{hdr: tar.Header{Name: "inside/evil.txt"}, content: "x"},
+		})
+		dst := t.TempDir()
+		results, err := Extract(src, dst, ExtractOptions{AllowSymlinks: true, ContinueOnError: true})
+		require.NoError(t, err)
+		assert.ErrorIs(t, results[0].Err, ErrUnsafePath)
+		assert.NoError(t, results[1].Err)
+		assert.ErrorIs(t, results[2].Err, ErrUnsafePath)
+
+		results, err = Extract(src, t.TempDir(), ExtractOptions{ContinueOnError: true})
+		require.NoError(t, err)
+		assert.True(t, results[0].Skipped)
+	})
+
+	t.Run("chained symlinks", func(t *testing.T) {
+		parent := t.TempDir()
+		require.NoError(t, os.WriteFile(filepath.Join(parent, "secret"), []byte("secret"), 0o600))
+		for _, entries := range [][]tarEntry{
+			{
+				{hdr: tar.Header{Name: "d/", Typeflag: tar.TypeDir, Mode: 0o755}},
+				{hdr: tar.Header{Name: "d/s1", Typeflag: tar.TypeSymlink, Linkname: ".."}},
+				{hdr: tar.Header{Name: "s2", Typeflag: tar.TypeSymlink, Linkname: "d/s1/../secret"}},
+			},
+			{
+				{hdr: tar.Header{Name: "d/", Typeflag: tar.TypeDir, Mode: 0o755}},
+				{hdr: tar.Header{Name: "s2", Typeflag: tar.TypeSymlink, Linkname: "d/s1/../secret"}},
+				{hdr: tar.Header{Name: "d/s1", Typeflag: tar.TypeSymlink, Linkname: ".."}},
+			},
+		} {
+			dst := filepath.Join(parent, "out")
+			require.NoError(t, os.RemoveAll(dst))
+			_, _ = Extract(writeTar(t, entries), dst, ExtractOptions{AllowSymlinks: true, ContinueOnError: true})
+			_, err := os.ReadFile(filepath.Join(dst, "s2"))
+			assert.Error(t, err)
+		}
+	})
+
+	t.Run("root entry of tar -C", func(t *testing.T) {
+		if _, err := exec.LookPath("tar"); err != nil {
+			t.Skip("tar is not installed")
+		}
+		dir := makeTree(t)
+		src := filepath.Join(t.TempDir(), "out.tar.gz")
+		out, err := exec.Command("tar", "czf", src, "-C", dir, ".").CombinedOutput()
+		require.NoError(t, err, string(out))
+
+		dst := t.TempDir()
+		results, err := Extract(src, dst, ExtractOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, "./", results[0].Name)
+		content, err := os.ReadFile(filepath.Join(dst, "Extensions", "a", "b", "c.txt"))
+		require.NoError(t, err)
+		assert.Equal(t, "deep", string(content))
+
+		// only directories may be the root
+		results, err = Extract(writeTar(t, []tarEntry{{hdr: tar.Header{Name: "."}, content: "x"}}), dst, ExtractOptions{ContinueOnError: true})
+		require.NoError(t, err)
+		assert.ErrorIs(t, results[0].Err, ErrUnsafePath)
+	})
+
+	t.Run("limits", func(t *testing.T) {
+		src := writeTar(t, []tarEntry{
+			{hdr: tar.Header{Name: "a"}, content: "1"},
+			{hdr: tar.Header{Name: "b"}, content: "2"},
+			{hdr: tar.Header{Name: "c"}, content: "3"},
+		})
+		_, err := Extract(src, t.TempDir(), ExtractOptions{MaxFiles: 2})
+		assert.ErrorIs(t, err, ErrLimitReached)
+
+		_, err = Extract(src, t.TempDir(), ExtractOptions{MaxTotalSize: 2})
+		assert.ErrorIs(t, err, ErrLimitReached)
+	})
+
+	t.Run("zip bomb", func(t *testing.T) {
+		buf := new(bytes.Buffer)
+		zw := zip.NewWriter(buf)
+		fw, err := zw.Create("bomb")
+		require.NoError(t, err)
+		_, err = fw.Write(make([]byte, 16<<20))
+		require.NoError(t, err)
+		require.NoError(t, zw.Close())
+
+		src := filepath.Join(t.TempDir(), "bomb.zip")
+		require.NoError(t, os.WriteFile(src, buf.Bytes(), 0o600))
+		_, err = Extract(src, t.TempDir(), ExtractOptions{})
+		assert.ErrorIs(t, err, ErrLimitReached)
+
+		_, err = Extract(src, t.TempDir(), ExtractOptions{MaxRatio: -1})
+		assert.NoError(t, err)
+	})
+}
@@ -0,0 +1,621 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/flate"
+	"compress/gzip"
+	"crypto/rsa"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Format is the container and compression of an archive
+type Format int
+
+const (
+	FormatZip Format = iota
+	FormatTar
+	FormatTarGz
+	FormatTarZstd
+)
+
+// String returns the usual file extension of the format
+func (f Format) String() string {
+	switch f {
+	case FormatZip:
+		return "zip"
+	case FormatTar:
+		return "tar"
+	case FormatTarGz:
+		return "tar.gz"
+	case FormatTarZstd:
+		return "tar.zst"
+	}
+	return fmt.Sprintf("Format(%d)", int(f))
+}
+
+// FormatFromName guesses the format from the extension of the archive name
+func FormatFromName(name string) (Format, error) {
+	lower := strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(lower, ".zip"):
+		return FormatZip, nil
+	case strings.HasSuffix(lower, ".tar"):
+		return FormatTar, nil
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		return FormatTarGz, nil
+	case strings.HasSuffix(lower, ".tar.zst"), strings.HasSuffix(lower, ".tzst"):
+		return FormatTarZstd, nil
+	}
+	return 0, fmt.Errorf("unknown archive format of %s", name)
+}
+
+// defaultModTime is the oldest time a zip header can hold, used for deterministic archives
+var defaultModTime = time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// Options controls what a Writer puts into the archive and how
+type Options struct {
+	Format Format
+	// Level is the compression level, the default of the format when zero
+	Level int
+
+	// Include keeps only the files matching one of the patterns, every file when empty.
+	// Patterns use path.Match syntax and are matched against the slash separated
+	// path inside the archive and against the base name.
+	Include []string
+	// Exclude drops the files and directories matching one of the patterns
+	Exclude []string
+
+	// Deterministic sorts the entries and drops owners and timestamps,
+	// so the same input always produces the same archive
+	Deterministic bool
+	// ModTime is the time stored for every entry of a deterministic archive, 1980-01-01 when zero
+	ModTime time.Time
+
+	// RemoveSources makes Create and CreateFromDir delete the files added from disk once the archive
+	// is complete, see Writer.RemoveSources. Directories walked by AddDir are removed when they
+	// are empty afterwards, the root is kept.
+	RemoveSources bool
+	// Remove is used to delete the sources, os.Remove when nil
+	Remove func(name string) error
+
+	// Password encrypts every zip entry with WinZip AES-256 (AE-2)
+	Password string
+	// Recipient wraps the password for the owner of the key and stores it in the archive comment,
+	// a random password is generated when Password is empty
+	Recipient *rsa.PublicKey
+}
+
+// Writer streams files into a zip or tar archive
+type Writer struct {
+	opts Options
+
+	zw   *zip.Writer
+	tw   *tar.Writer
+	comp io.WriteCloser
+
+	password string
+	names    map[string]bool
+	skip     map[string]bool
+	skipFS   map[string]bool
+	sources  []string
+	dirs     []string
+	fsFiles  []string
+	fsDirs   []string
+	closed   bool
+}
+
+// NewWriter returns a Writer writing the archive to w, nothing is buffered besides the compressor state
+func NewWriter(w io.Writer, opts Options) (*Writer, error) {
+	aw := &Writer{
+		opts:     opts,
+		password: opts.Password,
+		names:    make(map[string]bool),
+		skip:     make(map[string]bool),
+		skipFS:   make(map[string]bool),
+	}
+
+	encrypted := opts.Password != "" || opts.Recipient != nil
+	if encrypted && opts.Format != FormatZip {
+		return nil, fmt.Errorf("encryption is only supported by zip archives")
+	}
+
+	switch opts.Format {
+	case FormatZip:
+		aw.zw = zip.NewWriter(w)
+		if opts.Recipient != nil {
+			if aw.password == "" {
+				password, err := GeneratePassword()
+				if err != nil {
+					return nil, fmt.Errorf("failed to generate password, %v", err)
+				}
+				aw.password = password
+			}
+			wrapped, err := WrapPassword(opts.Recipient, aw.password)
+			if err != nil {
+				return nil, err
+			}
+			if err = aw.zw.SetComment(keyCommentPrefix + wrapped); err != nil {
+				return nil, err
+			}
+		}
+		if opts.Level != 0 {
+			level := opts.Level
+			aw.zw.RegisterCompressor(zip.Deflate, func(out io.Writer) (io.WriteCloser, error) {
+				return flate.NewWriter(out, level)
+			})
+		}
+	case FormatTar:
+		aw.tw = tar.NewWriter(w)
+	case FormatTarGz:
+		level := opts.Level
+		if level == 0 {
+			level = gzip.DefaultCompression
+		}
+		gw, err := gzip.NewWriterLevel(w, level)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create gzip writer, %v", err)
+		}
+		aw.comp = gw
+		aw.tw = tar.NewWriter(gw)
+	case FormatTarZstd:
+		zopts := []zstd.EOption{zstd.WithEncoderConcurrency(1)}
+		if opts.Level != 0 {
+			zopts = append(zopts, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(opts.Level)))
+		}
+		zw, err := zstd.NewWriter(w, zopts...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create zstd writer, %v", err)
+		}
+		aw.comp = zw
+		aw.tw = tar.NewWriter(zw)
+	default:
+		return nil, fmt.Errorf("unsupported archive format %v", opts.Format)
+	}
+	return aw, nil
+}
+
+// Password returns the password the entries are encrypted with, empty for plain archives
+func (w *Writer) Password() string {
+	return w.password
+}
+
+// Skip makes AddDir ignore the file at the provided path, e.g. the archive itself
+func (w *Writer) Skip(p string) {
+	if abs, err := filepath.Abs(p); err == nil {
+		w.skip[abs] = true
+	}
+}
+
+// AddFile adds the file, directory or symlink at src as name, directories are not walked
+func (w *Writer) AddFile(name, src string) error {
+	info, err := os.Lstat(src)
+	if err != nil {
+		return fmt.Errorf("failed to stat %s, %v", src, err)
+	}
+	name = cleanName(name)
+	if info.IsDir() {
+		return w.addEntry(name, src, info)
+	}
+	if !w.matchFile(name) {
+		return nil
+	}
+	return w.addEntry(name, src, info)
+}
+
+// AddDir walks root recursively and adds its content under prefix, which may be empty
+func (w *Writer) AddDir(root, prefix string) error {
+	prefix = cleanName(prefix)
+	return filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return fmt.Errorf("failed to walk %s, %v", p, err)
+		}
+		if abs, err := filepath.Abs(p); err == nil && w.skip[abs] {
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			return nil
+		}
+		name := path.Join(prefix, filepath.ToSlash(rel))
+
+		if matchAny(w.opts.Exclude, name) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return fmt.Errorf("failed to stat %s, %v", p, err)
+		}
+		if d.IsDir() {
+			// explicit entries keep empty directories, they are noise when filtering files
+			if len(w.opts.Include) == 0 {
+				if err := w.addEntry(name, p, info); err != nil {
+					return err
+				}
+			}
+			w.dirs = append(w.dirs, p)
+			return nil
+		}
+		if !w.matchFile(name) {
+			return nil
+		}
+		return w.addEntry(name, p, info)
+	})
+}
+
+// Close finishes the archive, sources are kept until RemoveSources is called.
+// It doesn't close the underlying writer.
+func (w *Writer) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+
+	var err error
+	if w.zw != nil {
+		err = w.zw.Close()
+	} else {
+		err = w.tw.Close()
+		if w.comp != nil {
+			if cerr := w.comp.Close(); err == nil {
+				err = cerr
+			}
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to close archive, %v", err)
+	}
+	return nil
+}
+
+// RemoveSources deletes the files added from disk, it must be called after a successful Close
+// and after the archive itself has been flushed to its final place
+func (w *Writer) RemoveSources() error {
+	if !w.closed {
+		return fmt.Errorf("archive is not closed")
+	}
+	remove := w.opts.Remove
+	if remove == nil {
+		remove = os.Remove
+	}
+	for _, p := range w.sources {
+		if err := remove(p); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove %s, %v", p, err)
+		}
+	}
+	// deepest directories first, non empty ones are kept
+	for i := len(w.dirs) - 1; i >= 0; i-- {
+		_ = os.Remove(w.dirs[i])
+	}
+	w.sources, w.dirs = nil, nil
+	return nil
+}
+
+func (w *Writer) matchFile(name string) bool {
+	if matchAny(w.opts.Exclude, name) {
+		return false
+	}
+	return len(w.opts.Include) == 0 || matchAny(w.opts.Include, name)
+}
+
+func (w *Writer) addEntry(name, src string, info fs.FileInfo) error {
+	var link string
+	if info.Mode()&fs.ModeSymlink != 0 {
+		target, err := os.Readlink(src)
+		if err != nil {
+			return fmt.Errorf("failed to read link %s, %v", src, err)
+		}
+		link = target
+	}
+
+	err := w.writeEntry(name, info, link, func() (io.ReadCloser, error) {
+		return os.Open(src)
+	})
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		w.sources = append(w.sources, src)
+	}
+	return nil
+}
+
+// AddFS walks root in fsys recursively and adds its content under prefix. Symlinks are skipped,
+// the sources are never removed by RemoveSources.
+func (w *Writer) AddFS(fsys fs.FS, root, prefix string) error {
+	prefix = cleanName(prefix)
+	return fs.WalkDir(fsys, root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return fmt.Errorf("failed to walk %s, %v", p, err)
+		}
+		if p == root || d.Type()&fs.ModeSymlink != 0 || w.skipFS[p] {
+			return nil
+		}
+		name := path.Join(prefix, strings.TrimPrefix(p, root+"/"))
+		if root == "." {
+			name = path.Join(prefix, p)
+		}
+
+		if matchAny(w.opts.Exclude, name) {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if !d.IsDir() && !w.matchFile(name) {
+			return nil
+		}
+		if d.IsDir() {
+			w.fsDirs = append(w.fsDirs, p)
+			if len(w.opts.Include) != 0 {
+				return nil
+			}
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return fmt.Errorf("failed to stat %s, %v", p, err)
+		}
+		err = w.writeEntry(name, info, "", func() (io.ReadCloser, error) {
+			return fsys.Open(p)
+		})
+		if err == nil && !d.IsDir() {
+			w.fsFiles = append(w.fsFiles, p)
+		}
+		return err
+	})
+}
+
+// AddedFS returns the paths of the files written by AddFS and of the directories it walked, in walk order.
+// Excluded, filtered and skipped entries and symlinks aren't listed, callers removing the sources
+// of an archive built from a file system should remove only these
+func (w *Writer) AddedFS() (files, dirs []string) {
+	return w.fsFiles, w.fsDirs
+}
+
+// SkipFS makes AddFS ignore the entry at the provided path
+func (w *Writer) SkipFS(p string) {
+	w.skipFS[p] = true
+}
+
+// AddReader adds a regular file with the content read from r, info provides its metadata
+func (w *Writer) AddReader(name string, r io.Reader, info fs.FileInfo) error {
+	name = cleanName(name)
+	if !w.matchFile(name) {
+		return nil
+	}
+	return w.writeEntry(name, info, "", func() (io.ReadCloser, error) {
+		return io.NopCloser(r), nil
+	})
+}
+
+func (w *Writer) writeEntry(name string, info fs.FileInfo, link string, open func() (io.ReadCloser, error)) error {
+	if name == "" || name == "." {
+		return nil
+	}
+	key := strings.TrimSuffix(name, "/")
+	if w.names[key] {
+		return fmt.Errorf("duplicate entry %s in archive", name)
+	}
+	w.names[key] = true
+
+	if w.zw != nil {
+		return w.addZipEntry(name, info, link, open)
+	}
+	return w.addTarEntry(name, info, link, open)
+}
+
+func (w *Writer) modTime(info fs.FileInfo) time.Time {
+	if !w.opts.Deterministic {
+		return info.ModTime()
+	}
+	if w.opts.ModTime.IsZero() {
+		return defaultModTime
+	}
+	return w.opts.ModTime
+}
+
+func (w *Writer) addZipEntry(name string, info fs.FileInfo, link string, open func() (io.ReadCloser, error)) error {
+	hdr, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return fmt.Errorf("failed to create header of %s, %v", name, err)
+	}
+	hdr.Name = name
+	hdr.Modified = w.modTime(info)
+	if info.IsDir() {
+		hdr.Name += "/"
+		hdr.Method = zip.Store
+	} else if link != "" {
+		hdr.Method = zip.Store
+	} else {
+		hdr.Method = zip.Deflate
+	}
+
+	if w.password != "" && !info.IsDir() {
+		ew, err := createEncrypted(w.zw, hdr, w.password, w.opts.Level)
+		if err != nil {
+			return fmt.Errorf("failed to create entry %s, %v", name, err)
+		}
+		if link != "" {
+			_, err = io.WriteString(ew, link)
+		} else {
+			err = copyFrom(ew, name, open)
+		}
+		if err != nil {
+			return err
+		}
+		return ew.Close()
+	}
+
+	fw, err := w.zw.CreateHeader(hdr)
+	if err != nil {
+		return fmt.Errorf("failed to create entry %s, %v", name, err)
+	}
+	switch {
+	case info.IsDir():
+		return nil
+	case link != "":
+		_, err = io.WriteString(fw, link)
+		return err
+	}
+	return copyFrom(fw, name, open)
+}
+
+func (w *Writer) addTarEntry(name string, info fs.FileInfo, link string, open func() (io.ReadCloser, error)) error {
+	hdr, err := tar.FileInfoHeader(info, link)
+	if err != nil {
+		return fmt.Errorf("failed to create header of %s, %v", name, err)
+	}
+	hdr.Name = name
+	if info.IsDir() {
+		hdr.Name += "/"
+	}
+	hdr.ModTime = w.modTime(info)
+	if w.opts.Deterministic {
+		hdr.Uid, hdr.Gid = 0, 0
+		hdr.Uname, hdr.Gname = "", ""
+		hdr.AccessTime, hdr.ChangeTime = time.Time{}, time.Time{}
+		hdr.Format = tar.FormatPAX
+	}
+
+	if err := w.tw.WriteHeader(hdr); err != nil {
+		return fmt.Errorf("failed to write header of %s, %v", name, err)
+	}
+	if !info.Mode().IsRegular() {
+		return nil
+	}
+	return copyFrom(w.tw, name, open)
+}
+
+func copyFrom(w io.Writer, name string, open func() (io.ReadCloser, error)) error {
+	f, err := open()
+	if err != nil {
+		return fmt.Errorf("failed to open %s, %v", name, err)
+	}
+	defer f.Close()
+
+	if _, err = io.Copy(w, f); err != nil {
+		return fmt.Errorf("failed to write %s into archive, %v", name, err)
+	}
+	return nil
+}
+
+// Create writes an archive of the sources to dst. Directories are added recursively under their
+// base name, files under their base name. The archive is written to a temporary file which is
+// renamed to dst on success, and only then sources are removed when requested.
+func Create(dst string, sources []string, opts Options) error {
+	return create(dst, opts, func(w *Writer) error {
+		srcs := append([]string(nil), sources...)
+		if opts.Deterministic {
+			sort.Strings(srcs)
+		}
+		for _, src := range srcs {
+			info, err := os.Stat(src)
+			if err != nil {
+				return fmt.Errorf("failed to stat %s, %v", src, err)
+			}
+			name := filepath.Base(filepath.Clean(src))
+			if info.IsDir() {
+				if err := w.AddFile(name, src); err != nil {
+					return err
+				}
+				if err := w.AddDir(src, name); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := w.AddFile(name, src); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// CreateFromDir writes an archive with the content of dir to dst, entries are relative to dir
+func CreateFromDir(dst, dir string, opts Options) error {
+	return create(dst, opts, func(w *Writer) error {
+		return w.AddDir(dir, "")
+	})
+}
+
+func create(dst string, opts Options, add func(w *Writer) error) (err error) {
+	tmp, err := os.CreateTemp(filepath.Dir(dst), "."+filepath.Base(dst)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create %s, %v", dst, err)
+	}
+	defer func() {
+		if err != nil {
+			_ = tmp.Close()
+			_ = os.Remove(tmp.Name())
+		}
+	}()
+
+	w, err := NewWriter(tmp, opts)
+	if err != nil {
+		return err
+	}
+	w.Skip(dst)
+	w.Skip(tmp.Name())
+
+	if err = add(w); err != nil {
+		return err
+	}
+	if err = w.Close(); err != nil {
+		return err
+	}
+	if err = tmp.Sync(); err != nil {
+		return fmt.Errorf("failed to sync %s, %v", tmp.Name(), err)
+	}
+	if err = tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close %s, %v", tmp.Name(), err)
+	}
+	if err = os.Rename(tmp.Name(), dst); err != nil {
+		return fmt.Errorf("failed to rename %s to %s, %v", tmp.Name(), dst, err)
+	}
+
+	if opts.RemoveSources {
+		return w.RemoveSources()
+	}
+	return nil
+}
+
+func cleanName(name string) string {
+	name = path.Clean(filepath.ToSlash(name))
+	name = strings.TrimLeft(name, "/")
+	if name == "." {
+		return ""
+	}
+	return name
+}
+
+func matchAny(patterns []string, name string) bool {
+	base := path.Base(name)
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+		if ok, _ := path.Match(pattern, base); ok {
+			return true
+		}
+	}
+	return false
+}
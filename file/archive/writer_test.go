@@ -0,0 +1,161 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func makeTree(t *testing.T) string {
+	dir := filepath.Join(t.TempDir(), "profile")
+	files := map[string]string{
+		"Cookies":              "cookies",
+		"Login Data":           "logins",
+		"Network/Cookies":      "network cookies",
+		"Cache/data_0":         "cache",
+		"Extensions/a/b/c.txt": "deep",
+	}
+	for name, content := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(p), 0o700))
+		require.NoError(t, os.WriteFile(p, []byte(content), 0o600))
+	}
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "Empty"), 0o700))
+	return dir
+}
+
+func zipNames(t *testing.T, p string) map[string]string {
+	zr, err := zip.OpenReader(p)
+	require.NoError(t, err)
+	defer zr.Close()
+
+	ret := make(map[string]string)
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		require.NoError(t, err)
+		content, err := io.ReadAll(rc)
+		require.NoError(t, err)
+		_ = rc.Close()
+		ret[f.Name] = string(content)
+	}
+	return ret
+}
+
+func tarNames(t *testing.T, r io.Reader) []string {
+	tr := tar.NewReader(r)
+	var names []string
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		names = append(names, hdr.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestCreateFromDir(t *testing.T) {
+	t.Run("zip is recursive", func(t *testing.T) {
+		dir := makeTree(t)
+		dst := filepath.Join(t.TempDir(), "out.zip")
+		require.NoError(t, CreateFromDir(dst, dir, Options{Format: FormatZip}))
+
+		names := zipNames(t, dst)
+		assert.Equal(t, "deep", names["Extensions/a/b/c.txt"])
+		assert.Equal(t, "network cookies", names["Network/Cookies"])
+		assert.Contains(t, names, "Empty/")
+	})
+
+	t.Run("include and exclude", func(t *testing.T) {
+		dir := makeTree(t)
+		dst := filepath.Join(t.TempDir(), "out.zip")
+		require.NoError(t, CreateFromDir(dst, dir, Options{
+			Format:  FormatZip,
+			Include: []string{"Cookies", "*.txt"},
+			Exclude: []string{"Network"},
+		}))
+
+		names := zipNames(t, dst)
+		assert.Len(t, names, 2)
+		assert.Contains(t, names, "Cookies")
+		assert.Contains(t, names, "Extensions/a/b/c.txt")
+	})
+
+	t.Run("tar.gz and tar.zst", func(t *testing.T) {
+		dir := makeTree(t)
+		out := t.TempDir()
+
+		gzPath := filepath.Join(out, "out.tar.gz")
+		require.NoError(t, CreateFromDir(gzPath, dir, Options{Format: FormatTarGz}))
+		f, err := os.Open(gzPath)
+		require.NoError(t, err)
+		defer f.Close()
+		gr, err := gzip.NewReader(f)
+		require.NoError(t, err)
+		gzNames := tarNames(t, gr)
+
+		zstPath := filepath.Join(out, "out.tar.zst")
+		require.NoError(t, CreateFromDir(zstPath, dir, Options{Format: FormatTarZstd}))
+		f2, err := os.Open(zstPath)
+		require.NoError(t, err)
+		defer f2.Close()
+		zr, err := zstd.NewReader(f2)
+		require.NoError(t, err)
+		defer zr.Close()
+
+		assert.Equal(t, gzNames, tarNames(t, zr))
+		assert.Contains(t, gzNames, "Extensions/a/b/c.txt")
+	})
+
+	t.Run("deterministic", func(t *testing.T) {
+		dir := makeTree(t)
+		out := t.TempDir()
+		opts := Options{Format: FormatTarGz, Deterministic: true}
+
+		first := filepath.Join(out, "first.tar.gz")
+		require.NoError(t, CreateFromDir(first, dir, opts))
+		require.NoError(t, os.Chtimes(filepath.Join(dir, "Cookies"), defaultModTime, defaultModTime))
+		second := filepath.Join(out, "second.tar.gz")
+		require.NoError(t, CreateFromDir(second, dir, opts))
+
+		a, err := os.ReadFile(first)
+		require.NoError(t, err)
+		b, err := os.ReadFile(second)
+		require.NoError(t, err)
+		assert.True(t, bytes.Equal(a, b))
+	})
+
+	t.Run("archive inside the source and remove sources", func(t *testing.T) {
+		dir := makeTree(t)
+		dst := filepath.Join(dir, "self.zip")
+		require.NoError(t, CreateFromDir(dst, dir, Options{Format: FormatZip, RemoveSources: true}))
+
+		names := zipNames(t, dst)
+		assert.NotContains(t, names, "self.zip")
+
+		entries, err := os.ReadDir(dir)
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+		assert.Equal(t, "self.zip", entries[0].Name())
+	})
+
+	t.Run("failure keeps sources", func(t *testing.T) {
+		dir := makeTree(t)
+		dst := filepath.Join(t.TempDir(), "missing", "out.zip")
+		assert.Error(t, CreateFromDir(dst, dir, Options{Format: FormatZip, RemoveSources: true}))
+		_, err := os.Stat(filepath.Join(dir, "Cookies"))
+		assert.NoError(t, err)
+	})
+}
@@ -2,7 +2,22 @@
 
 package file
 
+import (
+	"context"
+	"errors"
+)
+
 func CopyFileUsedByOtherProcess(srcPath, dstPath string) error {
 	// placeholder
 	return CopyFile(srcPath, dstPath)
 }
+
+func CopyFileUsedByOtherProcessContext(ctx context.Context, srcPath, dstPath string, opts *CopyOptions) error {
+	// placeholder
+	return CopyFileContext(ctx, srcPath, dstPath, opts)
+}
+
+// CopyFileFromVolumeContext reads the file from the raw NTFS volume, which is only supported on windows
+func CopyFileFromVolumeContext(ctx context.Context, srcPath, dstPath string, opts *CopyOptions) error {
+	return errors.New("raw volume access is only supported on windows")
+}
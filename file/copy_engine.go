@@ -0,0 +1,262 @@
+package file
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const defaultCopyBufferSize = 1 << 20
+
+// CopyProgressFunc is called after every chunk written by CopyFileContext,
+// total is the size of the source file
+type CopyProgressFunc func(written, total int64)
+
+// CopyOptions controls how CopyFileContext copies a file
+type CopyOptions struct {
+	// BufferSize is the size of the copy buffer, 1MiB when zero
+	BufferSize int
+	// Sync flushes the destination file and its directory to disk before returning
+	Sync bool
+	// PreserveMode keeps the permission bits of the source, otherwise the copy is created with 0600
+	PreserveMode bool
+	// PreserveTimes keeps the access and modification times of the source
+	PreserveTimes bool
+	// PreserveOwner keeps the uid and gid of the source where the platform supports it
+	PreserveOwner bool
+	// PreserveXattrs keeps the extended attributes of the source where the platform supports it
+	PreserveXattrs bool
+	// Sparse skips writing blocks of zeros so that holes are kept in the destination
+	Sparse bool
+	// Reflink tries a copy-on-write clone or an in-kernel copy before falling back to a buffered copy
+	Reflink bool
+	// Progress is notified with the number of bytes copied so far
+	Progress CopyProgressFunc
+}
+
+// CopyFileContext copies the file from the source to the destination with bounded memory.
+// The content is written to a temporary file next to dst which is renamed over dst once
+// everything succeeded, so dst is either the old file or the complete copy.
+func CopyFileContext(ctx context.Context, src, dst string, opts *CopyOptions) error {
+	if opts == nil {
+		opts = &CopyOptions{}
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("failed to open %s, %v", src, err)
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat %s, %v", src, err)
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("%s is not a regular file", src)
+	}
+
+	return copyToAtomic(ctx, in, info, dst, opts, func(out *os.File) error {
+		return copyContent(ctx, out, in, info.Size(), opts)
+	})
+}
+
+// copyToAtomic creates a temporary file next to dst, fills it with write and renames it to dst.
+// info describes the source and is used to restore its metadata, it may be nil.
+func copyToAtomic(ctx context.Context, src *os.File, info os.FileInfo, dst string, opts *CopyOptions, write func(out *os.File) error) (err error) {
+	dir, name := filepath.Split(dst)
+	if dir == "" {
+		dir = "."
+	}
+	tmp, err := os.CreateTemp(dir, "."+name+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file for %s, %v", dst, err)
+	}
+	defer func() {
+		if err != nil {
+			_ = tmp.Close()
+			_ = os.Remove(tmp.Name())
+		}
+	}()
+
+	if err = write(tmp); err != nil {
+		return err
+	}
+	if err = ctx.Err(); err != nil {
+		return err
+	}
+
+	if info != nil {
+		if err = preserveMetadata(src, tmp, info, opts); err != nil {
+			return err
+		}
+	}
+
+	if opts.Sync {
+		if err = tmp.Sync(); err != nil {
+			return fmt.Errorf("failed to sync %s, %v", tmp.Name(), err)
+		}
+	}
+	if err = tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close %s, %v", tmp.Name(), err)
+	}
+
+	// times have to be restored after the last write and close of the file
+	if info != nil && opts.PreserveTimes {
+		if err = os.Chtimes(tmp.Name(), accessTime(info), info.ModTime()); err != nil {
+			return fmt.Errorf("failed to restore times of %s, %v", dst, err)
+		}
+	}
+
+	if err = os.Rename(tmp.Name(), dst); err != nil {
+		return fmt.Errorf("failed to rename %s to %s, %v", tmp.Name(), dst, err)
+	}
+
+	if opts.Sync {
+		syncDir(dir)
+	}
+	return nil
+}
+
+func preserveMetadata(src, dst *os.File, info os.FileInfo, opts *CopyOptions) error {
+	if opts.PreserveMode {
+		if err := dst.Chmod(info.Mode().Perm()); err != nil {
+			return fmt.Errorf("failed to restore mode of %s, %v", dst.Name(), err)
+		}
+	}
+	if opts.PreserveOwner {
+		if err := copyOwner(dst, info); err != nil {
+			return fmt.Errorf("failed to restore owner of %s, %v", dst.Name(), err)
+		}
+	}
+	if opts.PreserveXattrs && src != nil {
+		if err := copyXattrs(src, dst); err != nil {
+			return fmt.Errorf("failed to restore xattrs of %s, %v", dst.Name(), err)
+		}
+	}
+	return nil
+}
+
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	// not every platform allows to sync a directory, it is best effort
+	_ = d.Sync()
+	_ = d.Close()
+}
+
+// copyContent copies size bytes from in to out, trying the fast paths of the platform first
+func copyContent(ctx context.Context, out, in *os.File, size int64, opts *CopyOptions) error {
+	if opts.Reflink {
+		if cloneFile(out, in) == nil {
+			if opts.Progress != nil {
+				opts.Progress(size, size)
+			}
+			return nil
+		}
+		if !opts.Sparse {
+			copied, err := copyFileRange(ctx, out, in, size, opts.Progress)
+			if err == nil {
+				return nil
+			}
+			if !errors.Is(err, errFastCopyUnsupported) {
+				return err
+			}
+			// the kernel may have copied a part before refusing, restart from scratch
+			if copied > 0 {
+				if err := resetCopy(out, in); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	_, err := copyBuffer(ctx, out, in, size, opts)
+	return err
+}
+
+func resetCopy(out, in *os.File) error {
+	if err := out.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := out.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	_, err := in.Seek(0, io.SeekStart)
+	return err
+}
+
+// copyBuffer copies src into out with a bounded buffer, holes are kept when opts.Sparse is set
+func copyBuffer(ctx context.Context, out *os.File, src io.Reader, total int64, opts *CopyOptions) (int64, error) {
+	size := opts.BufferSize
+	if size <= 0 {
+		size = defaultCopyBufferSize
+	}
+	buf := make([]byte, size)
+
+	var written int64
+	var pendingHole bool
+	for {
+		if err := ctx.Err(); err != nil {
+			return written, err
+		}
+
+		n, rerr := io.ReadFull(src, buf)
+		if n > 0 {
+			chunk := buf[:n]
+			if opts.Sparse && isZero(chunk) {
+				if _, err := out.Seek(int64(n), io.SeekCurrent); err != nil {
+					return written, fmt.Errorf("failed to seek in %s, %v", out.Name(), err)
+				}
+				pendingHole = true
+			} else {
+				if _, err := out.Write(chunk); err != nil {
+					return written, fmt.Errorf("failed to write %s, %v", out.Name(), err)
+				}
+				pendingHole = false
+			}
+			written += int64(n)
+			if opts.Progress != nil {
+				opts.Progress(written, total)
+			}
+		}
+
+		if rerr == io.EOF || rerr == io.ErrUnexpectedEOF {
+			break
+		}
+		if rerr != nil {
+			return written, fmt.Errorf("failed to read source, %v", rerr)
+		}
+	}
+
+	// a trailing hole is not materialized by seeking, extend the file to its full size
+	if pendingHole {
+		if err := out.Truncate(written); err != nil {
+			return written, fmt.Errorf("failed to truncate %s, %v", out.Name(), err)
+		}
+	}
+	return written, nil
+}
+
+func isZero(b []byte) bool {
+	for _, c := range b {
+		if c != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// accessTime returns the last access time of the file, or its modification time when unknown
+func accessTime(info os.FileInfo) time.Time {
+	if t, ok := statAccessTime(info); ok {
+		return t
+	}
+	return info.ModTime()
+}
@@ -0,0 +1,116 @@
+//go:build linux
+
+package file
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+var errFastCopyUnsupported = errors.New("in-kernel copy is not supported")
+
+// copyFileRangeChunk bounds a single copy_file_range call so that ctx and progress are honored
+const copyFileRangeChunk = 32 << 20
+
+// cloneFile shares the extents of in with out using FICLONE (btrfs, xfs, ...)
+func cloneFile(out, in *os.File) error {
+	return unix.IoctlFileClone(int(out.Fd()), int(in.Fd()))
+}
+
+// copyFileRange copies in to out inside the kernel, it returns errFastCopyUnsupported
+// when the filesystems involved can't do it
+func copyFileRange(ctx context.Context, out, in *os.File, size int64, progress CopyProgressFunc) (int64, error) {
+	var written int64
+	for written < size {
+		if err := ctx.Err(); err != nil {
+			return written, err
+		}
+
+		chunk := size - written
+		if chunk > copyFileRangeChunk {
+			chunk = copyFileRangeChunk
+		}
+		n, err := unix.CopyFileRange(int(in.Fd()), nil, int(out.Fd()), nil, int(chunk), 0)
+		if err != nil {
+			switch {
+			case errors.Is(err, unix.ENOSYS), errors.Is(err, unix.EXDEV), errors.Is(err, unix.EINVAL),
+				errors.Is(err, unix.EOPNOTSUPP), errors.Is(err, unix.EPERM):
+				return written, errFastCopyUnsupported
+			}
+			return written, fmt.Errorf("failed to copy_file_range, %v", err)
+		}
+		if n == 0 {
+			// the source shrunk while copying
+			break
+		}
+		written += int64(n)
+		if progress != nil {
+			progress(written, size)
+		}
+	}
+	return written, nil
+}
+
+func copyOwner(dst *os.File, info os.FileInfo) error {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return nil
+	}
+	return dst.Chown(int(st.Uid), int(st.Gid))
+}
+
+func copyXattrs(src, dst *os.File) error {
+	size, err := unix.Flistxattr(int(src.Fd()), nil)
+	if err != nil {
+		if errors.Is(err, unix.ENOTSUP) {
+			return nil
+		}
+		return err
+	}
+	if size == 0 {
+		return nil
+	}
+	buf := make([]byte, size)
+	size, err = unix.Flistxattr(int(src.Fd()), buf)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range strings.Split(strings.TrimRight(string(buf[:size]), "\x00"), "\x00") {
+		if name == "" {
+			continue
+		}
+		vsize, err := unix.Fgetxattr(int(src.Fd()), name, nil)
+		if err != nil {
+			return err
+		}
+		value := make([]byte, vsize)
+		vsize, err = unix.Fgetxattr(int(src.Fd()), name, value)
+		if err != nil {
+			return err
+		}
+		if err = unix.Fsetxattr(int(dst.Fd()), name, value[:vsize], 0); err != nil {
+			// attributes of other namespaces (trusted, security) may require privileges
+			if errors.Is(err, unix.EPERM) || errors.Is(err, unix.ENOTSUP) {
+				continue
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+func statAccessTime(info os.FileInfo) (time.Time, bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return time.Time{}, false
+	}
+	return time.Unix(st.Atim.Unix()), true
+}
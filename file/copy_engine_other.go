@@ -0,0 +1,34 @@
+//go:build !linux
+
+package file
+
+import (
+	"context"
+	"errors"
+	"os"
+	"time"
+)
+
+var errFastCopyUnsupported = errors.New("in-kernel copy is not supported")
+
+func cloneFile(out, in *os.File) error {
+	return errFastCopyUnsupported
+}
+
+func copyFileRange(ctx context.Context, out, in *os.File, size int64, progress CopyProgressFunc) (int64, error) {
+	return 0, errFastCopyUnsupported
+}
+
+// copyOwner is a no-op, ownership is only restored on linux
+func copyOwner(dst *os.File, info os.FileInfo) error {
+	return nil
+}
+
+// copyXattrs is a no-op, extended attributes are only restored on linux
+func copyXattrs(src, dst *os.File) error {
+	return nil
+}
+
+func statAccessTime(info os.FileInfo) (time.Time, bool) {
+	return time.Time{}, false
+}
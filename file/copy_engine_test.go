@@ -0,0 +1,96 @@
+package file
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCopyFileContext(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	content := make([]byte, 3*1024*1024+17)
+	_, err := rand.Read(content)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(src, content, 0o640))
+
+	t.Run("copy with progress", func(t *testing.T) {
+		dst := filepath.Join(dir, "dst")
+		var last int64
+		err := CopyFileContext(context.Background(), src, dst, &CopyOptions{
+			BufferSize: 64 * 1024,
+			Sync:       true,
+			Progress:   func(written, total int64) { last = written },
+		})
+		require.NoError(t, err)
+
+		got, err := os.ReadFile(dst)
+		require.NoError(t, err)
+		assert.True(t, bytes.Equal(content, got))
+		assert.Equal(t, int64(len(content)), last)
+
+		info, err := os.Stat(dst)
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+	})
+
+	t.Run("preserve metadata", func(t *testing.T) {
+		mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+		require.NoError(t, os.Chtimes(src, mtime, mtime))
+
+		dst := filepath.Join(dir, "preserved")
+		err := CopyFileContext(context.Background(), src, dst, &CopyOptions{
+			PreserveMode:   true,
+			PreserveTimes:  true,
+			PreserveOwner:  true,
+			PreserveXattrs: true,
+			Reflink:        true,
+		})
+		require.NoError(t, err)
+
+		info, err := os.Stat(dst)
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0o640), info.Mode().Perm())
+		assert.True(t, mtime.Equal(info.ModTime()))
+	})
+
+	t.Run("sparse", func(t *testing.T) {
+		sparse := filepath.Join(dir, "sparse")
+		data := make([]byte, 512*1024)
+		copy(data[100*1024:], "hello")
+		require.NoError(t, os.WriteFile(sparse, data, 0o600))
+
+		dst := filepath.Join(dir, "sparse_copy")
+		err := CopyFileContext(context.Background(), sparse, dst, &CopyOptions{BufferSize: 4096, Sparse: true})
+		require.NoError(t, err)
+
+		got, err := os.ReadFile(dst)
+		require.NoError(t, err)
+		assert.True(t, bytes.Equal(data, got))
+	})
+
+	t.Run("cancelled copy keeps destination", func(t *testing.T) {
+		dst := filepath.Join(dir, "cancelled")
+		require.NoError(t, os.WriteFile(dst, []byte("old"), 0o600))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		err := CopyFileContext(ctx, src, dst, nil)
+		assert.ErrorIs(t, err, context.Canceled)
+
+		got, err := os.ReadFile(dst)
+		require.NoError(t, err)
+		assert.Equal(t, "old", string(got))
+
+		matches, err := filepath.Glob(filepath.Join(dir, ".cancelled.*.tmp"))
+		require.NoError(t, err)
+		assert.Empty(t, matches)
+	})
+}
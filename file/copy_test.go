@@ -1,16 +1,22 @@
 package file
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"testing"
+
+	"github.com/stretchr/testify/require"
 )
 
 func TestCopy(t *testing.T) {
 	srcPath := "C:\\Users\\jarvis\\AppData\\Local\\Google\\Chrome\\User Data\\Default\\Network\\Cookies"
-	dstPath := "Cookies"
+	ws, err := NewWorkspace(context.Background(), &WorkspaceOptions{Dir: t.TempDir()})
+	require.NoError(t, err)
+	defer ws.Close()
+	dstPath := ws.Path("Cookies")
 
-	_, err := os.Open(srcPath)
+	_, err = os.Open(srcPath)
 	if err != nil {
 		fmt.Printf("failed to open file, %v\n", err)
 	}
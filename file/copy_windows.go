@@ -3,11 +3,14 @@
 package file
 
 import (
+	"context"
 	"fmt"
-	"github.com/kbinani/win"
-	windigo "github.com/rodrigocfd/windigo/win"
+	"github.com/w-devin/poketto/file/ntfs"
 	process "github.com/w-devin/poketto/windows"
 	"golang.org/x/sys/windows"
+	"io"
+	"os"
+	"path/filepath"
 	"strings"
 )
 
@@ -16,11 +19,25 @@ var (
 )
 
 func CopyFileUsedByOtherProcess(srcPath, dstPath string) error {
+	return CopyFileUsedByOtherProcessContext(context.Background(), srcPath, dstPath, nil)
+}
+
+// CopyFileUsedByOtherProcessContext copies a file locked by another process through a duplicate of its handle,
+// the content is streamed with a bounded buffer and committed to dstPath atomically.
+// When no process holding the file is found, the file is read from the raw NTFS volume instead.
+func CopyFileUsedByOtherProcessContext(ctx context.Context, srcPath, dstPath string, opts *CopyOptions) error {
+	if opts == nil {
+		opts = &CopyOptions{}
+	}
+
 	// 找到占用文件的进程及文件的句柄号
 	pid, fileHandlerNumber, err := FindProcessAndFileHandlerByFileName(srcPath)
 	if err != nil {
-		fmt.Printf("failed to found process and file handler of %s, %v", srcPath, err)
-		return fmt.Errorf("failed to found process and file handler of %s, %v", srcPath, err)
+		fmt.Printf("failed to found process and file handler of %s, %v, reading raw volume\n", srcPath, err)
+		if rawErr := CopyFileFromVolumeContext(ctx, srcPath, dstPath, opts); rawErr != nil {
+			return fmt.Errorf("failed to found process and file handler of %s, %v, %v", srcPath, err, rawErr)
+		}
+		return nil
 	}
 	fmt.Printf("found process, pid: %+v, file: %+v\n", pid, fileHandlerNumber)
 
@@ -37,34 +54,64 @@ func CopyFileUsedByOtherProcess(srcPath, dstPath string) error {
 		return fmt.Errorf("failed to duplicateHandle of source file")
 	}
 
-	// 创建文件映射
-	mappedPtr, err := windows.CreateFileMapping(duplicatedHandle, nil, windows.PAGE_READONLY, 0, 0, nil)
-	if err != nil {
-		return fmt.Errorf("failed to create file mapping of source file, %v", err)
-	}
+	// the duplicated handle shares its file pointer with the other process,
+	// read with explicit offsets so that neither side moves it for the other
+	src := os.NewFile(uintptr(duplicatedHandle), srcPath)
+	defer src.Close()
 
-	// map the entire file into memory
-	mappedViewPtr, err := windows.MapViewOfFile(mappedPtr, windows.FILE_MAP_READ, 0, 0, 0)
+	info, err := src.Stat()
 	if err != nil {
-		return fmt.Errorf("failed to amp the entire file into memory")
+		return fmt.Errorf("failed to stat duplicated handle of %s, %v", srcPath, err)
 	}
+	fileSize := info.Size()
+	fmt.Printf("fileSize: %d\n", fileSize)
 
 	// copy file
-	dstFilePtr, err := windows.CreateFile(windows.StringToUTF16Ptr(dstPath), windows.GENERIC_READ|windows.GENERIC_WRITE, windows.FILE_SHARE_READ|windows.FILE_SHARE_WRITE, nil, windows.CREATE_ALWAYS, 0, 0)
+	return copyToAtomic(ctx, nil, info, dstPath, opts, func(out *os.File) error {
+		_, err := copyBuffer(ctx, out, io.NewSectionReader(src, 0, fileSize), fileSize, opts)
+		return err
+	})
+}
+
+// CopyFileFromVolumeContext copies a file by parsing the NTFS volume it is stored on, which doesn't need
+// any handle of the file and therefore works for locked files too. Opening the volume requires administrator rights.
+func CopyFileFromVolumeContext(ctx context.Context, srcPath, dstPath string, opts *CopyOptions) error {
+	if opts == nil {
+		opts = &CopyOptions{}
+	}
+	abs, err := filepath.Abs(srcPath)
 	if err != nil {
-		return fmt.Errorf("failed to create file of dstPath: %s, %v", dstPath, err)
+		return err
+	}
+	volumeName := filepath.VolumeName(abs)
+	if len(volumeName) != 2 {
+		return fmt.Errorf("%s is not on a local drive", srcPath)
 	}
-	defer windows.CloseHandle(dstFilePtr)
 
-	duplicatedFile := windigo.HFILE(duplicatedHandle)
-	fileSize, err := duplicatedFile.GetFileSizeEx()
-	fmt.Printf("fileSize: %d\n", fileSize)
+	device, err := os.Open(`\\.\` + volumeName)
+	if err != nil {
+		return fmt.Errorf("failed to open volume %s, %v", volumeName, err)
+	}
+	defer device.Close()
 
-	var written uint32
-	if win.WriteFile(win.HANDLE(dstFilePtr), mappedViewPtr, win.DWORD(fileSize), &written, nil) {
-		return nil
+	// raw volumes only accept whole sectors, 4096 covers 512 byte and 4K native sectors
+	volume, err := ntfs.NewVolume(ntfs.NewAlignedReader(device, 4096))
+	if err != nil {
+		return fmt.Errorf("failed to read volume %s, %v", volumeName, err)
 	}
-	return fmt.Errorf("failed write content to %s", dstPath)
+	f, err := volume.Lookup(abs[len(volumeName):])
+	if err != nil {
+		return fmt.Errorf("failed to find %s on volume %s, %v", srcPath, volumeName, err)
+	}
+	r, err := f.Open()
+	if err != nil {
+		return fmt.Errorf("failed to open %s on volume %s, %v", srcPath, volumeName, err)
+	}
+
+	return copyToAtomic(ctx, nil, f, dstPath, opts, func(out *os.File) error {
+		_, err := copyBuffer(ctx, out, r, r.Size(), opts)
+		return err
+	})
 }
 
 func FindProcessAndFileHandlerByFileName(srcPath string) (pid uint32, fileHandler windows.Handle, err error) {
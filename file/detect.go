@@ -0,0 +1,458 @@
+package file
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"hash/crc32"
+	"io"
+	"math"
+	"os"
+	"unicode/utf8"
+)
+
+// detectSize is the number of bytes DetectType looks at
+const detectSize = 8 * 1024
+
+// FileType is the result of DetectType
+type FileType struct {
+	// MIME is the media type, application/octet-stream when unknown
+	MIME string
+	// Extension is the suggested extension including the dot, .bin when unknown
+	Extension string
+	// Description names the format for humans
+	Description string
+	// Confidence ranges from 0 for unknown data to 1 for an unambiguous signature
+	Confidence float64
+}
+
+// Unknown reports whether no format was recognized
+func (t FileType) Unknown() bool {
+	return t.Confidence == 0
+}
+
+var unknownType = FileType{MIME: "application/octet-stream", Extension: ".bin", Description: "unknown data"}
+
+// detector checks the head of the data, full is set when head holds all of it
+type detector func(head []byte, full bool) (FileType, bool)
+
+var detectors = []detector{
+	detectSQLite,
+	detectZip,
+	detectMagic,
+	detectPE,
+	detectELF,
+	detectPlist,
+	detectLevelDBLog,
+	detectJSON,
+	detectProtobuf,
+	detectText,
+}
+
+// DetectType guesses the format of the data read from r by its magic bytes and structure,
+// at most 8 KiB are read. When r is an io.ReadSeeker, the footer is checked as well for
+// formats like LevelDB tables and the position of r is restored.
+func DetectType(r io.Reader) (FileType, error) {
+	var start int64
+	seeker, _ := r.(io.ReadSeeker)
+	if seeker != nil {
+		var err error
+		if start, err = seeker.Seek(0, io.SeekCurrent); err != nil {
+			seeker = nil
+		}
+	}
+
+	head := make([]byte, detectSize)
+	n, err := io.ReadFull(r, head)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return unknownType, err
+	}
+	head = head[:n]
+	size := int64(n)
+	if n == detectSize {
+		size = -1
+	}
+
+	if seeker != nil {
+		defer seeker.Seek(start, io.SeekStart)
+		if size < 0 {
+			if t, ok := detectLevelDBTable(seeker); ok {
+				return t, nil
+			}
+			if end, err := seeker.Seek(0, io.SeekEnd); err == nil {
+				size = end - start
+			}
+		}
+	}
+	return detectBytes(head, size), nil
+}
+
+// DetectTypeBytes guesses the format of data, e.g. of a BLOB column
+func DetectTypeBytes(data []byte) FileType {
+	return detectBytes(data[:min(len(data), detectSize)], int64(len(data)))
+}
+
+// DetectFileType guesses the format of the file at path
+func DetectFileType(path string) (FileType, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return unknownType, err
+	}
+	defer f.Close()
+	return DetectType(f)
+}
+
+// detectBytes checks head, the first bytes of the data, size is the total size or -1 when it is unknown
+func detectBytes(head []byte, size int64) FileType {
+	if len(head) == 0 {
+		return FileType{MIME: "application/x-empty", Extension: ".bin", Description: "empty", Confidence: 1}
+	}
+	full := size == int64(len(head))
+	best := unknownType
+	for _, detect := range detectors {
+		if t, ok := detect(head, full); ok && t.Confidence > best.Confidence {
+			best = t
+			if best.Confidence >= 1 {
+				return best
+			}
+		}
+	}
+	if t, ok := detectEncrypted(head, size); ok && t.Confidence > best.Confidence {
+		best = t
+	}
+	return best
+}
+
+var sqliteHeader = []byte("SQLite format 3\x00")
+
+func detectSQLite(head []byte, full bool) (FileType, bool) {
+	if bytes.HasPrefix(head, sqliteHeader) {
+		return FileType{MIME: "application/vnd.sqlite3", Extension: ".sqlite", Description: "SQLite database", Confidence: 1}, true
+	}
+	return FileType{}, false
+}
+
+// sqliteMinPageSize is the smallest page size of SQLite, every valid page size is a multiple of it
+const sqliteMinPageSize = 512
+
+// detectEncrypted recognizes data without structure, encrypted databases like SQLCipher consist of
+// whole pages of random looking bytes, so their total size must be a multiple of the page size
+func detectEncrypted(head []byte, size int64) (FileType, bool) {
+	if len(head) < 1024 || entropy(head) < 7.5 {
+		return FileType{}, false
+	}
+	if size > 0 && size%sqliteMinPageSize == 0 {
+		return FileType{MIME: "application/vnd.sqlite3", Extension: ".sqlite", Description: "likely encrypted SQLite database", Confidence: 0.3}, true
+	}
+	return FileType{MIME: "application/octet-stream", Extension: ".bin", Description: "encrypted or compressed data", Confidence: 0.2}, true
+}
+
+// entropy returns the Shannon entropy of b in bits per byte
+func entropy(b []byte) float64 {
+	var counts [256]int
+	for _, c := range b {
+		counts[c]++
+	}
+	var e float64
+	for _, c := range counts {
+		if c > 0 {
+			p := float64(c) / float64(len(b))
+			e -= p * math.Log2(p)
+		}
+	}
+	return e
+}
+
+func detectZip(head []byte, full bool) (FileType, bool) {
+	if bytes.HasPrefix(head, []byte("PK\x05\x06")) {
+		return FileType{MIME: "application/zip", Extension: ".zip", Description: "empty zip archive", Confidence: 1}, true
+	}
+	if !bytes.HasPrefix(head, []byte("PK\x03\x04")) {
+		return FileType{}, false
+	}
+	t := FileType{MIME: "application/zip", Extension: ".zip", Description: "zip archive", Confidence: 1}
+
+	// the first entry of OpenDocument files is a stored mimetype file
+	if len(head) >= 30 {
+		nameLength := int(binary.LittleEndian.Uint16(head[26:]))
+		extraLength := int(binary.LittleEndian.Uint16(head[28:]))
+		size := int(binary.LittleEndian.Uint32(head[18:]))
+		if start := 30 + nameLength + extraLength; string(head[30:min(30+nameLength, len(head))]) == "mimetype" && start+size <= len(head) {
+			switch mime := string(head[start : start+size]); mime {
+			case "application/vnd.oasis.opendocument.text":
+				return FileType{MIME: mime, Extension: ".odt", Description: "OpenDocument text", Confidence: 1}, true
+			case "application/vnd.oasis.opendocument.spreadsheet":
+				return FileType{MIME: mime, Extension: ".ods", Description: "OpenDocument spreadsheet", Confidence: 1}, true
+			case "application/vnd.oasis.opendocument.presentation":
+				return FileType{MIME: mime, Extension: ".odp", Description: "OpenDocument presentation", Confidence: 1}, true
+			case "application/epub+zip":
+				return FileType{MIME: mime, Extension: ".epub", Description: "EPUB book", Confidence: 1}, true
+			}
+		}
+	}
+
+	switch {
+	case bytes.Contains(head, []byte("[Content_Types].xml")) || bytes.Contains(head, []byte("_rels/.rels")):
+		switch {
+		case bytes.Contains(head, []byte("word/")):
+			return FileType{MIME: "application/vnd.openxmlformats-officedocument.wordprocessingml.document", Extension: ".docx", Description: "Word document", Confidence: 0.95}, true
+		case bytes.Contains(head, []byte("xl/")):
+			return FileType{MIME: "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", Extension: ".xlsx", Description: "Excel workbook", Confidence: 0.95}, true
+		case bytes.Contains(head, []byte("ppt/")):
+			return FileType{MIME: "application/vnd.openxmlformats-officedocument.presentationml.presentation", Extension: ".pptx", Description: "PowerPoint presentation", Confidence: 0.95}, true
+		}
+		t.Description = "Office Open XML document"
+		t.Confidence = 0.9
+	case bytes.Contains(head, []byte("AndroidManifest.xml")) || bytes.Contains(head, []byte("classes.dex")):
+		return FileType{MIME: "application/vnd.android.package-archive", Extension: ".apk", Description: "Android package", Confidence: 0.9}, true
+	case bytes.Contains(head, []byte("META-INF/MANIFEST.MF")):
+		return FileType{MIME: "application/java-archive", Extension: ".jar", Description: "Java archive", Confidence: 0.9}, true
+	}
+	return t, true
+}
+
+type magic struct {
+	offset int
+	prefix string
+	t      FileType
+}
+
+var magics = []magic{
+	{0, "%PDF-", FileType{"application/pdf", ".pdf", "PDF document", 1}},
+	{0, "\x89PNG\r\n\x1a\n", FileType{"image/png", ".png", "PNG image", 1}},
+	{0, "\xFF\xD8\xFF", FileType{"image/jpeg", ".jpg", "JPEG image", 1}},
+	{0, "GIF87a", FileType{"image/gif", ".gif", "GIF image", 1}},
+	{0, "GIF89a", FileType{"image/gif", ".gif", "GIF image", 1}},
+	{8, "WEBP", FileType{"image/webp", ".webp", "WebP image", 1}},
+	{0, "II*\x00", FileType{"image/tiff", ".tif", "TIFF image", 0.9}},
+	{0, "MM\x00*", FileType{"image/tiff", ".tif", "TIFF image", 0.9}},
+	{4, "ftypheic", FileType{"image/heic", ".heic", "HEIC image", 1}},
+	{4, "ftypheix", FileType{"image/heic", ".heic", "HEIC image", 1}},
+	{4, "ftypmif1", FileType{"image/heif", ".heif", "HEIF image", 0.9}},
+	{4, "ftypavif", FileType{"image/avif", ".avif", "AVIF image", 1}},
+	{4, "ftypisom", FileType{"video/mp4", ".mp4", "MP4 video", 0.9}},
+	{4, "ftypmp42", FileType{"video/mp4", ".mp4", "MP4 video", 0.9}},
+	{0, "BM", FileType{"image/bmp", ".bmp", "BMP image", 0.4}},
+	{0, "\x00\x00\x01\x00", FileType{"image/vnd.microsoft.icon", ".ico", "icon", 0.4}},
+	{0, "\x1F\x8B\x08", FileType{"application/gzip", ".gz", "gzip compressed data", 1}},
+	{0, "BZh", FileType{"application/x-bzip2", ".bz2", "bzip2 compressed data", 0.6}},
+	{0, "\xFD7zXZ\x00", FileType{"application/x-xz", ".xz", "xz compressed data", 1}},
+	{0, "\x28\xB5\x2F\xFD", FileType{"application/zstd", ".zst", "zstd compressed data", 1}},
+	{0, "7z\xBC\xAF\x27\x1C", FileType{"application/x-7z-compressed", ".7z", "7-Zip archive", 1}},
+	{0, "Rar!\x1A\x07", FileType{"application/vnd.rar", ".rar", "RAR archive", 1}},
+	{0, "\xD0\xCF\x11\xE0\xA1\xB1\x1A\xE1", FileType{"application/x-ole-storage", ".ole", "OLE compound document", 1}},
+	{0, "\xFE\xED\xFA\xCE", FileType{"application/x-mach-binary", ".macho", "Mach-O binary", 1}},
+	{0, "\xFE\xED\xFA\xCF", FileType{"application/x-mach-binary", ".macho", "Mach-O binary", 1}},
+	{0, "\xCE\xFA\xED\xFE", FileType{"application/x-mach-binary", ".macho", "Mach-O binary", 1}},
+	{0, "\xCF\xFA\xED\xFE", FileType{"application/x-mach-binary", ".macho", "Mach-O binary", 1}},
+	{0, "bplist00", FileType{"application/x-bplist", ".plist", "binary property list", 1}},
+}
+
+func detectMagic(head []byte, full bool) (FileType, bool) {
+	for _, m := range magics {
+		if len(head) >= m.offset+len(m.prefix) && string(head[m.offset:m.offset+len(m.prefix)]) == m.prefix {
+			if m.offset == 8 && !bytes.HasPrefix(head, []byte("RIFF")) {
+				continue
+			}
+			return m.t, true
+		}
+	}
+	return FileType{}, false
+}
+
+func detectPE(head []byte, full bool) (FileType, bool) {
+	if !bytes.HasPrefix(head, []byte("MZ")) {
+		return FileType{}, false
+	}
+	t := FileType{MIME: "application/vnd.microsoft.portable-executable", Extension: ".exe", Description: "DOS executable", Confidence: 0.5}
+	if len(head) < 0x40 {
+		return t, true
+	}
+	offset := int(binary.LittleEndian.Uint32(head[0x3C:]))
+	if offset < 0x40 || offset+0x18 > len(head) || string(head[offset:offset+4]) != "PE\x00\x00" {
+		return t, true
+	}
+	const imageFileDLL = 0x2000
+	t.Confidence = 1
+	t.Description = "PE executable"
+	if binary.LittleEndian.Uint16(head[offset+0x16:])&imageFileDLL != 0 {
+		t.Extension = ".dll"
+		t.Description = "PE dynamic link library"
+	}
+	return t, true
+}
+
+func detectELF(head []byte, full bool) (FileType, bool) {
+	if !bytes.HasPrefix(head, []byte("\x7FELF")) || len(head) < 0x12 {
+		return FileType{}, false
+	}
+	t := FileType{MIME: "application/x-executable", Extension: ".elf", Description: "ELF executable", Confidence: 1}
+	order := binary.ByteOrder(binary.LittleEndian)
+	if head[5] == 2 {
+		order = binary.BigEndian
+	}
+	switch order.Uint16(head[0x10:]) {
+	case 1:
+		t.MIME, t.Extension, t.Description = "application/x-object", ".o", "ELF relocatable object"
+	case 3:
+		t.MIME, t.Extension, t.Description = "application/x-sharedlib", ".so", "ELF shared object"
+	case 4:
+		t.MIME, t.Extension, t.Description = "application/x-coredump", ".core", "ELF core dump"
+	}
+	return t, true
+}
+
+func detectPlist(head []byte, full bool) (FileType, bool) {
+	text := bytes.TrimLeft(bytes.TrimPrefix(head, []byte("\xEF\xBB\xBF")), " \t\r\n")
+	if !bytes.HasPrefix(text, []byte("<?xml")) && !bytes.HasPrefix(text, []byte("<!DOCTYPE")) && !bytes.HasPrefix(text, []byte("<plist")) {
+		return FileType{}, false
+	}
+	if bytes.Contains(text, []byte("<!DOCTYPE plist")) || bytes.Contains(text, []byte("<plist")) {
+		return FileType{MIME: "application/x-plist", Extension: ".plist", Description: "XML property list", Confidence: 0.95}, true
+	}
+	if bytes.Contains(text, []byte("<svg")) {
+		return FileType{MIME: "image/svg+xml", Extension: ".svg", Description: "SVG image", Confidence: 0.9}, true
+	}
+	if bytes.Contains(bytes.ToLower(text[:min(len(text), 512)]), []byte("<html")) {
+		return FileType{MIME: "text/html", Extension: ".html", Description: "HTML document", Confidence: 0.8}, true
+	}
+	return FileType{MIME: "application/xml", Extension: ".xml", Description: "XML document", Confidence: 0.8}, true
+}
+
+// levelDBTableMagic ends every LevelDB table file (.ldb, .sst)
+const levelDBTableMagic = 0xdb4775248b80fb57
+
+func detectLevelDBTable(r io.ReadSeeker) (FileType, bool) {
+	if _, err := r.Seek(-8, io.SeekEnd); err != nil {
+		return FileType{}, false
+	}
+	var footer [8]byte
+	if _, err := io.ReadFull(r, footer[:]); err != nil || binary.LittleEndian.Uint64(footer[:]) != levelDBTableMagic {
+		return FileType{}, false
+	}
+	return FileType{MIME: "application/x-leveldb-table", Extension: ".ldb", Description: "LevelDB table", Confidence: 1}, true
+}
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// detectLevelDBLog checks the checksum of the first record of a LevelDB log or MANIFEST file
+func detectLevelDBLog(head []byte, full bool) (FileType, bool) {
+	if len(head) >= 8 && binary.LittleEndian.Uint64(head[len(head)-8:]) == levelDBTableMagic && full {
+		return FileType{MIME: "application/x-leveldb-table", Extension: ".ldb", Description: "LevelDB table", Confidence: 1}, true
+	}
+	if len(head) < 7 {
+		return FileType{}, false
+	}
+	length := int(binary.LittleEndian.Uint16(head[4:]))
+	recordType := head[6]
+	if recordType < 1 || recordType > 2 || length == 0 || 7+length > len(head) {
+		return FileType{}, false
+	}
+	crc := crc32.Update(0, castagnoli, head[6:7+length])
+	masked := (crc>>15 | crc<<17) + 0xa282ead8
+	if masked != binary.LittleEndian.Uint32(head) {
+		return FileType{}, false
+	}
+	return FileType{MIME: "application/x-leveldb-log", Extension: ".log", Description: "LevelDB log", Confidence: 0.95}, true
+}
+
+func detectJSON(head []byte, full bool) (FileType, bool) {
+	text := bytes.TrimLeft(bytes.TrimPrefix(head, []byte("\xEF\xBB\xBF")), " \t\r\n")
+	if len(text) == 0 || (text[0] != '{' && text[0] != '[') {
+		return FileType{}, false
+	}
+	t := FileType{MIME: "application/json", Extension: ".json", Description: "JSON document", Confidence: 0.95}
+	dec := json.NewDecoder(bytes.NewReader(text))
+	for {
+		_, err := dec.Token()
+		if err != nil {
+			// the head of a longer document ends in the middle of a value
+			if !full && (errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)) {
+				t.Confidence = 0.7
+				return t, true
+			}
+			if err == io.EOF {
+				return t, true
+			}
+			return FileType{}, false
+		}
+	}
+}
+
+// detectProtobuf guesses serialized protocol buffers by decoding the wire format, which has no signature
+func detectProtobuf(head []byte, full bool) (FileType, bool) {
+	fields := 0
+	for b := head; len(b) > 0; {
+		key, n := binary.Uvarint(b)
+		if n <= 0 {
+			return protobufGuess(fields, full)
+		}
+		b = b[n:]
+		field, wireType := key>>3, key&7
+		if field == 0 || field > 1<<29-1 {
+			return FileType{}, false
+		}
+		switch wireType {
+		case 0:
+			if _, n = binary.Uvarint(b); n <= 0 {
+				return protobufGuess(fields, full)
+			}
+			b = b[n:]
+		case 1, 5:
+			size := 8
+			if wireType == 5 {
+				size = 4
+			}
+			if len(b) < size {
+				return protobufGuess(fields, full)
+			}
+			b = b[size:]
+		case 2:
+			length, n := binary.Uvarint(b)
+			if n <= 0 {
+				return protobufGuess(fields, full)
+			}
+			b = b[n:]
+			if length > uint64(len(b)) {
+				return protobufGuess(fields, full)
+			}
+			b = b[length:]
+		default:
+			return FileType{}, false
+		}
+		fields++
+	}
+	if fields < 2 {
+		return FileType{}, false
+	}
+	return FileType{MIME: "application/x-protobuf", Extension: ".pb", Description: "protocol buffers message", Confidence: 0.4}, true
+}
+
+// protobufGuess handles a message that runs past the end of the data, which is only fine when
+// the data is the head of something longer
+func protobufGuess(fields int, full bool) (FileType, bool) {
+	if full || fields < 2 {
+		return FileType{}, false
+	}
+	return FileType{MIME: "application/x-protobuf", Extension: ".pb", Description: "protocol buffers message", Confidence: 0.3}, true
+}
+
+func detectText(head []byte, full bool) (FileType, bool) {
+	text := head
+	if !full {
+		// the head may end in the middle of a character
+		for i := 0; i < utf8.UTFMax && len(text) > 0 && !utf8.Valid(text); i++ {
+			text = text[:len(text)-1]
+		}
+	}
+	if !utf8.Valid(text) {
+		return FileType{}, false
+	}
+	for _, c := range text {
+		if c < 0x20 && c != '\t' && c != '\n' && c != '\r' && c != '\f' {
+			return FileType{}, false
+		}
+	}
+	return FileType{MIME: "text/plain", Extension: ".txt", Description: "text", Confidence: 0.5}, true
+}
@@ -0,0 +1,131 @@
+package file
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"archive/zip"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDetectType(t *testing.T) {
+	random := make([]byte, 4096)
+	_, err := rand.Read(random)
+	require.NoError(t, err)
+
+	docx := &bytes.Buffer{}
+	zw := zip.NewWriter(docx)
+	for _, name := range []string{"[Content_Types].xml", "_rels/.rels", "word/document.xml"} {
+		w, err := zw.Create(name)
+		require.NoError(t, err)
+		_, _ = w.Write([]byte("<xml/>"))
+	}
+	require.NoError(t, zw.Close())
+
+	pe := make([]byte, 0x200)
+	copy(pe, "MZ")
+	binary.LittleEndian.PutUint32(pe[0x3C:], 0x80)
+	copy(pe[0x80:], "PE\x00\x00")
+	binary.LittleEndian.PutUint16(pe[0x80+0x16:], 0x2102)
+
+	elf := make([]byte, 64)
+	copy(elf, "\x7FELF\x02\x01\x01")
+	binary.LittleEndian.PutUint16(elf[0x10:], 3)
+
+	payload := []byte("\x01\x00\x00\x00\x00\x00\x00\x00")
+	record := append([]byte{1}, payload...)
+	crc := crc32.Checksum(record, crc32.MakeTable(crc32.Castagnoli))
+	levelDBLog := binary.LittleEndian.AppendUint32(nil, (crc>>15|crc<<17)+0xa282ead8)
+	levelDBLog = binary.LittleEndian.AppendUint16(levelDBLog, uint16(len(payload)))
+	levelDBLog = append(levelDBLog, record...)
+
+	tests := []struct {
+		name      string
+		data      []byte
+		extension string
+		mime      string
+	}{
+		{"sqlite", append([]byte("SQLite format 3\x00"), make([]byte, 100)...), ".sqlite", "application/vnd.sqlite3"},
+		{"encrypted sqlite", random, ".sqlite", "application/vnd.sqlite3"},
+		{"docx", docx.Bytes(), ".docx", "application/vnd.openxmlformats-officedocument.wordprocessingml.document"},
+		{"pdf", []byte("%PDF-1.7\n"), ".pdf", "application/pdf"},
+		{"png", []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"), ".png", "image/png"},
+		{"jpeg", []byte("\xFF\xD8\xFF\xE0\x00\x10JFIF"), ".jpg", "image/jpeg"},
+		{"webp", []byte("RIFF\x00\x00\x00\x00WEBPVP8 "), ".webp", "image/webp"},
+		{"dll", pe, ".dll", "application/vnd.microsoft.portable-executable"},
+		{"elf", elf, ".so", "application/x-sharedlib"},
+		{"bplist", []byte("bplist00\xd1\x01\x02"), ".plist", "application/x-bplist"},
+		{"xml plist", []byte(`<?xml version="1.0"?><!DOCTYPE plist><plist version="1.0"><dict/></plist>`), ".plist", "application/x-plist"},
+		{"leveldb log", levelDBLog, ".log", "application/x-leveldb-log"},
+		{"json", []byte(` {"os_crypt": {"encrypted_key": "RFBBUEk="}}`), ".json", "application/json"},
+		{"protobuf", []byte("\x08\x96\x01\x12\x07testing\x1d\x00\x00\x80\x3f"), ".pb", "application/x-protobuf"},
+		{"text", []byte("hello world\n"), ".txt", "text/plain"},
+		{"empty", nil, ".bin", "application/x-empty"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ft, err := DetectType(bytes.NewReader(tt.data))
+			require.NoError(t, err)
+			assert.Equal(t, tt.extension, ft.Extension)
+			assert.Equal(t, tt.mime, ft.MIME)
+			assert.Equal(t, ft, DetectTypeBytes(tt.data))
+		})
+	}
+
+	assert.True(t, DetectTypeBytes([]byte{0x00, 0x01, 0xFF}).Unknown())
+
+	t.Run("truncated json", func(t *testing.T) {
+		data := []byte(`[` + string(bytes.Repeat([]byte(`"value",`), 2000)) + `"end"]`)
+		ft := DetectTypeBytes(data)
+		assert.Equal(t, ".json", ft.Extension)
+		assert.Less(t, ft.Confidence, 0.95)
+	})
+
+	t.Run("random data not aligned to pages", func(t *testing.T) {
+		for _, size := range []int{9000, 10001, 100000} {
+			data := make([]byte, size)
+			_, err := rand.Read(data)
+			require.NoError(t, err)
+			// field 0 is invalid, random data must not pass as the head of a protobuf message
+			data[0] = 0
+			ft, err := DetectType(bytes.NewReader(data))
+			require.NoError(t, err)
+			assert.Equal(t, "application/octet-stream", ft.MIME, size)
+			assert.Equal(t, ft, DetectTypeBytes(data), size)
+		}
+
+		// the total size is unknown without seeking, the data can't be claimed to be a database
+		data := make([]byte, 4*detectSize)
+		_, err := rand.Read(data)
+		require.NoError(t, err)
+		data[0] = 0
+		ft, err := DetectType(bytes.NewBuffer(data))
+		require.NoError(t, err)
+		assert.Equal(t, "application/octet-stream", ft.MIME)
+		ft, err = DetectType(bytes.NewReader(data))
+		require.NoError(t, err)
+		assert.Equal(t, ".sqlite", ft.Extension)
+	})
+
+	t.Run("leveldb table", func(t *testing.T) {
+		data := make([]byte, 10000)
+		binary.LittleEndian.PutUint64(data[len(data)-8:], levelDBTableMagic)
+		p := filepath.Join(t.TempDir(), "000005.ldb")
+		require.NoError(t, os.WriteFile(p, data, 0o600))
+		ft, err := DetectFileType(p)
+		require.NoError(t, err)
+		assert.Equal(t, ".ldb", ft.Extension)
+
+		r := bytes.NewReader(data)
+		_, err = DetectType(r)
+		require.NoError(t, err)
+		assert.Equal(t, int64(len(data)), int64(r.Len()))
+	})
+}
@@ -1,39 +1,24 @@
 package file
 
 import (
-	"archive/zip"
-	"bytes"
-	"errors"
+	"context"
 	"fmt"
-	cp "github.com/otiai10/copy"
+	"github.com/w-devin/poketto/file/archive"
 	"os"
-	"path"
 	"path/filepath"
 	"strings"
 )
 
 // IsFileExists checks if the file exists in the provided path
 func IsFileExists(filename string) bool {
-	info, err := os.Stat(filename)
-	if os.IsNotExist(err) {
-		return false
-	}
-	if err != nil {
-		return false
-	}
-	return !info.IsDir()
+	fsys, name := splitOSPath(filename)
+	return IsFileExistsFS(fsys, name)
 }
 
 // IsDirExists checks if the folder exists
 func IsDirExists(folder string) bool {
-	info, err := os.Stat(folder)
-	if os.IsNotExist(err) {
-		return false
-	}
-	if err != nil {
-		return false
-	}
-	return info.IsDir()
+	fsys, name := splitOSPath(folder)
+	return IsDirExistsFS(fsys, name)
 }
 
 func CreateFolder(folderName string) error {
@@ -48,49 +33,43 @@ func CreateFolder(folderName string) error {
 	return nil
 }
 
-// FilesInFolder returns the filepath contains in the provided folder
+// FilesInFolder returns the filepath contains in the provided folder,
+// filename is matched case-insensitively against the end of the path
 func FilesInFolder(dir, filename string) ([]string, error) {
-	if !IsDirExists(dir) {
-		return nil, errors.New(dir + "folder does not exist")
+	found, err := FilesInFolderFS(NewOSFS(dir), ".", filename)
+	if found == nil {
+		return nil, err
+	}
+	files := make([]string, 0, len(found))
+	for _, p := range found {
+		files = append(files, filepath.Join(dir, filepath.FromSlash(p)))
 	}
-	var files []string
-	err := filepath.Walk(dir, func(path string, f os.FileInfo, err error) error {
-		if !f.IsDir() && strings.HasSuffix(path, filename) {
-			files = append(files, path)
-		}
-		return err
-	})
 	return files, err
 }
 
 // ReadFile reads the file from the provided path
 func ReadFile(filename string) (string, error) {
-	s, err := os.ReadFile(filename)
-	return string(s), err
+	fsys, name := splitOSPath(filename)
+	return ReadFileFS(fsys, name)
 }
 
 // CopyDir copies the directory from the source to the destination
 // skip the file if you don't want to copy
 func CopyDir(src, dst, skip string) error {
-	s := cp.Options{Skip: func(info os.FileInfo, src, dst string) (bool, error) {
-		return strings.HasSuffix(strings.ToLower(src), skip), nil
-	}}
-	return cp.Copy(src, dst, s)
+	return CopyDirFS(NewOSFS(src), ".", NewOSFS(dst), ".", skip)
 }
 
 // CopyDirHasSuffix copies the directory from the source to the destination
 // contain is the file if you want to copy, and rename copied filename with dir/index_filename
 func CopyDirHasSuffix(src, dst, suffix string) error {
-	var files []string
-	err := filepath.Walk(src, func(path string, f os.FileInfo, err error) error {
-		if !f.IsDir() && strings.HasSuffix(strings.ToLower(f.Name()), suffix) {
-			files = append(files, path)
-		}
-		return err
-	})
+	found, err := Find(os.DirFS(src), ".", FindOptions{Suffixes: []string{suffix}, SuffixFold: true})
 	if err != nil {
 		return err
 	}
+	files := make([]string, 0, len(found))
+	for _, p := range found {
+		files = append(files, filepath.Join(src, filepath.FromSlash(p)))
+	}
 	if err := os.MkdirAll(dst, 0o700); err != nil {
 		return err
 	}
@@ -105,28 +84,27 @@ func CopyDirHasSuffix(src, dst, suffix string) error {
 	return nil
 }
 
-// CopyFile copies the file from the source to the destination
+// CopyFile copies the file from the source to the destination,
+// see CopyFileContext for the options of the copy
 func CopyFile(src, dst string) error {
-	s, err := os.ReadFile(src)
-	if err != nil {
-		return fmt.Errorf("failed to ReadFile, %v", err)
-	}
-	err = os.WriteFile(dst, s, 0o600)
-	if err != nil {
-		return fmt.Errorf("failed to WriteFile, %v", err)
-	}
-	return nil
+	return CopyFileContext(context.Background(), src, dst, nil)
 }
 
-// ItemName returns the filename from the provided path
+// nameOptions makes the names of ItemName and BrowserName valid everywhere, names which had
+// to be changed get a hash so that different profiles don't collide. Callers which need unique
+// names in one directory number them with their own NameMap.
+var nameOptions = &NameOptions{HashSuffix: true}
+
+// ItemName returns the filename of an exported item of the browser
 func ItemName(browser, item, ext string) string {
 	replace := strings.NewReplacer(" ", "_", ".", "_", "-", "_")
-	return strings.ToLower(fmt.Sprintf("%s_%s.%s", replace.Replace(browser), item, ext))
+	return SanitizeName(strings.ToLower(fmt.Sprintf("%s_%s.%s", replace.Replace(browser), item, ext)), nameOptions)
 }
 
+// BrowserName returns the directory name of a browser profile of the user
 func BrowserName(browser, user string) string {
 	replace := strings.NewReplacer(" ", "_", ".", "_", "-", "_", "Profile", "user")
-	return strings.ToLower(fmt.Sprintf("%s_%s", replace.Replace(browser), replace.Replace(user)))
+	return SanitizeName(strings.ToLower(fmt.Sprintf("%s_%s", replace.Replace(browser), replace.Replace(user))), nameOptions)
 }
 
 // ParentDir returns the parent directory of the provided path
@@ -144,44 +122,16 @@ func ParentBaseDir(p string) string {
 	return BaseDir(ParentDir(p))
 }
 
-// CompressDir compresses the directory into a zip file
+// CompressDir compresses the directory recursively into dir.zip next to it,
+// the files are shredded once the archive has been written completely
 func CompressDir(dir string) error {
-	files, err := os.ReadDir(dir)
-	if err != nil {
-		return err
-	}
-	b := new(bytes.Buffer)
-	zw := zip.NewWriter(b)
-	for _, f := range files {
-		fw, err := zw.Create(f.Name())
-		if err != nil {
-			return err
-		}
-		name := path.Join(dir, f.Name())
-		content, err := os.ReadFile(name)
-		if err != nil {
-			return err
-		}
-		_, err = fw.Write(content)
-		if err != nil {
-			return err
-		}
-		err = os.Remove(name)
-		if err != nil {
-			return err
-		}
-	}
-	if err := zw.Close(); err != nil {
-		return err
-	}
-	filename := filepath.Join(dir, fmt.Sprintf("%s.zip", dir))
-	outFile, err := os.Create(filepath.Clean(filename))
-	if err != nil {
-		return err
-	}
-	_, err = b.WriteTo(outFile)
-	if err != nil {
-		return err
-	}
-	return outFile.Close()
+	fsys, name := splitOSPath(dir)
+	return CompressDirFS(fsys, name, archive.Options{RemoveSources: true})
+}
+
+// CompressDirWithPassword compresses the directory like CompressDir,
+// every entry is encrypted with WinZip AES-256 so that standard tools can open it with the password
+func CompressDirWithPassword(dir, password string) error {
+	fsys, name := splitOSPath(dir)
+	return CompressDirFS(fsys, name, archive.Options{RemoveSources: true, Password: password})
 }
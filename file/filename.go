@@ -0,0 +1,242 @@
+package file
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// NameRules selects the file systems a name has to be valid on
+type NameRules int
+
+const (
+	// NamePortable makes names valid on Windows and POSIX file systems
+	NamePortable NameRules = iota
+	// NameWindows only applies the rules of Windows
+	NameWindows
+	// NamePOSIX only forbids slashes, NUL and the names "." and ".."
+	NamePOSIX
+)
+
+// NameOptions controls SanitizeName and NameMap
+type NameOptions struct {
+	Rules NameRules
+	// MaxLength is the maximum length of a name in bytes, 255 when zero. Longer names are
+	// shortened and get a hash of the original name appended, which keeps them apart.
+	MaxLength int
+	// Replacement replaces invalid characters, "_" when empty
+	Replacement string
+	// HashSuffix appends a hash of the original name whenever it had to be changed,
+	// so that different names never end up the same
+	HashSuffix bool
+}
+
+func (o *NameOptions) maxLength() int {
+	if o.MaxLength <= 0 {
+		return 255
+	}
+	return o.MaxLength
+}
+
+func (o *NameOptions) replacement() string {
+	if o.Replacement == "" {
+		return "_"
+	}
+	return o.Replacement
+}
+
+func (o *NameOptions) windows() bool {
+	return o.Rules == NamePortable || o.Rules == NameWindows
+}
+
+// fold returns the key names are compared by, Windows file systems ignore the case
+func (o *NameOptions) fold(name string) string {
+	if o.windows() {
+		return strings.ToLower(name)
+	}
+	return name
+}
+
+// windowsReserved are the device names which can't be used as file names on Windows,
+// not even with an extension
+var windowsReserved = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true, "CONIN$": true, "CONOUT$": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true, "COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true, "LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// SanitizeName turns name into a valid file name, names which are already valid are returned as they are
+func SanitizeName(name string, opts *NameOptions) string {
+	if opts == nil {
+		opts = &NameOptions{}
+	}
+	sanitized, changed := opts.sanitize(name)
+	if (changed && opts.HashSuffix) || len(sanitized) > opts.maxLength() {
+		sanitized = withSuffix(sanitized, "~"+nameHash(name), opts.maxLength())
+	}
+	return sanitized
+}
+
+// sanitize returns whether the name had to be changed
+func (o *NameOptions) sanitize(name string) (string, bool) {
+	replacement := o.replacement()
+	var b strings.Builder
+	changed := false
+	for i, r := range name {
+		invalid := r == 0 || r == '/'
+		if r == utf8.RuneError {
+			_, size := utf8.DecodeRuneInString(name[i:])
+			invalid = invalid || size == 1
+		}
+		if o.windows() {
+			invalid = invalid || r < 0x20 || strings.ContainsRune(`<>:"\|?*`, r)
+		}
+		if invalid {
+			b.WriteString(replacement)
+			changed = true
+			continue
+		}
+		b.WriteRune(r)
+	}
+	s := b.String()
+
+	if o.windows() {
+		// Windows drops trailing dots and spaces
+		if trimmed := strings.TrimRight(s, ". "); trimmed != s {
+			s = trimmed
+			changed = true
+		}
+		stem, _, _ := strings.Cut(s, ".")
+		if windowsReserved[strings.ToUpper(strings.TrimRight(stem, " "))] {
+			s = replacement + s
+			changed = true
+		}
+	}
+	if s == "" || s == "." || s == ".." {
+		s = strings.Repeat(replacement, max(len(s), 1))
+		changed = true
+	}
+	return s, changed
+}
+
+// nameHash is a short hash telling names apart which were sanitized to the same
+func nameHash(name string) string {
+	sum := sha256.Sum256([]byte(name))
+	return hex.EncodeToString(sum[:4])
+}
+
+// withSuffix inserts suffix in front of the extension of name and shortens the name to maxLength bytes
+func withSuffix(name, suffix string, maxLength int) string {
+	ext := filepath.Ext(name)
+	if len(ext) > 16 || len(ext)+len(suffix) >= maxLength {
+		ext = ""
+	}
+	stem := strings.TrimSuffix(name, ext)
+	limit := maxLength - len(suffix) - len(ext)
+	if limit < 0 {
+		limit = 0
+	}
+	return truncateName(stem, limit) + truncateName(suffix+ext, maxLength)
+}
+
+// truncateName shortens name to at most limit bytes, cutting at a character boundary
+func truncateName(name string, limit int) string {
+	if len(name) <= limit {
+		return name
+	}
+	for limit > 0 && !utf8.RuneStart(name[limit]) {
+		limit--
+	}
+	return name[:limit]
+}
+
+// NameMap hands out sanitized names which are unique in one directory and remembers the
+// original names, e.g. to restore the profile names of an export. Names which are taken
+// are numbered like "Cookies-2".
+type NameMap struct {
+	opts NameOptions
+
+	mu        sync.Mutex
+	names     map[string]string // folded sanitized name -> original
+	sanitized map[string]string // original -> sanitized name
+}
+
+// NewNameMap returns an empty NameMap
+func NewNameMap(opts *NameOptions) *NameMap {
+	if opts == nil {
+		opts = &NameOptions{}
+	}
+	return &NameMap{opts: *opts, names: map[string]string{}, sanitized: map[string]string{}}
+}
+
+// Name returns the sanitized name for original, the same original always gets the same name
+func (m *NameMap) Name(original string) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if name, ok := m.sanitized[original]; ok {
+		return name
+	}
+
+	name := SanitizeName(original, &m.opts)
+	for i := 2; ; i++ {
+		if _, taken := m.names[m.opts.fold(name)]; !taken {
+			break
+		}
+		name = withSuffix(SanitizeName(original, &m.opts), fmt.Sprintf("-%d", i), m.opts.maxLength())
+	}
+	m.names[m.opts.fold(name)] = original
+	m.sanitized[original] = name
+	return name
+}
+
+// Original returns the name the sanitized name was handed out for
+func (m *NameMap) Original(name string) (string, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	original, ok := m.names[m.opts.fold(name)]
+	return original, ok
+}
+
+// nameMapJSON is the mapping table written by WriteJSON
+type nameMapJSON struct {
+	Version int               `json:"version"`
+	Names   map[string]string `json:"names"`
+}
+
+// WriteJSON writes the mapping table from the sanitized names to the original names
+func (m *NameMap) WriteJSON(w io.Writer) error {
+	m.mu.Lock()
+	table := nameMapJSON{Version: 1, Names: make(map[string]string, len(m.sanitized))}
+	for original, name := range m.sanitized {
+		table.Names[name] = original
+	}
+	m.mu.Unlock()
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(table)
+}
+
+// ReadNameMap reads a mapping table written by WriteJSON, names handed out afterwards
+// don't collide with the names in it
+func ReadNameMap(r io.Reader, opts *NameOptions) (*NameMap, error) {
+	var table nameMapJSON
+	if err := json.NewDecoder(r).Decode(&table); err != nil {
+		return nil, fmt.Errorf("failed to read name map, %v", err)
+	}
+	if table.Version != 1 {
+		return nil, fmt.Errorf("unsupported name map version %d", table.Version)
+	}
+	m := NewNameMap(opts)
+	for name, original := range table.Names {
+		m.names[m.opts.fold(name)] = original
+		m.sanitized[original] = name
+	}
+	return m, nil
+}
@@ -0,0 +1,99 @@
+package file
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSanitizeName(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules NameRules
+		want  string
+	}{
+		{"Cookies", NamePortable, "Cookies"},
+		{"Login Data", NamePortable, "Login Data"},
+		{"个人资料 1", NamePortable, "个人资料 1"},
+		{"a/b:c*d?", NamePortable, "a_b_c_d_"},
+		{"a/b:c*d?", NamePOSIX, "a_b:c*d?"},
+		{"con", NamePortable, "_con"},
+		{"CON.txt", NameWindows, "_CON.txt"},
+		{"COM1 .log", NamePortable, "_COM1 .log"},
+		{"con", NamePOSIX, "con"},
+		{"console", NamePortable, "console"},
+		{"trailing. ", NamePortable, "trailing"},
+		{"..", NamePortable, "_"},
+		{"..", NamePOSIX, "__"},
+		{"", NamePOSIX, "_"},
+		{"tab\there", NamePortable, "tab_here"},
+		{"bad\xffutf8", NamePOSIX, "bad_utf8"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, SanitizeName(tt.name, &NameOptions{Rules: tt.rules}), tt.name)
+	}
+
+	long := strings.Repeat("长", 100) + ".sqlite"
+	short := SanitizeName(long, nil)
+	assert.LessOrEqual(t, len(short), 255)
+	assert.True(t, utf8.ValidString(short))
+	assert.True(t, strings.HasSuffix(short, "~"+nameHash(long)+".sqlite"))
+	assert.NotEqual(t, short, SanitizeName(strings.Repeat("长", 101)+".sqlite", nil))
+	assert.Len(t, SanitizeName(strings.Repeat("a", 300), &NameOptions{MaxLength: 20}), 20)
+
+	// the suffix alone doesn't fit, it's cut at a character boundary as well
+	cut := withSuffix("name", "~长长长", 5)
+	assert.True(t, utf8.ValidString(cut))
+	assert.Equal(t, "~长", cut)
+
+	hashed := &NameOptions{HashSuffix: true}
+	assert.Equal(t, "plain.txt", SanitizeName("plain.txt", hashed))
+	assert.NotEqual(t, SanitizeName("a/b", hashed), SanitizeName("a:b", hashed))
+	assert.Equal(t, "a_b~"+nameHash("a/b"), SanitizeName("a/b", hashed))
+}
+
+func TestItemAndBrowserName(t *testing.T) {
+	assert.Equal(t, "google_chrome_cookie.json", ItemName("Google Chrome", "cookie", "json"))
+	assert.Equal(t, "microsoft_edge_dev_user_1", BrowserName("Microsoft Edge-Dev", "Profile 1"))
+	assert.Equal(t, "chrome_default", BrowserName("Chrome", "Default"))
+
+	assert.NotEqual(t, BrowserName("chrome", "a/b"), BrowserName("chrome", "a:b"))
+	assert.NotContains(t, BrowserName("chrome", "a/b"), "/")
+	assert.NotContains(t, ItemName("chrome", "x:y", "csv"), ":")
+}
+
+func TestNameMap(t *testing.T) {
+	m := NewNameMap(nil)
+	assert.Equal(t, "a_b", m.Name("a/b"))
+	assert.Equal(t, "a_b-2", m.Name("a:b"))
+	assert.Equal(t, "A_B-3", m.Name("A|B"))
+	assert.Equal(t, "a_b", m.Name("a/b"))
+	assert.Equal(t, "Default", m.Name("Default"))
+
+	original, ok := m.Original("A_B-2")
+	require.True(t, ok)
+	assert.Equal(t, "a:b", original)
+	_, ok = m.Original("missing")
+	assert.False(t, ok)
+
+	posix := NewNameMap(&NameOptions{Rules: NamePOSIX})
+	assert.Equal(t, "Cookies", posix.Name("Cookies"))
+	assert.Equal(t, "cookies", posix.Name("cookies"))
+
+	var buf bytes.Buffer
+	require.NoError(t, m.WriteJSON(&buf))
+	read, err := ReadNameMap(&buf, nil)
+	require.NoError(t, err)
+	original, ok = read.Original("a_b-3")
+	require.True(t, ok)
+	assert.Equal(t, "A|B", original)
+	assert.Equal(t, "a_b-2", read.Name("a:b"))
+	assert.Equal(t, "a_b-4", read.Name("a*b"))
+
+	_, err = ReadNameMap(strings.NewReader(`{"version": 2}`), nil)
+	assert.Error(t, err)
+}
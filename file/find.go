@@ -0,0 +1,288 @@
+package file
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bmatcuk/doublestar/v4"
+)
+
+// SymlinkPolicy tells Find what to do with symbolic links
+type SymlinkPolicy int
+
+const (
+	// SymlinkSkip ignores symlinks
+	SymlinkSkip SymlinkPolicy = iota
+	// SymlinkInclude reports symlinks like files without following them
+	SymlinkInclude
+	// SymlinkFollow follows symlinks, every target directory is walked once
+	SymlinkFollow
+)
+
+// FindOptions selects the files returned by Find, a file has to pass every filter that is set
+type FindOptions struct {
+	// Patterns are doublestar globs (e.g. "**/Network/Cookies") matched against the path relative
+	// to the root, patterns without a slash are matched against the base name
+	Patterns []string
+	// Suffixes are matched against the end of the relative path
+	Suffixes []string
+	// SuffixFold matches Suffixes case-insensitively
+	SuffixFold bool
+	// Regexps are matched against the relative path
+	Regexps []*regexp.Regexp
+	// Exclude drops the files and prunes the directories matching one of these globs
+	Exclude []string
+
+	MinSize int64
+	// MaxSize is the maximum file size, no limit when zero
+	MaxSize        int64
+	ModifiedAfter  time.Time
+	ModifiedBefore time.Time
+
+	// MaxDepth limits how deep Find descends, 1 only looks at the entries of the root, no limit when zero
+	MaxDepth int
+	Symlinks SymlinkPolicy
+	// IncludeDirs reports matching directories as well
+	IncludeDirs bool
+	// Concurrency is the number of directories read in parallel, the number of CPUs when zero
+	Concurrency int
+}
+
+// FindError is a failure on one path, Find goes on with the rest of the tree
+type FindError struct {
+	Path string
+	Err  error
+}
+
+func (e *FindError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Path, e.Err)
+}
+
+func (e *FindError) Unwrap() error {
+	return e.Err
+}
+
+// Validate checks the glob patterns of the options
+func (o *FindOptions) Validate() error {
+	for _, p := range append(append([]string(nil), o.Patterns...), o.Exclude...) {
+		if !doublestar.ValidatePattern(p) {
+			return fmt.Errorf("invalid pattern %q", p)
+		}
+	}
+	return nil
+}
+
+// Match reports whether a file with the relative path rel and info passes the filters,
+// depth and exclusions of directories are not considered
+func (o *FindOptions) Match(rel string, info fs.FileInfo) bool {
+	if matchGlobs(o.Exclude, rel) {
+		return false
+	}
+	if len(o.Patterns) > 0 && !matchGlobs(o.Patterns, rel) {
+		return false
+	}
+	if len(o.Suffixes) > 0 && !hasSuffix(rel, o.Suffixes, o.SuffixFold) {
+		return false
+	}
+	for _, re := range o.Regexps {
+		if !re.MatchString(rel) {
+			return false
+		}
+	}
+	if info == nil {
+		return true
+	}
+	if !info.IsDir() {
+		if info.Size() < o.MinSize || (o.MaxSize > 0 && info.Size() > o.MaxSize) {
+			return false
+		}
+	}
+	if !o.ModifiedAfter.IsZero() && !info.ModTime().After(o.ModifiedAfter) {
+		return false
+	}
+	if !o.ModifiedBefore.IsZero() && !info.ModTime().Before(o.ModifiedBefore) {
+		return false
+	}
+	return true
+}
+
+// Find walks root in fsys concurrently and returns the sorted paths of the matching files.
+// Errors on single entries don't stop the walk, they are returned joined together
+// with everything that has been found.
+func Find(fsys fs.FS, root string, opts FindOptions) ([]string, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	info, err := fs.Stat(fsys, root)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", root)
+	}
+
+	workers := opts.Concurrency
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	f := &finder{
+		fsys: fsys,
+		root: root,
+		opts: &opts,
+		sem:  make(chan struct{}, workers),
+	}
+	f.wg.Add(1)
+	go f.walk(root, 0)
+	f.wg.Wait()
+
+	sort.Strings(f.found)
+	return f.found, errors.Join(f.errs...)
+}
+
+type finder struct {
+	fsys fs.FS
+	root string
+	opts *FindOptions
+	sem  chan struct{}
+	wg   sync.WaitGroup
+
+	mu       sync.Mutex
+	found    []string
+	errs     []error
+	followed []fs.FileInfo
+}
+
+func (f *finder) walk(dir string, depth int) {
+	defer f.wg.Done()
+
+	f.sem <- struct{}{}
+	entries, err := fs.ReadDir(f.fsys, dir)
+	<-f.sem
+	if err != nil {
+		f.fail(dir, err)
+	}
+
+	for _, entry := range entries {
+		p := path.Join(dir, entry.Name())
+		rel := relPath(f.root, p)
+		isDir := entry.IsDir()
+
+		var info fs.FileInfo
+		if entry.Type()&fs.ModeSymlink != 0 {
+			switch f.opts.Symlinks {
+			case SymlinkSkip:
+				continue
+			case SymlinkFollow:
+				target, err := fs.Stat(f.fsys, p)
+				if err != nil {
+					f.fail(p, err)
+					continue
+				}
+				info = target
+				isDir = target.IsDir()
+				if isDir && !f.follow(target) {
+					continue
+				}
+			}
+		}
+
+		if isDir {
+			if matchGlobs(f.opts.Exclude, rel) {
+				continue
+			}
+			if f.opts.IncludeDirs {
+				f.check(p, rel, entry, info)
+			}
+			if f.opts.MaxDepth <= 0 || depth+1 < f.opts.MaxDepth {
+				f.wg.Add(1)
+				go f.walk(p, depth+1)
+			}
+			continue
+		}
+		if !entry.Type().IsRegular() && entry.Type()&fs.ModeSymlink == 0 {
+			// devices, sockets and pipes
+			continue
+		}
+		f.check(p, rel, entry, info)
+	}
+}
+
+func (f *finder) check(p, rel string, entry fs.DirEntry, info fs.FileInfo) {
+	if !f.opts.Match(rel, nil) {
+		return
+	}
+	if info == nil && f.opts.needsInfo() {
+		var err error
+		if info, err = entry.Info(); err != nil {
+			f.fail(p, err)
+			return
+		}
+	}
+	if info != nil && !f.opts.Match(rel, info) {
+		return
+	}
+	f.mu.Lock()
+	f.found = append(f.found, p)
+	f.mu.Unlock()
+}
+
+// follow reports whether the target of a symlink has to be walked, which is only the case the first time
+func (f *finder) follow(target fs.FileInfo) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, info := range f.followed {
+		if os.SameFile(info, target) {
+			return false
+		}
+	}
+	f.followed = append(f.followed, target)
+	return true
+}
+
+func (f *finder) fail(p string, err error) {
+	f.mu.Lock()
+	f.errs = append(f.errs, &FindError{Path: p, Err: err})
+	f.mu.Unlock()
+}
+
+func (o *FindOptions) needsInfo() bool {
+	return o.MinSize > 0 || o.MaxSize > 0 || !o.ModifiedAfter.IsZero() || !o.ModifiedBefore.IsZero()
+}
+
+func matchGlobs(patterns []string, rel string) bool {
+	base := path.Base(rel)
+	for _, pattern := range patterns {
+		name := rel
+		if !strings.Contains(pattern, "/") {
+			name = base
+		}
+		if ok, _ := doublestar.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func hasSuffix(s string, suffixes []string, fold bool) bool {
+	if fold {
+		s = strings.ToLower(s)
+	}
+	for _, suffix := range suffixes {
+		if fold {
+			suffix = strings.ToLower(suffix)
+		}
+		if strings.HasSuffix(s, suffix) {
+			return true
+		}
+	}
+	return false
+}
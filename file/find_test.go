@@ -0,0 +1,117 @@
+package file
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFind(t *testing.T) {
+	old := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	recent := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	fsys := fstest.MapFS{
+		"Default/Network/Cookies":     {Data: []byte("cookies"), ModTime: recent},
+		"Default/Login Data":          {Data: []byte("login data"), ModTime: recent},
+		"Default/History":             {Data: []byte("h"), ModTime: old},
+		"Profile 1/Network/Cookies":   {Data: []byte("cookies 2"), ModTime: old},
+		"Profile 1/Cache/data_0":      {Data: make([]byte, 4096), ModTime: old},
+		"Profile 1/Cache/deep/a/b.db": {Data: []byte("db"), ModTime: old},
+	}
+
+	cases := []struct {
+		name string
+		opts FindOptions
+		want []string
+	}{
+		{"everything", FindOptions{}, []string{
+			"Default/History", "Default/Login Data", "Default/Network/Cookies",
+			"Profile 1/Cache/data_0", "Profile 1/Cache/deep/a/b.db", "Profile 1/Network/Cookies",
+		}},
+		{"doublestar", FindOptions{Patterns: []string{"**/Network/Cookies"}}, []string{
+			"Default/Network/Cookies", "Profile 1/Network/Cookies",
+		}},
+		{"base name pattern", FindOptions{Patterns: []string{"*.db"}}, []string{"Profile 1/Cache/deep/a/b.db"}},
+		{"suffix", FindOptions{Suffixes: []string{"Cookies"}}, []string{
+			"Default/Network/Cookies", "Profile 1/Network/Cookies",
+		}},
+		{"suffix keeps case", FindOptions{Suffixes: []string{"COOKIES"}}, nil},
+		{"suffix ignores case", FindOptions{Suffixes: []string{"COOKIES"}, SuffixFold: true}, []string{
+			"Default/Network/Cookies", "Profile 1/Network/Cookies",
+		}},
+		{"regexp", FindOptions{Regexps: []*regexp.Regexp{regexp.MustCompile(`^Default/.* Data$`)}}, []string{"Default/Login Data"}},
+		{"exclude prunes", FindOptions{Exclude: []string{"Cache"}}, []string{
+			"Default/History", "Default/Login Data", "Default/Network/Cookies", "Profile 1/Network/Cookies",
+		}},
+		{"size", FindOptions{MinSize: 5, MaxSize: 100}, []string{
+			"Default/Login Data", "Default/Network/Cookies", "Profile 1/Network/Cookies",
+		}},
+		{"mtime", FindOptions{ModifiedAfter: old}, []string{"Default/Login Data", "Default/Network/Cookies"}},
+		{"max depth", FindOptions{MaxDepth: 2}, []string{"Default/History", "Default/Login Data"}},
+		{"dirs", FindOptions{IncludeDirs: true, Patterns: []string{"Network"}}, []string{
+			"Default/Network", "Profile 1/Network",
+		}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := Find(fsys, ".", tc.opts)
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+
+	t.Run("sub directory", func(t *testing.T) {
+		got, err := Find(fsys, "Profile 1", FindOptions{Patterns: []string{"Cache/**"}})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"Profile 1/Cache/data_0", "Profile 1/Cache/deep/a/b.db"}, got)
+	})
+
+	t.Run("invalid pattern", func(t *testing.T) {
+		_, err := Find(fsys, ".", FindOptions{Patterns: []string{"[a"}})
+		assert.Error(t, err)
+	})
+}
+
+func TestFindErrorsAndSymlinks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks and permissions differ on windows")
+	}
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "a", "locked"), 0o700))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a", "Cookies"), []byte("x"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a", "locked", "Cookies"), []byte("x"), 0o600))
+	require.NoError(t, os.Symlink(filepath.Join(dir, "a"), filepath.Join(dir, "link")))
+	// a loop back to the root
+	require.NoError(t, os.Symlink(dir, filepath.Join(dir, "a", "loop")))
+
+	got, err := Find(os.DirFS(dir), ".", FindOptions{Suffixes: []string{"Cookies"}})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a/Cookies", "a/locked/Cookies"}, got)
+
+	got, err = Find(os.DirFS(dir), ".", FindOptions{Suffixes: []string{"Cookies"}, Symlinks: SymlinkFollow})
+	require.NoError(t, err)
+	assert.Contains(t, got, "link/Cookies")
+
+	if os.Geteuid() != 0 {
+		require.NoError(t, os.Chmod(filepath.Join(dir, "a", "locked"), 0))
+		defer os.Chmod(filepath.Join(dir, "a", "locked"), 0o700)
+
+		got, err = Find(os.DirFS(dir), ".", FindOptions{Suffixes: []string{"Cookies"}})
+		assert.Error(t, err)
+		var findErr *FindError
+		assert.ErrorAs(t, err, &findErr)
+		assert.ErrorIs(t, err, fs.ErrPermission)
+		assert.Equal(t, []string{"a/Cookies"}, got)
+
+		files, err := FilesInFolder(dir, "Cookies")
+		assert.Error(t, err)
+		assert.Equal(t, []string{filepath.Join(dir, "a", "Cookies")}, files)
+	}
+}
@@ -0,0 +1,230 @@
+package file
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/w-devin/poketto/file/archive"
+)
+
+// WritableFile is an open file of a WritableFS
+type WritableFile interface {
+	fs.File
+	io.Writer
+}
+
+// WritableFS is a fs.FS which can be modified, names follow the rules of fs.ValidPath
+type WritableFS interface {
+	fs.StatFS
+	OpenFile(name string, flag int, perm fs.FileMode) (WritableFile, error)
+	MkdirAll(name string, perm fs.FileMode) error
+	Remove(name string) error
+	RemoveAll(name string) error
+	Rename(oldname, newname string) error
+	Chtimes(name string, atime, mtime time.Time) error
+}
+
+var (
+	_ WritableFS = (*OSFS)(nil)
+	_ WritableFS = (*MemFS)(nil)
+	_ WritableFS = (*ReadOnlyFS)(nil)
+	_ WritableFS = (*OverlayFS)(nil)
+	_ fs.FS      = (*ZipFS)(nil)
+)
+
+// CreateFS creates or truncates the named file
+func CreateFS(fsys WritableFS, name string) (WritableFile, error) {
+	return fsys.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o600)
+}
+
+// WriteFileFS writes data to the named file, creating it if necessary
+func WriteFileFS(fsys WritableFS, name string, data []byte, perm fs.FileMode) error {
+	f, err := fsys.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// IsFileExistsFS checks if the file exists in fsys
+func IsFileExistsFS(fsys fs.FS, name string) bool {
+	info, err := fs.Stat(fsys, name)
+	if err != nil {
+		return false
+	}
+	return !info.IsDir()
+}
+
+// IsDirExistsFS checks if the folder exists in fsys
+func IsDirExistsFS(fsys fs.FS, name string) bool {
+	info, err := fs.Stat(fsys, name)
+	if err != nil {
+		return false
+	}
+	return info.IsDir()
+}
+
+// ReadFileFS reads the named file from fsys
+func ReadFileFS(fsys fs.FS, name string) (string, error) {
+	s, err := fs.ReadFile(fsys, name)
+	return string(s), err
+}
+
+// FilesInFolderFS returns the paths of the files below dir whose path ends with filename
+func FilesInFolderFS(fsys fs.FS, dir, filename string) ([]string, error) {
+	if !IsDirExistsFS(fsys, dir) {
+		return nil, errors.New(dir + "folder does not exist")
+	}
+	return Find(fsys, dir, FindOptions{Suffixes: []string{filename}})
+}
+
+// CopyDirFS copies srcDir of src to dstDir of dst, entries whose lowercased path ends with skip
+// are left out. Symlinks to files are copied as regular files, symlinks to directories are skipped.
+func CopyDirFS(src fs.FS, srcDir string, dst WritableFS, dstDir string, skip string) error {
+	return fs.WalkDir(src, srcDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if skip != "" && strings.HasSuffix(strings.ToLower(p), skip) {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+
+		target := dstDir
+		if p != srcDir {
+			target = path.Join(dstDir, relPath(srcDir, p))
+		}
+
+		info, err := fs.Stat(src, p)
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if d.Type()&fs.ModeSymlink != 0 {
+				return nil
+			}
+			return dst.MkdirAll(target, info.Mode().Perm()|0o700)
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		return copyFileFS(src, p, dst, target, info.Mode().Perm())
+	})
+}
+
+func copyFileFS(src fs.FS, srcName string, dst WritableFS, dstName string, perm fs.FileMode) error {
+	in, err := src.Open(srcName)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := dst.OpenFile(dstName, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to copy %s, %v", srcName, err)
+	}
+	return nil
+}
+
+// CompressDirFS compresses dir recursively into dir.zip next to it inside fsys. With opts.RemoveSources
+// the archived files are removed once the archive has been written completely, it is shredded on an OSFS,
+// and directories left empty are removed as well. Excluded files and symlinks are kept
+func CompressDirFS(fsys WritableFS, dir string, opts archive.Options) (err error) {
+	if dir == "." {
+		return fmt.Errorf("can't compress the root of the file system next to itself")
+	}
+	opts.Format = archive.FormatZip
+
+	name := dir + ".zip"
+	tmp := path.Join(path.Dir(dir), fmt.Sprintf(".%s.%d.tmp", path.Base(name), time.Now().UnixNano()))
+	out, err := fsys.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to create %s, %v", name, err)
+	}
+	defer func() {
+		if err != nil {
+			_ = out.Close()
+			_ = fsys.Remove(tmp)
+		}
+	}()
+
+	w, err := archive.NewWriter(out, opts)
+	if err != nil {
+		return err
+	}
+	if err = w.AddFS(fsys, dir, ""); err != nil {
+		return err
+	}
+	if err = w.Close(); err != nil {
+		return err
+	}
+	if err = out.Close(); err != nil {
+		return err
+	}
+	if err = fsys.Rename(tmp, name); err != nil {
+		return fmt.Errorf("failed to rename %s to %s, %v", tmp, name, err)
+	}
+
+	if !opts.RemoveSources {
+		return nil
+	}
+	remove := fsys.Remove
+	if o, ok := fsys.(*OSFS); ok {
+		// the sources are sensitive copies, overwrite them before they are removed
+		remove = func(name string) error {
+			return Shred(o.Path(name), nil)
+		}
+	}
+	// only what went into the archive, excluded files and files created meanwhile are kept
+	files, dirs := w.AddedFS()
+	for _, p := range files {
+		if err = remove(p); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("failed to remove %s, %v", p, err)
+		}
+	}
+	// deepest directories first, non empty ones are kept
+	for i := len(dirs) - 1; i >= 0; i-- {
+		_ = fsys.Remove(dirs[i])
+	}
+	return nil
+}
+
+func relPath(root, p string) string {
+	if root == "." {
+		return p
+	}
+	return strings.TrimPrefix(p, root+"/")
+}
+
+// splitOSPath returns the file system of the parent of p and the name of p inside of it
+func splitOSPath(p string) (*OSFS, string) {
+	p = filepath.Clean(p)
+	dir, base := filepath.Split(p)
+	if base == "" || base == "." || base == ".." || dir == p {
+		return NewOSFS(p), "."
+	}
+	if dir == "" {
+		dir = "."
+	}
+	return NewOSFS(dir), base
+}
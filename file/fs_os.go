@@ -0,0 +1,119 @@
+package file
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// OSFS is a WritableFS of the directory tree rooted at a directory of the operating system
+type OSFS struct {
+	root string
+}
+
+// NewOSFS returns the file system rooted at root
+func NewOSFS(root string) *OSFS {
+	return &OSFS{root: root}
+}
+
+// Root returns the directory the file system is rooted at
+func (o *OSFS) Root() string {
+	return o.root
+}
+
+// Path returns the path of name in the operating system
+func (o *OSFS) Path(name string) string {
+	return filepath.Join(o.root, filepath.FromSlash(name))
+}
+
+func (o *OSFS) resolve(op, name string) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	return o.Path(name), nil
+}
+
+func (o *OSFS) Open(name string) (fs.File, error) {
+	p, err := o.resolve("open", name)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(p)
+}
+
+func (o *OSFS) Stat(name string) (fs.FileInfo, error) {
+	p, err := o.resolve("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	return os.Stat(p)
+}
+
+func (o *OSFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	p, err := o.resolve("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadDir(p)
+}
+
+func (o *OSFS) ReadFile(name string) ([]byte, error) {
+	p, err := o.resolve("readfile", name)
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadFile(p)
+}
+
+func (o *OSFS) OpenFile(name string, flag int, perm fs.FileMode) (WritableFile, error) {
+	p, err := o.resolve("open", name)
+	if err != nil {
+		return nil, err
+	}
+	return os.OpenFile(p, flag, perm)
+}
+
+func (o *OSFS) MkdirAll(name string, perm fs.FileMode) error {
+	p, err := o.resolve("mkdir", name)
+	if err != nil {
+		return err
+	}
+	return os.MkdirAll(p, perm)
+}
+
+func (o *OSFS) Remove(name string) error {
+	p, err := o.resolve("remove", name)
+	if err != nil {
+		return err
+	}
+	return os.Remove(p)
+}
+
+func (o *OSFS) RemoveAll(name string) error {
+	p, err := o.resolve("removeall", name)
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(p)
+}
+
+func (o *OSFS) Rename(oldname, newname string) error {
+	oldPath, err := o.resolve("rename", oldname)
+	if err != nil {
+		return err
+	}
+	newPath, err := o.resolve("rename", newname)
+	if err != nil {
+		return err
+	}
+	return os.Rename(oldPath, newPath)
+}
+
+func (o *OSFS) Chtimes(name string, atime, mtime time.Time) error {
+	p, err := o.resolve("chtimes", name)
+	if err != nil {
+		return err
+	}
+	return os.Chtimes(p, atime, mtime)
+}
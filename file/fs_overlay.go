@@ -0,0 +1,377 @@
+package file
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ReadOnlyFS exposes a fs.FS as a WritableFS whose modifications all fail with fs.ErrPermission
+type ReadOnlyFS struct {
+	fsys fs.FS
+}
+
+// NewReadOnlyFS returns a read-only view of fsys
+func NewReadOnlyFS(fsys fs.FS) *ReadOnlyFS {
+	return &ReadOnlyFS{fsys: fsys}
+}
+
+func (r *ReadOnlyFS) Open(name string) (fs.File, error) {
+	f, err := r.fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	// hide the write methods of the underlying file
+	return readOnlyFile{f}, nil
+}
+
+func (r *ReadOnlyFS) Stat(name string) (fs.FileInfo, error) {
+	return fs.Stat(r.fsys, name)
+}
+
+func (r *ReadOnlyFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	return fs.ReadDir(r.fsys, name)
+}
+
+func (r *ReadOnlyFS) OpenFile(name string, flag int, perm fs.FileMode) (WritableFile, error) {
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_CREATE|os.O_TRUNC|os.O_APPEND) != 0 {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrPermission}
+	}
+	f, err := r.fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return readOnlyFile{f}, nil
+}
+
+func (r *ReadOnlyFS) MkdirAll(name string, perm fs.FileMode) error {
+	return &fs.PathError{Op: "mkdir", Path: name, Err: fs.ErrPermission}
+}
+
+func (r *ReadOnlyFS) Remove(name string) error {
+	return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrPermission}
+}
+
+func (r *ReadOnlyFS) RemoveAll(name string) error {
+	return &fs.PathError{Op: "removeall", Path: name, Err: fs.ErrPermission}
+}
+
+func (r *ReadOnlyFS) Rename(oldname, newname string) error {
+	return &fs.PathError{Op: "rename", Path: oldname, Err: fs.ErrPermission}
+}
+
+func (r *ReadOnlyFS) Chtimes(name string, atime, mtime time.Time) error {
+	return &fs.PathError{Op: "chtimes", Path: name, Err: fs.ErrPermission}
+}
+
+type readOnlyFile struct {
+	fs.File
+}
+
+func (f readOnlyFile) Write(p []byte) (int, error) {
+	return 0, fs.ErrPermission
+}
+
+func (f readOnlyFile) ReadDir(count int) ([]fs.DirEntry, error) {
+	if d, ok := f.File.(fs.ReadDirFile); ok {
+		return d.ReadDir(count)
+	}
+	return nil, errors.New("not a directory")
+}
+
+// OverlayFS layers a writable upper file system over a read-only lower one.
+// Reads prefer the upper layer, every modification goes to the upper layer and files of
+// the lower layer are copied up before they are modified. Removed lower entries are hidden
+// by whiteouts which only live in memory.
+type OverlayFS struct {
+	lower fs.FS
+	upper WritableFS
+
+	mu        sync.RWMutex
+	whiteouts map[string]bool
+	// opaque directories were removed and created again, the lower content stays hidden
+	opaque map[string]bool
+}
+
+// NewOverlayFS returns the overlay of upper over lower
+func NewOverlayFS(lower fs.FS, upper WritableFS) *OverlayFS {
+	return &OverlayFS{lower: lower, upper: upper, whiteouts: make(map[string]bool), opaque: make(map[string]bool)}
+}
+
+// hidden reports whether name or one of its parents has been removed from the lower layer
+func (o *OverlayFS) hidden(name string) bool {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	for p := name; p != "."; p = path.Dir(p) {
+		if o.whiteouts[p] || (p != name && o.opaque[p]) {
+			return true
+		}
+	}
+	return o.opaque["."] && name != "."
+}
+
+func (o *OverlayFS) inUpper(name string) bool {
+	_, err := o.upper.Stat(name)
+	return err == nil
+}
+
+func (o *OverlayFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	info, err := o.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		entries, err := o.ReadDir(name)
+		if err != nil {
+			return nil, err
+		}
+		return &overlayDir{info: info, entries: entries}, nil
+	}
+	if o.inUpper(name) {
+		return o.upper.Open(name)
+	}
+	return o.lower.Open(name)
+}
+
+func (o *OverlayFS) Stat(name string) (fs.FileInfo, error) {
+	if info, err := o.upper.Stat(name); err == nil {
+		return info, nil
+	}
+	if o.hidden(name) {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+	}
+	return fs.Stat(o.lower, name)
+}
+
+// ReadDir merges the entries of both layers, upper entries shadow lower ones
+func (o *OverlayFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	merged := make(map[string]fs.DirEntry)
+	var found bool
+	o.mu.RLock()
+	opaque := o.opaque[name]
+	o.mu.RUnlock()
+	if !o.hidden(name) && !opaque {
+		if entries, err := fs.ReadDir(o.lower, name); err == nil {
+			found = true
+			for _, e := range entries {
+				if !o.hidden(path.Join(name, e.Name())) {
+					merged[e.Name()] = e
+				}
+			}
+		}
+	}
+	if entries, err := fs.ReadDir(o.upper, name); err == nil {
+		found = true
+		for _, e := range entries {
+			merged[e.Name()] = e
+		}
+	}
+	if !found {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+
+	entries := make([]fs.DirEntry, 0, len(merged))
+	for _, e := range merged {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
+
+func (o *OverlayFS) OpenFile(name string, flag int, perm fs.FileMode) (WritableFile, error) {
+	writable := flag&(os.O_WRONLY|os.O_RDWR|os.O_CREATE|os.O_TRUNC|os.O_APPEND) != 0
+	if !writable {
+		f, err := o.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		return readOnlyFile{f}, nil
+	}
+
+	if !o.inUpper(name) {
+		info, err := o.Stat(name)
+		switch {
+		case err == nil && flag&os.O_CREATE != 0 && flag&os.O_EXCL != 0:
+			return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrExist}
+		case err == nil && info.IsDir():
+			return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+		case err == nil && flag&os.O_TRUNC == 0:
+			if err := o.copyUp(name, info); err != nil {
+				return nil, err
+			}
+		case err == nil:
+			// truncated anyway, no need to copy the content up
+			if err := o.upper.MkdirAll(path.Dir(name), 0o755); err != nil {
+				return nil, err
+			}
+			flag |= os.O_CREATE
+		default:
+			if err := o.upper.MkdirAll(path.Dir(name), 0o755); err != nil {
+				return nil, err
+			}
+		}
+	}
+	f, err := o.upper.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	o.unhide(name)
+	return f, nil
+}
+
+// copyUp copies a file of the lower layer to the upper one
+func (o *OverlayFS) copyUp(name string, info fs.FileInfo) error {
+	if err := o.upper.MkdirAll(path.Dir(name), 0o755); err != nil {
+		return err
+	}
+	if err := copyFileFS(o.lower, name, o.upper, name, info.Mode().Perm()); err != nil {
+		return err
+	}
+	return o.upper.Chtimes(name, info.ModTime(), info.ModTime())
+}
+
+// unhide makes name visible again after it has been created in the upper layer,
+// a directory stays opaque so that the removed lower content doesn't come back
+func (o *OverlayFS) unhide(name string) {
+	o.mu.Lock()
+	if o.whiteouts[name] {
+		delete(o.whiteouts, name)
+		o.opaque[name] = true
+	}
+	o.mu.Unlock()
+}
+
+func (o *OverlayFS) MkdirAll(name string, perm fs.FileMode) error {
+	if err := o.upper.MkdirAll(name, perm); err != nil {
+		return err
+	}
+	for p := name; p != "."; p = path.Dir(p) {
+		o.unhide(p)
+	}
+	return nil
+}
+
+func (o *OverlayFS) Remove(name string) error {
+	info, err := o.Stat(name)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		if entries, _ := o.ReadDir(name); len(entries) > 0 {
+			return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrInvalid}
+		}
+	}
+	if o.inUpper(name) {
+		if err := o.upper.Remove(name); err != nil {
+			return err
+		}
+	}
+	o.hide(name)
+	return nil
+}
+
+func (o *OverlayFS) RemoveAll(name string) error {
+	if err := o.upper.RemoveAll(name); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	o.hide(name)
+	return nil
+}
+
+func (o *OverlayFS) hide(name string) {
+	if _, err := fs.Stat(o.lower, name); err == nil {
+		o.mu.Lock()
+		o.whiteouts[name] = true
+		o.mu.Unlock()
+	}
+}
+
+func (o *OverlayFS) Rename(oldname, newname string) error {
+	info, err := o.Stat(oldname)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		// directories are copied up as a whole
+		if err := CopyDirFS(o, oldname, o.upper, newname, ""); err != nil {
+			return err
+		}
+		if err := o.upper.RemoveAll(oldname); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	} else {
+		if !o.inUpper(oldname) {
+			if err := o.copyUp(oldname, info); err != nil {
+				return err
+			}
+		}
+		if err := o.upper.MkdirAll(path.Dir(newname), 0o755); err != nil {
+			return err
+		}
+		if err := o.upper.Rename(oldname, newname); err != nil {
+			return err
+		}
+	}
+	o.hide(oldname)
+	o.unhide(newname)
+	return nil
+}
+
+func (o *OverlayFS) Chtimes(name string, atime, mtime time.Time) error {
+	if !o.inUpper(name) {
+		info, err := o.Stat(name)
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if err := o.upper.MkdirAll(name, info.Mode().Perm()); err != nil {
+				return err
+			}
+		} else if err := o.copyUp(name, info); err != nil {
+			return err
+		}
+	}
+	return o.upper.Chtimes(name, atime, mtime)
+}
+
+type overlayDir struct {
+	info    fs.FileInfo
+	entries []fs.DirEntry
+}
+
+func (d *overlayDir) Stat() (fs.FileInfo, error) {
+	return d.info, nil
+}
+
+func (d *overlayDir) Read(p []byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.info.Name(), Err: fs.ErrInvalid}
+}
+
+func (d *overlayDir) ReadDir(count int) ([]fs.DirEntry, error) {
+	if count <= 0 {
+		entries := d.entries
+		d.entries = nil
+		return entries, nil
+	}
+	if len(d.entries) == 0 {
+		return nil, io.EOF
+	}
+	if count > len(d.entries) {
+		count = len(d.entries)
+	}
+	entries := d.entries[:count]
+	d.entries = d.entries[count:]
+	return entries, nil
+}
+
+func (d *overlayDir) Close() error {
+	return nil
+}
@@ -0,0 +1,198 @@
+package file
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/w-devin/poketto/file/archive"
+)
+
+func TestMemFS(t *testing.T) {
+	m := NewMemFS()
+	require.NoError(t, m.MkdirAll("a/b", 0o755))
+	require.NoError(t, WriteFileFS(m, "a/b/c.txt", []byte("hello"), 0o644))
+	require.NoError(t, WriteFileFS(m, "a/d.txt", []byte("d"), 0o644))
+
+	f, err := m.OpenFile("a/b/c.txt", os.O_WRONLY|os.O_APPEND, 0)
+	require.NoError(t, err)
+	_, err = f.Write([]byte(" world"))
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	s, err := ReadFileFS(m, "a/b/c.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "hello world", s)
+	assert.True(t, IsDirExistsFS(m, "a/b"))
+	assert.False(t, IsFileExistsFS(m, "a/b"))
+	assert.Error(t, WriteFileFS(m, "missing/x", nil, 0o644))
+
+	require.NoError(t, m.Rename("a/b", "e"))
+	found, err := Find(m, ".", FindOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a/d.txt", "e/c.txt"}, found)
+
+	assert.Error(t, m.Remove("e"))
+	require.NoError(t, m.RemoveAll("e"))
+	assert.False(t, IsDirExistsFS(m, "e"))
+
+	require.NoError(t, fstest.TestFS(m, "a/d.txt"))
+}
+
+func TestOverlayFS(t *testing.T) {
+	lower := fstest.MapFS{
+		"conf/app.ini":  {Data: []byte("lower")},
+		"conf/keep.ini": {Data: []byte("keep")},
+		"data/1.bin":    {Data: []byte("1")},
+	}
+	upper := NewMemFS()
+	o := NewOverlayFS(lower, upper)
+
+	f, err := o.OpenFile("conf/app.ini", os.O_WRONLY|os.O_APPEND, 0)
+	require.NoError(t, err)
+	_, err = f.Write([]byte(" upper"))
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	s, err := ReadFileFS(o, "conf/app.ini")
+	require.NoError(t, err)
+	assert.Equal(t, "lower upper", s)
+	assert.Equal(t, "lower", string(lower["conf/app.ini"].Data))
+
+	require.NoError(t, o.Remove("conf/keep.ini"))
+	assert.False(t, IsFileExistsFS(o, "conf/keep.ini"))
+
+	require.NoError(t, o.Rename("data", "moved"))
+	require.NoError(t, o.RemoveAll("conf"))
+	require.NoError(t, o.MkdirAll("conf", 0o755))
+
+	found, err := Find(o, ".", FindOptions{IncludeDirs: true})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"conf", "moved", "moved/1.bin"}, found)
+	assert.Len(t, lower, 3)
+}
+
+func TestReadOnlyFS(t *testing.T) {
+	r := NewReadOnlyFS(fstest.MapFS{"a.txt": {Data: []byte("a")}})
+	s, err := ReadFileFS(r, "a.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "a", s)
+
+	_, err = CreateFS(r, "b.txt")
+	assert.ErrorIs(t, err, fs.ErrPermission)
+	assert.ErrorIs(t, r.Remove("a.txt"), fs.ErrPermission)
+	assert.ErrorIs(t, r.MkdirAll("d", 0o755), fs.ErrPermission)
+}
+
+func TestZipFS(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := archive.NewWriter(&buf, archive.Options{Format: archive.FormatZip, Password: "secret"})
+	require.NoError(t, err)
+	require.NoError(t, w.AddFS(fstest.MapFS{"dir/a.txt": {Data: []byte("encrypted")}}, ".", ""))
+	require.NoError(t, w.Close())
+
+	z, err := NewZipFS(bytes.NewReader(buf.Bytes()), int64(buf.Len()), "secret")
+	require.NoError(t, err)
+	s, err := ReadFileFS(z, "dir/a.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "encrypted", s)
+
+	z, err = NewZipFS(bytes.NewReader(buf.Bytes()), int64(buf.Len()), "wrong")
+	require.NoError(t, err)
+	_, err = z.Open("dir/a.txt")
+	assert.ErrorIs(t, err, archive.ErrPassword)
+}
+
+func TestCopyAndCompressDirFS(t *testing.T) {
+	src := fstest.MapFS{
+		"p/Cookies":     {Data: []byte("c")},
+		"p/cache/x.tmp": {Data: []byte("x")},
+		"p/Login Data":  {Data: []byte("l")},
+	}
+	m := NewMemFS()
+	require.NoError(t, CopyDirFS(src, "p", m, "out", ".tmp"))
+	found, err := Find(m, ".", FindOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"out/Cookies", "out/Login Data"}, found)
+
+	require.NoError(t, CompressDirFS(m, "out", archive.Options{RemoveSources: true}))
+	entries, err := fs.ReadDir(m, "out")
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+
+	data, err := fs.ReadFile(m, "out.zip")
+	require.NoError(t, err)
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	require.NoError(t, err)
+	var names []string
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+	}
+	assert.ElementsMatch(t, []string{"Cookies", "Login Data", "cache/"}, names)
+}
+
+func TestCompressDirFSKeepsExcluded(t *testing.T) {
+	m := NewMemFS()
+	for name, content := range map[string]string{
+		"out/data.db":      "d",
+		"out/keep.log":     "k",
+		"out/sub/a.txt":    "a",
+		"out/logs/b.log":   "b",
+		"out/empty/.dummy": "",
+	} {
+		require.NoError(t, m.MkdirAll(path.Dir(name), 0o755))
+		require.NoError(t, WriteFileFS(m, name, []byte(content), 0o644))
+	}
+
+	require.NoError(t, CompressDirFS(m, "out", archive.Options{RemoveSources: true, Exclude: []string{"*.log", "**/*.log"}}))
+	found, err := Find(m, "out", FindOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"out/keep.log", "out/logs/b.log"}, found)
+	_, err = fs.Stat(m, "out/sub")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+}
+
+func TestCompressDirFSShredsOnlyArchived(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "out")
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "sub"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "sub", "a.txt"), []byte("a"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "keep.log"), []byte("keep"), 0o644))
+	require.NoError(t, os.Symlink("keep.log", filepath.Join(dir, "link")))
+
+	require.NoError(t, CompressDirFS(NewOSFS(root), "out", archive.Options{RemoveSources: true, Exclude: []string{"*.log"}}))
+	data, err := os.ReadFile(filepath.Join(dir, "keep.log"))
+	require.NoError(t, err)
+	assert.Equal(t, "keep", string(data))
+	_, err = os.Lstat(filepath.Join(dir, "link"))
+	assert.NoError(t, err)
+	assert.False(t, IsDirExists(filepath.Join(dir, "sub")))
+}
+
+func TestCompressDir(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "profile")
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "sub"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "sub", "a.txt"), []byte("a"), 0o644))
+
+	require.NoError(t, CompressDir(dir))
+	assert.True(t, IsDirExists(dir))
+	assert.True(t, IsFileExists(dir+".zip"))
+
+	zr, err := zip.OpenReader(dir + ".zip")
+	require.NoError(t, err)
+	defer zr.Close()
+	rc, err := zr.Open("sub/a.txt")
+	require.NoError(t, err)
+	data, err := io.ReadAll(rc)
+	require.NoError(t, err)
+	assert.Equal(t, "a", string(data))
+}
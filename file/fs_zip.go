@@ -0,0 +1,53 @@
+package file
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"io/fs"
+
+	"github.com/w-devin/poketto/file/archive"
+)
+
+// ZipFS is a read-only fs.FS of the content of a zip archive, WinZip AES encrypted
+// entries are decrypted with the password
+type ZipFS struct {
+	*zip.Reader
+	password string
+	files    map[string]*zip.File
+}
+
+// NewZipFS returns the file system of the zip archive read from r
+func NewZipFS(r io.ReaderAt, size int64, password string) (*ZipFS, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read zip, %v", err)
+	}
+	z := &ZipFS{Reader: zr, password: password, files: make(map[string]*zip.File)}
+	for _, f := range zr.File {
+		z.files[f.Name] = f
+	}
+	return z, nil
+}
+
+// Open opens the named entry, encrypted entries are decrypted on the fly
+func (z *ZipFS) Open(name string) (fs.File, error) {
+	f, ok := z.files[name]
+	if !ok || !archive.IsEncrypted(f) {
+		return z.Reader.Open(name)
+	}
+	rc, err := archive.OpenFile(f, z.password)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	return &zipFile{ReadCloser: rc, info: f.FileInfo()}, nil
+}
+
+type zipFile struct {
+	io.ReadCloser
+	info fs.FileInfo
+}
+
+func (f *zipFile) Stat() (fs.FileInfo, error) {
+	return f.info, nil
+}
@@ -0,0 +1,408 @@
+package file
+
+import (
+	"bufio"
+	"crypto"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/blake2b"
+
+	pcrypto "github.com/w-devin/poketto/crypto"
+)
+
+// HashAlgorithm names a hash function of a manifest
+type HashAlgorithm string
+
+const (
+	HashSHA256 HashAlgorithm = "sha256"
+	HashSHA1   HashAlgorithm = "sha1"
+	HashMD5    HashAlgorithm = "md5"
+	// HashBLAKE2b is BLAKE2b-512, the default of b2sum
+	HashBLAKE2b HashAlgorithm = "blake2b"
+)
+
+// ManifestVersion is the version of the JSON manifest format
+const ManifestVersion = 1
+
+// New returns a new hash.Hash of the algorithm
+func (a HashAlgorithm) New() (hash.Hash, error) {
+	switch a {
+	case HashSHA256:
+		return sha256.New(), nil
+	case HashSHA1:
+		return sha1.New(), nil
+	case HashMD5:
+		return md5.New(), nil
+	case HashBLAKE2b:
+		return blake2b.New512(nil)
+	}
+	return nil, fmt.Errorf("unsupported hash algorithm %q", a)
+}
+
+// ManifestEntry is a file recorded in a manifest
+type ManifestEntry struct {
+	// Path is relative to the root of the manifest and uses forward slashes
+	Path    string                   `json:"path"`
+	Size    int64                    `json:"size"`
+	ModTime time.Time                `json:"mtime"`
+	Hashes  map[HashAlgorithm]string `json:"hashes"`
+}
+
+// Manifest lists the files of a directory with their hashes, it can be signed
+// to prove that the files didn't change after they have been collected
+type Manifest struct {
+	Version    int             `json:"version"`
+	Created    time.Time       `json:"created"`
+	Algorithms []HashAlgorithm `json:"algorithms"`
+	Files      []ManifestEntry `json:"files"`
+	// KeyFingerprint is the fingerprint of the public key of the signature, see crypto.Fingerprint
+	KeyFingerprint string `json:"key_fingerprint,omitempty"`
+	// Signature is the signature of the manifest without the signature
+	Signature []byte `json:"signature,omitempty"`
+}
+
+// ManifestOptions controls how a manifest is built and verified
+type ManifestOptions struct {
+	// Algorithms are the hashes computed for every file, SHA-256 when empty
+	Algorithms []HashAlgorithm
+	// Find selects the files of the manifest, every regular file when empty
+	Find FindOptions
+	// Concurrency is the number of files hashed in parallel, the number of CPUs when zero
+	Concurrency int
+}
+
+// ManifestReport is the result of the verification of a manifest
+type ManifestReport struct {
+	// Missing files are in the manifest but not on disk
+	Missing []string
+	// Extra files are on disk but not in the manifest
+	Extra []string
+	// Modified files differ in size or hash
+	Modified []string
+}
+
+// OK reports whether the files match the manifest exactly
+func (r *ManifestReport) OK() bool {
+	return len(r.Missing) == 0 && len(r.Extra) == 0 && len(r.Modified) == 0
+}
+
+// BuildManifest hashes the files below dir
+func BuildManifest(dir string, opts *ManifestOptions) (*Manifest, error) {
+	return BuildManifestFS(os.DirFS(dir), ".", opts)
+}
+
+// BuildManifestFS hashes the files below root in fsys in parallel
+func BuildManifestFS(fsys fs.FS, root string, opts *ManifestOptions) (*Manifest, error) {
+	if opts == nil {
+		opts = &ManifestOptions{}
+	}
+	algorithms := opts.Algorithms
+	if len(algorithms) == 0 {
+		algorithms = []HashAlgorithm{HashSHA256}
+	}
+	for _, a := range algorithms {
+		if _, err := a.New(); err != nil {
+			return nil, err
+		}
+	}
+
+	found, err := findManifestFiles(fsys, root, opts)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := hashFiles(fsys, root, found, algorithms, opts.Concurrency)
+	if err != nil {
+		return nil, err
+	}
+	return &Manifest{
+		Version:    ManifestVersion,
+		Created:    time.Now().UTC().Truncate(time.Second),
+		Algorithms: algorithms,
+		Files:      entries,
+	}, nil
+}
+
+func findManifestFiles(fsys fs.FS, root string, opts *ManifestOptions) ([]string, error) {
+	find := opts.Find
+	find.IncludeDirs = false
+	return Find(fsys, root, find)
+}
+
+// hashFiles hashes the files with every algorithm in a single read, the entries keep the order of names
+func hashFiles(fsys fs.FS, root string, names []string, algorithms []HashAlgorithm, concurrency int) ([]ManifestEntry, error) {
+	if concurrency <= 0 {
+		concurrency = runtime.NumCPU()
+	}
+	entries := make([]ManifestEntry, len(names))
+	errs := make([]error, len(names))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, name := range names {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, name string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			entry, err := hashFile(fsys, name, algorithms)
+			if err != nil {
+				errs[i] = &FindError{Path: name, Err: err}
+				return
+			}
+			entry.Path = relPath(root, name)
+			entries[i] = entry
+		}(i, name)
+	}
+	wg.Wait()
+	return entries, errors.Join(errs...)
+}
+
+func hashFile(fsys fs.FS, name string, algorithms []HashAlgorithm) (ManifestEntry, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return ManifestEntry{}, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return ManifestEntry{}, err
+	}
+
+	hashes := make([]hash.Hash, len(algorithms))
+	writers := make([]io.Writer, len(algorithms))
+	for i, a := range algorithms {
+		if hashes[i], err = a.New(); err != nil {
+			return ManifestEntry{}, err
+		}
+		writers[i] = hashes[i]
+	}
+	size, err := io.Copy(io.MultiWriter(writers...), f)
+	if err != nil {
+		return ManifestEntry{}, err
+	}
+
+	entry := ManifestEntry{
+		Size:    size,
+		ModTime: info.ModTime().UTC(),
+		Hashes:  make(map[HashAlgorithm]string, len(algorithms)),
+	}
+	for i, a := range algorithms {
+		entry.Hashes[a] = hex.EncodeToString(hashes[i].Sum(nil))
+	}
+	return entry, nil
+}
+
+// ReadManifest reads a JSON manifest
+func ReadManifest(r io.Reader) (*Manifest, error) {
+	var m Manifest
+	if err := json.NewDecoder(r).Decode(&m); err != nil {
+		return nil, fmt.Errorf("failed to decode manifest, %v", err)
+	}
+	if m.Version != ManifestVersion {
+		return nil, fmt.Errorf("unsupported manifest version %d", m.Version)
+	}
+	if err := m.checkAlgorithms(); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// WriteJSON writes the manifest as indented JSON
+func (m *Manifest) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(m)
+}
+
+// WriteSums writes the hashes of algorithm in the format of sha256sum, md5sum and b2sum
+func (m *Manifest) WriteSums(w io.Writer, algorithm HashAlgorithm) error {
+	bw := bufio.NewWriter(w)
+	for _, entry := range m.Files {
+		sum, ok := entry.Hashes[algorithm]
+		if !ok {
+			return fmt.Errorf("no %s hash for %s", algorithm, entry.Path)
+		}
+		if _, err := fmt.Fprintf(bw, "%s  %s\n", sum, entry.Path); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// ReadSums reads a file in the format of sha256sum, the entries have no size or modification time
+func ReadSums(r io.Reader, algorithm HashAlgorithm) (*Manifest, error) {
+	m := &Manifest{Version: ManifestVersion, Algorithms: []HashAlgorithm{algorithm}}
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimRight(scanner.Text(), "\r")
+		if text == "" {
+			continue
+		}
+		sum, name, ok := strings.Cut(text, " ")
+		if !ok || len(name) < 2 || (name[0] != ' ' && name[0] != '*') {
+			return nil, fmt.Errorf("invalid checksum line %d", line)
+		}
+		if _, err := hex.DecodeString(sum); err != nil {
+			return nil, fmt.Errorf("invalid checksum line %d, %v", line, err)
+		}
+		m.Files = append(m.Files, ManifestEntry{
+			Path:   path.Clean(strings.TrimPrefix(name[1:], "./")),
+			Size:   -1,
+			Hashes: map[HashAlgorithm]string{algorithm: strings.ToLower(sum)},
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// payload returns the signed bytes, the JSON encoding of the manifest without its signature
+func (m *Manifest) payload() ([]byte, error) {
+	unsigned := *m
+	unsigned.Signature = nil
+	return json.Marshal(&unsigned)
+}
+
+// Sign signs the manifest with crypto.Sign, signer can be an RSA, ECDSA or Ed25519 key.
+// A signed manifest is the signature of a directory.
+func (m *Manifest) Sign(signer crypto.Signer) error {
+	fingerprint, err := pcrypto.Fingerprint(signer.Public())
+	if err != nil {
+		return err
+	}
+	m.KeyFingerprint = fingerprint
+	data, err := m.payload()
+	if err != nil {
+		return err
+	}
+	m.Signature, err = pcrypto.Sign(signer, data)
+	return err
+}
+
+// VerifySignature checks the signature of the manifest with crypto.Verify, the errors of
+// invalid signatures wrap crypto.ErrSignature
+func (m *Manifest) VerifySignature(publicKey crypto.PublicKey) error {
+	if len(m.Signature) == 0 {
+		return errors.New("manifest is not signed")
+	}
+	fingerprint, err := pcrypto.Fingerprint(publicKey)
+	if err != nil {
+		return err
+	}
+	if m.KeyFingerprint != fingerprint {
+		return fmt.Errorf("%w: manifest is signed by key %s", pcrypto.ErrSignature, m.KeyFingerprint)
+	}
+	data, err := m.payload()
+	if err != nil {
+		return err
+	}
+	return pcrypto.Verify(publicKey, data, m.Signature)
+}
+
+// Verify compares the files below dir with the manifest
+func (m *Manifest) Verify(dir string, opts *ManifestOptions) (*ManifestReport, error) {
+	return m.VerifyFS(os.DirFS(dir), ".", opts)
+}
+
+// VerifyFS compares the files below root in fsys with the manifest, opts.Find selects the
+// files which are reported as extra and the algorithms of the manifest are used for hashing
+func (m *Manifest) VerifyFS(fsys fs.FS, root string, opts *ManifestOptions) (*ManifestReport, error) {
+	if opts == nil {
+		opts = &ManifestOptions{}
+	}
+	if err := m.checkAlgorithms(); err != nil {
+		return nil, err
+	}
+	found, err := findManifestFiles(fsys, root, opts)
+	if err != nil {
+		return nil, err
+	}
+	current := make(map[string]bool, len(found))
+	for _, p := range found {
+		current[relPath(root, p)] = true
+	}
+
+	report := &ManifestReport{}
+	var names []string
+	recorded := make(map[string]*ManifestEntry, len(m.Files))
+	for i := range m.Files {
+		entry := &m.Files[i]
+		recorded[entry.Path] = entry
+		p := path.Join(root, entry.Path)
+		if info, err := fs.Stat(fsys, p); err != nil || !info.Mode().IsRegular() {
+			report.Missing = append(report.Missing, entry.Path)
+			continue
+		}
+		names = append(names, p)
+	}
+	for rel := range current {
+		if _, ok := recorded[rel]; !ok {
+			report.Extra = append(report.Extra, rel)
+		}
+	}
+
+	entries, err := hashFiles(fsys, root, names, m.Algorithms, opts.Concurrency)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if !recorded[entry.Path].matches(&entry, m.Algorithms) {
+			report.Modified = append(report.Modified, entry.Path)
+		}
+	}
+
+	sort.Strings(report.Missing)
+	sort.Strings(report.Extra)
+	sort.Strings(report.Modified)
+	return report, nil
+}
+
+// checkAlgorithms makes sure that files are verified with at least one supported hash
+func (m *Manifest) checkAlgorithms() error {
+	if len(m.Algorithms) == 0 {
+		return errors.New("manifest has no hash algorithms")
+	}
+	for _, a := range m.Algorithms {
+		if _, err := a.New(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// matches compares the size, when it is known, and every hash of the recorded entry,
+// which needs a hash of every algorithm of the manifest
+func (e *ManifestEntry) matches(actual *ManifestEntry, algorithms []HashAlgorithm) bool {
+	if e.Size >= 0 && e.Size != actual.Size {
+		return false
+	}
+	for _, a := range algorithms {
+		if _, ok := e.Hashes[a]; !ok {
+			return false
+		}
+	}
+	for a, sum := range e.Hashes {
+		if !strings.EqualFold(actual.Hashes[a], sum) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,110 @@
+package file
+
+import (
+	"bytes"
+	"crypto"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	pcrypto "github.com/w-devin/poketto/crypto"
+)
+
+func TestManifest(t *testing.T) {
+	fsys := fstest.MapFS{
+		"Default/Cookies":    {Data: []byte("abc")},
+		"Default/Login Data": {Data: []byte("login")},
+		"Local State":        {Data: []byte("{}")},
+	}
+	m, err := BuildManifestFS(fsys, ".", &ManifestOptions{
+		Algorithms: []HashAlgorithm{HashSHA256, HashSHA1, HashMD5, HashBLAKE2b},
+	})
+	require.NoError(t, err)
+	require.Len(t, m.Files, 3)
+	cookies := m.Files[0]
+	assert.Equal(t, "Default/Cookies", cookies.Path)
+	assert.Equal(t, int64(3), cookies.Size)
+	assert.Equal(t, "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad", cookies.Hashes[HashSHA256])
+	assert.Equal(t, "a9993e364706816aba3e25717850c26c9cd0d89d", cookies.Hashes[HashSHA1])
+	assert.Equal(t, "900150983cd24fb0d6963f7d28e17f72", cookies.Hashes[HashMD5])
+	assert.Len(t, cookies.Hashes[HashBLAKE2b], 128)
+
+	t.Run("json and signature", func(t *testing.T) {
+		privateKey, publicKey, err := pcrypto.GenerateKeyPair(2048)
+		require.NoError(t, err)
+		require.NoError(t, m.Sign(privateKey))
+
+		var buf bytes.Buffer
+		require.NoError(t, m.WriteJSON(&buf))
+		read, err := ReadManifest(&buf)
+		require.NoError(t, err)
+		require.NoError(t, read.VerifySignature(publicKey))
+
+		read.Files[1].Hashes[HashSHA256] = "00"
+		assert.ErrorIs(t, read.VerifySignature(publicKey), pcrypto.ErrSignature)
+	})
+
+	t.Run("signature of other keys", func(t *testing.T) {
+		for _, keyType := range []pcrypto.KeyType{pcrypto.KeyEd25519, pcrypto.KeyECDSAP256} {
+			privateKey, err := pcrypto.GenerateKey(keyType)
+			require.NoError(t, err)
+			signer := privateKey.(crypto.Signer)
+			require.NoError(t, m.Sign(signer))
+			require.NoError(t, m.VerifySignature(signer.Public()))
+
+			other, err := pcrypto.GenerateKey(keyType)
+			require.NoError(t, err)
+			assert.ErrorIs(t, m.VerifySignature(other.(crypto.Signer).Public()), pcrypto.ErrSignature)
+		}
+	})
+
+	t.Run("sums", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, m.WriteSums(&buf, HashSHA256))
+		assert.Contains(t, buf.String(), "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad  Default/Cookies\n")
+
+		read, err := ReadSums(&buf, HashSHA256)
+		require.NoError(t, err)
+		report, err := read.VerifyFS(fsys, ".", nil)
+		require.NoError(t, err)
+		assert.True(t, report.OK())
+	})
+
+	t.Run("verify", func(t *testing.T) {
+		changed := fstest.MapFS{
+			"Default/Cookies": {Data: []byte("abd")},
+			"Local State":     {Data: []byte("{}")},
+			"Default/new":     {Data: []byte("new")},
+		}
+		report, err := m.VerifyFS(changed, ".", nil)
+		require.NoError(t, err)
+		assert.False(t, report.OK())
+		assert.Equal(t, []string{"Default/Login Data"}, report.Missing)
+		assert.Equal(t, []string{"Default/new"}, report.Extra)
+		assert.Equal(t, []string{"Default/Cookies"}, report.Modified)
+	})
+
+	t.Run("missing hashes", func(t *testing.T) {
+		stripped := *m
+		stripped.Files = append([]ManifestEntry(nil), m.Files...)
+		stripped.Files[0].Hashes = map[HashAlgorithm]string{}
+		stripped.Files[1].Hashes = map[HashAlgorithm]string{HashMD5: m.Files[1].Hashes[HashMD5]}
+		report, err := stripped.VerifyFS(fsys, ".", nil)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"Default/Cookies", "Default/Login Data"}, report.Modified)
+
+		stripped.Algorithms = nil
+		_, err = stripped.VerifyFS(fsys, ".", nil)
+		assert.Error(t, err)
+		for _, data := range []string{
+			`{"version":1,"files":[{"path":"Local State","size":2,"hashes":{}}]}`,
+			`{"version":1,"algorithms":["crc32"],"files":[]}`,
+		} {
+			_, err = ReadManifest(strings.NewReader(data))
+			assert.Error(t, err, data)
+		}
+	})
+}
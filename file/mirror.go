@@ -0,0 +1,531 @@
+package file
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// MirrorCompare tells Mirror how to detect changed files
+type MirrorCompare int
+
+const (
+	// CompareSizeModTime treats files with the same size and modification time as unchanged
+	CompareSizeModTime MirrorCompare = iota
+	// CompareHash compares the content hashes of the files
+	CompareHash
+)
+
+// MirrorAction is an operation of a mirror plan
+type MirrorAction int
+
+const (
+	// MirrorCopy copies a file missing in the destination
+	MirrorCopy MirrorAction = iota
+	// MirrorUpdate replaces a changed file of the destination
+	MirrorUpdate
+	// MirrorDelete removes an extraneous file or directory of the destination
+	MirrorDelete
+)
+
+func (a MirrorAction) String() string {
+	switch a {
+	case MirrorCopy:
+		return "copy"
+	case MirrorUpdate:
+		return "update"
+	case MirrorDelete:
+		return "delete"
+	}
+	return fmt.Sprintf("MirrorAction(%d)", int(a))
+}
+
+// MirrorOptions controls Mirror
+type MirrorOptions struct {
+	Compare MirrorCompare
+	// Algorithm is the hash used by CompareHash, SHA-256 when empty
+	Algorithm HashAlgorithm
+	// ModifyWindow is the largest difference of modification times still considered equal,
+	// useful for file systems with a coarse time resolution
+	ModifyWindow time.Duration
+	// Delete removes the destination files which don't exist in the source. Nothing is deleted
+	// when the source couldn't be walked completely, like rsync does on I/O errors
+	Delete bool
+	// DryRun only computes the plan, nothing is copied, deleted or saved
+	DryRun bool
+	// StateFile keeps the hashes of the last run, files whose size and modification time
+	// didn't change on both sides since then aren't hashed again
+	StateFile string
+	// Find selects the synchronized files, files of the destination which aren't selected are never deleted
+	Find FindOptions
+	// Concurrency is the number of files compared in parallel, the number of CPUs when zero
+	Concurrency int
+}
+
+// MirrorOp is a single operation of a mirror plan
+type MirrorOp struct {
+	Action MirrorAction
+	// Path is relative to the mirrored directories
+	Path string
+	Size int64
+}
+
+// MirrorPlan lists what Mirror did or, in a dry run, would do
+type MirrorPlan struct {
+	Ops       []MirrorOp
+	Unchanged int
+}
+
+// Bytes returns the number of bytes copied by the plan
+func (p *MirrorPlan) Bytes() int64 {
+	var n int64
+	for _, op := range p.Ops {
+		if op.Action != MirrorDelete {
+			n += op.Size
+		}
+	}
+	return n
+}
+
+// WriteTo prints the plan, one operation per line
+func (p *MirrorPlan) WriteTo(w io.Writer) (int64, error) {
+	var b strings.Builder
+	for _, op := range p.Ops {
+		if op.Action == MirrorDelete {
+			fmt.Fprintf(&b, "%-6s %s\n", op.Action, op.Path)
+		} else {
+			fmt.Fprintf(&b, "%-6s %s (%d bytes)\n", op.Action, op.Path, op.Size)
+		}
+	}
+	fmt.Fprintf(&b, "%d to copy (%d bytes), %d unchanged\n", len(p.Ops)-p.count(MirrorDelete), p.Bytes(), p.Unchanged)
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+func (p *MirrorPlan) count(action MirrorAction) int {
+	n := 0
+	for _, op := range p.Ops {
+		if op.Action == action {
+			n++
+		}
+	}
+	return n
+}
+
+// mirrorState is saved in the state file between runs
+type mirrorState struct {
+	Version   int                         `json:"version"`
+	Algorithm HashAlgorithm               `json:"algorithm"`
+	Files     map[string]mirrorStateEntry `json:"files"`
+}
+
+type mirrorStateEntry struct {
+	Size     int64     `json:"size"`
+	ModTime  time.Time `json:"mtime"`
+	Hash     string    `json:"hash,omitempty"`
+	DstSize  int64     `json:"dst_size"`
+	DstMTime time.Time `json:"dst_mtime"`
+}
+
+// Mirror makes dst an incremental copy of src, only new and changed files are copied
+func Mirror(src, dst string, opts *MirrorOptions) (*MirrorPlan, error) {
+	if err := os.MkdirAll(dst, 0o755); err != nil {
+		return nil, err
+	}
+	return MirrorFS(os.DirFS(src), ".", NewOSFS(dst), ".", opts)
+}
+
+// MirrorFS makes dstDir of dst an incremental copy of srcDir of src. Failures on single files
+// don't stop the synchronization, they are returned joined together with the plan.
+func MirrorFS(src fs.FS, srcDir string, dst WritableFS, dstDir string, opts *MirrorOptions) (*MirrorPlan, error) {
+	if opts == nil {
+		opts = &MirrorOptions{}
+	}
+	m := &mirror{src: src, srcDir: srcDir, dst: dst, dstDir: dstDir, opts: opts, algorithm: opts.Algorithm}
+	if m.algorithm == "" {
+		m.algorithm = HashSHA256
+	}
+	if _, err := m.algorithm.New(); err != nil {
+		return nil, err
+	}
+	m.state = m.loadState()
+
+	plan, err := m.plan()
+	if err != nil {
+		return nil, err
+	}
+	if opts.DryRun {
+		return plan, errors.Join(m.errs...)
+	}
+	m.apply(plan)
+	if opts.StateFile != "" {
+		if err := m.saveState(); err != nil {
+			m.fail(opts.StateFile, err)
+		}
+	}
+	return plan, errors.Join(m.errs...)
+}
+
+type mirror struct {
+	src       fs.FS
+	srcDir    string
+	dst       WritableFS
+	dstDir    string
+	opts      *MirrorOptions
+	algorithm HashAlgorithm
+
+	mu    sync.Mutex
+	state *mirrorState
+	errs  []error
+}
+
+func (m *mirror) plan() (*MirrorPlan, error) {
+	find := m.opts.Find
+	find.IncludeDirs = false
+	srcFiles, err := Find(m.src, m.srcDir, find)
+	if err != nil && srcFiles == nil {
+		return nil, err
+	}
+	if err != nil {
+		m.errs = append(m.errs, err)
+	}
+
+	plan := &MirrorPlan{}
+	ops := make([]*MirrorOp, len(srcFiles))
+	failed := make([]bool, len(srcFiles))
+	sources := make(map[string]bool, len(srcFiles))
+	workers := m.opts.Concurrency
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	sem := make(chan struct{}, workers)
+	var wg sync.WaitGroup
+	for i, p := range srcFiles {
+		rel := relPath(m.srcDir, p)
+		sources[rel] = true
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, rel string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			op, err := m.compare(rel)
+			if err != nil {
+				m.fail(rel, err)
+				failed[i] = true
+				return
+			}
+			ops[i] = op
+		}(i, rel)
+	}
+	wg.Wait()
+	for i, op := range ops {
+		switch {
+		case failed[i]:
+		case op == nil:
+			plan.Unchanged++
+		default:
+			plan.Ops = append(plan.Ops, *op)
+		}
+	}
+
+	// a file missing from a partial walk may still exist, it must neither be forgotten nor deleted
+	if err != nil {
+		return plan, nil
+	}
+
+	// forget the files which are gone from the source
+	m.mu.Lock()
+	for rel := range m.state.Files {
+		if !sources[rel] {
+			delete(m.state.Files, rel)
+		}
+	}
+	m.mu.Unlock()
+
+	if m.opts.Delete {
+		plan.Ops = append(plan.Ops, m.extraneous(sources)...)
+	}
+	return plan, nil
+}
+
+// compare returns the operation needed for the source file rel, nil when it is unchanged
+func (m *mirror) compare(rel string) (*MirrorOp, error) {
+	srcInfo, err := fs.Stat(m.src, path.Join(m.srcDir, rel))
+	if err != nil {
+		return nil, err
+	}
+	op := &MirrorOp{Action: MirrorCopy, Path: rel, Size: srcInfo.Size()}
+	dstInfo, err := m.dst.Stat(path.Join(m.dstDir, rel))
+	// a file of the destination where the source has a directory hides the files below it
+	if errors.Is(err, fs.ErrNotExist) || errors.Is(err, syscall.ENOTDIR) {
+		return op, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	op.Action = MirrorUpdate
+	if !dstInfo.Mode().IsRegular() || srcInfo.Size() != dstInfo.Size() {
+		return op, nil
+	}
+
+	if m.opts.Compare == CompareSizeModTime {
+		if m.sameTime(srcInfo.ModTime(), dstInfo.ModTime()) {
+			m.record(rel, srcInfo, dstInfo, "")
+			return nil, nil
+		}
+		return op, nil
+	}
+
+	m.mu.Lock()
+	known, ok := m.state.Files[rel]
+	m.mu.Unlock()
+	if ok && known.Hash != "" && known.Size == srcInfo.Size() && known.ModTime.Equal(srcInfo.ModTime()) &&
+		known.DstSize == dstInfo.Size() && known.DstMTime.Equal(dstInfo.ModTime()) {
+		return nil, nil
+	}
+
+	srcHash, err := m.hash(m.src, path.Join(m.srcDir, rel))
+	if err != nil {
+		return nil, err
+	}
+	dstHash, err := m.hash(m.dst, path.Join(m.dstDir, rel))
+	if err != nil {
+		return nil, err
+	}
+	if srcHash != dstHash {
+		return op, nil
+	}
+	m.record(rel, srcInfo, dstInfo, srcHash)
+	return nil, nil
+}
+
+func (m *mirror) sameTime(a, b time.Time) bool {
+	d := a.Sub(b)
+	if d < 0 {
+		d = -d
+	}
+	return d <= m.opts.ModifyWindow
+}
+
+func (m *mirror) hash(fsys fs.FS, name string) (string, error) {
+	entry, err := hashFile(fsys, name, []HashAlgorithm{m.algorithm})
+	if err != nil {
+		return "", err
+	}
+	return entry.Hashes[m.algorithm], nil
+}
+
+// extraneous returns the deletions of the selected destination files missing in the source,
+// directories are deleted as a whole when they don't exist in the source
+func (m *mirror) extraneous(sources map[string]bool) []MirrorOp {
+	var ops []MirrorOp
+	err := fs.WalkDir(m.dst, m.dstDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			m.fail(p, err)
+			return nil
+		}
+		if p == m.dstDir {
+			return nil
+		}
+		rel := relPath(m.dstDir, p)
+		if d.IsDir() {
+			if matchGlobs(m.opts.Find.Exclude, rel) {
+				return fs.SkipDir
+			}
+			info, err := fs.Stat(m.src, path.Join(m.srcDir, rel))
+			if err != nil || !info.IsDir() {
+				if m.containsSelected(p) {
+					ops = append(ops, MirrorOp{Action: MirrorDelete, Path: rel})
+				}
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if sources[rel] || m.isStateFile(p) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			m.fail(p, err)
+			return nil
+		}
+		if m.opts.Find.Match(rel, info) {
+			ops = append(ops, MirrorOp{Action: MirrorDelete, Path: rel, Size: info.Size()})
+		}
+		return nil
+	})
+	if err != nil {
+		m.fail(m.dstDir, err)
+	}
+	return ops
+}
+
+// containsSelected reports whether the destination directory only holds files selected by the options,
+// a directory with files that are out of the selection is kept
+func (m *mirror) containsSelected(dir string) bool {
+	keep := false
+	_ = fs.WalkDir(m.dst, dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil || !m.opts.Find.Match(relPath(m.dstDir, p), info) || m.isStateFile(p) {
+			keep = true
+			return fs.SkipAll
+		}
+		return nil
+	})
+	return !keep
+}
+
+// isStateFile reports whether the destination file p is the state file of this mirror
+func (m *mirror) isStateFile(p string) bool {
+	o, ok := m.dst.(*OSFS)
+	if !ok || m.opts.StateFile == "" {
+		return false
+	}
+	a, err1 := filepath.Abs(o.Path(p))
+	b, err2 := filepath.Abs(m.opts.StateFile)
+	return err1 == nil && err2 == nil && a == b
+}
+
+// apply runs the deletions before the copies, they make room for a file which replaces
+// a directory and the other way round
+func (m *mirror) apply(plan *MirrorPlan) {
+	for _, op := range plan.Ops {
+		if op.Action != MirrorDelete {
+			continue
+		}
+		if err := m.dst.RemoveAll(path.Join(m.dstDir, op.Path)); err != nil {
+			m.fail(op.Path, err)
+		}
+		m.mu.Lock()
+		delete(m.state.Files, op.Path)
+		m.mu.Unlock()
+	}
+	for _, op := range plan.Ops {
+		if op.Action == MirrorDelete {
+			continue
+		}
+		if err := m.copy(op.Path); err != nil {
+			m.fail(op.Path, err)
+		}
+	}
+}
+
+// copy replaces the destination file through a temporary file and keeps the modification time of the source
+func (m *mirror) copy(rel string) error {
+	srcName := path.Join(m.srcDir, rel)
+	target := path.Join(m.dstDir, rel)
+	srcInfo, err := fs.Stat(m.src, srcName)
+	if err != nil {
+		return err
+	}
+	if err = m.dst.MkdirAll(path.Dir(target), 0o755); err != nil {
+		return err
+	}
+	tmp := path.Join(path.Dir(target), fmt.Sprintf(".%s.%d.tmp", path.Base(target), time.Now().UnixNano()))
+	if err = copyFileFS(m.src, srcName, m.dst, tmp, srcInfo.Mode().Perm()); err != nil {
+		_ = m.dst.Remove(tmp)
+		return err
+	}
+	if err = m.dst.Chtimes(tmp, srcInfo.ModTime(), srcInfo.ModTime()); err != nil {
+		_ = m.dst.Remove(tmp)
+		return err
+	}
+	if err = m.dst.Rename(tmp, target); err != nil {
+		_ = m.dst.Remove(tmp)
+		return err
+	}
+
+	if m.opts.StateFile == "" {
+		return nil
+	}
+	dstInfo, err := m.dst.Stat(target)
+	if err != nil {
+		return err
+	}
+	var sum string
+	if m.opts.Compare == CompareHash {
+		if sum, err = m.hash(m.dst, target); err != nil {
+			return err
+		}
+	}
+	m.record(rel, srcInfo, dstInfo, sum)
+	return nil
+}
+
+func (m *mirror) record(rel string, srcInfo, dstInfo fs.FileInfo, sum string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.state.Files[rel] = mirrorStateEntry{
+		Size:     srcInfo.Size(),
+		ModTime:  srcInfo.ModTime(),
+		Hash:     sum,
+		DstSize:  dstInfo.Size(),
+		DstMTime: dstInfo.ModTime(),
+	}
+}
+
+// loadState reads the state file, a missing or unreadable state only means that everything gets compared
+func (m *mirror) loadState() *mirrorState {
+	state := &mirrorState{Version: 1, Algorithm: m.algorithm, Files: make(map[string]mirrorStateEntry)}
+	if m.opts.StateFile == "" {
+		return state
+	}
+	data, err := os.ReadFile(m.opts.StateFile)
+	if err != nil {
+		return state
+	}
+	var saved mirrorState
+	if json.Unmarshal(data, &saved) != nil || saved.Version != state.Version || saved.Algorithm != m.algorithm || saved.Files == nil {
+		return state
+	}
+	return &saved
+}
+
+func (m *mirror) saveState() error {
+	m.mu.Lock()
+	data, err := json.Marshal(m.state)
+	m.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(m.opts.StateFile)
+	if err = os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, ".mirror-state-*")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), m.opts.StateFile)
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+	}
+	return err
+}
+
+func (m *mirror) fail(p string, err error) {
+	m.mu.Lock()
+	m.errs = append(m.errs, &FindError{Path: p, Err: err})
+	m.mu.Unlock()
+}
@@ -0,0 +1,135 @@
+package file
+
+import (
+	"bytes"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMirror(t *testing.T) {
+	root := t.TempDir()
+	src := filepath.Join(root, "src")
+	dst := filepath.Join(root, "dst")
+	state := filepath.Join(root, "state.json")
+	mtime := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	write := func(dir, name, data string) {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(p), 0o755))
+		require.NoError(t, os.WriteFile(p, []byte(data), 0o644))
+		require.NoError(t, os.Chtimes(p, mtime, mtime))
+	}
+	write(src, "Default/Cookies", "cookies")
+	write(src, "Default/History", "history")
+	write(src, "Local State", "{}")
+
+	for _, compare := range []MirrorCompare{CompareSizeModTime, CompareHash} {
+		opts := &MirrorOptions{Compare: compare, Delete: true, StateFile: state}
+		require.NoError(t, os.RemoveAll(dst))
+		require.NoError(t, os.RemoveAll(state))
+
+		plan, err := Mirror(src, dst, opts)
+		require.NoError(t, err)
+		assert.Len(t, plan.Ops, 3)
+		s, err := ReadFile(filepath.Join(dst, "Default", "Cookies"))
+		require.NoError(t, err)
+		assert.Equal(t, "cookies", s)
+		assert.FileExists(t, state)
+
+		plan, err = Mirror(src, dst, opts)
+		require.NoError(t, err)
+		assert.Empty(t, plan.Ops)
+		assert.Equal(t, 3, plan.Unchanged)
+
+		// same size and time but different content is only noticed by hashes
+		write(src, "Default/History", "HISTORY")
+		write(dst, "Old/file", "old")
+		write(dst, "extra", "extra")
+		dryRun := *opts
+		dryRun.DryRun = true
+		// the state would trust the unchanged size and time
+		dryRun.StateFile = ""
+		plan, err = Mirror(src, dst, &dryRun)
+		require.NoError(t, err)
+		want := []MirrorOp{{Action: MirrorDelete, Path: "Old"}, {Action: MirrorDelete, Path: "extra", Size: 5}}
+		if compare == CompareHash {
+			want = append([]MirrorOp{{Action: MirrorUpdate, Path: "Default/History", Size: 7}}, want...)
+		}
+		assert.Equal(t, want, plan.Ops)
+		assert.FileExists(t, filepath.Join(dst, "extra"))
+
+		var buf bytes.Buffer
+		_, err = plan.WriteTo(&buf)
+		require.NoError(t, err)
+		assert.Contains(t, buf.String(), "delete extra\n")
+
+		_, err = Mirror(src, dst, opts)
+		require.NoError(t, err)
+		assert.NoFileExists(t, filepath.Join(dst, "extra"))
+		assert.NoDirExists(t, filepath.Join(dst, "Old"))
+		write(src, "Default/History", "history")
+	}
+}
+
+// unreadableDirFS fails to list dir, like a subdirectory without permission
+type unreadableDirFS struct {
+	fstest.MapFS
+	dir string
+}
+
+func (f unreadableDirFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if name == f.dir {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrPermission}
+	}
+	return f.MapFS.ReadDir(name)
+}
+
+func TestMirrorPartialSource(t *testing.T) {
+	src := unreadableDirFS{MapFS: fstest.MapFS{
+		"a.txt":        {Data: []byte("a")},
+		"locked/b.txt": {Data: []byte("b")},
+	}}
+	dst := NewMemFS()
+	opts := &MirrorOptions{Delete: true}
+	_, err := MirrorFS(src.MapFS, ".", dst, ".", opts)
+	require.NoError(t, err)
+	require.NoError(t, WriteFileFS(dst, "extra", []byte("extra"), 0o644))
+
+	src.dir = "locked"
+	plan, err := MirrorFS(src, ".", dst, ".", opts)
+	assert.ErrorIs(t, err, fs.ErrPermission)
+	require.NotNil(t, plan)
+	assert.Zero(t, plan.count(MirrorDelete))
+	data, err := fs.ReadFile(dst, "locked/b.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "b", string(data))
+	assert.True(t, IsFileExistsFS(dst, "extra"))
+}
+
+func TestMirrorTypeChange(t *testing.T) {
+	root := t.TempDir()
+	src := filepath.Join(root, "src")
+	dst := filepath.Join(root, "dst")
+	// a file replaces a directory and a directory replaces a file
+	require.NoError(t, os.MkdirAll(filepath.Join(src, "b"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(src, "a"), []byte("file"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(src, "b", "x"), []byte("x"), 0o644))
+	require.NoError(t, os.MkdirAll(filepath.Join(dst, "a"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dst, "a", "old"), []byte("old"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dst, "b"), []byte("file"), 0o644))
+
+	_, err := Mirror(src, dst, &MirrorOptions{Delete: true})
+	require.NoError(t, err)
+	s, err := ReadFile(filepath.Join(dst, "a"))
+	require.NoError(t, err)
+	assert.Equal(t, "file", s)
+	s, err = ReadFile(filepath.Join(dst, "b", "x"))
+	require.NoError(t, err)
+	assert.Equal(t, "x", s)
+}
@@ -0,0 +1,32 @@
+package file
+
+import "errors"
+
+// errNotifyUnsupported makes the callers of newNotifier fall back to polling
+var errNotifyUnsupported = errors.New("file change notifications are not supported")
+
+// notifyOp is the kind of a change reported by a notifier
+type notifyOp uint32
+
+const (
+	notifyCreate notifyOp = 1 << iota
+	notifyWrite
+	notifyRemove
+	notifyRename
+	notifyChmod
+)
+
+// notifyEvent is a change in a watched directory, Path is empty when events have been lost
+// and the directories have to be scanned again
+type notifyEvent struct {
+	Path string
+	Op   notifyOp
+}
+
+// notifier delivers the changes of the entries of watched directories
+type notifier interface {
+	add(dir string) error
+	remove(dir string)
+	events() <-chan notifyEvent
+	close() error
+}
@@ -0,0 +1,148 @@
+package file
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"golang.org/x/sys/unix"
+)
+
+const inotifyMask = unix.IN_CREATE | unix.IN_MODIFY | unix.IN_CLOSE_WRITE | unix.IN_ATTRIB |
+	unix.IN_MOVED_FROM | unix.IN_MOVED_TO | unix.IN_DELETE | unix.IN_DELETE_SELF | unix.IN_MOVE_SELF |
+	unix.IN_ONLYDIR | unix.IN_EXCL_UNLINK
+
+// inotify watches directories with inotify(7)
+type inotify struct {
+	f *os.File
+
+	mu      sync.Mutex
+	watches map[int]string // watch descriptor -> directory
+	dirs    map[string]int
+
+	ch   chan notifyEvent
+	done chan struct{}
+}
+
+func newNotifier() (notifier, error) {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return nil, err
+	}
+	// a non-blocking descriptor is handled by the runtime poller, closing it ends pending reads
+	n := &inotify{
+		f:       os.NewFile(uintptr(fd), "inotify"),
+		watches: map[int]string{},
+		dirs:    map[string]int{},
+		ch:      make(chan notifyEvent, 128),
+		done:    make(chan struct{}),
+	}
+	go n.read()
+	return n, nil
+}
+
+func (n *inotify) add(dir string) error {
+	dir = filepath.Clean(dir)
+	wd, err := unix.InotifyAddWatch(int(n.f.Fd()), dir, inotifyMask)
+	if err != nil {
+		return &os.PathError{Op: "inotify_add_watch", Path: dir, Err: err}
+	}
+	n.mu.Lock()
+	n.watches[wd] = dir
+	n.dirs[dir] = wd
+	n.mu.Unlock()
+	return nil
+}
+
+func (n *inotify) remove(dir string) {
+	dir = filepath.Clean(dir)
+	n.mu.Lock()
+	wd, ok := n.dirs[dir]
+	delete(n.dirs, dir)
+	delete(n.watches, wd)
+	n.mu.Unlock()
+	if ok {
+		_, _ = unix.InotifyRmWatch(int(n.f.Fd()), uint32(wd))
+	}
+}
+
+func (n *inotify) events() <-chan notifyEvent {
+	return n.ch
+}
+
+func (n *inotify) close() error {
+	select {
+	case <-n.done:
+		return nil
+	default:
+	}
+	close(n.done)
+	return n.f.Close()
+}
+
+func (n *inotify) read() {
+	defer close(n.ch)
+	buf := make([]byte, 64*1024)
+	for {
+		count, err := n.f.Read(buf)
+		if err != nil {
+			return
+		}
+		for off := 0; off+unix.SizeofInotifyEvent <= count; {
+			wd := int(int32(binary.NativeEndian.Uint32(buf[off:])))
+			mask := binary.NativeEndian.Uint32(buf[off+4:])
+			length := int(binary.NativeEndian.Uint32(buf[off+12:]))
+			name := strings.TrimRight(string(buf[off+unix.SizeofInotifyEvent:off+unix.SizeofInotifyEvent+length]), "\x00")
+			off += unix.SizeofInotifyEvent + length
+
+			if mask&unix.IN_Q_OVERFLOW != 0 {
+				if !n.send(notifyEvent{}) {
+					return
+				}
+				continue
+			}
+			n.mu.Lock()
+			dir, ok := n.watches[wd]
+			if mask&unix.IN_IGNORED != 0 {
+				delete(n.watches, wd)
+				if n.dirs[dir] == wd {
+					delete(n.dirs, dir)
+				}
+			}
+			n.mu.Unlock()
+			if !ok {
+				continue
+			}
+
+			event := notifyEvent{Path: filepath.Join(dir, name)}
+			switch {
+			case mask&(unix.IN_CREATE|unix.IN_MOVED_TO) != 0:
+				event.Op = notifyCreate
+			case mask&(unix.IN_MODIFY|unix.IN_CLOSE_WRITE) != 0:
+				event.Op = notifyWrite
+			case mask&(unix.IN_DELETE|unix.IN_DELETE_SELF) != 0:
+				event.Op = notifyRemove
+			case mask&(unix.IN_MOVED_FROM|unix.IN_MOVE_SELF) != 0:
+				event.Op = notifyRename
+			case mask&unix.IN_ATTRIB != 0:
+				event.Op = notifyChmod
+			default:
+				continue
+			}
+			if !n.send(event) {
+				return
+			}
+		}
+	}
+}
+
+func (n *inotify) send(event notifyEvent) bool {
+	select {
+	case n.ch <- event:
+		return true
+	case <-n.done:
+		return false
+	}
+}
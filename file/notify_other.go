@@ -0,0 +1,7 @@
+//go:build !linux
+
+package file
+
+func newNotifier() (notifier, error) {
+	return nil, errNotifyUnsupported
+}
@@ -0,0 +1,250 @@
+package ntfs
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/fs"
+	"time"
+)
+
+// file name namespaces
+const (
+	namespacePOSIX = 0
+	namespaceWin32 = 1
+	namespaceDOS   = 2
+)
+
+// file attribute flags of $STANDARD_INFORMATION
+const (
+	fileAttrReadOnly  = 0x0001
+	fileAttrDirectory = 0x10000000
+)
+
+// File is a file or a directory of the volume, it implements fs.FileInfo
+type File struct {
+	v     *Volume
+	ref   uint64
+	seq   uint16
+	flags uint16
+	attrs []*attribute
+
+	name    string
+	parent  uint64
+	attrib  uint32
+	created time.Time
+	modTime time.Time
+	access  time.Time
+}
+
+func newFile(v *Volume, rec *record) (*File, error) {
+	f := &File{v: v, ref: rec.ref, seq: rec.seq, flags: rec.flags, attrs: rec.attrs}
+	if err := f.loadAttributeList(); err != nil {
+		return nil, err
+	}
+
+	if std := f.attribute(attrStandardInformation, ""); std != nil && len(std.value) >= 0x24 {
+		f.created = ntfsTime(binary.LittleEndian.Uint64(std.value[0x00:]))
+		f.modTime = ntfsTime(binary.LittleEndian.Uint64(std.value[0x08:]))
+		f.access = ntfsTime(binary.LittleEndian.Uint64(std.value[0x18:]))
+		f.attrib = binary.LittleEndian.Uint32(std.value[0x20:])
+	}
+	// prefer the long name, files may have a separate DOS 8.3 name
+	best := -1
+	for _, a := range f.attrs {
+		if a.typ != attrFileName || !a.resident {
+			continue
+		}
+		fn, err := parseFileName(a.value)
+		if err != nil {
+			return nil, err
+		}
+		if best == -1 || best == namespaceDOS {
+			f.name, f.parent, best = fn.name, fn.parent, int(fn.namespace)
+		}
+	}
+	if f.ref == RecordRoot {
+		f.name = "."
+	}
+	return f, nil
+}
+
+// maxAttributeListSize is the limit of Windows for $ATTRIBUTE_LIST, larger sizes come from corrupt records
+const maxAttributeListSize = 256 << 10
+
+// loadAttributeList collects the attributes stored in extension records, files with many
+// attributes or very fragmented streams list them in $ATTRIBUTE_LIST
+func (f *File) loadAttributeList() error {
+	list := f.attribute(attrAttributeList, "")
+	if list == nil {
+		return nil
+	}
+	if list.size > maxAttributeListSize {
+		return fmt.Errorf("%w: attribute list of record %d has %d bytes", ErrCorrupt, f.ref, list.size)
+	}
+	data := make([]byte, list.size)
+	if _, err := (&stream{v: f.v, attr: list}).ReadAt(data, 0); err != nil && err != io.EOF {
+		return fmt.Errorf("ntfs: failed to read attribute list of record %d, %v", f.ref, err)
+	}
+
+	loaded := map[uint64]bool{f.ref: true}
+	attrs := append([]*attribute(nil), f.attrs...)
+	for offset := 0; offset+0x1A <= len(data); {
+		length := int(binary.LittleEndian.Uint16(data[offset+4:]))
+		if length < 0x1A || offset+length > len(data) {
+			return fmt.Errorf("%w: invalid attribute list entry", ErrCorrupt)
+		}
+		ref := binary.LittleEndian.Uint64(data[offset+0x10:]) & refMask
+		offset += length
+		if loaded[ref] {
+			continue
+		}
+		loaded[ref] = true
+		rec, err := f.v.record(ref)
+		if err != nil {
+			return err
+		}
+		if rec.baseRef&refMask != f.ref {
+			return fmt.Errorf("%w: record %d isn't an extension of record %d", ErrCorrupt, ref, f.ref)
+		}
+		for _, a := range rec.attrs {
+			if a.typ != attrAttributeList {
+				attrs = append(attrs, a)
+			}
+		}
+	}
+	f.attrs = attrs
+	return nil
+}
+
+func (f *File) attribute(typ uint32, name string) *attribute {
+	return mergeAttributes(f.attrs, typ, name)
+}
+
+// Ref returns the number of the MFT record of the file
+func (f *File) Ref() uint64 {
+	return f.ref
+}
+
+// ParentRef returns the number of the MFT record of the parent directory
+func (f *File) ParentRef() uint64 {
+	return f.parent & refMask
+}
+
+// Name returns the long name of the file
+func (f *File) Name() string {
+	return f.name
+}
+
+// Size returns the size of the unnamed data stream
+func (f *File) Size() int64 {
+	if data := f.attribute(attrData, ""); data != nil {
+		return data.size
+	}
+	return 0
+}
+
+// Mode returns the file mode, the permissions are derived from the read-only attribute
+func (f *File) Mode() fs.FileMode {
+	mode := fs.FileMode(0o644)
+	if f.attrib&fileAttrReadOnly != 0 {
+		mode = 0o444
+	}
+	if f.IsDir() {
+		return fs.ModeDir | mode | 0o111
+	}
+	return mode
+}
+
+// ModTime returns the last modification time
+func (f *File) ModTime() time.Time {
+	return f.modTime
+}
+
+// CreationTime returns the creation time
+func (f *File) CreationTime() time.Time {
+	return f.created
+}
+
+// AccessTime returns the last access time
+func (f *File) AccessTime() time.Time {
+	return f.access
+}
+
+// IsDir reports whether the file is a directory
+func (f *File) IsDir() bool {
+	return f.flags&recordDirectory != 0
+}
+
+// Sys returns nil
+func (f *File) Sys() any {
+	return nil
+}
+
+// Streams returns the names of the data streams, the unnamed main stream is ""
+// and the others are alternate data streams like "Zone.Identifier"
+func (f *File) Streams() []string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, a := range f.attrs {
+		if a.typ == attrData && !seen[a.name] {
+			seen[a.name] = true
+			names = append(names, a.name)
+		}
+	}
+	return names
+}
+
+// OpenStream returns a reader of the data stream name, "" is the main stream
+func (f *File) OpenStream(name string) (*io.SectionReader, error) {
+	data := f.attribute(attrData, name)
+	if data == nil {
+		return nil, fmt.Errorf("ntfs: %s has no stream %q, %w", f.name, name, fs.ErrNotExist)
+	}
+	if !data.resident && data.flags&(attrFlagCompressed|attrFlagEncrypted) != 0 {
+		return nil, fmt.Errorf("%w: %s is compressed or encrypted", ErrUnsupported, f.name)
+	}
+	return io.NewSectionReader(&stream{v: f.v, attr: data}, 0, data.size), nil
+}
+
+// Open returns a reader of the main data stream
+func (f *File) Open() (*io.SectionReader, error) {
+	return f.OpenStream("")
+}
+
+type fileName struct {
+	parent    uint64
+	size      int64
+	flags     uint32
+	namespace uint8
+	name      string
+	modTime   time.Time
+}
+
+func parseFileName(b []byte) (*fileName, error) {
+	if len(b) < 0x42 {
+		return nil, fmt.Errorf("%w: short file name", ErrCorrupt)
+	}
+	length := int(b[0x40])
+	if 0x42+2*length > len(b) {
+		return nil, fmt.Errorf("%w: file name out of bounds", ErrCorrupt)
+	}
+	return &fileName{
+		parent:    binary.LittleEndian.Uint64(b),
+		modTime:   ntfsTime(binary.LittleEndian.Uint64(b[0x10:])),
+		size:      int64(binary.LittleEndian.Uint64(b[0x30:])),
+		flags:     binary.LittleEndian.Uint32(b[0x38:]),
+		namespace: b[0x41],
+		name:      decodeName(b[0x42 : 0x42+2*length]),
+	}, nil
+}
+
+// ntfsTime converts the number of 100 ns intervals since 1601-01-01 UTC
+func ntfsTime(t uint64) time.Time {
+	const epochDelta = 116444736000000000
+	if t == 0 {
+		return time.Time{}
+	}
+	d := int64(t) - epochDelta
+	return time.Unix(d/1e7, d%1e7*100).UTC()
+}
@@ -0,0 +1,199 @@
+package ntfs
+
+import (
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+)
+
+var (
+	_ fs.StatFS    = (*Volume)(nil)
+	_ fs.ReadDirFS = (*Volume)(nil)
+)
+
+// Open implements fs.FS, an alternate data stream is opened by appending its name
+// after a colon like "Downloads/setup.exe:Zone.Identifier". The system files of the
+// volume like $MFT are part of the root directory.
+func (v *Volume) Open(name string) (fs.File, error) {
+	f, streamName, err := v.resolve("open", name)
+	if err != nil {
+		return nil, err
+	}
+	if f.IsDir() && streamName == "" {
+		return &openDir{f: f}, nil
+	}
+	r, err := f.OpenStream(streamName)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	var info fs.FileInfo = f
+	if streamName != "" {
+		info = &streamInfo{File: f, name: f.name + ":" + streamName, size: r.Size()}
+	}
+	return &openFile{info: info, SectionReader: r}, nil
+}
+
+// Stat implements fs.StatFS
+func (v *Volume) Stat(name string) (fs.FileInfo, error) {
+	f, streamName, err := v.resolve("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	if streamName != "" {
+		data := f.attribute(attrData, streamName)
+		if data == nil {
+			return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+		}
+		return &streamInfo{File: f, name: f.name + ":" + streamName, size: data.size}, nil
+	}
+	return f, nil
+}
+
+// ReadDir implements fs.ReadDirFS
+func (v *Volume) ReadDir(name string) ([]fs.DirEntry, error) {
+	f, _, err := v.resolve("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	return dirEntries(f)
+}
+
+func (v *Volume) resolve(op, name string) (*File, string, error) {
+	if !fs.ValidPath(name) {
+		return nil, "", &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	if strings.Contains(name, "\\") {
+		// only slashes separate the names of a fs.FS and NTFS names can't contain backslashes
+		return nil, "", &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+	streamName := ""
+	if base := path.Base(name); strings.Contains(base, ":") {
+		var file string
+		file, streamName, _ = strings.Cut(base, ":")
+		name = path.Join(path.Dir(name), file)
+	}
+	f, err := v.Lookup(name)
+	if err != nil {
+		return nil, "", &fs.PathError{Op: op, Path: name, Err: err}
+	}
+	return f, streamName, nil
+}
+
+func dirEntries(f *File) ([]fs.DirEntry, error) {
+	entries, err := f.ReadDir()
+	if err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: f.name, Err: err}
+	}
+	// the index is collated by the upper case names, fs.ReadDir is sorted by the names
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+	result := make([]fs.DirEntry, 0, len(entries))
+	for _, e := range entries {
+		result = append(result, &dirEntry{v: f.v, e: e})
+	}
+	return result, nil
+}
+
+type dirEntry struct {
+	v *Volume
+	e DirEntry
+}
+
+func (d *dirEntry) Name() string {
+	return d.e.Name
+}
+
+func (d *dirEntry) IsDir() bool {
+	return d.e.IsDir
+}
+
+func (d *dirEntry) Type() fs.FileMode {
+	if d.e.IsDir {
+		return fs.ModeDir
+	}
+	return 0
+}
+
+func (d *dirEntry) Info() (fs.FileInfo, error) {
+	return d.v.File(d.e.Ref)
+}
+
+type openFile struct {
+	info fs.FileInfo
+	*io.SectionReader
+}
+
+func (o *openFile) Stat() (fs.FileInfo, error) {
+	return o.info, nil
+}
+
+func (o *openFile) Close() error {
+	return nil
+}
+
+type openDir struct {
+	f       *File
+	entries []fs.DirEntry
+	read    bool
+}
+
+func (d *openDir) Stat() (fs.FileInfo, error) {
+	return d.f, nil
+}
+
+func (d *openDir) Read(p []byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.f.name, Err: fs.ErrInvalid}
+}
+
+func (d *openDir) ReadDir(count int) ([]fs.DirEntry, error) {
+	if !d.read {
+		entries, err := dirEntries(d.f)
+		if err != nil {
+			return nil, err
+		}
+		d.entries = entries
+		d.read = true
+	}
+	if count <= 0 {
+		entries := d.entries
+		d.entries = nil
+		return entries, nil
+	}
+	if len(d.entries) == 0 {
+		return nil, io.EOF
+	}
+	if count > len(d.entries) {
+		count = len(d.entries)
+	}
+	entries := d.entries[:count]
+	d.entries = d.entries[count:]
+	return entries, nil
+}
+
+func (d *openDir) Close() error {
+	return nil
+}
+
+// streamInfo describes an alternate data stream
+type streamInfo struct {
+	*File
+	name string
+	size int64
+}
+
+func (s *streamInfo) Name() string {
+	return s.name
+}
+
+func (s *streamInfo) Size() int64 {
+	return s.size
+}
+
+func (s *streamInfo) IsDir() bool {
+	return false
+}
+
+func (s *streamInfo) Mode() fs.FileMode {
+	return s.File.Mode() &^ (fs.ModeDir | 0o111)
+}
@@ -0,0 +1,166 @@
+package ntfs
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/fs"
+	"strings"
+	"time"
+)
+
+// index entry flags
+const (
+	entrySubnode = 0x01
+	entryLast    = 0x02
+)
+
+const indexName = "$I30"
+
+// DirEntry is an entry of a directory index, the size and the time are the ones recorded in
+// the index which may lag behind the file itself
+type DirEntry struct {
+	Ref     uint64
+	Name    string
+	IsDir   bool
+	Size    int64
+	ModTime time.Time
+}
+
+// ReadDir returns the entries of the directory in index order
+func (f *File) ReadDir() ([]DirEntry, error) {
+	if !f.IsDir() {
+		return nil, fmt.Errorf("ntfs: %s is not a directory", f.name)
+	}
+	root := f.attribute(attrIndexRoot, indexName)
+	if root == nil || len(root.value) < 0x20 {
+		return nil, fmt.Errorf("%w: directory %s has no index root", ErrCorrupt, f.name)
+	}
+
+	w := &indexWalker{f: f, seen: make(map[uint64]bool), visited: make(map[uint64]bool)}
+	if alloc := f.attribute(attrIndexAllocation, indexName); alloc != nil {
+		w.alloc = &stream{v: f.v, attr: alloc}
+		w.recordSize = int(binary.LittleEndian.Uint32(root.value[0x08:]))
+		w.unit = f.v.ClusterSize
+		if int64(w.recordSize) < f.v.ClusterSize {
+			// small index records are addressed in units of 512 bytes
+			w.unit = 512
+		}
+	}
+	if err := w.walk(root.value[0x10:]); err != nil {
+		return nil, err
+	}
+	return w.entries, nil
+}
+
+// Lookup returns the entry name of the directory, names are compared case-insensitively
+func (f *File) Lookup(name string) (*File, error) {
+	entries, err := f.ReadDir()
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		if e.Name == name {
+			return f.v.File(e.Ref)
+		}
+	}
+	for _, e := range entries {
+		if strings.EqualFold(e.Name, name) {
+			return f.v.File(e.Ref)
+		}
+	}
+	return nil, fmt.Errorf("ntfs: %s not found in %s, %w", name, f.name, fs.ErrNotExist)
+}
+
+type indexWalker struct {
+	f          *File
+	alloc      *stream
+	recordSize int
+	unit       int64
+
+	entries []DirEntry
+	seen    map[uint64]bool
+	visited map[uint64]bool
+}
+
+// walk visits the entries of the node whose index header is at the start of b in order,
+// the subnode of an entry holds the names sorting before the entry
+func (w *indexWalker) walk(b []byte) error {
+	if len(b) < 0x10 {
+		return fmt.Errorf("%w: short index header", ErrCorrupt)
+	}
+	offset := int(binary.LittleEndian.Uint32(b))
+	end := int(binary.LittleEndian.Uint32(b[4:]))
+	if end > len(b) || offset > end {
+		return fmt.Errorf("%w: index header out of bounds", ErrCorrupt)
+	}
+
+	for offset+0x10 <= end {
+		length := int(binary.LittleEndian.Uint16(b[offset+8:]))
+		keyLength := int(binary.LittleEndian.Uint16(b[offset+0x0A:]))
+		flags := binary.LittleEndian.Uint16(b[offset+0x0C:])
+		if length < 0x10 || offset+length > end || 0x10+keyLength > length {
+			return fmt.Errorf("%w: invalid index entry", ErrCorrupt)
+		}
+		entry := b[offset : offset+length]
+
+		if flags&entrySubnode != 0 {
+			if length < 0x18 {
+				return fmt.Errorf("%w: index entry without subnode", ErrCorrupt)
+			}
+			if err := w.descend(binary.LittleEndian.Uint64(entry[length-8:])); err != nil {
+				return err
+			}
+		}
+		if flags&entryLast != 0 {
+			break
+		}
+		if err := w.add(binary.LittleEndian.Uint64(entry), entry[0x10:0x10+keyLength]); err != nil {
+			return err
+		}
+		offset += length
+	}
+	return nil
+}
+
+func (w *indexWalker) descend(vcn uint64) error {
+	if w.alloc == nil {
+		return fmt.Errorf("%w: index subnode without allocation", ErrCorrupt)
+	}
+	if w.visited[vcn] {
+		return fmt.Errorf("%w: index loop", ErrCorrupt)
+	}
+	w.visited[vcn] = true
+
+	buf := make([]byte, w.recordSize)
+	if _, err := w.alloc.ReadAt(buf, int64(vcn)*w.unit); err != nil && err != io.EOF {
+		return fmt.Errorf("ntfs: failed to read index record %d of %s, %v", vcn, w.f.name, err)
+	}
+	if string(buf[:4]) != "INDX" {
+		return fmt.Errorf("%w: missing INDX signature", ErrCorrupt)
+	}
+	if err := applyFixups(buf, w.f.v.BytesPerSector); err != nil {
+		return err
+	}
+	return w.walk(buf[0x18:])
+}
+
+func (w *indexWalker) add(ref uint64, key []byte) error {
+	fn, err := parseFileName(key)
+	if err != nil {
+		return err
+	}
+	// files with a long name have a second entry for their DOS name
+	if fn.namespace == namespaceDOS || w.seen[ref&refMask] {
+		return nil
+	}
+	w.seen[ref&refMask] = true
+	w.entries = append(w.entries, DirEntry{
+		Ref:     ref & refMask,
+		Name:    fn.name,
+		IsDir:   fn.flags&fileAttrDirectory != 0,
+		Size:    fn.size,
+		ModTime: fn.modTime,
+	})
+	return nil
+}
@@ -0,0 +1,524 @@
+package ntfs
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+	"unicode/utf16"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// the test image uses 512 byte sectors, 4 KiB clusters, 1 KiB file records and 4 KiB index records
+const (
+	testSector  = 512
+	testCluster = 4096
+	testRecord  = 1024
+)
+
+var testTime = time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+
+type testRun struct {
+	lcn    int64 // -1 for sparse
+	length uint64
+}
+
+type testImage struct {
+	b []byte
+}
+
+func newTestImage(clusters int) *testImage {
+	m := &testImage{b: make([]byte, clusters*testCluster)}
+	boot := m.b
+	copy(boot, []byte{0xEB, 0x52, 0x90})
+	copy(boot[3:], "NTFS    ")
+	binary.LittleEndian.PutUint16(boot[0x0B:], testSector)
+	boot[0x0D] = testCluster / testSector
+	boot[0x15] = 0xF8
+	binary.LittleEndian.PutUint64(boot[0x28:], uint64(clusters*testCluster/testSector-1))
+	binary.LittleEndian.PutUint64(boot[0x30:], 4)
+	binary.LittleEndian.PutUint64(boot[0x38:], 2)
+	boot[0x40] = 0xF6 // 2^10 bytes
+	boot[0x44] = 0x01
+	binary.LittleEndian.PutUint64(boot[0x48:], 0x1234)
+	boot[0x1FE], boot[0x1FF] = 0x55, 0xAA
+	return m
+}
+
+// mftOffset maps record numbers to the two fragments of the MFT at clusters 4 and 10
+func mftOffset(ref int) int {
+	if ref < 8 {
+		return 4*testCluster + ref*testRecord
+	}
+	return 10*testCluster + (ref-8)*testRecord
+}
+
+func (m *testImage) record(ref int, flags uint16, baseRef uint64, attrs ...[]byte) {
+	b := m.b[mftOffset(ref) : mftOffset(ref)+testRecord]
+	copy(b, "FILE")
+	binary.LittleEndian.PutUint16(b[4:], 0x30)
+	binary.LittleEndian.PutUint16(b[6:], testRecord/testSector+1)
+	binary.LittleEndian.PutUint16(b[0x10:], 1)
+	binary.LittleEndian.PutUint16(b[0x12:], 1)
+	binary.LittleEndian.PutUint16(b[0x14:], 0x38)
+	binary.LittleEndian.PutUint16(b[0x16:], flags)
+	binary.LittleEndian.PutUint32(b[0x1C:], testRecord)
+	binary.LittleEndian.PutUint64(b[0x20:], baseRef)
+	offset := 0x38
+	for i, a := range attrs {
+		binary.LittleEndian.PutUint16(a[0x0E:], uint16(i))
+		offset += copy(b[offset:], a)
+	}
+	binary.LittleEndian.PutUint32(b[offset:], attrEnd)
+	binary.LittleEndian.PutUint32(b[0x18:], uint32(offset+8))
+	protect(b, 0x30)
+}
+
+// protect writes the update sequence like NTFS does before a multi-sector structure goes to disk
+func protect(b []byte, usaOffset int) {
+	count := len(b)/testSector + 1
+	binary.LittleEndian.PutUint16(b[usaOffset:], 7)
+	for i := 1; i < count; i++ {
+		end := i*testSector - 2
+		copy(b[usaOffset+2*i:], b[end:end+2])
+		binary.LittleEndian.PutUint16(b[end:], 7)
+	}
+}
+
+func (m *testImage) indexRecord(cluster int, entries []byte) {
+	b := m.b[cluster*testCluster : (cluster+1)*testCluster]
+	copy(b, "INDX")
+	binary.LittleEndian.PutUint16(b[4:], 0x28)
+	binary.LittleEndian.PutUint16(b[6:], testCluster/testSector+1)
+	binary.LittleEndian.PutUint32(b[0x18:], 0x40-0x18)
+	binary.LittleEndian.PutUint32(b[0x1C:], uint32(0x40-0x18+len(entries)))
+	binary.LittleEndian.PutUint32(b[0x20:], testCluster-0x18)
+	copy(b[0x40:], entries)
+	protect(b, 0x28)
+}
+
+func align8(n int) int {
+	return (n + 7) &^ 7
+}
+
+func utf16le(s string) []byte {
+	u := utf16.Encode([]rune(s))
+	b := make([]byte, 2*len(u))
+	for i, c := range u {
+		binary.LittleEndian.PutUint16(b[2*i:], c)
+	}
+	return b
+}
+
+func resident(typ uint32, name string, value []byte) []byte {
+	n := utf16le(name)
+	valueOffset := align8(0x18 + len(n))
+	b := make([]byte, align8(valueOffset+len(value)))
+	binary.LittleEndian.PutUint32(b, typ)
+	binary.LittleEndian.PutUint32(b[4:], uint32(len(b)))
+	b[9] = byte(len(n) / 2)
+	binary.LittleEndian.PutUint16(b[0x0A:], 0x18)
+	binary.LittleEndian.PutUint32(b[0x10:], uint32(len(value)))
+	binary.LittleEndian.PutUint16(b[0x14:], uint16(valueOffset))
+	copy(b[0x18:], n)
+	copy(b[valueOffset:], value)
+	return b
+}
+
+func nonResident(typ uint32, name string, runs []testRun, size, initSize int64) []byte {
+	n := utf16le(name)
+	var runlist []byte
+	var prev int64
+	var clusters uint64
+	for _, r := range runs {
+		length := encodeInt(int64(r.length), false)
+		var offset []byte
+		if r.lcn >= 0 {
+			offset = encodeInt(r.lcn-prev, true)
+			prev = r.lcn
+		}
+		runlist = append(runlist, byte(len(offset)<<4|len(length)))
+		runlist = append(append(runlist, length...), offset...)
+		clusters += r.length
+	}
+	runlist = append(runlist, 0)
+
+	runOffset := align8(0x40 + len(n))
+	b := make([]byte, align8(runOffset+len(runlist)))
+	binary.LittleEndian.PutUint32(b, typ)
+	binary.LittleEndian.PutUint32(b[4:], uint32(len(b)))
+	b[8] = 1
+	b[9] = byte(len(n) / 2)
+	binary.LittleEndian.PutUint16(b[0x0A:], 0x40)
+	binary.LittleEndian.PutUint64(b[0x18:], clusters-1)
+	binary.LittleEndian.PutUint16(b[0x20:], uint16(runOffset))
+	binary.LittleEndian.PutUint64(b[0x28:], clusters*testCluster)
+	binary.LittleEndian.PutUint64(b[0x30:], uint64(size))
+	binary.LittleEndian.PutUint64(b[0x38:], uint64(initSize))
+	copy(b[0x40:], n)
+	copy(b[runOffset:], runlist)
+	return b
+}
+
+func encodeInt(v int64, signed bool) []byte {
+	var b []byte
+	for {
+		b = append(b, byte(v))
+		v >>= 8
+		last := b[len(b)-1]&0x80 != 0
+		if !signed && v == 0 || signed && (v == 0 && !last || v == -1 && last) {
+			return b
+		}
+	}
+}
+
+func ntfsStamp(t time.Time) uint64 {
+	return uint64(t.UnixNano()/100 + 116444736000000000)
+}
+
+func stdInfo(attrib uint32) []byte {
+	v := make([]byte, 0x48)
+	for i := 0; i < 4; i++ {
+		binary.LittleEndian.PutUint64(v[8*i:], ntfsStamp(testTime))
+	}
+	binary.LittleEndian.PutUint32(v[0x20:], attrib)
+	return resident(attrStandardInformation, "", v)
+}
+
+func fileNameValue(parent uint64, name string, namespace byte, size int64, dir bool) []byte {
+	n := utf16le(name)
+	v := make([]byte, 0x42+len(n))
+	binary.LittleEndian.PutUint64(v, parent|5<<48)
+	for i := 1; i <= 4; i++ {
+		binary.LittleEndian.PutUint64(v[8*i:], ntfsStamp(testTime))
+	}
+	binary.LittleEndian.PutUint64(v[0x28:], uint64(size))
+	binary.LittleEndian.PutUint64(v[0x30:], uint64(size))
+	if dir {
+		binary.LittleEndian.PutUint32(v[0x38:], fileAttrDirectory)
+	}
+	v[0x40] = byte(len(n) / 2)
+	v[0x41] = namespace
+	copy(v[0x42:], n)
+	return v
+}
+
+func fileNameAttr(parent uint64, name string, size int64, dir bool) []byte {
+	return resident(attrFileName, "", fileNameValue(parent, name, namespaceWin32, size, dir))
+}
+
+func indexEntry(ref uint64, key []byte, subnode int64) []byte {
+	length := align8(0x10 + len(key))
+	var flags uint16
+	if key == nil {
+		flags |= entryLast
+	}
+	if subnode >= 0 {
+		flags |= entrySubnode
+		length += 8
+	}
+	b := make([]byte, length)
+	binary.LittleEndian.PutUint64(b, ref|1<<48)
+	binary.LittleEndian.PutUint16(b[8:], uint16(length))
+	binary.LittleEndian.PutUint16(b[0x0A:], uint16(len(key)))
+	binary.LittleEndian.PutUint16(b[0x0C:], flags)
+	copy(b[0x10:], key)
+	if subnode >= 0 {
+		binary.LittleEndian.PutUint64(b[length-8:], uint64(subnode))
+	}
+	return b
+}
+
+func indexRoot(large bool, entries ...[]byte) []byte {
+	list := bytes.Join(entries, nil)
+	v := make([]byte, 0x20+len(list))
+	binary.LittleEndian.PutUint32(v, attrFileName)
+	binary.LittleEndian.PutUint32(v[4:], 1)
+	binary.LittleEndian.PutUint32(v[8:], testCluster)
+	v[0x0C] = 1
+	binary.LittleEndian.PutUint32(v[0x10:], 0x10)
+	binary.LittleEndian.PutUint32(v[0x14:], uint32(0x10+len(list)))
+	binary.LittleEndian.PutUint32(v[0x18:], uint32(0x10+len(list)))
+	if large {
+		v[0x1C] = 1
+	}
+	copy(v[0x20:], list)
+	return resident(attrIndexRoot, indexName, v)
+}
+
+func attributeList(entries ...[2]uint64) []byte {
+	var v []byte
+	for _, e := range entries {
+		b := make([]byte, 0x20)
+		binary.LittleEndian.PutUint32(b, uint32(e[0]))
+		binary.LittleEndian.PutUint16(b[4:], 0x20)
+		b[7] = 0x1A
+		binary.LittleEndian.PutUint64(b[0x10:], e[1]|1<<48)
+		v = append(v, b...)
+	}
+	return resident(attrAttributeList, "", v)
+}
+
+func fill(b []byte, seed byte) {
+	for i := range b {
+		b[i] = seed + byte(i%251)
+	}
+}
+
+// buildTestImage returns a small volume with a fragmented MFT and
+//
+//	/small.txt            resident, read-only, with the stream Zone.Identifier
+//	/big.bin              non-resident, fragmented with a sparse run
+//	/attrlist.dat         data in an extension record listed in $ATTRIBUTE_LIST
+//	/Users/Cookies        non-resident, shorter initialized size, in an index record
+//	/Users/History        resident
+func buildTestImage(t *testing.T) (*testImage, map[string][]byte) {
+	m := newTestImage(32)
+	want := map[string][]byte{
+		"small.txt":                 []byte("hello ntfs"),
+		"small.txt:Zone.Identifier": []byte("[ZoneTransfer]\r\nZoneId=3\r\n"),
+		"attrlist.dat":              []byte("from extension"),
+		"Users/History":             []byte("history"),
+	}
+
+	m.record(RecordMFT, recordInUse, 0, stdInfo(0), fileNameAttr(RecordRoot, "$MFT", 16*testRecord, false),
+		nonResident(attrData, "", []testRun{{4, 2}, {10, 2}}, 16*testRecord, 16*testRecord))
+
+	m.record(RecordRoot, recordInUse|recordDirectory, 0, stdInfo(0), fileNameAttr(RecordRoot, ".", 0, true),
+		indexRoot(false,
+			indexEntry(RecordMFT, fileNameValue(RecordRoot, "$MFT", namespaceWin32, 16*testRecord, false), -1),
+			indexEntry(8, fileNameValue(RecordRoot, "attrlist.dat", namespaceWin32, 14, false), -1),
+			indexEntry(10, fileNameValue(RecordRoot, "big.bin", namespaceWin32, 0, false), -1),
+			indexEntry(10, fileNameValue(RecordRoot, "BIG~1.BIN", namespaceDOS, 0, false), -1),
+			indexEntry(11, fileNameValue(RecordRoot, "small.txt", namespaceWin32, 10, false), -1),
+			indexEntry(12, fileNameValue(RecordRoot, "Users", namespaceWin32, 0, true), -1),
+			indexEntry(0, nil, -1)))
+
+	m.record(8, recordInUse, 0, stdInfo(0), attributeList(
+		[2]uint64{attrStandardInformation, 8}, [2]uint64{attrFileName, 8}, [2]uint64{attrData, 9}),
+		fileNameAttr(RecordRoot, "attrlist.dat", 14, false))
+	m.record(9, recordInUse, 8|1<<48, resident(attrData, "", want["attrlist.dat"]))
+
+	big := make([]byte, 3*testCluster+100)
+	fill(big[:testCluster], 1)
+	fill(big[2*testCluster:], 2)
+	copy(m.b[20*testCluster:], big[:testCluster])
+	copy(m.b[17*testCluster:], big[2*testCluster:])
+	want["big.bin"] = big
+	m.record(10, recordInUse, 0, stdInfo(0), fileNameAttr(RecordRoot, "big.bin", int64(len(big)), false),
+		nonResident(attrData, "", []testRun{{20, 1}, {-1, 1}, {17, 2}}, int64(len(big)), int64(len(big))))
+
+	m.record(11, recordInUse, 0, stdInfo(fileAttrReadOnly), fileNameAttr(RecordRoot, "small.txt", 10, false),
+		resident(attrData, "", want["small.txt"]), resident(attrData, "Zone.Identifier", want["small.txt:Zone.Identifier"]))
+
+	m.record(12, recordInUse|recordDirectory, 0, stdInfo(0), fileNameAttr(RecordRoot, "Users", 0, true),
+		indexRoot(true,
+			indexEntry(14, fileNameValue(12, "History", namespaceWin32, 7, false), 0),
+			indexEntry(0, nil, -1)),
+		nonResident(attrIndexAllocation, indexName, []testRun{{14, 1}}, testCluster, testCluster))
+	m.indexRecord(14, bytes.Join([][]byte{
+		indexEntry(13, fileNameValue(12, "Cookies", namespaceWin32, 5000, false), -1),
+		indexEntry(0, nil, -1),
+	}, nil))
+
+	cookies := make([]byte, 5000)
+	fill(cookies, 3)
+	copy(m.b[22*testCluster:], cookies)
+	clear(cookies[4500:])
+	want["Users/Cookies"] = cookies
+	m.record(13, recordInUse, 0, stdInfo(0), fileNameAttr(12, "Cookies", 5000, false),
+		nonResident(attrData, "", []testRun{{22, 2}}, 5000, 4500))
+
+	m.record(14, recordInUse, 0, stdInfo(0), fileNameAttr(12, "History", 7, false), resident(attrData, "", want["Users/History"]))
+	return m, want
+}
+
+func TestVolume(t *testing.T) {
+	m, want := buildTestImage(t)
+	v, err := NewVolume(bytes.NewReader(m.b))
+	require.NoError(t, err)
+	assert.Equal(t, int64(testCluster), v.ClusterSize)
+	assert.Equal(t, testRecord, v.RecordSize)
+	assert.Equal(t, testCluster, v.IndexRecordSize)
+	assert.Equal(t, uint64(16), v.Records())
+
+	for name, data := range want {
+		got, err := fs.ReadFile(v, name)
+		require.NoError(t, err, name)
+		assert.Equal(t, data, got, name)
+	}
+
+	entries, err := fs.ReadDir(v, ".")
+	require.NoError(t, err)
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	assert.Equal(t, []string{"$MFT", "Users", "attrlist.dat", "big.bin", "small.txt"}, names)
+
+	f, err := v.Lookup(`C:\USERS\history`)
+	require.NoError(t, err)
+	assert.Equal(t, "History", f.Name())
+	assert.Equal(t, uint64(12), f.ParentRef())
+	assert.Equal(t, testTime, f.ModTime())
+
+	small, err := v.Lookup("small.txt")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"", "Zone.Identifier"}, small.Streams())
+	assert.Equal(t, fs.FileMode(0o444), small.Mode())
+	info, err := fs.Stat(v, "small.txt:Zone.Identifier")
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(want["small.txt:Zone.Identifier"])), info.Size())
+
+	big, err := v.Lookup("big.bin")
+	require.NoError(t, err)
+	r, err := big.Open()
+	require.NoError(t, err)
+	part := make([]byte, 200)
+	_, err = r.ReadAt(part, testCluster-100)
+	require.NoError(t, err)
+	assert.Equal(t, want["big.bin"][testCluster-100:testCluster+100], part)
+
+	_, err = fs.ReadFile(v, "missing")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+
+	require.NoError(t, fstest.TestFS(v, "small.txt", "big.bin", "Users/Cookies", "Users/History"))
+}
+
+func TestVolumeErrors(t *testing.T) {
+	_, err := NewVolume(bytes.NewReader(make([]byte, 4096)))
+	assert.ErrorIs(t, err, ErrNotNTFS)
+
+	m, _ := buildTestImage(t)
+	// a sector of the record of small.txt which hasn't been written completely
+	m.b[mftOffset(11)+testSector-1] ^= 0xFF
+	v, err := NewVolume(bytes.NewReader(m.b))
+	require.NoError(t, err)
+	_, err = v.Lookup("small.txt")
+	assert.ErrorIs(t, err, ErrCorrupt)
+}
+
+func TestAlignedReader(t *testing.T) {
+	m, want := buildTestImage(t)
+	r := NewAlignedReader(&strictReader{b: m.b}, testSector)
+	v, err := NewVolume(r)
+	require.NoError(t, err)
+	got, err := fs.ReadFile(v, "Users/Cookies")
+	require.NoError(t, err)
+	assert.Equal(t, want["Users/Cookies"], got)
+}
+
+// strictReader rejects unaligned reads like a raw Windows volume
+type strictReader struct {
+	b []byte
+}
+
+func (s *strictReader) ReadAt(p []byte, off int64) (int, error) {
+	if off%testSector != 0 || len(p)%testSector != 0 {
+		return 0, io.ErrShortBuffer
+	}
+	return bytes.NewReader(s.b).ReadAt(p, off)
+}
+
+func TestAttributeListTooLarge(t *testing.T) {
+	m, _ := buildTestImage(t)
+	m.record(15, recordInUse, 0, stdInfo(0), fileNameAttr(RecordRoot, "huge", 0, false),
+		nonResident(attrAttributeList, "", []testRun{{30, 1}}, 1<<40, 1<<40))
+	v, err := NewVolume(bytes.NewReader(m.b))
+	require.NoError(t, err)
+	_, err = v.File(15)
+	assert.ErrorIs(t, err, ErrCorrupt)
+}
+
+func TestCorruptRunlist(t *testing.T) {
+	// a sparse run of 2^64-1 clusters
+	sparse := nonResident(attrData, "", []testRun{{-1, 1 << 56}}, testCluster, testCluster)
+	for i := 0x41; i < 0x49; i++ {
+		sparse[i] = 0xFF
+	}
+	for name, attr := range map[string][]byte{
+		"length overflows": sparse,
+		"past the volume":  nonResident(attrData, "", []testRun{{30, 4}}, testCluster, testCluster),
+		"far cluster":      nonResident(attrData, "", []testRun{{1 << 60, 1}}, testCluster, testCluster),
+	} {
+		m, _ := buildTestImage(t)
+		m.record(15, recordInUse, 0, stdInfo(0), fileNameAttr(RecordRoot, "corrupt", testCluster, false), attr)
+		v, err := NewVolume(bytes.NewReader(m.b))
+		require.NoError(t, err, name)
+		_, err = v.File(15)
+		assert.ErrorIs(t, err, ErrCorrupt, name)
+	}
+}
+
+// extent turns a non-resident attribute into the extent starting at vcn, like the ones stored in extension records
+func extent(a []byte, vcn uint64) []byte {
+	last := binary.LittleEndian.Uint64(a[0x18:])
+	binary.LittleEndian.PutUint64(a[0x10:], vcn)
+	binary.LittleEndian.PutUint64(a[0x18:], vcn+last)
+	return a
+}
+
+func TestFragmentedMFT(t *testing.T) {
+	m, want := buildTestImage(t)
+	// the base record of $MFT maps only its first fragment, the second one is in extension record 7
+	m.record(RecordMFT, recordInUse, 0, stdInfo(0), attributeList(
+		[2]uint64{attrStandardInformation, RecordMFT}, [2]uint64{attrFileName, RecordMFT},
+		[2]uint64{attrData, RecordMFT}, [2]uint64{attrData, 7}),
+		fileNameAttr(RecordRoot, "$MFT", 16*testRecord, false),
+		nonResident(attrData, "", []testRun{{4, 2}}, 16*testRecord, 16*testRecord))
+	m.record(7, recordInUse, RecordMFT|1<<48, extent(nonResident(attrData, "", []testRun{{10, 2}}, 0, 0), 2))
+
+	v, err := NewVolume(bytes.NewReader(m.b))
+	require.NoError(t, err)
+	assert.Equal(t, uint64(16), v.Records())
+	for name, data := range want {
+		got, err := fs.ReadFile(v, name)
+		require.NoError(t, err, name)
+		assert.Equal(t, data, got, name)
+	}
+}
+
+// TestMkntfsImage reads a volume made by mkntfs and written by ntfs-3g, see testdata/mkntfs.sh
+func TestMkntfsImage(t *testing.T) {
+	f, err := os.Open(filepath.Join("testdata", "mkntfs.img.gz"))
+	if errors.Is(err, fs.ErrNotExist) {
+		t.Skip("testdata/mkntfs.img.gz is missing, build it with testdata/mkntfs.sh")
+	}
+	require.NoError(t, err)
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	require.NoError(t, err)
+	img, err := io.ReadAll(zr)
+	require.NoError(t, err)
+
+	v, err := NewVolume(bytes.NewReader(img))
+	require.NoError(t, err)
+	assert.Equal(t, int64(4096), v.ClusterSize)
+
+	frag := bytes.Repeat([]byte("poketto\n"), 131072/8)
+	for name, data := range map[string][]byte{
+		"small.txt":                 []byte("hello ntfs"),
+		"small.txt:Zone.Identifier": []byte("[ZoneTransfer]\r\nZoneId=3\r\n"),
+		"Users/Default/Cookies":     []byte("cookies"),
+		"frag.bin":                  frag,
+	} {
+		got, err := fs.ReadFile(v, name)
+		require.NoError(t, err, name)
+		assert.Equal(t, data, got, name)
+	}
+
+	file, err := v.Lookup("frag.bin")
+	require.NoError(t, err)
+	assert.Greater(t, len(file.attribute(attrData, "").runs), 1, "frag.bin isn't fragmented")
+
+	require.NoError(t, fstest.TestFS(v, "small.txt", "frag.bin", "Users/Default/Cookies"))
+}
@@ -0,0 +1,204 @@
+package ntfs
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"unicode/utf16"
+)
+
+// attribute types
+const (
+	attrStandardInformation = 0x10
+	attrAttributeList       = 0x20
+	attrFileName            = 0x30
+	attrData                = 0x80
+	attrIndexRoot           = 0x90
+	attrIndexAllocation     = 0xA0
+	attrEnd                 = 0xFFFFFFFF
+)
+
+// attribute flags
+const (
+	attrFlagCompressed = 0x0001
+	attrFlagEncrypted  = 0x4000
+)
+
+// record flags
+const (
+	recordInUse     = 0x0001
+	recordDirectory = 0x0002
+)
+
+// refMask keeps the record number of a file reference, the upper 16 bits are the sequence number
+const refMask = 1<<48 - 1
+
+type record struct {
+	ref     uint64
+	seq     uint16
+	flags   uint16
+	baseRef uint64
+	attrs   []*attribute
+}
+
+func (r *record) inUse() bool {
+	return r.flags&recordInUse != 0
+}
+
+type attribute struct {
+	typ      uint32
+	name     string
+	flags    uint16
+	id       uint16
+	resident bool
+
+	// value of a resident attribute
+	value []byte
+
+	// runs of a non-resident attribute
+	startVCN uint64
+	lastVCN  uint64
+	runs     []run
+	size     int64
+	initSize int64
+}
+
+// applyFixups checks the update sequence of a multi-sector structure and restores the last two bytes
+// of every sector, they are replaced by the update sequence number when the structure is written
+func applyFixups(buf []byte, sectorSize int) error {
+	if len(buf) < 8 {
+		return ErrCorrupt
+	}
+	offset := int(binary.LittleEndian.Uint16(buf[4:]))
+	count := int(binary.LittleEndian.Uint16(buf[6:]))
+	if count == 0 || offset+2*count > len(buf) || (count-1)*sectorSize > len(buf) {
+		return fmt.Errorf("%w: invalid update sequence", ErrCorrupt)
+	}
+	usn := buf[offset : offset+2]
+	for i := 1; i < count; i++ {
+		end := i*sectorSize - 2
+		if buf[end] != usn[0] || buf[end+1] != usn[1] {
+			return fmt.Errorf("%w: torn write in sector %d", ErrCorrupt, i-1)
+		}
+		copy(buf[end:end+2], buf[offset+2*i:offset+2*i+2])
+	}
+	return nil
+}
+
+func (v *Volume) parseRecord(buf []byte, ref uint64) (*record, error) {
+	if string(buf[:4]) != "FILE" {
+		return nil, fmt.Errorf("%w: missing FILE signature", ErrCorrupt)
+	}
+	if err := applyFixups(buf, v.BytesPerSector); err != nil {
+		return nil, err
+	}
+	rec := &record{
+		ref:     ref,
+		seq:     binary.LittleEndian.Uint16(buf[0x10:]),
+		flags:   binary.LittleEndian.Uint16(buf[0x16:]),
+		baseRef: binary.LittleEndian.Uint64(buf[0x20:]),
+	}
+	used := int(binary.LittleEndian.Uint32(buf[0x18:]))
+	if used > len(buf) {
+		return nil, fmt.Errorf("%w: used size of record exceeds its size", ErrCorrupt)
+	}
+
+	for offset := int(binary.LittleEndian.Uint16(buf[0x14:])); offset+8 <= used; {
+		typ := binary.LittleEndian.Uint32(buf[offset:])
+		if typ == attrEnd {
+			break
+		}
+		length := int(binary.LittleEndian.Uint32(buf[offset+4:]))
+		if length < 0x18 || offset+length > used {
+			return nil, fmt.Errorf("%w: invalid attribute length", ErrCorrupt)
+		}
+		attr, err := v.parseAttribute(buf[offset : offset+length])
+		if err != nil {
+			return nil, err
+		}
+		rec.attrs = append(rec.attrs, attr)
+		offset += length
+	}
+	return rec, nil
+}
+
+func (v *Volume) parseAttribute(b []byte) (*attribute, error) {
+	attr := &attribute{
+		typ:      binary.LittleEndian.Uint32(b),
+		resident: b[8] == 0,
+		flags:    binary.LittleEndian.Uint16(b[0x0C:]),
+		id:       binary.LittleEndian.Uint16(b[0x0E:]),
+	}
+	nameLength := int(b[9])
+	nameOffset := int(binary.LittleEndian.Uint16(b[0x0A:]))
+	if nameOffset+2*nameLength > len(b) {
+		return nil, fmt.Errorf("%w: attribute name out of bounds", ErrCorrupt)
+	}
+	attr.name = decodeName(b[nameOffset : nameOffset+2*nameLength])
+
+	if attr.resident {
+		length := int(binary.LittleEndian.Uint32(b[0x10:]))
+		offset := int(binary.LittleEndian.Uint16(b[0x14:]))
+		if offset+length > len(b) {
+			return nil, fmt.Errorf("%w: resident value out of bounds", ErrCorrupt)
+		}
+		attr.value = b[offset : offset+length]
+		attr.size = int64(length)
+		attr.initSize = attr.size
+		return attr, nil
+	}
+
+	if len(b) < 0x40 {
+		return nil, fmt.Errorf("%w: short non-resident attribute", ErrCorrupt)
+	}
+	attr.startVCN = binary.LittleEndian.Uint64(b[0x10:])
+	attr.lastVCN = binary.LittleEndian.Uint64(b[0x18:])
+	attr.size = int64(binary.LittleEndian.Uint64(b[0x30:]))
+	attr.initSize = int64(binary.LittleEndian.Uint64(b[0x38:]))
+	offset := int(binary.LittleEndian.Uint16(b[0x20:]))
+	if offset > len(b) || attr.size < 0 || attr.initSize < 0 {
+		return nil, fmt.Errorf("%w: invalid non-resident attribute", ErrCorrupt)
+	}
+	runs, err := v.parseRunlist(b[offset:], attr.startVCN)
+	if err != nil {
+		return nil, err
+	}
+	attr.runs = runs
+	return attr, nil
+}
+
+// mergeAttributes returns the attribute with the type and the name, the extents of a non-resident
+// attribute which is split over several records are joined into one
+func mergeAttributes(attrs []*attribute, typ uint32, name string) *attribute {
+	var extents []*attribute
+	for _, a := range attrs {
+		if a.typ == typ && a.name == name {
+			if a.resident {
+				return a
+			}
+			extents = append(extents, a)
+		}
+	}
+	if len(extents) == 0 {
+		return nil
+	}
+	if len(extents) == 1 {
+		return extents[0]
+	}
+	sort.Slice(extents, func(i, j int) bool { return extents[i].startVCN < extents[j].startVCN })
+	merged := *extents[0]
+	merged.runs = nil
+	for _, e := range extents {
+		merged.runs = append(merged.runs, e.runs...)
+		merged.lastVCN = e.lastVCN
+	}
+	return &merged
+}
+
+func decodeName(b []byte) string {
+	u := make([]uint16, len(b)/2)
+	for i := range u {
+		u[i] = binary.LittleEndian.Uint16(b[2*i:])
+	}
+	return string(utf16.Decode(u))
+}
@@ -0,0 +1,140 @@
+package ntfs
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+)
+
+// run maps length clusters starting at vcn to the clusters starting at lcn, lcn is -1 for sparse runs
+type run struct {
+	vcn    uint64
+	lcn    int64
+	length uint64
+}
+
+// parseRunlist decodes the runlist of a non-resident attribute. Every run starts with a header byte
+// whose low nibble is the size of the length and the high nibble the size of the offset to the
+// previous run, a run without offset is sparse. Runs have to fit into the volume and their
+// offsets in the stream have to fit into an int64.
+func (v *Volume) parseRunlist(b []byte, vcn uint64) ([]run, error) {
+	maxVCN := uint64(math.MaxInt64 / v.ClusterSize)
+	if vcn > maxVCN {
+		return nil, fmt.Errorf("%w: invalid start of runlist", ErrCorrupt)
+	}
+	var runs []run
+	var lcn int64
+	for i := 0; i < len(b) && b[i] != 0; {
+		lengthSize := int(b[i] & 0x0F)
+		offsetSize := int(b[i] >> 4)
+		i++
+		if lengthSize == 0 || lengthSize > 8 || offsetSize > 8 || i+lengthSize+offsetSize > len(b) {
+			return nil, fmt.Errorf("%w: invalid runlist", ErrCorrupt)
+		}
+		var length uint64
+		for j := lengthSize - 1; j >= 0; j-- {
+			length = length<<8 | uint64(b[i+j])
+		}
+		i += lengthSize
+		if length > maxVCN-vcn {
+			return nil, fmt.Errorf("%w: run length overflows", ErrCorrupt)
+		}
+
+		r := run{vcn: vcn, lcn: -1, length: length}
+		if offsetSize > 0 {
+			// the offset is a signed little-endian integer
+			offset := int64(int8(b[i+offsetSize-1]))
+			for j := offsetSize - 2; j >= 0; j-- {
+				offset = offset<<8 | int64(b[i+j])
+			}
+			lcn += offset
+			if lcn < 0 {
+				return nil, fmt.Errorf("%w: negative cluster in runlist", ErrCorrupt)
+			}
+			if uint64(lcn) > v.clusters || length > v.clusters-uint64(lcn) {
+				return nil, fmt.Errorf("%w: run past the end of the volume", ErrCorrupt)
+			}
+			r.lcn = lcn
+		}
+		i += offsetSize
+		runs = append(runs, r)
+		vcn += length
+	}
+	return runs, nil
+}
+
+// stream reads the value of an attribute, clusters of sparse runs and bytes after the initialized size read as zeros
+type stream struct {
+	v    *Volume
+	attr *attribute
+}
+
+func (s *stream) Size() int64 {
+	return s.attr.size
+}
+
+func (s *stream) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, fmt.Errorf("ntfs: negative offset")
+	}
+	if off >= s.attr.size {
+		return 0, io.EOF
+	}
+	var err error
+	if remaining := s.attr.size - off; int64(len(p)) > remaining {
+		p = p[:remaining]
+		err = io.EOF
+	}
+
+	if s.attr.resident {
+		return copy(p, s.attr.value[off:]), err
+	}
+	if s.attr.flags&(attrFlagCompressed|attrFlagEncrypted) != 0 {
+		return 0, ErrUnsupported
+	}
+
+	n := 0
+	for n < len(p) {
+		pos := off + int64(n)
+		chunk := p[n:]
+		if pos >= s.attr.initSize {
+			clear(chunk)
+			n = len(p)
+			break
+		}
+		if limit := s.attr.initSize - pos; int64(len(chunk)) > limit {
+			chunk = chunk[:limit]
+		}
+
+		vcn := uint64(pos / s.v.ClusterSize)
+		r, ok := s.find(vcn)
+		if !ok {
+			return n, fmt.Errorf("%w: cluster %d of stream isn't mapped", ErrCorrupt, vcn)
+		}
+		inRun := pos - int64(r.vcn)*s.v.ClusterSize
+		if limit := int64(r.length)*s.v.ClusterSize - inRun; int64(len(chunk)) > limit {
+			chunk = chunk[:limit]
+		}
+		if r.lcn < 0 {
+			clear(chunk)
+		} else if m, rerr := s.v.r.ReadAt(chunk, r.lcn*s.v.ClusterSize+inRun); m < len(chunk) {
+			if rerr == nil || rerr == io.EOF {
+				rerr = io.ErrUnexpectedEOF
+			}
+			return n + m, rerr
+		}
+		n += len(chunk)
+	}
+	return n, err
+}
+
+// find returns the run containing vcn
+func (s *stream) find(vcn uint64) (run, bool) {
+	runs := s.attr.runs
+	i := sort.Search(len(runs), func(i int) bool { return runs[i].vcn+runs[i].length > vcn })
+	if i == len(runs) || runs[i].vcn > vcn {
+		return run{}, false
+	}
+	return runs[i], true
+}
@@ -0,0 +1,28 @@
+#!/bin/sh
+# Builds mkntfs.img.gz, the volume read by TestMkntfsImage. It needs mkntfs and ntfs-3g from
+# the ntfs-3g package, setfattr from attr and root to mount the image through FUSE.
+set -eu
+cd "$(dirname "$0")"
+img=$(mktemp)
+mnt=$(mktemp -d)
+trap 'umount "$mnt" 2>/dev/null || true; rm -rf "$img" "$mnt"' EXIT
+
+truncate -s 2M "$img"
+mkntfs -F -Q -q -c 4096 -s 512 -L poketto "$img"
+ntfs-3g "$img" "$mnt"
+
+printf 'hello ntfs' >"$mnt/small.txt"
+setfattr -n user.Zone.Identifier -v 0x5b5a6f6e655472616e736665725d0d0a5a6f6e6549643d330d0a "$mnt/small.txt"
+mkdir -p "$mnt/Users/Default"
+printf 'cookies' >"$mnt/Users/Default/Cookies"
+
+# frag.bin fills the gap left by gap.bin and continues behind end.bin
+head -c 65536 /dev/zero >"$mnt/gap.bin"
+head -c 65536 /dev/zero >"$mnt/end.bin"
+sync
+rm "$mnt/gap.bin"
+sync
+yes poketto | head -c 131072 >"$mnt/frag.bin"
+
+umount "$mnt"
+gzip -9n <"$img" >mkntfs.img.gz
@@ -0,0 +1,237 @@
+// Package ntfs reads files straight from an NTFS volume without going through the operating system,
+// which makes it possible to copy files that are locked by other processes. It parses the boot sector,
+// the master file table, the runlists of the data attributes and the directory indexes of a volume
+// provided as an io.ReaderAt, e.g. a disk image or a raw device like \\.\C: opened with NewAlignedReader.
+package ntfs
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"sync"
+)
+
+// well known MFT record numbers
+const (
+	RecordMFT     = 0
+	RecordMFTMirr = 1
+	RecordLogFile = 2
+	RecordVolume  = 3
+	RecordRoot    = 5
+	RecordBitmap  = 6
+)
+
+var (
+	// ErrNotNTFS is returned when the boot sector isn't the one of an NTFS volume
+	ErrNotNTFS = errors.New("ntfs: not an NTFS volume")
+	// ErrCorrupt is returned for structures which fail their consistency checks
+	ErrCorrupt = errors.New("ntfs: corrupt structure")
+	// ErrUnsupported is returned for compressed and encrypted streams
+	ErrUnsupported = errors.New("ntfs: unsupported stream")
+)
+
+// Volume is an NTFS volume, it is safe for concurrent use when the underlying io.ReaderAt is
+type Volume struct {
+	r io.ReaderAt
+
+	BytesPerSector  int
+	ClusterSize     int64
+	TotalSectors    uint64
+	MFTCluster      uint64
+	RecordSize      int
+	IndexRecordSize int
+	SerialNumber    uint64
+
+	// clusters is the number of clusters of the volume, runs past it are corrupt
+	clusters uint64
+	mft      *stream
+
+	mu    sync.Mutex
+	cache map[uint64]*record
+}
+
+// NewVolume parses the boot sector and the $MFT record of the volume read from r
+func NewVolume(r io.ReaderAt) (*Volume, error) {
+	boot := make([]byte, 512)
+	if _, err := r.ReadAt(boot, 0); err != nil {
+		return nil, fmt.Errorf("ntfs: failed to read boot sector, %v", err)
+	}
+	if !bytes.Equal(boot[3:11], []byte("NTFS    ")) {
+		return nil, ErrNotNTFS
+	}
+
+	v := &Volume{r: r, cache: make(map[uint64]*record)}
+	v.BytesPerSector = int(binary.LittleEndian.Uint16(boot[0x0B:]))
+	sectorsPerCluster := int64(boot[0x0D])
+	if sectorsPerCluster > 0x80 {
+		// large clusters are stored as a negative power of two
+		sectorsPerCluster = 1 << (256 - sectorsPerCluster)
+	}
+	v.ClusterSize = int64(v.BytesPerSector) * sectorsPerCluster
+	v.TotalSectors = binary.LittleEndian.Uint64(boot[0x28:])
+	v.MFTCluster = binary.LittleEndian.Uint64(boot[0x30:])
+	v.RecordSize = recordSize(int8(boot[0x40]), v.ClusterSize)
+	v.IndexRecordSize = recordSize(int8(boot[0x44]), v.ClusterSize)
+	v.SerialNumber = binary.LittleEndian.Uint64(boot[0x48:])
+
+	if v.BytesPerSector < 256 || v.BytesPerSector&(v.BytesPerSector-1) != 0 || sectorsPerCluster == 0 ||
+		v.RecordSize < v.BytesPerSector || v.RecordSize > 1<<16 || v.IndexRecordSize < 512 {
+		return nil, ErrNotNTFS
+	}
+	// the last cluster may be partial, the backup boot sector follows the volume
+	v.clusters = min(v.TotalSectors/uint64(sectorsPerCluster)+1, uint64(math.MaxInt64/v.ClusterSize))
+	if v.MFTCluster >= v.clusters {
+		return nil, fmt.Errorf("%w: $MFT past the end of the volume", ErrCorrupt)
+	}
+
+	// $MFT describes its own location, read its record from the start of the MFT to bootstrap
+	buf := make([]byte, v.RecordSize)
+	if _, err := r.ReadAt(buf, int64(v.MFTCluster)*v.ClusterSize); err != nil {
+		return nil, fmt.Errorf("ntfs: failed to read $MFT, %v", err)
+	}
+	rec, err := v.parseRecord(buf, RecordMFT)
+	if err != nil {
+		return nil, fmt.Errorf("ntfs: failed to parse $MFT, %w", err)
+	}
+	data := mergeAttributes(rec.attrs, attrData, "")
+	if data == nil || data.resident {
+		return nil, fmt.Errorf("%w: $MFT has no non-resident data", ErrCorrupt)
+	}
+	v.mft = &stream{v: v, attr: data}
+
+	// the runlist of a fragmented $MFT continues in extension records listed in its $ATTRIBUTE_LIST,
+	// they are stored in the part which is mapped by the base record
+	if mergeAttributes(rec.attrs, attrAttributeList, "") != nil {
+		f, err := newFile(v, rec)
+		if err != nil {
+			return nil, fmt.Errorf("ntfs: failed to read extents of $MFT, %w", err)
+		}
+		v.mft = &stream{v: v, attr: f.attribute(attrData, "")}
+	}
+	return v, nil
+}
+
+// recordSize decodes the size of a record from the boot sector,
+// positive values count clusters, negative ones are a power of two in bytes
+func recordSize(v int8, clusterSize int64) int {
+	if v < 0 {
+		return 1 << uint(-v)
+	}
+	return int(int64(v) * clusterSize)
+}
+
+// Records returns the number of records of the MFT
+func (v *Volume) Records() uint64 {
+	return uint64(v.mft.attr.size) / uint64(v.RecordSize)
+}
+
+// record reads and caches the MFT record with the number ref
+func (v *Volume) record(ref uint64) (*record, error) {
+	ref &= refMask
+	v.mu.Lock()
+	rec, ok := v.cache[ref]
+	v.mu.Unlock()
+	if ok {
+		return rec, nil
+	}
+	if ref >= v.Records() {
+		return nil, fmt.Errorf("%w: record %d out of the MFT", ErrCorrupt, ref)
+	}
+
+	buf := make([]byte, v.RecordSize)
+	if _, err := v.mft.ReadAt(buf, int64(ref)*int64(v.RecordSize)); err != nil {
+		return nil, fmt.Errorf("ntfs: failed to read record %d, %v", ref, err)
+	}
+	rec, err := v.parseRecord(buf, ref)
+	if err != nil {
+		return nil, fmt.Errorf("ntfs: record %d, %w", ref, err)
+	}
+	v.mu.Lock()
+	if len(v.cache) > 4096 {
+		v.cache = make(map[uint64]*record)
+	}
+	v.cache[ref] = rec
+	v.mu.Unlock()
+	return rec, nil
+}
+
+// File returns the file of the MFT record ref
+func (v *Volume) File(ref uint64) (*File, error) {
+	rec, err := v.record(ref)
+	if err != nil {
+		return nil, err
+	}
+	if !rec.inUse() {
+		return nil, fmt.Errorf("ntfs: record %d is not in use", ref&refMask)
+	}
+	if rec.baseRef&refMask != 0 {
+		return nil, fmt.Errorf("ntfs: record %d is an extension of record %d", ref&refMask, rec.baseRef&refMask)
+	}
+	return newFile(v, rec)
+}
+
+// Root returns the root directory
+func (v *Volume) Root() (*File, error) {
+	return v.File(RecordRoot)
+}
+
+// Lookup returns the file at p, the components are separated by slashes or backslashes and matched
+// case-insensitively. A leading drive letter like "C:" is ignored.
+func (v *Volume) Lookup(p string) (*File, error) {
+	p = strings.ReplaceAll(p, "\\", "/")
+	if len(p) >= 2 && p[1] == ':' {
+		p = p[2:]
+	}
+	f, err := v.Root()
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range strings.Split(p, "/") {
+		if name == "" || name == "." {
+			continue
+		}
+		if f, err = f.Lookup(name); err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+// alignedReader turns unaligned reads into reads of whole sectors
+type alignedReader struct {
+	r     io.ReaderAt
+	align int64
+}
+
+// NewAlignedReader wraps r so that every read starts and ends on a multiple of align bytes,
+// raw Windows volumes like \\.\C: reject any other read
+func NewAlignedReader(r io.ReaderAt, align int) io.ReaderAt {
+	return &alignedReader{r: r, align: int64(align)}
+}
+
+func (a *alignedReader) ReadAt(p []byte, off int64) (int, error) {
+	start := off / a.align * a.align
+	end := (off + int64(len(p)) + a.align - 1) / a.align * a.align
+	if start == off && end == off+int64(len(p)) {
+		return a.r.ReadAt(p, off)
+	}
+	buf := make([]byte, end-start)
+	n, err := a.r.ReadAt(buf, start)
+	if int64(n) <= off-start {
+		if err == nil {
+			err = io.EOF
+		}
+		return 0, err
+	}
+	n = copy(p, buf[off-start:n])
+	if n == len(p) {
+		err = nil
+	} else if err == nil {
+		err = io.EOF
+	}
+	return n, err
+}
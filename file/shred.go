@@ -0,0 +1,299 @@
+package file
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/w-devin/poketto/logger"
+)
+
+// ErrCopyOnWrite warns that the file system writes modified blocks to new places,
+// overwriting a file there doesn't destroy its previous content
+var ErrCopyOnWrite = errors.New("file system is copy-on-write, overwriting doesn't reach the original blocks")
+
+// ShredMethod is the data written over a file
+type ShredMethod int
+
+const (
+	// ShredZeros overwrites the file with zeros
+	ShredZeros ShredMethod = iota
+	// ShredRandom overwrites the file with random data
+	ShredRandom
+	// ShredDoD overwrites the file with zeros, ones and random data as in DoD 5220.22-M
+	ShredDoD
+)
+
+// ShredOptions controls Shred and WipeDir
+type ShredOptions struct {
+	Method ShredMethod
+	// Passes is the number of times the method is applied, 1 when zero
+	Passes int
+	// KeepName removes the file under its name instead of renaming it to random names first
+	KeepName bool
+	// KeepFile only overwrites the file without removing it
+	KeepFile bool
+	// Warn receives warnings like ErrCopyOnWrite, they are logged when nil
+	Warn func(path string, err error)
+}
+
+// ShredError is a file which couldn't be shredded
+type ShredError struct {
+	Path string
+	Err  error
+}
+
+func (e *ShredError) Error() string {
+	return fmt.Sprintf("failed to shred %s, %v", e.Path, e.Err)
+}
+
+func (e *ShredError) Unwrap() error {
+	return e.Err
+}
+
+// WipeReport is the result of WipeDir
+type WipeReport struct {
+	// Shredded are the files which have been overwritten and removed
+	Shredded []string
+	// Failed are the files which couldn't be overwritten or removed
+	Failed []*ShredError
+	// CopyOnWrite is set when a file was on a copy-on-write file system
+	CopyOnWrite bool
+}
+
+// Shred overwrites the file at path, renames it to obfuscate its name and removes it.
+// Symlinks are removed without touching their target.
+func Shred(path string, opts *ShredOptions) error {
+	_, err := shred(path, opts)
+	return err
+}
+
+// shred returns whether the file was on a copy-on-write file system
+func shred(path string, opts *ShredOptions) (bool, error) {
+	if opts == nil {
+		opts = &ShredOptions{}
+	}
+	info, err := os.Lstat(path)
+	if err != nil {
+		return false, &ShredError{Path: path, Err: err}
+	}
+	if info.IsDir() {
+		return false, &ShredError{Path: path, Err: errors.New("is a directory, use WipeDir")}
+	}
+
+	cow := false
+	if info.Mode().IsRegular() {
+		if cow, err = isCopyOnWrite(path); err == nil && cow {
+			opts.warn(path, ErrCopyOnWrite)
+		}
+		if err = overwrite(path, info, opts); err != nil {
+			return cow, &ShredError{Path: path, Err: err}
+		}
+	}
+	if opts.KeepFile {
+		return cow, nil
+	}
+
+	if !opts.KeepName {
+		if renamed, err := obfuscateName(path); err == nil {
+			path = renamed
+		}
+	}
+	if err = os.Remove(path); err != nil {
+		return cow, &ShredError{Path: path, Err: err}
+	}
+	syncDir(filepath.Dir(path))
+	return cow, nil
+}
+
+func (o *ShredOptions) warn(path string, err error) {
+	if o.Warn != nil {
+		o.Warn(path, err)
+		return
+	}
+	logger.Logger.Warnf("%s: %v", path, err)
+}
+
+// patterns returns the passes of the method, nil stands for random data
+func (o *ShredOptions) patterns() [][]byte {
+	var method [][]byte
+	switch o.Method {
+	case ShredRandom:
+		method = [][]byte{nil}
+	case ShredDoD:
+		method = [][]byte{{0x00}, {0xFF}, nil}
+	default:
+		method = [][]byte{{0x00}}
+	}
+	passes := o.Passes
+	if passes <= 0 {
+		passes = 1
+	}
+	var patterns [][]byte
+	for i := 0; i < passes; i++ {
+		patterns = append(patterns, method...)
+	}
+	return patterns
+}
+
+// overwrite writes every pass over the whole file and syncs it to the disk before the next one
+func overwrite(path string, info fs.FileInfo, opts *ShredOptions) error {
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if errors.Is(err, fs.ErrPermission) {
+		// read-only files can be shredded by their owner
+		if os.Chmod(path, info.Mode().Perm()|0o200) == nil {
+			f, err = os.OpenFile(path, os.O_WRONLY, 0)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	size := info.Size()
+	buf := make([]byte, 64*1024)
+	for _, pattern := range opts.patterns() {
+		if pattern != nil {
+			for i := range buf {
+				buf[i] = pattern[i%len(pattern)]
+			}
+		}
+		for off := int64(0); off < size; {
+			chunk := buf
+			if remaining := size - off; int64(len(chunk)) > remaining {
+				chunk = chunk[:remaining]
+			}
+			if pattern == nil {
+				if _, err = rand.Read(chunk); err != nil {
+					return err
+				}
+			}
+			n, err := f.WriteAt(chunk, off)
+			if err != nil {
+				return err
+			}
+			off += int64(n)
+		}
+		if err = f.Sync(); err != nil {
+			return err
+		}
+	}
+	if opts.KeepFile {
+		return nil
+	}
+	// drop the size of the file as well
+	if err = f.Truncate(0); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+// obfuscateName renames the file to random names of the same and then of decreasing length,
+// so that the directory entry doesn't reveal the original name
+func obfuscateName(path string) (string, error) {
+	dir := filepath.Dir(path)
+	for length := len(filepath.Base(path)); length > 0; length /= 2 {
+		name, err := randomName(length)
+		if err != nil {
+			return path, err
+		}
+		target := filepath.Join(dir, name)
+		if _, err := os.Lstat(target); err == nil {
+			continue
+		}
+		if err := os.Rename(path, target); err != nil {
+			return path, err
+		}
+		path = target
+	}
+	return path, nil
+}
+
+func randomName(length int) (string, error) {
+	const alphabet = "abcdefghijklmnopqrstuvwxyz0123456789"
+	b := make([]byte, length)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	for i := range b {
+		b[i] = alphabet[int(b[i])%len(alphabet)]
+	}
+	return string(b), nil
+}
+
+// WipeDir shreds every file below dir and removes the directory tree. It goes on after failures,
+// the files which couldn't be shredded are listed in the report and returned joined together.
+func WipeDir(dir string, opts *ShredOptions) (*WipeReport, error) {
+	report, err := wipeTree(dir, opts)
+	if err != nil {
+		return report, err
+	}
+	if err = os.RemoveAll(dir); err != nil {
+		report.Failed = append(report.Failed, &ShredError{Path: dir, Err: err})
+	}
+	return report, report.err()
+}
+
+func wipeTree(dir string, opts *ShredOptions) (*WipeReport, error) {
+	if opts == nil {
+		opts = &ShredOptions{}
+	}
+	fileOpts := *opts
+	fileOpts.KeepFile = false
+	// warn only once for the whole tree
+	warned := false
+	fileOpts.Warn = func(path string, err error) {
+		if !warned {
+			warned = true
+			opts.warn(dir, err)
+		}
+	}
+
+	report := &WipeReport{}
+	info, err := os.Lstat(dir)
+	if err != nil {
+		return report, err
+	}
+	if !info.IsDir() {
+		return report, fmt.Errorf("%s is not a directory", dir)
+	}
+
+	var files []string
+	_ = filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			report.Failed = append(report.Failed, &ShredError{Path: p, Err: err})
+			return nil
+		}
+		if !d.IsDir() {
+			files = append(files, p)
+		}
+		return nil
+	})
+	sort.Strings(files)
+	for _, p := range files {
+		cow, err := shred(p, &fileOpts)
+		report.CopyOnWrite = report.CopyOnWrite || cow
+		if err != nil {
+			var shredErr *ShredError
+			if !errors.As(err, &shredErr) {
+				shredErr = &ShredError{Path: p, Err: err}
+			}
+			report.Failed = append(report.Failed, shredErr)
+			continue
+		}
+		report.Shredded = append(report.Shredded, p)
+	}
+	return report, nil
+}
+
+func (r *WipeReport) err() error {
+	errs := make([]error, len(r.Failed))
+	for i, e := range r.Failed {
+		errs[i] = e
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,12 @@
+package file
+
+import "golang.org/x/sys/unix"
+
+// isCopyOnWrite reports whether path is on APFS, which never overwrites blocks in place
+func isCopyOnWrite(path string) (bool, error) {
+	var st unix.Statfs_t
+	if err := unix.Statfs(path, &st); err != nil {
+		return false, err
+	}
+	return unix.ByteSliceToString(st.Fstypename[:]) == "apfs", nil
+}
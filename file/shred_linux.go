@@ -0,0 +1,25 @@
+package file
+
+import "golang.org/x/sys/unix"
+
+// magic numbers of copy-on-write and log-structured file systems
+const (
+	btrfsSuperMagic    = 0x9123683E
+	zfsSuperMagic      = 0x2FC12FC1
+	bcachefsSuperMagic = 0xCA451A4E
+	f2fsSuperMagic     = 0xF2F52010
+	nilfsSuperMagic    = 0x3434
+)
+
+// isCopyOnWrite reports whether path is on a file system where overwriting doesn't happen in place
+func isCopyOnWrite(path string) (bool, error) {
+	var st unix.Statfs_t
+	if err := unix.Statfs(path, &st); err != nil {
+		return false, err
+	}
+	switch uint32(st.Type) {
+	case btrfsSuperMagic, zfsSuperMagic, bcachefsSuperMagic, f2fsSuperMagic, nilfsSuperMagic:
+		return true, nil
+	}
+	return false, nil
+}
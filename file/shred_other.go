@@ -0,0 +1,8 @@
+//go:build !linux && !darwin
+
+package file
+
+// isCopyOnWrite can't detect the file system on this platform
+func isCopyOnWrite(path string) (bool, error) {
+	return false, nil
+}
@@ -0,0 +1,76 @@
+package file
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShred(t *testing.T) {
+	dir := t.TempDir()
+	noWarn := func(string, error) {}
+
+	for _, method := range []ShredMethod{ShredZeros, ShredRandom, ShredDoD} {
+		p := filepath.Join(dir, "Login Data")
+		require.NoError(t, os.WriteFile(p, []byte("secret password"), 0o400))
+		require.NoError(t, Shred(p, &ShredOptions{Method: method, Passes: 2, Warn: noWarn}))
+		assert.NoFileExists(t, p)
+	}
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+
+	t.Run("keep file", func(t *testing.T) {
+		p := filepath.Join(dir, "kept")
+		require.NoError(t, os.WriteFile(p, []byte("secret"), 0o600))
+		require.NoError(t, Shred(p, &ShredOptions{KeepFile: true, Warn: noWarn}))
+		data, err := os.ReadFile(p)
+		require.NoError(t, err)
+		assert.Equal(t, make([]byte, 6), data)
+	})
+
+	t.Run("symlink", func(t *testing.T) {
+		target := filepath.Join(dir, "target")
+		link := filepath.Join(dir, "link")
+		require.NoError(t, os.WriteFile(target, []byte("target"), 0o600))
+		require.NoError(t, os.Symlink(target, link))
+		require.NoError(t, Shred(link, &ShredOptions{Warn: noWarn}))
+		data, err := os.ReadFile(target)
+		require.NoError(t, err)
+		assert.Equal(t, "target", string(data))
+	})
+
+	assert.Error(t, Shred(dir, nil))
+}
+
+func TestWipeDir(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "workspace")
+	for _, name := range []string{"a/Cookies", "a/b/History", "c"} {
+		p := filepath.Join(root, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(p), 0o755))
+		require.NoError(t, os.WriteFile(p, []byte(name), 0o600))
+	}
+	locked := filepath.Join(root, "locked")
+	require.NoError(t, os.MkdirAll(locked, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(locked, "f"), []byte("f"), 0o600))
+	if runtime.GOOS != "windows" && os.Getuid() != 0 {
+		require.NoError(t, os.Chmod(locked, 0o500))
+		defer os.Chmod(locked, 0o755)
+	}
+
+	report, err := WipeDir(root, &ShredOptions{Warn: func(string, error) {}})
+	if runtime.GOOS != "windows" && os.Getuid() != 0 {
+		require.Error(t, err)
+		require.NotEmpty(t, report.Failed)
+		assert.Equal(t, filepath.Join(locked, "f"), report.Failed[0].Path)
+		require.NoError(t, os.Chmod(locked, 0o755))
+		_, err = WipeDir(root, nil)
+	}
+	require.NoError(t, err)
+	assert.NoDirExists(t, root)
+	assert.Contains(t, report.Shredded, filepath.Join(root, "c"))
+}
@@ -0,0 +1,289 @@
+package file
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// TailOptions controls Tail
+type TailOptions struct {
+	// Offset is the byte offset to start at, it is ignored when Lines or FromEnd is set
+	Offset int64
+	// Lines starts with the last Lines lines of the file like tail -n
+	Lines int
+	// FromEnd starts at the end of the file and only streams new lines
+	FromEnd bool
+	// PollInterval is the interval the file is checked at without inotify, 250ms when zero
+	PollInterval time.Duration
+	// Poll checks the file periodically even where inotify is available
+	Poll bool
+	// MaxLineLength splits longer lines, 1 MiB when zero
+	MaxLineLength int
+}
+
+func (o *TailOptions) pollInterval() time.Duration {
+	if o.PollInterval <= 0 {
+		return 250 * time.Millisecond
+	}
+	return o.PollInterval
+}
+
+func (o *TailOptions) maxLineLength() int {
+	if o.MaxLineLength <= 0 {
+		return 1024 * 1024
+	}
+	return o.MaxLineLength
+}
+
+// TailLine is a line streamed by Tail
+type TailLine struct {
+	// Text is the line without the line break
+	Text string
+	// Offset is the position of the line in the file it was read from
+	Offset int64
+	// Err is set on the last value sent when the file can't be read anymore
+	Err error
+}
+
+// Tail streams the lines appended to the file at path until ctx is done, like tail -F. It
+// follows the path when the file is rotated by renaming or recreating it and starts over
+// when the file is truncated, e.g. by copytruncate rotation. A file which doesn't exist yet
+// is waited for. The last line is only sent once it is complete.
+func Tail(ctx context.Context, path string, opts *TailOptions) (<-chan *TailLine, error) {
+	if opts == nil {
+		opts = &TailOptions{}
+	}
+	t := &tailer{path: path, opts: opts}
+	if err := t.open(true); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	lines := make(chan *TailLine, 64)
+	go t.run(ctx, lines)
+	return lines, nil
+}
+
+type tailer struct {
+	path string
+	opts *TailOptions
+
+	f       *os.File
+	offset  int64  // offset of the next read
+	pending []byte // incomplete last line
+}
+
+// open opens the file at path, first applies the start options instead of reading from the start
+func (t *tailer) open(first bool) error {
+	f, err := os.Open(t.path)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	offset := int64(0)
+	if first {
+		switch {
+		case t.opts.Lines > 0:
+			if offset, err = lastLines(f, info.Size(), t.opts.Lines); err != nil {
+				_ = f.Close()
+				return err
+			}
+		case t.opts.FromEnd:
+			offset = info.Size()
+		default:
+			offset = min(max(t.opts.Offset, 0), info.Size())
+		}
+	}
+	if _, err = f.Seek(offset, io.SeekStart); err != nil {
+		_ = f.Close()
+		return err
+	}
+	t.f, t.offset, t.pending = f, offset, nil
+	return nil
+}
+
+// lastLines returns the offset of the last n lines, a line break ending the file doesn't start another line
+func lastLines(f *os.File, size int64, n int) (int64, error) {
+	buf := make([]byte, 32*1024)
+	end := size
+	for end > 0 {
+		start := max(end-int64(len(buf)), 0)
+		chunk := buf[:end-start]
+		if _, err := f.ReadAt(chunk, start); err != nil && !errors.Is(err, io.EOF) {
+			return 0, err
+		}
+		for i := len(chunk) - 1; i >= 0; i-- {
+			if chunk[i] != '\n' || start+int64(i) == size-1 {
+				continue
+			}
+			if n--; n == 0 {
+				return start + int64(i) + 1, nil
+			}
+		}
+		end = start
+	}
+	return 0, nil
+}
+
+func (t *tailer) run(ctx context.Context, lines chan<- *TailLine) {
+	defer close(lines)
+	defer func() {
+		if t.f != nil {
+			_ = t.f.Close()
+		}
+	}()
+
+	interval := t.opts.pollInterval()
+	var events <-chan notifyEvent
+	if !t.opts.Poll {
+		if n, err := newNotifier(); err == nil {
+			defer n.close()
+			if err = n.add(filepath.Dir(t.path)); err == nil {
+				events = n.events()
+				// events are missed while the directory itself is replaced, check now and then anyway
+				interval = max(interval, time.Second)
+			}
+		}
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := t.follow(ctx, lines); err != nil {
+			if ctx.Err() == nil {
+				sendLine(ctx, lines, &TailLine{Offset: t.offset, Err: err})
+			}
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case _, ok := <-events:
+			if !ok {
+				// inotify stopped, keep polling
+				events = nil
+				ticker.Reset(t.opts.pollInterval())
+			}
+		case <-ticker.C:
+		}
+	}
+}
+
+// follow reads the new lines and handles the rotation and truncation of the file
+func (t *tailer) follow(ctx context.Context, lines chan<- *TailLine) error {
+	if t.f == nil {
+		if err := t.open(false); err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+	}
+	if err := t.read(ctx, lines); err != nil {
+		return err
+	}
+
+	current, err := t.f.Stat()
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(t.path)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		// renamed or removed, the writer may still append to the old file until a new one appears
+		return nil
+	case err != nil:
+		return err
+	case !os.SameFile(info, current):
+		// rotated, the old file has been read to its end
+		if !t.flush(ctx, lines) {
+			return ctx.Err()
+		}
+		_ = t.f.Close()
+		t.f = nil
+		if err = t.open(false); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		if t.f == nil {
+			return nil
+		}
+		return t.read(ctx, lines)
+	case current.Size() < t.offset:
+		// truncated in place
+		if !t.flush(ctx, lines) {
+			return ctx.Err()
+		}
+		if _, err = t.f.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		t.offset = 0
+		return t.read(ctx, lines)
+	}
+	return nil
+}
+
+// read sends the complete lines up to the end of the file
+func (t *tailer) read(ctx context.Context, lines chan<- *TailLine) error {
+	buf := make([]byte, 32*1024)
+	maxLength := t.opts.maxLineLength()
+	for {
+		n, err := t.f.Read(buf)
+		if n > 0 {
+			t.pending = append(t.pending, buf[:n]...)
+			t.offset += int64(n)
+			for {
+				i := bytes.IndexByte(t.pending, '\n')
+				if i < 0 && len(t.pending) < maxLength {
+					break
+				}
+				next := i + 1
+				if i < 0 || i > maxLength {
+					i, next = maxLength, maxLength
+				}
+				line := &TailLine{
+					Text:   string(bytes.TrimSuffix(t.pending[:i], []byte("\r"))),
+					Offset: t.offset - int64(len(t.pending)),
+				}
+				if !sendLine(ctx, lines, line) {
+					return ctx.Err()
+				}
+				t.pending = t.pending[next:]
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// flush sends the incomplete last line of a file which won't be continued
+func (t *tailer) flush(ctx context.Context, lines chan<- *TailLine) bool {
+	if len(t.pending) == 0 {
+		return true
+	}
+	line := &TailLine{Text: string(t.pending), Offset: t.offset - int64(len(t.pending))}
+	t.pending = nil
+	return sendLine(ctx, lines, line)
+}
+
+func sendLine(ctx context.Context, lines chan<- *TailLine, line *TailLine) bool {
+	select {
+	case lines <- line:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
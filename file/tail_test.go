@@ -0,0 +1,125 @@
+package file
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTail(t *testing.T) {
+	for _, poll := range []bool{false, true} {
+		name := "notify"
+		if poll {
+			name = "poll"
+		}
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			p := filepath.Join(dir, "xray.log")
+			require.NoError(t, os.WriteFile(p, []byte("one\ntwo\nthree\n"), 0o600))
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			lines, err := Tail(ctx, p, &TailOptions{Lines: 2, Poll: poll, PollInterval: 10 * time.Millisecond})
+			require.NoError(t, err)
+			next := func() *TailLine {
+				select {
+				case line := <-lines:
+					require.NotNil(t, line)
+					require.NoError(t, line.Err)
+					return line
+				case <-time.After(5 * time.Second):
+					t.Fatal("no line")
+					return nil
+				}
+			}
+			assert.Equal(t, &TailLine{Text: "two", Offset: 4}, next())
+			assert.Equal(t, "three", next().Text)
+
+			appendFile(t, p, "four\r\nfi")
+			assert.Equal(t, "four", next().Text)
+			appendFile(t, p, "ve\n")
+			assert.Equal(t, &TailLine{Text: "five", Offset: 20}, next())
+
+			// copytruncate
+			require.NoError(t, os.Truncate(p, 0))
+			time.Sleep(50 * time.Millisecond)
+			appendFile(t, p, "after truncate\n")
+			assert.Equal(t, &TailLine{Text: "after truncate", Offset: 0}, next())
+
+			// rename rotation, the rest of the old file is read first
+			appendFile(t, p, "last ")
+			require.NoError(t, os.Rename(p, p+".1"))
+			appendFile(t, p+".1", "old\n")
+			require.NoError(t, os.WriteFile(p, []byte("new\n"), 0o600))
+			assert.Equal(t, "last old", next().Text)
+			assert.Equal(t, &TailLine{Text: "new", Offset: 0}, next())
+
+			// removed and recreated later
+			require.NoError(t, os.Remove(p))
+			time.Sleep(50 * time.Millisecond)
+			require.NoError(t, os.WriteFile(p, []byte("recreated\n"), 0o600))
+			assert.Equal(t, "recreated", next().Text)
+
+			cancel()
+			for range lines {
+			}
+		})
+	}
+}
+
+func TestTailStart(t *testing.T) {
+	dir := t.TempDir()
+	p := filepath.Join(dir, "log")
+	require.NoError(t, os.WriteFile(p, []byte("one\ntwo\nthree"), 0o600))
+
+	collect := func(opts *TailOptions, count int) []string {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		opts.PollInterval = 10 * time.Millisecond
+		lines, err := Tail(ctx, p, opts)
+		require.NoError(t, err)
+		var texts []string
+		for line := range lines {
+			require.NoError(t, line.Err)
+			if texts = append(texts, line.Text); len(texts) == count {
+				break
+			}
+		}
+		return texts
+	}
+	assert.Equal(t, []string{"one", "two"}, collect(&TailOptions{}, 2))
+	assert.Equal(t, []string{"two"}, collect(&TailOptions{Offset: 4}, 1))
+	assert.Equal(t, []string{"one", "two"}, collect(&TailOptions{Lines: 10}, 2))
+	assert.Equal(t, []string{"tw", "o"}, collect(&TailOptions{Offset: 4, MaxLineLength: 2}, 2))
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		appendFile(t, p, " more\n")
+	}()
+	assert.Equal(t, []string{" more"}, collect(&TailOptions{FromEnd: true}, 1))
+
+	missing := filepath.Join(dir, "missing")
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		_ = os.WriteFile(missing, []byte(strings.Repeat("x", 3)+"\n"), 0o600)
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	lines, err := Tail(ctx, missing, &TailOptions{PollInterval: 10 * time.Millisecond})
+	require.NoError(t, err)
+	assert.Equal(t, "xxx", (<-lines).Text)
+}
+
+func appendFile(t *testing.T, p, data string) {
+	f, err := os.OpenFile(p, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	require.NoError(t, err)
+	_, err = f.WriteString(data)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+}
@@ -0,0 +1,370 @@
+package file
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/w-devin/poketto/logger"
+)
+
+// WatchOp is the kind of a change reported by Watch
+type WatchOp int
+
+const (
+	WatchCreate WatchOp = iota
+	WatchWrite
+	WatchRename
+	WatchDelete
+)
+
+func (o WatchOp) String() string {
+	switch o {
+	case WatchCreate:
+		return "create"
+	case WatchWrite:
+		return "write"
+	case WatchRename:
+		return "rename"
+	case WatchDelete:
+		return "delete"
+	default:
+		return fmt.Sprintf("WatchOp(%d)", int(o))
+	}
+}
+
+// WatchEvent is a change of a file below one of the watched roots
+type WatchEvent struct {
+	Op   WatchOp
+	Path string
+	// OldPath is the previous path of a renamed file
+	OldPath string
+	// Root is the watched root the file is in
+	Root string
+	// Info describes the file after the change, it is nil for deleted files
+	Info fs.FileInfo
+}
+
+// WatchOptions controls WatchWithOptions
+type WatchOptions struct {
+	// Filter selects the files, symlinks are never followed
+	Filter FindOptions
+	// Debounce is the quiet time after the last change before events are sent, 100ms when zero
+	Debounce time.Duration
+	// PollInterval is the interval the roots are scanned at without inotify, 1s when zero
+	PollInterval time.Duration
+	// Poll scans the roots periodically even where inotify is available
+	Poll bool
+}
+
+func (o *WatchOptions) debounce() time.Duration {
+	if o.Debounce <= 0 {
+		return 100 * time.Millisecond
+	}
+	return o.Debounce
+}
+
+func (o *WatchOptions) pollInterval() time.Duration {
+	if o.PollInterval <= 0 {
+		return time.Second
+	}
+	return o.PollInterval
+}
+
+// Watch sends the changes of the files below roots matching filter until ctx is done,
+// see WatchWithOptions
+func Watch(ctx context.Context, roots []string, filter FindOptions) (<-chan *WatchEvent, error) {
+	return WatchWithOptions(ctx, roots, &WatchOptions{Filter: filter})
+}
+
+// WatchWithOptions sends the changes of the matching files below roots until ctx is done.
+// Bursts of changes, like a browser rewriting its Cookies database, are collected until they
+// settle and reported once per file. The files existing when the watch starts aren't reported.
+// Changes are noticed with inotify on linux and by scanning the roots periodically elsewhere.
+func WatchWithOptions(ctx context.Context, roots []string, opts *WatchOptions) (<-chan *WatchEvent, error) {
+	if opts == nil {
+		opts = &WatchOptions{}
+	}
+	if err := opts.Filter.Validate(); err != nil {
+		return nil, err
+	}
+	w := &watcher{opts: opts, known: map[string]watchEntry{}, watched: map[string]bool{}}
+	for _, root := range roots {
+		root = filepath.Clean(root)
+		info, err := os.Stat(root)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			return nil, fmt.Errorf("%s is not a directory", root)
+		}
+		w.roots = append(w.roots, root)
+	}
+
+	if !opts.Poll {
+		if n, err := newNotifier(); err == nil {
+			w.notifier = n
+		}
+	}
+	for _, root := range w.roots {
+		w.scan(root, root, w.known)
+	}
+
+	events := make(chan *WatchEvent, 64)
+	go w.run(ctx, events)
+	return events, nil
+}
+
+type watchEntry struct {
+	info fs.FileInfo
+	root string
+}
+
+type watcher struct {
+	opts  *WatchOptions
+	roots []string
+	// known are the matching files as of the last scan
+	known    map[string]watchEntry
+	notifier notifier
+	watched  map[string]bool
+}
+
+func (w *watcher) run(ctx context.Context, out chan<- *WatchEvent) {
+	defer close(out)
+	defer w.stopNotifier()
+
+	debounce := w.opts.debounce()
+	var notifications <-chan notifyEvent
+	var ticks <-chan time.Time
+	var ticker *time.Ticker
+	defer func() {
+		if ticker != nil {
+			ticker.Stop()
+		}
+	}()
+	timer := time.NewTimer(debounce)
+	timer.Stop()
+	var settled <-chan time.Time
+	var first time.Time
+	dirty := map[string]notifyOp{}
+
+	for {
+		switch {
+		case w.notifier != nil:
+			notifications = w.notifier.events()
+		case ticker == nil:
+			// no inotify or it failed, e.g. because of the limit of watches
+			ticker = time.NewTicker(w.opts.pollInterval())
+			ticks, notifications = ticker.C, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-notifications:
+			if !ok {
+				w.stopNotifier()
+				continue
+			}
+			if event.Path == "" {
+				// events have been lost
+				for _, root := range w.roots {
+					if _, ok := dirty[root]; !ok {
+						dirty[root] = 0
+					}
+				}
+			} else {
+				dirty[event.Path] |= event.Op
+			}
+			// a file written constantly is still reported every few debounce intervals
+			if first.IsZero() {
+				first = time.Now()
+			}
+			timer.Reset(max(min(debounce, 10*debounce-time.Since(first)), 0))
+			settled = timer.C
+		case <-settled:
+			settled, first = nil, time.Time{}
+			if !w.rescan(ctx, dirty, out) {
+				return
+			}
+			dirty = map[string]notifyOp{}
+		case <-ticks:
+			all := map[string]notifyOp{}
+			for _, root := range w.roots {
+				all[root] = 0
+			}
+			if !w.rescan(ctx, all, out) {
+				return
+			}
+		}
+	}
+}
+
+func (w *watcher) stopNotifier() {
+	if w.notifier != nil {
+		_ = w.notifier.close()
+		w.notifier = nil
+	}
+	w.watched = map[string]bool{}
+}
+
+// scan adds the matching files at or below p to entries and watches the directories
+func (w *watcher) scan(root, p string, entries map[string]watchEntry) {
+	info, err := os.Lstat(p)
+	if err != nil {
+		// gone again or unreadable, there's nothing to report
+		return
+	}
+	filter := &w.opts.Filter
+	rel := "."
+	if p != root {
+		rel = filepath.ToSlash(strings.TrimPrefix(p, root+string(filepath.Separator)))
+	}
+
+	if info.IsDir() {
+		if rel != "." {
+			if matchGlobs(filter.Exclude, rel) {
+				return
+			}
+			if filter.IncludeDirs && filter.Match(rel, info) {
+				entries[p] = watchEntry{info: info, root: root}
+			}
+		}
+		depth := 0
+		if rel != "." {
+			depth = strings.Count(rel, "/") + 1
+		}
+		if filter.MaxDepth > 0 && depth >= filter.MaxDepth {
+			return
+		}
+		w.watch(p)
+		children, err := os.ReadDir(p)
+		if err != nil {
+			return
+		}
+		for _, child := range children {
+			w.scan(root, filepath.Join(p, child.Name()), entries)
+		}
+		return
+	}
+	if info.Mode()&fs.ModeSymlink != 0 && filter.Symlinks == SymlinkSkip {
+		return
+	}
+	if filter.Match(rel, info) {
+		entries[p] = watchEntry{info: info, root: root}
+	}
+}
+
+func (w *watcher) watch(dir string) {
+	if w.notifier == nil || w.watched[dir] {
+		return
+	}
+	if err := w.notifier.add(dir); err != nil {
+		logger.Logger.Warnf("failed to watch %s, scanning periodically instead, %v", dir, err)
+		w.stopNotifier()
+		return
+	}
+	w.watched[dir] = true
+}
+
+// rootOf returns the innermost root containing p
+func (w *watcher) rootOf(p string) string {
+	root := ""
+	for _, r := range w.roots {
+		if (p == r || isBelow(p, r)) && len(r) > len(root) {
+			root = r
+		}
+	}
+	return root
+}
+
+func isBelow(p, dir string) bool {
+	return strings.HasPrefix(p, strings.TrimSuffix(dir, string(filepath.Separator))+string(filepath.Separator))
+}
+
+// rescan compares the dirty paths and everything below them with the last scan and sends the differences
+func (w *watcher) rescan(ctx context.Context, dirty map[string]notifyOp, out chan<- *WatchEvent) bool {
+	current := map[string]watchEntry{}
+	previous := map[string]watchEntry{}
+	for p := range dirty {
+		root := w.rootOf(p)
+		if root == "" {
+			continue
+		}
+		if _, err := os.Lstat(p); err != nil {
+			for dir := range w.watched {
+				if w.notifier != nil && (dir == p || isBelow(dir, p)) {
+					w.notifier.remove(dir)
+					delete(w.watched, dir)
+				}
+			}
+		}
+		w.scan(root, p, current)
+		for known, entry := range w.known {
+			if known == p || isBelow(known, p) {
+				previous[known] = entry
+			}
+		}
+	}
+
+	var events []*WatchEvent
+	var created, deleted []string
+	for p, entry := range current {
+		old, ok := previous[p]
+		switch {
+		case !ok:
+			created = append(created, p)
+		case old.info.Size() != entry.info.Size() || !old.info.ModTime().Equal(entry.info.ModTime()) ||
+			old.info.Mode() != entry.info.Mode() || (dirty[p]&notifyWrite != 0 && !entry.info.IsDir()):
+			events = append(events, &WatchEvent{Op: WatchWrite, Path: p, Root: entry.root, Info: entry.info})
+		}
+	}
+	for p := range previous {
+		if _, ok := current[p]; !ok {
+			deleted = append(deleted, p)
+		}
+	}
+	sort.Strings(created)
+	sort.Strings(deleted)
+
+	renamed := map[string]bool{}
+	for _, p := range created {
+		entry := current[p]
+		event := &WatchEvent{Op: WatchCreate, Path: p, Root: entry.root, Info: entry.info}
+		for _, old := range deleted {
+			if !renamed[old] && os.SameFile(previous[old].info, entry.info) {
+				renamed[old] = true
+				event.Op, event.OldPath = WatchRename, old
+				break
+			}
+		}
+		events = append(events, event)
+	}
+	for _, p := range deleted {
+		if !renamed[p] {
+			events = append(events, &WatchEvent{Op: WatchDelete, Path: p, Root: previous[p].root})
+		}
+	}
+
+	for p := range previous {
+		delete(w.known, p)
+	}
+	for p, entry := range current {
+		w.known[p] = entry
+	}
+
+	sort.SliceStable(events, func(i, j int) bool { return events[i].Path < events[j].Path })
+	for _, event := range events {
+		select {
+		case out <- event:
+		case <-ctx.Done():
+			return false
+		}
+	}
+	return true
+}
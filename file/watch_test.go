@@ -0,0 +1,108 @@
+package file
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWatch(t *testing.T) {
+	for _, poll := range []bool{false, true} {
+		name := "notify"
+		if poll {
+			name = "poll"
+		}
+		t.Run(name, func(t *testing.T) {
+			root := t.TempDir()
+			profile := filepath.Join(root, "Default", "Network")
+			require.NoError(t, os.MkdirAll(profile, 0o755))
+			cookies := filepath.Join(profile, "Cookies")
+			require.NoError(t, os.WriteFile(cookies, []byte("v1"), 0o600))
+			require.NoError(t, os.WriteFile(filepath.Join(profile, "Cookies-journal"), nil, 0o600))
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			events, err := WatchWithOptions(ctx, []string{root}, &WatchOptions{
+				Filter:       FindOptions{Suffixes: []string{"Cookies"}, Exclude: []string{"**/Cache"}},
+				Debounce:     20 * time.Millisecond,
+				PollInterval: 20 * time.Millisecond,
+				Poll:         poll,
+			})
+			require.NoError(t, err)
+			next := func() *WatchEvent {
+				select {
+				case event := <-events:
+					require.NotNil(t, event)
+					return event
+				case <-time.After(5 * time.Second):
+					t.Fatal("no event")
+					return nil
+				}
+			}
+
+			// a burst of writes is reported once
+			for i := 0; i < 5; i++ {
+				require.NoError(t, os.WriteFile(cookies, []byte("v2 longer "+string(rune('a'+i))), 0o600))
+			}
+			require.NoError(t, os.WriteFile(filepath.Join(profile, "History"), nil, 0o600))
+			event := next()
+			assert.Equal(t, WatchWrite, event.Op)
+			assert.Equal(t, cookies, event.Path)
+			assert.Equal(t, root, event.Root)
+			require.NotNil(t, event.Info)
+
+			// created in a new directory
+			other := filepath.Join(root, "Profile 1", "Network", "Cookies")
+			require.NoError(t, os.MkdirAll(filepath.Dir(other), 0o755))
+			require.NoError(t, os.WriteFile(other, []byte("new"), 0o600))
+			event = next()
+			assert.Equal(t, WatchCreate, event.Op)
+			assert.Equal(t, other, event.Path)
+
+			// excluded
+			require.NoError(t, os.MkdirAll(filepath.Join(root, "Default", "Cache"), 0o755))
+			require.NoError(t, os.WriteFile(filepath.Join(root, "Default", "Cache", "cookies"), nil, 0o600))
+
+			renamed := filepath.Join(profile, "Old Cookies")
+			require.NoError(t, os.Rename(cookies, renamed))
+			event = next()
+			assert.Equal(t, WatchRename, event.Op)
+			assert.Equal(t, renamed, event.Path)
+			assert.Equal(t, cookies, event.OldPath)
+
+			require.NoError(t, os.Remove(renamed))
+			event = next()
+			assert.Equal(t, WatchDelete, event.Op)
+			assert.Equal(t, renamed, event.Path)
+			assert.Nil(t, event.Info)
+
+			require.NoError(t, os.RemoveAll(filepath.Join(root, "Profile 1")))
+			event = next()
+			assert.Equal(t, WatchDelete, event.Op)
+			assert.Equal(t, other, event.Path)
+
+			select {
+			case event := <-events:
+				t.Fatalf("unexpected event %v %s", event.Op, event.Path)
+			case <-time.After(100 * time.Millisecond):
+			}
+			cancel()
+			for range events {
+			}
+		})
+	}
+}
+
+func TestWatchErrors(t *testing.T) {
+	root := t.TempDir()
+	_, err := Watch(context.Background(), []string{filepath.Join(root, "missing")}, FindOptions{})
+	assert.Error(t, err)
+	_, err = Watch(context.Background(), []string{root}, FindOptions{Patterns: []string{"["}})
+	assert.Error(t, err)
+	assert.Equal(t, "rename", WatchRename.String())
+}
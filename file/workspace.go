@@ -0,0 +1,311 @@
+package file
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/w-devin/poketto/logger"
+)
+
+const (
+	// workspaceMarker holds the pid of the process owning a workspace
+	workspaceMarker = ".workspace"
+	// staleGrace is the age from which a workspace without a marker counts as stale
+	staleGrace = time.Minute
+)
+
+// WorkspaceOptions controls NewWorkspace
+type WorkspaceOptions struct {
+	// Dir is the parent directory of the workspace, os.TempDir() when empty
+	Dir string
+	// Prefix starts the name of the workspace directory, "poketto-" when empty
+	Prefix string
+	// Shred shreds the files of the workspace on cleanup instead of only removing them
+	Shred *ShredOptions
+	// IgnoreSignals keeps the workspace when the process receives SIGINT or SIGTERM
+	IgnoreSignals bool
+	// CleanStale removes the workspaces left behind by crashed runs, they are only logged otherwise
+	CleanStale bool
+}
+
+func (o *WorkspaceOptions) dir() string {
+	if o.Dir == "" {
+		return os.TempDir()
+	}
+	return o.Dir
+}
+
+func (o *WorkspaceOptions) prefix() string {
+	if o.Prefix == "" {
+		return "poketto-"
+	}
+	return o.Prefix
+}
+
+// Workspace is a private temporary directory for working files, it is removed on Close,
+// when its context is done or when the process is interrupted
+type Workspace struct {
+	dir  string
+	opts WorkspaceOptions
+
+	mu        sync.Mutex
+	names     map[string]bool
+	closeOnce sync.Once
+	closeErr  error
+	done      chan struct{}
+}
+
+// NewWorkspace creates a workspace below opts.Dir accessible only by the current user
+func NewWorkspace(ctx context.Context, opts *WorkspaceOptions) (*Workspace, error) {
+	if opts == nil {
+		opts = &WorkspaceOptions{}
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	stale, err := FindStaleWorkspaces(opts)
+	if err == nil && len(stale) > 0 {
+		if opts.CleanStale {
+			_, err = removeWorkspaces(stale, opts.Shred)
+		}
+		if !opts.CleanStale || err != nil {
+			logger.Logger.Warnf("found workspaces of crashed runs: %s", strings.Join(stale, ", "))
+		}
+	}
+
+	dir, err := os.MkdirTemp(opts.dir(), opts.prefix())
+	if err != nil {
+		return nil, fmt.Errorf("failed to create workspace, %v", err)
+	}
+	// MkdirTemp already uses 0700, but not every platform applies it
+	if err = os.Chmod(dir, 0o700); err != nil {
+		_ = os.RemoveAll(dir)
+		return nil, fmt.Errorf("failed to protect workspace %s, %v", dir, err)
+	}
+	marker := []byte(strconv.Itoa(os.Getpid()))
+	if err = os.WriteFile(filepath.Join(dir, workspaceMarker), marker, 0o600); err != nil {
+		_ = os.RemoveAll(dir)
+		return nil, fmt.Errorf("failed to create workspace %s, %v", dir, err)
+	}
+
+	w := &Workspace{dir: dir, opts: *opts, names: map[string]bool{workspaceMarker: true}, done: make(chan struct{})}
+	if !opts.IgnoreSignals {
+		registerWorkspace(w)
+	}
+	if ctx.Done() != nil {
+		go func() {
+			select {
+			case <-ctx.Done():
+				_ = w.Close()
+			case <-w.done:
+			}
+		}()
+	}
+	return w, nil
+}
+
+// Dir returns the directory of the workspace
+func (w *Workspace) Dir() string {
+	return w.dir
+}
+
+// Path returns a path in the workspace which hasn't been handed out before. It uses the base
+// name of name and numbers it like "Cookies-2" when taken, the file itself isn't created.
+func (w *Workspace) Path(name string) string {
+	name = filepath.Base(name)
+	if name == "." || name == ".." || name == string(filepath.Separator) {
+		name = "file"
+	}
+	ext := filepath.Ext(name)
+	stem := strings.TrimSuffix(name, ext)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	candidate := name
+	for i := 2; ; i++ {
+		if !w.names[candidate] {
+			if _, err := os.Lstat(filepath.Join(w.dir, candidate)); errors.Is(err, os.ErrNotExist) {
+				break
+			}
+		}
+		candidate = fmt.Sprintf("%s-%d%s", stem, i, ext)
+	}
+	w.names[candidate] = true
+	return filepath.Join(w.dir, candidate)
+}
+
+// CreateFile creates a new file at a unique path, readable and writable by the current user only
+func (w *Workspace) CreateFile(name string) (*os.File, error) {
+	return os.OpenFile(w.Path(name), os.O_RDWR|os.O_CREATE|os.O_EXCL, 0o600)
+}
+
+// WriteFile writes data to a new file at a unique path and returns the path
+func (w *Workspace) WriteFile(name string, data []byte) (string, error) {
+	f, err := w.CreateFile(name)
+	if err != nil {
+		return "", err
+	}
+	if _, err = f.Write(data); err != nil {
+		_ = f.Close()
+		return f.Name(), err
+	}
+	return f.Name(), f.Close()
+}
+
+// Mkdir creates a new directory at a unique path
+func (w *Workspace) Mkdir(name string) (string, error) {
+	p := w.Path(name)
+	return p, os.Mkdir(p, 0o700)
+}
+
+// Close removes the workspace, shredding its files when enabled. It is safe to call more than once.
+func (w *Workspace) Close() error {
+	w.closeOnce.Do(func() {
+		close(w.done)
+		unregisterWorkspace(w)
+		_, w.closeErr = removeWorkspaces([]string{w.dir}, w.opts.Shred)
+	})
+	return w.closeErr
+}
+
+// FindStaleWorkspaces returns the workspaces below opts.Dir with opts.Prefix whose process has exited
+func FindStaleWorkspaces(opts *WorkspaceOptions) ([]string, error) {
+	if opts == nil {
+		opts = &WorkspaceOptions{}
+	}
+	entries, err := os.ReadDir(opts.dir())
+	if err != nil {
+		return nil, err
+	}
+	var stale []string
+	for _, entry := range entries {
+		if !entry.IsDir() || !strings.HasPrefix(entry.Name(), opts.prefix()) {
+			continue
+		}
+		dir := filepath.Join(opts.dir(), entry.Name())
+		data, err := os.ReadFile(filepath.Join(dir, workspaceMarker))
+		if err != nil {
+			// only an empty directory is a workspace whose creator crashed before writing the marker
+			if errors.Is(err, os.ErrNotExist) && isEmptyDir(dir) {
+				if info, err := entry.Info(); err == nil && time.Since(info.ModTime()) >= staleGrace {
+					stale = append(stale, dir)
+				}
+			}
+			continue
+		}
+		pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+		if err != nil || !processAlive(pid) {
+			stale = append(stale, dir)
+		}
+	}
+	return stale, nil
+}
+
+func isEmptyDir(dir string) bool {
+	entries, err := os.ReadDir(dir)
+	return err == nil && len(entries) == 0
+}
+
+// CleanStaleWorkspaces removes the workspaces found by FindStaleWorkspaces and returns them
+func CleanStaleWorkspaces(opts *WorkspaceOptions) ([]string, error) {
+	if opts == nil {
+		opts = &WorkspaceOptions{}
+	}
+	stale, err := FindStaleWorkspaces(opts)
+	if err != nil {
+		return nil, err
+	}
+	return removeWorkspaces(stale, opts.Shred)
+}
+
+// removeWorkspaces returns the removed directories
+func removeWorkspaces(dirs []string, shred *ShredOptions) ([]string, error) {
+	var removed []string
+	var errs []error
+	for _, dir := range dirs {
+		var err error
+		if shred != nil {
+			_, err = WipeDir(dir, shred)
+		} else {
+			err = os.RemoveAll(dir)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to remove workspace %s, %v", dir, err))
+			continue
+		}
+		removed = append(removed, dir)
+	}
+	return removed, errors.Join(errs...)
+}
+
+// workspaces are the open workspaces cleaned up on signals
+var workspaces struct {
+	sync.Mutex
+	open    map[*Workspace]bool
+	signals chan os.Signal
+}
+
+func registerWorkspace(w *Workspace) {
+	workspaces.Lock()
+	defer workspaces.Unlock()
+	if len(workspaces.open) == 0 {
+		workspaces.open = map[*Workspace]bool{}
+		workspaces.signals = make(chan os.Signal, 1)
+		signal.Notify(workspaces.signals, os.Interrupt, syscall.SIGTERM)
+		go handleWorkspaceSignals(workspaces.signals)
+	}
+	workspaces.open[w] = true
+}
+
+func unregisterWorkspace(w *Workspace) {
+	workspaces.Lock()
+	defer workspaces.Unlock()
+	if !workspaces.open[w] {
+		return
+	}
+	delete(workspaces.open, w)
+	if len(workspaces.open) == 0 {
+		// give the signals back to the default handling
+		signal.Stop(workspaces.signals)
+		close(workspaces.signals)
+	}
+}
+
+// handleWorkspaceSignals closes every open workspace and raises the signal again,
+// which terminates the process unless the application handles it as well
+func handleWorkspaceSignals(signals chan os.Signal) {
+	for sig := range signals {
+		workspaces.Lock()
+		open := make([]*Workspace, 0, len(workspaces.open))
+		for w := range workspaces.open {
+			open = append(open, w)
+		}
+		workspaces.Unlock()
+
+		for _, w := range open {
+			if err := w.Close(); err != nil {
+				logger.Logger.Warnf("%v", err)
+			}
+		}
+		raise(sig)
+	}
+}
+
+func raise(sig os.Signal) {
+	p, err := os.FindProcess(os.Getpid())
+	if err == nil && p.Signal(sig) == nil {
+		return
+	}
+	// signals can't be sent on windows
+	os.Exit(1)
+}
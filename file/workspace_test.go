@@ -0,0 +1,139 @@
+package file
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWorkspace(t *testing.T) {
+	parent := t.TempDir()
+	w, err := NewWorkspace(context.Background(), &WorkspaceOptions{Dir: parent})
+	require.NoError(t, err)
+	defer w.Close()
+
+	info, err := os.Stat(w.Dir())
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(filepath.Base(w.Dir()), "poketto-"))
+	if runtime.GOOS != "windows" {
+		assert.Equal(t, os.FileMode(0o700), info.Mode().Perm())
+	}
+
+	assert.Equal(t, filepath.Join(w.Dir(), "Cookies"), w.Path("Cookies"))
+	assert.Equal(t, filepath.Join(w.Dir(), "Cookies-2"), w.Path("Default/Cookies"))
+	p, err := w.WriteFile("sqlite3.dll", []byte("dll"))
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(w.Dir(), "sqlite3.dll"), p)
+	p, err = w.WriteFile("sqlite3.dll", []byte("dll"))
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(w.Dir(), "sqlite3-2.dll"), p)
+	assert.Equal(t, filepath.Join(w.Dir(), "file"), w.Path(".."))
+	assert.NotEqual(t, filepath.Join(w.Dir(), workspaceMarker), w.Path(workspaceMarker))
+	dir, err := w.Mkdir("export")
+	require.NoError(t, err)
+	assert.DirExists(t, dir)
+
+	require.NoError(t, w.Close())
+	assert.NoDirExists(t, w.Dir())
+	assert.NoError(t, w.Close())
+
+	t.Run("shred", func(t *testing.T) {
+		w, err := NewWorkspace(context.Background(), &WorkspaceOptions{Dir: parent, Shred: &ShredOptions{Warn: func(string, error) {}}})
+		require.NoError(t, err)
+		_, err = w.WriteFile("Login Data", []byte("secret"))
+		require.NoError(t, err)
+		require.NoError(t, w.Close())
+		assert.NoDirExists(t, w.Dir())
+	})
+
+	t.Run("context", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		w, err := NewWorkspace(ctx, &WorkspaceOptions{Dir: parent})
+		require.NoError(t, err)
+		cancel()
+		assert.Eventually(t, func() bool {
+			_, err := os.Stat(w.Dir())
+			return os.IsNotExist(err)
+		}, 5*time.Second, 10*time.Millisecond)
+	})
+}
+
+func TestStaleWorkspaces(t *testing.T) {
+	parent := t.TempDir()
+	opts := &WorkspaceOptions{Dir: parent, IgnoreSignals: true}
+	live, err := NewWorkspace(context.Background(), opts)
+	require.NoError(t, err)
+	defer live.Close()
+
+	crashed := filepath.Join(parent, "poketto-crashed")
+	require.NoError(t, os.Mkdir(crashed, 0o700))
+	// pids are far below this on every platform
+	require.NoError(t, os.WriteFile(filepath.Join(crashed, workspaceMarker), []byte("1073741823"), 0o600))
+	empty := filepath.Join(parent, "poketto-empty")
+	require.NoError(t, os.Mkdir(empty, 0o700))
+	old := time.Now().Add(-time.Hour)
+	require.NoError(t, os.Chtimes(empty, old, old))
+	unrelated := filepath.Join(parent, "poketto-unrelated")
+	require.NoError(t, os.Mkdir(unrelated, 0o700))
+	require.NoError(t, os.WriteFile(filepath.Join(unrelated, "data"), nil, 0o600))
+	require.NoError(t, os.Chtimes(unrelated, old, old))
+
+	stale, err := FindStaleWorkspaces(opts)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{crashed, empty}, stale)
+
+	opts.CleanStale = true
+	w, err := NewWorkspace(context.Background(), opts)
+	require.NoError(t, err)
+	defer w.Close()
+	assert.NoDirExists(t, crashed)
+	assert.NoDirExists(t, empty)
+	assert.DirExists(t, unrelated)
+	assert.DirExists(t, live.Dir())
+}
+
+func TestWorkspaceSignal(t *testing.T) {
+	if parent := os.Getenv("POKETTO_WORKSPACE_HELPER"); parent != "" {
+		w, err := NewWorkspace(context.Background(), &WorkspaceOptions{Dir: parent})
+		if err != nil {
+			os.Exit(2)
+		}
+		fmt.Println(w.Dir())
+		time.Sleep(time.Minute)
+		os.Exit(3)
+	}
+	if runtime.GOOS == "windows" {
+		t.Skip("signals can't be sent on windows")
+	}
+
+	parent := t.TempDir()
+	cmd := exec.Command(os.Args[0], "-test.run=^TestWorkspaceSignal$")
+	cmd.Env = append(os.Environ(), "POKETTO_WORKSPACE_HELPER="+parent)
+	stdout, err := cmd.StdoutPipe()
+	require.NoError(t, err)
+	require.NoError(t, cmd.Start())
+	dir, err := bufio.NewReader(stdout).ReadString('\n')
+	require.NoError(t, err)
+	dir = strings.TrimSpace(dir)
+	assert.DirExists(t, dir)
+	data, err := os.ReadFile(filepath.Join(dir, workspaceMarker))
+	require.NoError(t, err)
+	assert.Equal(t, strconv.Itoa(cmd.Process.Pid), string(data))
+
+	require.NoError(t, cmd.Process.Signal(os.Interrupt))
+	err = cmd.Wait()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "interrupt")
+	assert.NoDirExists(t, dir)
+}
@@ -0,0 +1,23 @@
+//go:build windows
+
+package file
+
+import (
+	"golang.org/x/sys/windows"
+)
+
+// processAlive reports whether a process with the pid is running
+func processAlive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	h, err := windows.OpenProcess(windows.PROCESS_QUERY_LIMITED_INFORMATION, false, uint32(pid))
+	if err != nil {
+		// the process exists when it is only inaccessible
+		return err == windows.ERROR_ACCESS_DENIED
+	}
+	defer windows.CloseHandle(h)
+	var code uint32
+	const stillActive = 259
+	return windows.GetExitCodeProcess(h, &code) == nil && code == stillActive
+}
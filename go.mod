@@ -5,18 +5,18 @@ go 1.21
 toolchain go1.22.1
 
 require (
-	github.com/kbinani/win v0.3.0
-	github.com/otiai10/copy v1.14.0
-	github.com/rodrigocfd/windigo v0.0.0-20230809154420-8faa606d9f5f
+	github.com/bmatcuk/doublestar/v4 v4.6.1
+	github.com/klauspost/compress v1.17.4
 	github.com/stretchr/testify v1.8.4
 	github.com/w-devin/logrus v0.0.0-20241114123150-23ccf7390878
+	golang.org/x/crypto v0.14.0
 	golang.org/x/sys v0.14.0
+	software.sslmate.com/src/go-pkcs12 v0.7.3
 )
 
 require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
 	github.com/sirupsen/logrus v1.9.0 // indirect
-	golang.org/x/sync v0.3.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
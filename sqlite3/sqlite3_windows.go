@@ -2,11 +2,11 @@ package sqlite3
 
 import (
 	"C"
+	"context"
 	"fmt"
 	"github.com/w-devin/poketto/assets"
 	"github.com/w-devin/poketto/file"
 	"log"
-	"os"
 	"sync"
 )
 
@@ -17,25 +17,41 @@ const (
 var (
 	instanceCountLock sync.Mutex
 	instanceCount     = 0
+	// workspace holds the extracted sqlite3.dll for the life of the process, a loaded dll can't be
+	// removed and loading a second copy has no effect, it is cleaned up as stale by the next run
+	workspace *file.Workspace
 )
 
 type SQLiteBase struct {
 	database uintptr
 }
 
+// Init extracts sqlite3.dll into a private workspace once and loads it from there
 func Init() {
-	if !file.IsFileExists(SQLITE3DLL) {
-		sqlite3Dll := assets.GetSqliteDll()
-		sqliteDll, err := sqlite3Dll.ReadFile(SQLITE3DLL)
-		if err != nil {
-			log.Fatalf("failed to got %s, %v", SQLITE3DLL, err)
-		}
+	instanceCountLock.Lock()
+	defer instanceCountLock.Unlock()
+	if workspace != nil {
+		return
+	}
 
-		err = os.WriteFile(SQLITE3DLL, sqliteDll, os.ModePerm)
-		if err != nil {
-			log.Fatalf("failed to put %s done, %v", SQLITE3DLL, err)
-		}
+	sqlite3Dll := assets.GetSqliteDll()
+	sqliteDll, err := sqlite3Dll.ReadFile(SQLITE3DLL)
+	if err != nil {
+		log.Fatalf("failed to got %s, %v", SQLITE3DLL, err)
 	}
+
+	// a loaded dll can't be removed, the workspaces of earlier runs are cleaned up here
+	ws, err := file.NewWorkspace(context.Background(), &file.WorkspaceOptions{Shred: &file.ShredOptions{}, CleanStale: true})
+	if err != nil {
+		log.Fatalf("failed to create workspace for %s, %v", SQLITE3DLL, err)
+	}
+	dllPath, err := ws.WriteFile(SQLITE3DLL, sqliteDll)
+	if err != nil {
+		_ = ws.Close()
+		log.Fatalf("failed to put %s done, %v", SQLITE3DLL, err)
+	}
+	workspace = ws
+	sqlite3.Name = dllPath
 }
 
 func OpenDatabase(baseName, dbKey string) (*SQLiteBase, error) {
@@ -62,13 +78,8 @@ func OpenDatabase(baseName, dbKey string) (*SQLiteBase, error) {
 
 func (db *SQLiteBase) Close() {
 	instanceCountLock.Lock()
+	defer instanceCountLock.Unlock()
 	instanceCount -= 1
-	instanceCountLock.Unlock()
-	if instanceCount <= 0 {
-		if file.IsFileExists(SQLITE3DLL) {
-			_ = os.Remove(SQLITE3DLL)
-		}
-	}
 }
 
 func (db *SQLiteBase) ExecuteQuery(query string) (fields []string, ret []map[string]interface{}, err error) {